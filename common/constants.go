@@ -34,6 +34,9 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// MetricsToken 访问 /metrics 所需的令牌，为空时不开放监控指标
+var MetricsToken = ""
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
@@ -73,6 +76,45 @@ var MemoryCacheEnabled bool
 
 var LogConsumeEnabled = true
 
+// ChannelPerformanceEnabled 是否按真实流量汇总渠道性能数据
+var ChannelPerformanceEnabled = true
+
+// LogArchiveEnabled 是否定期将超过保留天数的日志归档为压缩文件后删除
+var LogArchiveEnabled = false
+var LogArchiveRetentionDays = 30
+
+// StatusProbeEnabled 是否定期对公开模型发起探测请求，生成内置状态页数据
+var StatusProbeEnabled = false
+var StatusProbeIntervalMinutes = 5
+var StatusProbeRetentionDays = 30
+
+// BatchConcurrency 批处理请求在主节点上的最大并发数，所有批处理共享
+var BatchConcurrency = 4
+
+// BatchPriceRatio 批处理请求在分组倍率基础上叠加的折扣倍率，1 表示不打折
+var BatchPriceRatio = 1.0
+
+// FileMaxSizeMB 通过 /v1/files 上传的单个文件大小上限
+var FileMaxSizeMB = 200
+
+// FileTokenScoped 为 true 时文件只对上传时使用的令牌可见，否则对同一用户的所有令牌可见
+var FileTokenScoped = false
+
+// FileUserStorageLimitMB 每个用户的文件存储空间上限，0 表示不限制
+var FileUserStorageLimitMB = 1024
+
+// FileRetentionDays 文件默认保留天数，过期后自动删除，0 表示永久保留
+var FileRetentionDays = 30
+
+// ResponsesStoreEnabled 为 true 时网关保存 /v1/responses 的响应（请求中 store 为 false 时除外）
+var ResponsesStoreEnabled = false
+
+// ResponsesRetentionDays 保存的响应保留天数，0 表示永久保留
+var ResponsesRetentionDays = 30
+
+// ResponsesBackgroundConcurrency 后台响应在主节点上的最大并发数
+var ResponsesBackgroundConcurrency = 8
+
 var SMTPServer = ""
 var SMTPPort = 587
 var SMTPSSLEnabled = false
@@ -163,6 +205,10 @@ var (
 	CriticalRateLimitNum            = 20
 	CriticalRateLimitDuration int64 = 20 * 60
 
+	CountTokenRateLimitEnable   bool
+	CountTokenRateLimitNum            = 60
+	CountTokenRateLimitDuration int64 = 60
+
 	UploadRateLimitNum            = 10
 	UploadRateLimitDuration int64 = 60
 
@@ -190,6 +236,21 @@ const (
 	RedemptionCodeStatusUsed     = 3 // also don't use 0
 )
 
+const (
+	CouponStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	CouponStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	PayloadCaptureRuleStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	PayloadCaptureRuleStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	AlertRuleStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	AlertRuleStatusDisabled = 2 // also don't use 0
+)
+
 const (
 	ChannelStatusUnknown          = 0
 	ChannelStatusEnabled          = 1 // don't use 0, 0 is the default value!
@@ -2,6 +2,7 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"mime"
@@ -101,6 +102,38 @@ func GetContextKeyType[T any](c *gin.Context, key constant.ContextKey) (T, bool)
 	return t, false
 }
 
+type batchRequestKey struct{}
+
+// WithBatchRequest 标记请求由批处理任务在进程内发起，外部请求无法伪造该标记
+func WithBatchRequest(ctx context.Context, batchId string) context.Context {
+	return context.WithValue(ctx, batchRequestKey{}, batchId)
+}
+
+// GetBatchRequestId 返回请求所属的批处理 id，非批处理请求返回空字符串
+func GetBatchRequestId(c *gin.Context) string {
+	if c == nil || c.Request == nil {
+		return ""
+	}
+	batchId, _ := c.Request.Context().Value(batchRequestKey{}).(string)
+	return batchId
+}
+
+type backgroundResponseKey struct{}
+
+// WithBackgroundResponse 标记请求由后台响应任务在进程内发起，外部请求无法伪造该标记
+func WithBackgroundResponse(ctx context.Context, responseId string) context.Context {
+	return context.WithValue(ctx, backgroundResponseKey{}, responseId)
+}
+
+// GetBackgroundResponseId 返回请求所属的后台响应 id，非后台响应请求返回空字符串
+func GetBackgroundResponseId(c *gin.Context) string {
+	if c == nil || c.Request == nil {
+		return ""
+	}
+	responseId, _ := c.Request.Context().Value(backgroundResponseKey{}).(string)
+	return responseId
+}
+
 func ApiError(c *gin.Context, err error) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": false,
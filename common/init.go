@@ -81,6 +81,25 @@ func InitEnv() {
 	DebugEnabled = os.Getenv("DEBUG") == "true"
 	MemoryCacheEnabled = os.Getenv("MEMORY_CACHE_ENABLED") == "true"
 	IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
+	MetricsToken = os.Getenv("METRICS_TOKEN")
+	ChannelPerformanceEnabled = GetEnvOrDefaultBool("CHANNEL_PERFORMANCE_ENABLED", true)
+	LogArchiveEnabled = GetEnvOrDefaultBool("LOG_ARCHIVE_ENABLED", false)
+	LogArchiveRetentionDays = GetEnvOrDefault("LOG_ARCHIVE_RETENTION_DAYS", 30)
+	StatusProbeEnabled = GetEnvOrDefaultBool("STATUS_PROBE_ENABLED", false)
+	StatusProbeIntervalMinutes = GetEnvOrDefault("STATUS_PROBE_INTERVAL_MINUTES", 5)
+	StatusProbeRetentionDays = GetEnvOrDefault("STATUS_PROBE_RETENTION_DAYS", 30)
+	BatchConcurrency = GetEnvOrDefault("BATCH_CONCURRENCY", 4)
+	if ratio, err := strconv.ParseFloat(os.Getenv("BATCH_PRICE_RATIO"), 64); err == nil && ratio >= 0 {
+		BatchPriceRatio = ratio
+	}
+	FileMaxSizeMB = GetEnvOrDefault("FILE_MAX_SIZE_MB", 200)
+	FileTokenScoped = GetEnvOrDefaultBool("FILE_TOKEN_SCOPED", false)
+	FileUserStorageLimitMB = GetEnvOrDefault("FILE_USER_STORAGE_LIMIT_MB", 1024)
+	FileRetentionDays = GetEnvOrDefault("FILE_RETENTION_DAYS", 30)
+	ResponsesStoreEnabled = GetEnvOrDefaultBool("RESPONSES_STORE_ENABLED", false)
+	ResponsesRetentionDays = GetEnvOrDefault("RESPONSES_RETENTION_DAYS", 30)
+	ResponsesBackgroundConcurrency = GetEnvOrDefault("RESPONSES_BACKGROUND_CONCURRENCY", 8)
+	InitLogEnv()
 
 	// Parse requestInterval and set RequestInterval
 	requestInterval, _ = strconv.Atoi(os.Getenv("POLLING_INTERVAL"))
@@ -107,6 +126,10 @@ func InitEnv() {
 	CriticalRateLimitEnable = GetEnvOrDefaultBool("CRITICAL_RATE_LIMIT_ENABLE", true)
 	CriticalRateLimitNum = GetEnvOrDefault("CRITICAL_RATE_LIMIT", 20)
 	CriticalRateLimitDuration = int64(GetEnvOrDefault("CRITICAL_RATE_LIMIT_DURATION", 20*60))
+
+	CountTokenRateLimitEnable = GetEnvOrDefaultBool("COUNT_TOKEN_RATE_LIMIT_ENABLE", true)
+	CountTokenRateLimitNum = GetEnvOrDefault("COUNT_TOKEN_RATE_LIMIT", 60)
+	CountTokenRateLimitDuration = int64(GetEnvOrDefault("COUNT_TOKEN_RATE_LIMIT_DURATION", 60))
 	initConstantEnv()
 }
 
@@ -0,0 +1,227 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LogLevelDebug = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	LogLevelFatal
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+const modulePathPrefix = "github.com/QuantumNous/new-api/"
+
+// LogJSONEnabled 为 true 时日志按行输出 JSON，便于日志系统解析；数据库 logs 表不受影响
+var LogJSONEnabled bool
+
+// 日志输出目标及日志文件轮转配置
+var (
+	LogOutputStdout   = true
+	LogOutputFile     = true
+	LogFileMaxSizeMB  = 0 // 单个日志文件最大体积，0 表示不按体积轮转
+	LogFileMaxBackups = 0 // 保留的历史日志文件数，0 表示全部保留
+)
+
+var defaultLogLevel = LogLevelInfo
+var packageLogLevels map[string]int
+var callerPackageCache sync.Map
+
+// LogFields 每行 JSON 日志携带的请求关联字段
+type LogFields struct {
+	RequestId   string `json:"request_id,omitempty"`
+	UserId      int    `json:"user_id,omitempty"`
+	TokenId     int    `json:"token_id,omitempty"`
+	ChannelId   int    `json:"channel_id,omitempty"`
+	Model       string `json:"model,omitempty"`
+	RelayFormat string `json:"relay_format,omitempty"`
+}
+
+type jsonLogLine struct {
+	Level string `json:"level"`
+	Time  string `json:"time"`
+	LogFields
+	Msg string `json:"msg"`
+}
+
+func InitLogEnv() {
+	LogJSONEnabled = strings.EqualFold(GetEnvOrDefaultString("LOG_FORMAT", "text"), "json")
+	level := "info"
+	if DebugEnabled {
+		level = "debug"
+	}
+	if err := SetLogLevels(GetEnvOrDefaultString("LOG_LEVEL", level), os.Getenv("LOG_PACKAGE_LEVELS")); err != nil {
+		SysError("failed to parse log level: " + err.Error())
+	}
+	outputs := strings.Split(strings.ToLower(GetEnvOrDefaultString("LOG_OUTPUT", "stdout,file")), ",")
+	LogOutputStdout, LogOutputFile = false, false
+	for _, output := range outputs {
+		switch strings.TrimSpace(output) {
+		case "stdout":
+			LogOutputStdout = true
+		case "file":
+			LogOutputFile = true
+		}
+	}
+	if !LogOutputStdout && !LogOutputFile {
+		LogOutputStdout = true
+	}
+	LogFileMaxSizeMB = GetEnvOrDefault("LOG_FILE_MAX_SIZE_MB", 0)
+	LogFileMaxBackups = GetEnvOrDefault("LOG_FILE_MAX_BACKUPS", 0)
+}
+
+func parseLogLevel(level string) (int, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level == "warning" {
+		level = "warn"
+	}
+	for i, name := range logLevelNames {
+		if name == level {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level: %s", level)
+}
+
+// SetLogLevels 设置默认日志级别及按包的日志级别，packageLevels 形如 "relay=debug,model=warn"，
+// 包名为相对模块根目录的路径，按最长前缀匹配
+func SetLogLevels(level string, packageLevels string) error {
+	defaultLevel, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	levels := make(map[string]int)
+	for _, item := range strings.Split(packageLevels, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pkg, lv, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid package log level: %s", item)
+		}
+		parsed, err := parseLogLevel(lv)
+		if err != nil {
+			return err
+		}
+		levels[strings.Trim(strings.TrimSpace(pkg), "/")] = parsed
+	}
+	defaultLogLevel = defaultLevel
+	packageLogLevels = levels
+	return nil
+}
+
+// LogLevelEnabled 判断调用方所在包是否输出该级别日志，skip 为 0 表示直接调用方
+func LogLevelEnabled(level int, skip int) bool {
+	threshold := defaultLogLevel
+	if len(packageLogLevels) > 0 {
+		threshold = packageLogLevel(callerPackage(skip+2), threshold)
+	}
+	return level >= threshold
+}
+
+func packageLogLevel(pkg string, fallback int) int {
+	matched := -1
+	level := fallback
+	for prefix, lv := range packageLogLevels {
+		if (pkg == prefix || strings.HasPrefix(pkg, prefix+"/")) && len(prefix) > matched {
+			matched = len(prefix)
+			level = lv
+		}
+	}
+	return level
+}
+
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	if pkg, ok := callerPackageCache.Load(pc); ok {
+		return pkg.(string)
+	}
+	pkg := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name := fn.Name()
+		lastSlash := strings.LastIndex(name, "/")
+		if dot := strings.Index(name[lastSlash+1:], "."); dot >= 0 {
+			name = name[:lastSlash+1+dot]
+		}
+		pkg = strings.TrimSuffix(strings.TrimPrefix(name, modulePathPrefix), "_test")
+	}
+	callerPackageCache.Store(pc, pkg)
+	return pkg
+}
+
+// ContextLogFields 从请求上下文中提取日志关联字段
+func ContextLogFields(ctx context.Context) LogFields {
+	if c, ok := ctx.(*gin.Context); ok {
+		return logFieldsFromGetter(c.Get)
+	}
+	fields := LogFields{}
+	if id, ok := ctx.Value(RequestIdKey).(string); ok {
+		fields.RequestId = id
+	}
+	return fields
+}
+
+// LogFieldsFromKeys 从 gin 上下文的 Keys 中提取日志关联字段，用于请求结束后的访问日志
+func LogFieldsFromKeys(keys map[string]any) LogFields {
+	return logFieldsFromGetter(func(key string) (any, bool) {
+		value, ok := keys[key]
+		return value, ok
+	})
+}
+
+func logFieldsFromGetter(get func(key string) (any, bool)) LogFields {
+	fields := LogFields{}
+	if v, ok := get(RequestIdKey); ok {
+		fields.RequestId, _ = v.(string)
+	}
+	if v, ok := get(string(constant.ContextKeyUserId)); ok {
+		fields.UserId, _ = v.(int)
+	}
+	if v, ok := get(string(constant.ContextKeyTokenId)); ok {
+		fields.TokenId, _ = v.(int)
+	}
+	if v, ok := get(string(constant.ContextKeyChannelId)); ok {
+		fields.ChannelId, _ = v.(int)
+	}
+	if v, ok := get(string(constant.ContextKeyOriginalModel)); ok {
+		fields.Model, _ = v.(string)
+	}
+	if v, ok := get(string(constant.ContextKeyRelayFormat)); ok {
+		fields.RelayFormat, _ = v.(string)
+	}
+	return fields
+}
+
+// WriteJSONLog 向 writer 写入一行 JSON 日志
+func WriteJSONLog(writer io.Writer, level int, fields LogFields, msg string) {
+	line := jsonLogLine{
+		Level:     logLevelNames[level],
+		Time:      time.Now().Format(time.RFC3339Nano),
+		LogFields: fields,
+		Msg:       strings.TrimSpace(msg),
+	}
+	data, err := Marshal(line)
+	if err != nil {
+		return
+	}
+	_, _ = writer.Write(append(data, '\n'))
+}
@@ -9,16 +9,34 @@ import (
 )
 
 func SysLog(s string) {
+	if !LogLevelEnabled(LogLevelInfo, 1) {
+		return
+	}
+	if LogJSONEnabled {
+		WriteJSONLog(gin.DefaultWriter, LogLevelInfo, LogFields{}, s)
+		return
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
 }
 
 func SysError(s string) {
+	if !LogLevelEnabled(LogLevelError, 1) {
+		return
+	}
+	if LogJSONEnabled {
+		WriteJSONLog(gin.DefaultErrorWriter, LogLevelError, LogFields{}, s)
+		return
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
 }
 
 func FatalLog(v ...any) {
+	if LogJSONEnabled {
+		WriteJSONLog(gin.DefaultErrorWriter, LogLevelFatal, LogFields{}, fmt.Sprint(v...))
+		os.Exit(1)
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
 	os.Exit(1)
@@ -32,6 +50,11 @@ func LogStartupSuccess(startTime time.Time, port string) {
 	// Get network IPs
 	networkIps := GetNetworkIps()
 
+	if LogJSONEnabled {
+		SysLog(fmt.Sprintf("%s %s ready in %d ms, port: %s", SystemName, Version, durationMs, port))
+		return
+	}
+
 	// Print blank line for spacing
 	fmt.Fprintf(gin.DefaultWriter, "\n")
 
@@ -8,6 +8,9 @@ const (
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
+	ContextKeyRelayFormat      ContextKey = "relay_format"
+	// ContextKeyRelayAttemptStartTime 当前渠道尝试（含重试）的开始时间
+	ContextKeyRelayAttemptStartTime ContextKey = "relay_attempt_start_time"
 
 	/* token related keys */
 	ContextKeyTokenUnlimited         ContextKey = "token_unlimited_quota"
@@ -17,6 +20,7 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenPrepaid           ContextKey = "token_prepaid"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -51,4 +55,9 @@ const (
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
+
+	ContextKeyPayloadCapture ContextKey = "payload_capture"
+
+	// ContextKeyPreviousResponseId 已在本站展开的 previous_response_id
+	ContextKeyPreviousResponseId ContextKey = "previous_response_id"
 )
@@ -3,8 +3,9 @@ package constant
 type TaskPlatform string
 
 const (
-	TaskPlatformSuno       TaskPlatform = "suno"
-	TaskPlatformMidjourney              = "mj"
+	TaskPlatformSuno        TaskPlatform = "suno"
+	TaskPlatformMidjourney               = "mj"
+	TaskPlatformClaudeBatch TaskPlatform = "claude_batch"
 )
 
 const (
@@ -15,6 +16,7 @@ const (
 	TaskActionTextGenerate      = "textGenerate"
 	TaskActionFirstTailGenerate = "firstTailGenerate"
 	TaskActionReferenceGenerate = "referenceGenerate"
+	TaskActionMessageBatch      = "messageBatch"
 )
 
 var SunoModel2Action = map[string]string{
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllAlertRules(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	rules, total, err := model.GetAllAlertRules(pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(rules)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AddAlertRule(c *gin.Context) {
+	rule := model.AlertRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rule.Id = 0
+	if err := rule.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &rule)
+}
+
+func UpdateAlertRule(c *gin.Context) {
+	rule := model.AlertRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetAlertRuleById(rule.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := rule.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &rule)
+}
+
+func DeleteAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteAlertRuleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetAlertEvents 告警事件列表，可按 rule_id 及 status（firing / resolved）筛选
+func GetAlertEvents(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	ruleId, _ := strconv.Atoi(c.Query("rule_id"))
+	events, total, err := model.GetAlertEvents(ruleId, c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(events)
+	common.ApiSuccess(c, pageInfo)
+}
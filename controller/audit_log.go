@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditLogExportBatchSize = 1000
+
+func parseAuditLogQuery(c *gin.Context) *model.AuditLogQuery {
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return &model.AuditLogQuery{
+		ActorId:    actorId,
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetId:   c.Query("target_id"),
+		StartTime:  startTimestamp,
+		EndTime:    endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	logs, total, err := model.GetAuditLogs(parseAuditLogQuery(c), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ExportAuditLogs 按查询条件导出审计日志，format 为 csv（默认）或 jsonl
+func ExportAuditLogs(c *gin.Context) {
+	query := parseAuditLogQuery(c)
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		common.ApiErrorMsg(c, "不支持的导出格式")
+		return
+	}
+	filename := fmt.Sprintf("audit-logs-%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	if format == "jsonl" {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if format == "csv" {
+		_ = writer.Write([]string{"id", "created_at", "actor_id", "actor_name", "actor_role", "ip", "action", "target_type", "target_id", "diff"})
+	}
+	err := model.IterateAuditLogs(query, auditLogExportBatchSize, func(logs []*model.AuditLog) error {
+		for _, log := range logs {
+			if format == "jsonl" {
+				line, err := common.Marshal(log)
+				if err != nil {
+					return err
+				}
+				if _, err = c.Writer.Write(append(line, '\n')); err != nil {
+					return err
+				}
+				continue
+			}
+			err := writer.Write([]string{
+				strconv.Itoa(log.Id),
+				time.Unix(log.CreatedAt, 0).Format(time.RFC3339),
+				strconv.Itoa(log.ActorId),
+				log.ActorName,
+				strconv.Itoa(log.ActorRole),
+				log.Ip,
+				log.Action,
+				log.TargetType,
+				log.TargetId,
+				log.Diff,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		// 响应头已经发出，只能记录错误
+		common.SysError("failed to export audit logs: " + err.Error())
+	}
+}
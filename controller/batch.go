@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// getRequestBatch 返回当前用户的批处理，不存在时直接返回 404
+func getRequestBatch(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatch(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		}
+		return nil
+	}
+	return batch
+}
+
+func CreateBatch(c *gin.Context) {
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenPrepaid) {
+		openAIErrorResponse(c, http.StatusForbidden, "invalid_token", service.ErrPrepaidTokenUnsupported.Error())
+		return
+	}
+	var request dto.OpenAIBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !service.IsBatchEndpoint(request.Endpoint) {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("Invalid value for 'endpoint': %s", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != service.BatchCompletionWindow {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_completion_window",
+			fmt.Sprintf("Invalid value for 'completion_window': %s, only %s is supported", request.CompletionWindow, service.BatchCompletionWindow))
+		return
+	}
+	userId, tokenId := service.GetRequestFileScope(c)
+	inputFile, err := model.GetUserFile(userId, tokenId, request.InputFileId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		return
+	}
+	if inputFile.Purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", "The input file must be uploaded with purpose 'batch'.")
+		return
+	}
+	batch, err := service.CreateBatch(c.Request.Context(), c.GetInt("id"), c.GetInt("token_id"),
+		common.GetContextKeyString(c, constant.ContextKeyUsingGroup), inputFile, &request)
+	if err != nil {
+		if errors.Is(err, service.ErrBatchInsufficientQuota) {
+			openAIErrorResponse(c, http.StatusForbidden, "insufficient_quota", err.Error())
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		}
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAI(batch))
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch := getRequestBatch(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAI(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch := getRequestBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.Status != model.BatchStatusCancelling && batch.Status != model.BatchStatusCancelled {
+		ok, err := service.CancelBatch(batch)
+		if err != nil {
+			openAIErrorResponse(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+			return
+		}
+		if !ok {
+			openAIErrorResponse(c, http.StatusConflict, "batch_not_cancellable",
+				fmt.Sprintf("Cannot cancel a batch with status '%s'.", batch.Status))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAI(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	after, limit := openAIListQuery(c, 20, 100)
+	batches, err := model.GetUserBatches(c.GetInt("id"), after, limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "list_batches_failed", err.Error())
+		return
+	}
+	list := &dto.OpenAIBatchList{Object: "list", Data: make([]*dto.OpenAIBatch, 0, len(batches))}
+	if len(batches) > limit {
+		batches = batches[:limit]
+		list.HasMore = true
+	}
+	for _, batch := range batches {
+		list.Data = append(list.Data, service.BatchToOpenAI(batch))
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = &list.Data[0].Id
+		list.LastId = &list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
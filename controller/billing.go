@@ -14,7 +14,8 @@ func GetSubscription(c *gin.Context) {
 	var err error
 	var token *model.Token
 	var expiredTime int64
-	if common.DisplayTokenStatEnabled {
+	// 兑换码发放的令牌额度独立于用户额度，始终展示令牌额度
+	if common.DisplayTokenStatEnabled || c.GetBool("token_prepaid") {
 		tokenId := c.GetInt("token_id")
 		token, err = model.GetTokenById(tokenId)
 		expiredTime = token.ExpiredTime
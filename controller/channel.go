@@ -427,6 +427,7 @@ func GetChannelKey(c *gin.Context) {
 
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("查看渠道密钥信息 (渠道ID: %d)", channelId))
+	model.RecordAuditLog(c, model.AuditActionChannelKeyView, model.AuditTargetChannel, channelId, nil, nil)
 
 	// 返回渠道密钥
 	c.JSON(http.StatusOK, gin.H{
@@ -626,6 +627,9 @@ func AddChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	for i := range channels {
+		model.RecordAuditLog(c, model.AuditActionChannelCreate, model.AuditTargetChannel, channels[i].Id, nil, &channels[i])
+	}
 	service.ResetProxyClientCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -636,12 +640,16 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	originChannel, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if originChannel != nil {
+		model.RecordAuditLog(c, model.AuditActionChannelDelete, model.AuditTargetChannel, id, originChannel, nil)
+	}
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -656,6 +664,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordAuditLog(c, model.AuditActionChannelDeleteDisabled, model.AuditTargetChannel, "", nil, map[string]any{"deleted": rows})
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -795,6 +804,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordAuditLog(c, model.AuditActionChannelDeleteBatch, model.AuditTargetChannel, "", nil, map[string]any{"ids": channelBatch.Ids})
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -911,6 +921,9 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatedChannel, err := model.GetChannelById(channel.Id, true); err == nil {
+		model.RecordAuditLog(c, model.AuditActionChannelUpdate, model.AuditTargetChannel, channel.Id, originChannel, updatedChannel)
+	}
 	model.InitChannelCache()
 	service.ResetProxyClientCache()
 	channel.Key = ""
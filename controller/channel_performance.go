@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelPerformance 渠道性能统计，granularity=hour 时按小时返回时间序列，否则按渠道、模型汇总整个时间范围
+func GetChannelPerformance(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	modelName := c.Query("model_name")
+	byBucket := c.Query("granularity") == "hour"
+	stats, err := model.GetChannelPerformanceStats(startTimestamp, endTimestamp, channelId, modelName, byBucket)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stats)
+}
+
+// RankChannelPerformance 按模型对渠道性能排名，默认统计最近 24 小时、请求数不少于 10 的渠道
+func RankChannelPerformance(c *gin.Context) {
+	modelName := c.Query("model_name")
+	if modelName == "" {
+		common.ApiError(c, errors.New("模型名称不能为空"))
+		return
+	}
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if endTimestamp == 0 {
+		endTimestamp = common.GetTimestamp()
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 24*3600
+	}
+	minRequests := 10
+	if v, err := strconv.Atoi(c.Query("min_requests")); err == nil && v >= 0 {
+		minRequests = v
+	}
+	stats, err := model.RankChannelPerformance(startTimestamp, endTimestamp, modelName, minRequests)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stats)
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func claudeErrorResponse(c *gin.Context, apiErr *types.NewAPIError) {
+	c.JSON(apiErr.StatusCode, gin.H{
+		"type":  "error",
+		"error": apiErr.ToClaudeError(),
+	})
+}
+
+// getRequestMessageBatch 返回当前用户的消息批处理任务，不存在时直接返回 404
+func getRequestMessageBatch(c *gin.Context, batchId string) *model.Task {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), batchId)
+	if err != nil {
+		claudeErrorResponse(c, types.NewError(err, types.ErrorCodeQueryDataError))
+		return nil
+	}
+	if !exist || task.Platform != constant.TaskPlatformClaudeBatch {
+		claudeErrorResponse(c, types.NewErrorWithStatusCode(fmt.Errorf("消息批处理 %s 不存在", batchId), types.ErrorCodeInvalidRequest, http.StatusNotFound))
+		return nil
+	}
+	return task
+}
+
+func CreateMessageBatch(c *gin.Context) {
+	task, apiErr := relay.RelayClaudeBatchSubmit(c)
+	if apiErr != nil {
+		logger.LogError(c, fmt.Sprintf("create message batch failed: %s", apiErr.Error()))
+		claudeErrorResponse(c, apiErr)
+		return
+	}
+	data, err := relay.GetClaudeBatchTaskData(task)
+	if err != nil {
+		claudeErrorResponse(c, types.NewError(err, types.ErrorCodeQueryDataError))
+		return
+	}
+	c.JSON(http.StatusOK, relay.ClaudeBatchResponse(data.Batch))
+}
+
+// RetrieveMessageBatch 未结束的批处理实时查询上游，已结束的直接返回任务中保存的批处理对象
+func RetrieveMessageBatch(c *gin.Context) {
+	task := getRequestMessageBatch(c, c.Param("id"))
+	if task == nil {
+		return
+	}
+	data, err := relay.GetClaudeBatchTaskData(task)
+	if err != nil {
+		claudeErrorResponse(c, types.NewError(err, types.ErrorCodeQueryDataError))
+		return
+	}
+	batch := data.Batch
+	if task.Status != model.TaskStatusSuccess && task.Status != model.TaskStatusFailure {
+		var apiErr *types.NewAPIError
+		batch, apiErr = relay.FetchClaudeBatch(c.Request.Context(), task, c.Request.Header)
+		if apiErr != nil {
+			claudeErrorResponse(c, apiErr)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, relay.ClaudeBatchResponse(batch))
+}
+
+func CancelMessageBatch(c *gin.Context) {
+	task := getRequestMessageBatch(c, c.Param("id"))
+	if task == nil {
+		return
+	}
+	batch, apiErr := relay.CancelClaudeBatch(c.Request.Context(), task, c.Request.Header)
+	if apiErr != nil {
+		claudeErrorResponse(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, relay.ClaudeBatchResponse(batch))
+}
+
+// ListMessageBatches 列出任务中保存的批处理对象，状态由后台任务轮询更新
+func ListMessageBatches(c *gin.Context) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	var beforeId, afterId int64
+	if cursor := c.Query("before_id"); cursor != "" {
+		task := getRequestMessageBatch(c, cursor)
+		if task == nil {
+			return
+		}
+		beforeId = task.ID
+	}
+	if cursor := c.Query("after_id"); cursor != "" {
+		task := getRequestMessageBatch(c, cursor)
+		if task == nil {
+			return
+		}
+		afterId = task.ID
+	}
+	tasks, err := model.GetUserPlatformTasks(c.GetInt("id"), constant.TaskPlatformClaudeBatch, beforeId, afterId, limit+1)
+	if err != nil {
+		claudeErrorResponse(c, types.NewError(err, types.ErrorCodeQueryDataError))
+		return
+	}
+	list := &dto.ClaudeMessageBatchList{Data: make([]*dto.ClaudeMessageBatch, 0, len(tasks))}
+	if len(tasks) > limit {
+		list.HasMore = true
+		if beforeId > 0 {
+			tasks = tasks[1:]
+		} else {
+			tasks = tasks[:limit]
+		}
+	}
+	for _, task := range tasks {
+		data, err := relay.GetClaudeBatchTaskData(task)
+		if err != nil {
+			continue
+		}
+		list.Data = append(list.Data, relay.ClaudeBatchResponse(data.Batch))
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = &list.Data[0].Id
+		list.LastId = &list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetMessageBatchResults 转发上游的结果 JSONL
+func GetMessageBatchResults(c *gin.Context) {
+	task := getRequestMessageBatch(c, c.Param("id"))
+	if task == nil {
+		return
+	}
+	resp, apiErr := relay.OpenClaudeBatchResults(c.Request.Context(), task, c.Request.Header)
+	if apiErr != nil {
+		claudeErrorResponse(c, apiErr)
+		return
+	}
+	defer resp.Body.Close()
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/binary"
+	}
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, resp.Body)
+}
+
+func UpdateClaudeBatchTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) {
+	for channelId, taskIds := range taskChannelM {
+		logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的消息批处理有: %d", channelId, len(taskIds)))
+		for _, taskId := range taskIds {
+			if err := updateClaudeBatchTask(ctx, taskM[taskId]); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("更新消息批处理 %s 失败: %s", taskId, err.Error()))
+			}
+		}
+	}
+}
+
+func updateClaudeBatchTask(ctx context.Context, task *model.Task) error {
+	if task == nil {
+		return errors.New("task not found")
+	}
+	batch, apiErr := relay.FetchClaudeBatch(ctx, task, nil)
+	if apiErr != nil {
+		if apiErr.StatusCode == http.StatusNotFound {
+			return relay.FailClaudeBatch(task, apiErr.Error())
+		}
+		return apiErr
+	}
+	return relay.UpdateClaudeBatchTask(ctx, task, batch)
+}
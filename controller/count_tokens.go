@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayCountTokens 处理免费的 token 计数请求，失败时按请求格式返回错误
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(relayFormat))
+	apiErr := relay.RelayCountTokens(c, relayFormat)
+	if apiErr == nil {
+		return
+	}
+	logger.LogError(c, fmt.Sprintf("count tokens error: %s", apiErr.Error()))
+	apiErr.SetMessage(common.MessageWithRequestId(apiErr.Error(), c.GetString(common.RequestIdKey)))
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		claudeErrorResponse(c, apiErr)
+		return
+	case types.RelayFormatGemini:
+		helper.GeminiError(c, apiErr.ToGeminiError())
+		return
+	}
+	c.JSON(apiErr.StatusCode, gin.H{
+		"error": apiErr.ToOpenAIError(),
+	})
+}
+
+// RelayGeminiModels 分发 Gemini 的 models/{model}:{action} 请求，countTokens 单独处理
+func RelayGeminiModels(c *gin.Context) {
+	if strings.HasSuffix(c.Request.URL.Path, ":countTokens") {
+		RelayCountTokens(c, types.RelayFormatGemini)
+		return
+	}
+	Relay(c, types.RelayFormatGemini)
+}
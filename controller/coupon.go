@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllCoupons(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	coupons, total, err := model.GetAllCoupons(pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(coupons)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon, err := model.GetCouponById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func AddCoupon(c *gin.Context) {
+	coupon := model.Coupon{}
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if strings.TrimSpace(coupon.Code) == "" {
+		coupon.Code = strings.ToUpper(common.GetRandomString(8))
+	}
+	if err := coupon.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon.Id = 0
+	coupon.UsedCount = 0
+	if err := coupon.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &coupon)
+}
+
+func UpdateCoupon(c *gin.Context) {
+	coupon := model.Coupon{}
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetCouponById(coupon.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := coupon.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := coupon.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &coupon)
+}
+
+func DeleteCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteCouponById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// prepareTopUpCoupon 创建充值订单时校验优惠码，返回需记录到订单上的优惠码和赠送额度
+// baseQuota 为本次充值到账的额度，未填写优惠码时直接返回
+func prepareTopUpCoupon(code string, userId int, group string, baseQuota int) (string, int, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "", 0, nil
+	}
+	coupon, bonus, err := model.CheckCoupon(code, userId, group, baseQuota)
+	if err != nil {
+		return "", 0, err
+	}
+	return coupon.Code, bonus, nil
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// filePurposes /v1/files 接受的文件用途
+var filePurposes = map[string]bool{
+	"assistants": true,
+	"batch":      true,
+	"fine-tune":  true,
+	"vision":     true,
+	"user_data":  true,
+	"evals":      true,
+}
+
+func openAIErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+// openAIListQuery 解析列表接口的 after 及 limit 参数
+func openAIListQuery(c *gin.Context, defaultLimit int, maxLimit int) (string, int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return c.Query("after"), limit
+}
+
+// getRequestFile 返回当前用户的文件，不存在时直接返回 404
+func getRequestFile(c *gin.Context) *model.File {
+	userId, tokenId := service.GetRequestFileScope(c)
+	file, err := model.GetUserFile(userId, tokenId, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_file_failed", err.Error())
+		}
+		return nil
+	}
+	return file
+}
+
+// parseFileExpiresAfter 解析 expires_after[anchor] 及 expires_after[seconds]，未指定时返回 0
+func parseFileExpiresAfter(c *gin.Context) (int64, error) {
+	anchor, seconds := c.PostForm("expires_after[anchor]"), c.PostForm("expires_after[seconds]")
+	if anchor == "" && seconds == "" {
+		return 0, nil
+	}
+	if anchor != "created_at" {
+		return 0, fmt.Errorf("Invalid value for 'expires_after[anchor]': %s", anchor)
+	}
+	value, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || value < 3600 || value > 30*86400 {
+		return 0, errors.New("'expires_after[seconds]' must be between 3600 and 2592000")
+	}
+	return value, nil
+}
+
+func UploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	if !filePurposes[purpose] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid value for 'purpose': %s", purpose))
+		return
+	}
+	expiresAfter, err := parseFileExpiresAfter(c)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_expires_after", err.Error())
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "missing_file", "Missing required parameter: 'file'.")
+		return
+	}
+	if header.Size > int64(common.FileMaxSizeMB)<<20 {
+		openAIErrorResponse(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("File size exceeds the limit of %d MB.", common.FileMaxSizeMB))
+		return
+	}
+	if err = service.CheckFileStorageQuota(c.GetInt("id"), header.Size); err != nil {
+		if errors.Is(err, service.ErrFileStorageQuotaExceeded) {
+			openAIErrorResponse(c, http.StatusForbidden, "storage_quota_exceeded",
+				fmt.Sprintf("File storage limit of %d MB exceeded, please delete unused files.", common.FileUserStorageLimitMB))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "check_storage_quota_failed", err.Error())
+		}
+		return
+	}
+	reader, err := header.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer reader.Close()
+	file, err := service.SaveFile(c.Request.Context(), c.GetInt("id"), c.GetInt("token_id"), purpose, header.Filename, reader, header.Size, expiresAfter)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "save_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAI(file))
+}
+
+func ListFiles(c *gin.Context) {
+	after, limit := openAIListQuery(c, 100, 1000)
+	userId, tokenId := service.GetRequestFileScope(c)
+	files, err := model.GetUserFiles(userId, tokenId, c.Query("purpose"), after, limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "list_files_failed", err.Error())
+		return
+	}
+	list := &dto.OpenAIFileList{Object: "list", Data: make([]*dto.OpenAIFile, 0, len(files))}
+	if len(files) > limit {
+		files = files[:limit]
+		list.HasMore = true
+	}
+	for _, file := range files {
+		list.Data = append(list.Data, service.FileToOpenAI(file))
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = &list.Data[0].Id
+		list.LastId = &list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getRequestFile(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAI(file))
+}
+
+func GetFileContent(c *gin.Context) {
+	file := getRequestFile(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.OpenFile(c.Request.Context(), file)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "read_file_failed", err.Error())
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getRequestFile(c)
+	if file == nil {
+		return
+	}
+	if used, err := model.IsFileUsedByUnfinishedBatch(file.FileId); err != nil || used {
+		openAIErrorResponse(c, http.StatusConflict, "file_in_use", "The file is used by an unfinished batch.")
+		return
+	}
+	if err := service.DeleteFile(c.Request.Context(), file); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, &dto.OpenAIFileDeleted{Id: file.FileId, Object: "file", Deleted: true})
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLogArchives 归档文件列表，可按日期（2006-01-02）筛选
+func GetLogArchives(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	archives, total, err := model.GetLogArchives(c.Query("day"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(archives)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ArchiveLogs 立即归档 target_timestamp 所在日之前的日志，归档校验通过后删除
+func ArchiveLogs(c *gin.Context) {
+	targetTimestamp, _ := strconv.ParseInt(c.Query("target_timestamp"), 10, 64)
+	if targetTimestamp == 0 {
+		common.ApiError(c, errors.New("target timestamp is required"))
+		return
+	}
+	archives, err := service.ArchiveLogs(c.Request.Context(), targetTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, archives)
+}
+
+// ImportLogArchive 将归档重新导入 restored_logs 表，重复导入会覆盖上次导入的数据
+func ImportLogArchive(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	count, err := service.ImportLogArchive(c.Request.Context(), id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
+
+func GetRestoredLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	logs, total, err := model.GetRestoredLogs(id, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func DeleteRestoredLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.DeleteRestoredLogs(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
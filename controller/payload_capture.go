@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllPayloadCaptureRules(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	rules, total, err := model.GetAllPayloadCaptureRules(pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(rules)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AddPayloadCaptureRule(c *gin.Context) {
+	rule := model.PayloadCaptureRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rule.Id = 0
+	rule.CapturedCount = 0
+	if err := rule.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &rule)
+}
+
+func UpdatePayloadCaptureRule(c *gin.Context) {
+	rule := model.PayloadCaptureRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetPayloadCaptureRuleById(rule.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := rule.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &rule)
+}
+
+func DeletePayloadCaptureRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeletePayloadCaptureRuleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetPayloadCaptures 采集记录列表，可按规则或用户筛选，不返回内容
+func GetPayloadCaptures(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	ruleId, _ := strconv.Atoi(c.Query("rule_id"))
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	captures, total, err := model.GetPayloadCaptures(ruleId, userId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(captures)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetPayloadCapture 按请求 id 获取采集内容，日志详情中的 payload_capture_request_id 即为该 id
+func GetPayloadCapture(c *gin.Context) {
+	requestId := c.Param("request_id")
+	captures, err := model.GetPayloadCapturesByRequestId(requestId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(captures) == 0 {
+		common.ApiError(c, errors.New("采集记录不存在或已过期"))
+		return
+	}
+	common.ApiSuccess(c, captures)
+}
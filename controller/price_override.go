@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkManageUserPermission 校验当前管理员是否有权管理目标用户
+func checkManageUserPermission(c *gin.Context, userId int) bool {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return false
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权管理同权限等级或更高权限等级的用户",
+		})
+		return false
+	}
+	return true
+}
+
+// GetUserPriceOverrides 获取用户的自定义价格规则（包含令牌级规则）
+func GetUserPriceOverrides(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !checkManageUserPermission(c, userId) {
+		return
+	}
+	overrides, err := model.GetPriceOverridesByUserId(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, overrides)
+}
+
+// UpdateUserPriceOverrides 覆盖保存用户的自定义价格规则
+func UpdateUserPriceOverrides(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !checkManageUserPermission(c, userId) {
+		return
+	}
+	var overrides []*model.PriceOverride
+	if err := c.ShouldBindJSON(&overrides); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	for _, o := range overrides {
+		if o.TokenId == 0 {
+			continue
+		}
+		if _, err := model.GetTokenByIds(o.TokenId, userId); err != nil {
+			common.ApiErrorMsg(c, fmt.Sprintf("令牌 %d 不属于该用户", o.TokenId))
+			return
+		}
+	}
+	if err := model.ReplaceUserPriceOverrides(userId, overrides); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, fmt.Sprintf("管理员更新了用户的自定义价格规则，共 %d 条", len(overrides)))
+	common.ApiSuccess(c, overrides)
+}
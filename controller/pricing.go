@@ -17,7 +17,12 @@ func GetPricing(c *gin.Context) {
 		groupRatio[s] = f
 	}
 	var group string
+	priceOverrides := make([]*model.PriceOverride, 0)
 	if exists {
+		overrides, err := model.GetPriceOverridesByUserId(userId.(int))
+		if err == nil {
+			priceOverrides = overrides
+		}
 		user, err := model.GetUserCache(userId.(int))
 		if err == nil {
 			group = user.Group
@@ -46,6 +51,7 @@ func GetPricing(c *gin.Context) {
 		"usable_group":       usableGroup,
 		"supported_endpoint": model.GetSupportedEndpointMap(),
 		"auto_groups":        service.GetUserAutoGroup(group),
+		"price_overrides":    priceOverrides,
 	})
 }
 
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getQuotaLedgers 查询用户账本，指定 token_id 时查询该令牌的账本
+func getQuotaLedgers(c *gin.Context, userId int) {
+	accountType := model.LedgerAccountUser
+	accountId := userId
+	if tokenIdStr := c.Query("token_id"); tokenIdStr != "" {
+		tokenId, err := strconv.Atoi(tokenIdStr)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if err = model.CheckTokenLedgerOwner(tokenId, userId); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		accountType = model.LedgerAccountToken
+		accountId = tokenId
+	}
+	pageInfo := common.GetPageQuery(c)
+	ledgers, total, err := model.GetQuotaLedgers(accountType, accountId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(ledgers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfQuotaLedgers(c *gin.Context) {
+	getQuotaLedgers(c, c.GetInt("id"))
+}
+
+func GetUserQuotaLedgers(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !checkManageUserPermission(c, userId) {
+		return
+	}
+	getQuotaLedgers(c, userId)
+}
+
+// CheckQuotaLedger 检查账本合计与用户、令牌余额是否一致
+func CheckQuotaLedger(c *gin.Context) {
+	result, err := model.CheckQuotaLedgerConsistency()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
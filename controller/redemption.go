@@ -8,6 +8,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -90,16 +91,25 @@ func AddRedemption(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 		return
 	}
+	if err := validateRedemptionReward(&redemption); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 	var keys []string
 	for i := 0; i < redemption.Count; i++ {
 		key := common.GetUUID()
 		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt("id"),
-			Name:        redemption.Name,
-			Key:         key,
-			CreatedTime: common.GetTimestamp(),
-			Quota:       redemption.Quota,
-			ExpiredTime: redemption.ExpiredTime,
+			UserId:         c.GetInt("id"),
+			Name:           redemption.Name,
+			Key:            key,
+			CreatedTime:    common.GetTimestamp(),
+			Quota:          redemption.Quota,
+			ExpiredTime:    redemption.ExpiredTime,
+			RewardType:     redemption.RewardType,
+			RewardGroup:    redemption.RewardGroup,
+			RewardDuration: redemption.RewardDuration,
+			MaxUses:        redemption.MaxUses,
+			PerUserLimit:   redemption.PerUserLimit,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -110,6 +120,7 @@ func AddRedemption(c *gin.Context) {
 			})
 			return
 		}
+		model.RecordAuditLog(c, model.AuditActionRedemptionCreate, model.AuditTargetRedemption, cleanRedemption.Id, nil, &cleanRedemption)
 		keys = append(keys, key)
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -127,6 +138,7 @@ func DeleteRedemption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordAuditLog(c, model.AuditActionRedemptionDelete, model.AuditTargetRedemption, id, nil, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -147,15 +159,25 @@ func UpdateRedemption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	originRedemption := *cleanRedemption
 	if statusOnly == "" {
 		if err := validateExpiredTime(redemption.ExpiredTime); err != nil {
 			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 			return
 		}
+		if err := validateRedemptionReward(&redemption); err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+			return
+		}
 		// If you add more fields, please also update redemption.Update()
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
 		cleanRedemption.ExpiredTime = redemption.ExpiredTime
+		cleanRedemption.RewardType = redemption.RewardType
+		cleanRedemption.RewardGroup = redemption.RewardGroup
+		cleanRedemption.RewardDuration = redemption.RewardDuration
+		cleanRedemption.MaxUses = redemption.MaxUses
+		cleanRedemption.PerUserLimit = redemption.PerUserLimit
 	}
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
@@ -165,6 +187,7 @@ func UpdateRedemption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordAuditLog(c, model.AuditActionRedemptionUpdate, model.AuditTargetRedemption, cleanRedemption.Id, &originRedemption, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -187,6 +210,56 @@ func DeleteInvalidRedemption(c *gin.Context) {
 	return
 }
 
+// GetRedemptionRecords 获取兑换码的兑换记录
+func GetRedemptionRecords(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	records, total, err := model.GetRedemptionRecords(id, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(records)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func validateRedemptionReward(redemption *model.Redemption) error {
+	if redemption.RewardType == "" {
+		redemption.RewardType = model.RedemptionRewardQuota
+	}
+	switch redemption.RewardType {
+	case model.RedemptionRewardQuota:
+	case model.RedemptionRewardToken:
+		if redemption.Quota <= 0 {
+			return errors.New("令牌额度必须大于0")
+		}
+	case model.RedemptionRewardGroup:
+		if !ratio_setting.ContainsGroupRatio(redemption.RewardGroup) {
+			return errors.New("兑换分组不存在")
+		}
+	default:
+		return errors.New("不支持的兑换奖励类型")
+	}
+	if redemption.RewardDuration < 0 {
+		return errors.New("有效时长不能为负数")
+	}
+	if redemption.MaxUses <= 0 {
+		redemption.MaxUses = 1
+	}
+	if redemption.PerUserLimit <= 0 {
+		redemption.PerUserLimit = 1
+	}
+	if redemption.PerUserLimit > redemption.MaxUses {
+		return errors.New("每用户兑换次数不能大于总兑换次数")
+	}
+	return nil
+}
+
 func validateExpiredTime(expired int64) error {
 	if expired != 0 && expired < common.GetTimestamp() {
 		return errors.New("过期时间不能早于当前时间")
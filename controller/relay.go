@@ -7,11 +7,13 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/metrics"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
@@ -20,18 +22,22 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/tracing"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
 	var err *types.NewAPIError
 	switch info.RelayMode {
-	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		err = relay.ImageHelper(c, info)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
@@ -67,11 +73,22 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 	originalModel := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
 
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(relayFormat))
+
 	var (
 		newAPIError *types.NewAPIError
 		ws          *websocket.Conn
+		relayInfo   *relaycommon.RelayInfo
 	)
 
+	defer func() {
+		recordRelayMetrics(c, relayInfo, newAPIError)
+		if newAPIError != nil {
+			model.RecordUsageError(c)
+		}
+		service.FinishPayloadCapture(c)
+	}()
+
 	if relayFormat == types.RelayFormatOpenAIRealtime {
 		var err error
 		ws, err = upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -94,6 +111,8 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 					"type":  "error",
 					"error": newAPIError.ToClaudeError(),
 				})
+			case types.RelayFormatGemini:
+				helper.GeminiError(c, newAPIError.ToGeminiError())
 			default:
 				c.JSON(newAPIError.StatusCode, gin.H{
 					"error": newAPIError.ToOpenAIError(),
@@ -102,13 +121,29 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	// 引用本站文件的 file_id 替换为文件内容后再解析请求
+	if relayFormat == types.RelayFormatOpenAI || relayFormat == types.RelayFormatOpenAIResponses {
+		if err := service.InlineRequestFiles(c); err != nil {
+			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+			return
+		}
+	}
+
+	// previous_response_id 指向本站保存的响应时展开为完整的对话
+	if relayFormat == types.RelayFormatOpenAIResponses {
+		if err := service.ExpandPreviousResponse(c); err != nil {
+			newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+			return
+		}
+	}
+
 	request, err := helper.GetAndValidateRequest(c, relayFormat)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
 		return
 	}
 
-	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, ws)
+	relayInfo, err = relaycommon.GenRelayInfo(c, relayFormat, request, ws)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
 		return
@@ -125,7 +160,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	countSpan := tracing.Start(c, "CountRequestToken")
 	tokens, err := service.CountRequestToken(c, meta, relayInfo)
+	countSpan.SetAttributes(attribute.Int("prompt_tokens", tokens))
+	tracing.EndWithError(countSpan, err)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
 		return
@@ -133,7 +171,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetPromptTokens(tokens)
 
+	priceSpan := tracing.Start(c, "ModelPriceHelper")
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+	tracing.EndWithError(priceSpan, err)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
 		return
@@ -141,13 +181,26 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
 
+	allowancePattern, newAPIError := service.ConsumeSubscriptionAllowance(c, relayInfo)
+	if newAPIError != nil {
+		return
+	}
+	defer func() {
+		if newAPIError != nil {
+			service.ReturnSubscriptionAllowance(c, relayInfo, allowancePattern)
+		}
+	}()
+
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
+		preConsumeSpan := tracing.Start(c, "PreConsumeQuota", attribute.Int("quota", priceData.QuotaToPreConsume))
 		newAPIError = service.PreConsumeQuota(c, priceData.QuotaToPreConsume, relayInfo)
 		if newAPIError != nil {
+			tracing.EndWithError(preConsumeSpan, newAPIError)
 			return
 		}
+		preConsumeSpan.End()
 	}
 
 	defer func() {
@@ -166,9 +219,21 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 
 		addUsedChannel(c, channel.Id)
+		service.StartPayloadCaptureAttempt(c)
+		if i > 0 {
+			metrics.RecordRetry(relayMetricsLabels(c))
+		}
 		requestBody, _ := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
+		attemptStart := time.Now()
+		common.SetContextKey(c, constant.ContextKeyRelayAttemptStartTime, attemptStart)
+		attemptSpan, endAttempt := tracing.StartScope(c, "RelayAttempt",
+			attribute.Int("retry", i),
+			attribute.Int("channel_id", channel.Id),
+			attribute.Int("channel_type", channel.Type),
+			attribute.Int("key_index", common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)),
+		)
 		switch relayFormat {
 		case types.RelayFormatOpenAIRealtime:
 			newAPIError = relay.WssHelper(c, relayInfo)
@@ -179,6 +244,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		default:
 			newAPIError = relayHandler(c, relayInfo)
 		}
+		endRelayAttemptSpan(c, relayInfo, attemptSpan, newAPIError)
+		endAttempt()
+		recordChannelPerformance(relayInfo, channel.Id, originalModel, attemptStart, newAPIError)
+		model.RecordAlertRequest(channel.Id, originalModel, newAPIError != nil)
 
 		if newAPIError == nil {
 			return
@@ -205,6 +274,61 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// endRelayAttemptSpan 记录单次尝试的状态码，流式请求额外记录从首个响应到结束的输出耗时
+func endRelayAttemptSpan(c *gin.Context, relayInfo *relaycommon.RelayInfo, span trace.Span, newAPIError *types.NewAPIError) {
+	if relayInfo.IsStream && relayInfo.HasSendResponse() {
+		tracing.StartAt(c, "UpstreamStream", relayInfo.FirstResponseTime).End()
+	}
+	if newAPIError != nil {
+		span.SetAttributes(attribute.Int("status_code", newAPIError.StatusCode))
+		span.RecordError(newAPIError)
+		span.SetStatus(codes.Error, string(newAPIError.GetErrorCode()))
+		return
+	}
+	span.SetAttributes(attribute.Int("status_code", c.Writer.Status()))
+}
+
+func relayMetricsLabels(c *gin.Context) metrics.RelayLabels {
+	return metrics.RelayLabels{
+		ChannelId:   common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		ChannelType: common.GetContextKeyInt(c, constant.ContextKeyChannelType),
+		Model:       common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		Group:       common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		RelayFormat: common.GetContextKeyString(c, constant.ContextKeyRelayFormat),
+	}
+}
+
+// recordRelayMetrics 在请求结束后记录请求数、错误、耗时与首字时间，渠道标签为最后一次尝试的渠道
+func recordRelayMetrics(c *gin.Context, relayInfo *relaycommon.RelayInfo, newAPIError *types.NewAPIError) {
+	startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
+	if startTime.IsZero() {
+		return
+	}
+	statusCode := c.Writer.Status()
+	errorCode := ""
+	if newAPIError != nil {
+		statusCode = newAPIError.StatusCode
+		errorCode = string(newAPIError.GetErrorCode())
+	}
+	var firstToken time.Duration
+	if relayInfo != nil && relayInfo.IsStream && relayInfo.HasSendResponse() {
+		firstToken = relayInfo.FirstResponseTime.Sub(relayInfo.StartTime)
+	}
+	metrics.RecordRelayRequest(relayMetricsLabels(c), statusCode, errorCode, time.Since(startTime), firstToken)
+}
+
+// recordChannelPerformance 按渠道记录单次尝试的耗时、首字时间及是否失败，实时语音会话时长不具参考意义，不做记录
+func recordChannelPerformance(relayInfo *relaycommon.RelayInfo, channelId int, modelName string, attemptStart time.Time, newAPIError *types.NewAPIError) {
+	if relayInfo.RelayFormat == types.RelayFormatOpenAIRealtime {
+		return
+	}
+	var firstToken time.Duration
+	if relayInfo.IsStream && relayInfo.HasSendResponse() && relayInfo.FirstResponseTime.After(attemptStart) {
+		firstToken = relayInfo.FirstResponseTime.Sub(attemptStart)
+	}
+	model.RecordChannelAttempt(channelId, modelName, time.Since(attemptStart), firstToken, newAPIError != nil)
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
@@ -316,6 +440,9 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 			adminInfo["is_multi_key"] = true
 			adminInfo["multi_key_index"] = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
 		}
+		if service.IsPayloadCaptured(c) {
+			adminInfo["payload_capture_request_id"] = c.GetString(common.RequestIdKey)
+		}
 		other["admin_info"] = adminInfo
 		model.RecordErrorLog(c, userId, channelId, modelName, tokenName, err.MaskSensitiveError(), tokenId, 0, false, userGroup, other)
 	}
@@ -323,6 +450,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 }
 
 func RelayMidjourney(c *gin.Context) {
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(types.RelayFormatMjProxy))
 	relayInfo, err := relaycommon.GenRelayInfo(c, types.RelayFormatMjProxy, nil, nil)
 
 	if err != nil {
@@ -390,6 +518,7 @@ func RelayNotFound(c *gin.Context) {
 }
 
 func RelayTask(c *gin.Context) {
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(types.RelayFormatTask))
 	retryTimes := common.RetryTimes
 	channelId := c.GetInt("channel_id")
 	group := c.GetString("group")
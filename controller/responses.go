@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+)
+
+// getRequestStoredResponse 返回当前用户保存的响应，不存在时直接返回 404
+func getRequestStoredResponse(c *gin.Context) *model.StoredResponse {
+	response, err := model.GetUserStoredResponse(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "response_not_found", fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		}
+		return nil
+	}
+	return response
+}
+
+// RelayResponses 处理 /v1/responses，background 为 true 的请求排队后由后台执行
+func RelayResponses(c *gin.Context) {
+	if !service.IsBackgroundResponsesRequest(c) {
+		Relay(c, types.RelayFormatOpenAIResponses)
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(types.RelayFormatOpenAIResponses))
+	if body, err := common.GetRequestBody(c); err != nil || gjson.GetBytes(body, "store").String() == "false" {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "Background mode requires store to be true.")
+		return
+	}
+	if err := service.ExpandPreviousResponse(c); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	response, err := service.CreateBackgroundResponse(c)
+	if err != nil {
+		if errors.Is(err, service.ErrResponseInsufficientQuota) {
+			openAIErrorResponse(c, http.StatusForbidden, string(types.ErrorCodeInsufficientUserQuota), err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrResponseStoreDisabled) {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrPrepaidTokenUnsupported) {
+			openAIErrorResponse(c, http.StatusForbidden, "invalid_token", err.Error())
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("create background response failed: %s", err.Error()))
+		openAIErrorResponse(c, http.StatusInternalServerError, "create_response_failed", err.Error())
+		return
+	}
+	if response.Stream {
+		streamResponseEvents(c, response, -1)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response.Response)
+}
+
+// RelayBackgroundResponse 在进程内执行后台响应。提交时已检查过 IP 白名单及请求频率，
+// 这里只按保存的令牌、分组及客户端 IP 重建上下文，再选择渠道并转发
+func RelayBackgroundResponse(c *gin.Context, response *model.StoredResponse) {
+	middleware.RequestId()(c)
+	token, err := model.GetTokenById(response.TokenId)
+	if err == nil {
+		token, err = model.ValidateUserToken(token.Key)
+	}
+	if err != nil {
+		openAIErrorResponse(c, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "get_user_failed", err.Error())
+		return
+	}
+	if userCache.Status != common.UserStatusEnabled {
+		openAIErrorResponse(c, http.StatusForbidden, "user_disabled", "用户已被封禁")
+		return
+	}
+	userCache.WriteContext(c)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, response.UsingGroup)
+	if err = middleware.SetupContextForToken(c, token); err != nil {
+		return
+	}
+	middleware.Distribute()(c)
+	if c.IsAborted() {
+		return
+	}
+	Relay(c, types.RelayFormatOpenAIResponses)
+}
+
+// streamResponseEvents 按顺序推送后台响应保存的事件，响应未结束时持续等待新事件
+func streamResponseEvents(c *gin.Context, response *model.StoredResponse, after int) {
+	helper.SetEventStreamHeaders(c)
+	for {
+		status, err := model.GetStoredResponseStatus(response.ResponseId)
+		if err != nil {
+			return
+		}
+		events, err := model.GetResponseEvents(response.ResponseId, after, 100)
+		if err != nil {
+			return
+		}
+		for _, event := range events {
+			c.Render(-1, common.CustomEvent{Data: "event: " + event.Type + "\n"})
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(event.Data)})
+			after = event.SequenceNumber
+		}
+		if len(events) > 0 {
+			_ = helper.FlushWriter(c)
+			continue
+		}
+		if model.IsResponseFinished(status) {
+			return
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// RetrieveResponse 返回保存的响应对象，后台流式响应指定 stream=true 时从 starting_after 之后的事件开始重新推送
+func RetrieveResponse(c *gin.Context) {
+	response := getRequestStoredResponse(c)
+	if response == nil {
+		return
+	}
+	if c.Query("stream") != "true" {
+		c.Data(http.StatusOK, "application/json", response.Response)
+		return
+	}
+	if !response.Background || !response.Stream {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "Only background responses created with stream=true can be streamed.")
+		return
+	}
+	after := -1
+	if startingAfter := c.Query("starting_after"); startingAfter != "" {
+		var err error
+		if after, err = strconv.Atoi(startingAfter); err != nil {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "starting_after must be an integer.")
+			return
+		}
+	}
+	streamResponseEvents(c, response, after)
+}
+
+// CancelResponse 取消未结束的后台响应，重复取消直接返回已取消的响应
+func CancelResponse(c *gin.Context) {
+	response := getRequestStoredResponse(c)
+	if response == nil {
+		return
+	}
+	if !response.Background {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "Only background responses can be cancelled.")
+		return
+	}
+	if !model.IsResponseFinished(response.Status) {
+		if _, err := service.CancelBackgroundResponse(response); err != nil {
+			openAIErrorResponse(c, http.StatusInternalServerError, "cancel_response_failed", err.Error())
+			return
+		}
+		// 取消前响应可能刚好结束，以数据库中的状态为准
+		if response = getRequestStoredResponse(c); response == nil {
+			return
+		}
+	}
+	if response.Status != model.ResponseStatusCancelled {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Cannot cancel a response with status '%s'.", response.Status))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response.Response)
+}
+
+func DeleteResponse(c *gin.Context) {
+	response := getRequestStoredResponse(c)
+	if response == nil {
+		return
+	}
+	if response.Background && !model.IsResponseFinished(response.Status) {
+		if _, err := service.CancelBackgroundResponse(response); err != nil {
+			openAIErrorResponse(c, http.StatusInternalServerError, "delete_response_failed", err.Error())
+			return
+		}
+	}
+	if err := model.DeleteStoredResponse(response); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "delete_response_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, dto.ResponsesDeleted{Id: response.ResponseId, Object: "response", Deleted: true})
+}
+
+// ListResponseInputItems 分页返回响应的输入条目，包含由 previous_response_id 展开的历史条目
+func ListResponseInputItems(c *gin.Context) {
+	response := getRequestStoredResponse(c)
+	if response == nil {
+		return
+	}
+	after, limit := openAIListQuery(c, 20, 100)
+	var items []json.RawMessage
+	if err := common.Unmarshal(response.Input, &items); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		return
+	}
+	if c.DefaultQuery("order", "desc") == "desc" {
+		slices.Reverse(items)
+	}
+	if after != "" {
+		index := slices.IndexFunc(items, func(item json.RawMessage) bool {
+			return gjson.GetBytes(item, "id").String() == after
+		})
+		if index < 0 {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid_after", fmt.Sprintf("Input item with id '%s' not found.", after))
+			return
+		}
+		items = items[index+1:]
+	}
+	list := &dto.ResponsesInputItemList{Object: "list", Data: items}
+	if len(items) > limit {
+		list.Data = items[:limit]
+		list.HasMore = true
+	}
+	if list.Data == nil {
+		list.Data = make([]json.RawMessage, 0)
+	}
+	if len(list.Data) > 0 {
+		firstId := gjson.GetBytes(list.Data[0], "id").String()
+		lastId := gjson.GetBytes(list.Data[len(list.Data)-1], "id").String()
+		list.FirstId, list.LastId = &firstId, &lastId
+	}
+	c.JSON(http.StatusOK, list)
+}
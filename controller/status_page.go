@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStatusPage 内置状态页数据，基于定期的探测结果计算各模型的可用率及故障区间，无需外部监控服务
+func GetStatusPage(c *gin.Context) {
+	page, err := service.GetStatusPage()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, page)
+}
+
+// RunStatusProbes 立即在后台发起一轮探测
+func RunStatusProbes(c *gin.Context) {
+	go service.RunStatusProbes()
+	common.ApiSuccess(c, nil)
+}
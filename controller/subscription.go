@@ -0,0 +1,349 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/thanhpk/randstr"
+)
+
+const subscriptionReferenceMetadataKey = "reference_id"
+
+type SubscribeRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+// GetSubscriptionPlans 管理员获取全部订阅套餐
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetAllSubscriptionPlans(false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func CreateSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	if err := plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &plan)
+}
+
+func UpdateSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if plan.Id == 0 {
+		common.ApiErrorMsg(c, "缺少套餐 ID")
+		return
+	}
+	origin, err := model.GetSubscriptionPlanById(plan.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.CreatedTime = origin.CreatedTime
+	if err := plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &plan)
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteSubscriptionPlanById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetAllSubscriptions 管理员查看订阅记录，可通过 ?status=active 过滤
+func GetAllSubscriptions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	subs, total, err := model.GetAllSubscriptions(pageInfo, c.Query("status"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(subs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetEnabledSubscriptionPlans 用户可购买的订阅套餐
+func GetEnabledSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetAllSubscriptionPlans(true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, plan := range plans {
+		plan.StripePriceId = ""
+	}
+	common.ApiSuccess(c, plans)
+}
+
+// GetSelfSubscription 获取当前用户的订阅状态及本周期模型次数使用情况
+func GetSelfSubscription(c *gin.Context) {
+	userId := c.GetInt("id")
+	current, err := model.GetEffectiveSubscriptionByUserId(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	history, err := model.GetUserSubscriptions(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data := gin.H{
+		"current": current,
+		"history": history,
+	}
+	if current != nil {
+		plan, err := model.GetSubscriptionPlanById(current.PlanId)
+		if err == nil {
+			plan.StripePriceId = ""
+			data["plan"] = plan
+		}
+		usages, err := model.GetSubscriptionAllowanceUsages(current.Id, current.CurrentPeriodStart)
+		if err == nil {
+			data["allowance_usages"] = usages
+		}
+	}
+	common.ApiSuccess(c, data)
+}
+
+// RequestSubscription 创建 Stripe 订阅结账链接
+func RequestSubscription(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil || !plan.Enabled {
+		c.JSON(200, gin.H{"message": "error", "data": "订阅套餐不存在"})
+		return
+	}
+	if plan.StripePriceId == "" {
+		c.JSON(200, gin.H{"message": "error", "data": "该套餐未配置支付价格"})
+		return
+	}
+
+	id := c.GetInt("id")
+	current, err := model.GetEffectiveSubscriptionByUserId(id)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "查询订阅状态失败"})
+		return
+	}
+	if current != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "已有生效中的订阅，请到期或取消后再订阅"})
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "获取用户信息失败"})
+		return
+	}
+
+	reference := fmt.Sprintf("new-api-sub-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
+	referenceId := "sub_" + common.Sha1([]byte(reference))
+
+	payLink, err := genStripeSubscriptionLink(referenceId, user.StripeCustomer, user.Email, plan.StripePriceId)
+	if err != nil {
+		log.Println("获取Stripe订阅支付链接失败", err)
+		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		return
+	}
+	if _, err = model.CreatePendingSubscription(user.Id, plan.Id, referenceId); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "创建订阅失败"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"pay_link": payLink,
+		},
+	})
+}
+
+// CancelSelfSubscription 在当前周期结束时取消订阅，周期内权益保留
+func CancelSelfSubscription(c *gin.Context) {
+	userId := c.GetInt("id")
+	current, err := model.GetEffectiveSubscriptionByUserId(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if current == nil || current.StripeSubscriptionId == "" {
+		common.ApiErrorMsg(c, "没有可取消的订阅")
+		return
+	}
+	if current.CancelAtPeriodEnd {
+		common.ApiSuccess(c, current)
+		return
+	}
+	if err := setupStripeKey(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	_, err = subscription.Update(current.StripeSubscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	if err != nil {
+		log.Println("取消Stripe订阅失败", current.StripeSubscriptionId, err)
+		common.ApiErrorMsg(c, "取消订阅失败")
+		return
+	}
+	if err := model.UpdateSubscriptionState(current.StripeSubscriptionId, current.ReferenceId, true, current.CurrentPeriodEnd); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func setupStripeKey() error {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return errors.New("无效的Stripe API密钥")
+	}
+	stripe.Key = setting.StripeApiSecret
+	return nil
+}
+
+func genStripeSubscriptionLink(referenceId string, customerId string, email string, priceId string) (string, error) {
+	if err := setupStripeKey(); err != nil {
+		return "", err
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(referenceId),
+		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/topup"),
+		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(priceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode:                stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+		SubscriptionData:    &stripe.CheckoutSessionSubscriptionDataParams{},
+	}
+	// 订阅及其账单都会携带该元数据，用于在 webhook 中定位订阅记录
+	params.SubscriptionData.AddMetadata(subscriptionReferenceMetadataKey, referenceId)
+
+	if customerId == "" {
+		if email != "" {
+			params.CustomerEmail = stripe.String(email)
+		}
+	} else {
+		params.Customer = stripe.String(customerId)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+func subscriptionCheckoutCompleted(event stripe.Event) {
+	referenceId := event.GetObjectValue("client_reference_id")
+	subscriptionId := event.GetObjectValue("subscription")
+	if err := model.BindStripeSubscription(referenceId, subscriptionId); err != nil {
+		log.Println("绑定Stripe订阅失败", referenceId, err.Error())
+		return
+	}
+	log.Printf("Stripe订阅结账完成：%s, %s", referenceId, subscriptionId)
+}
+
+// subscriptionInvoicePaid 每次订阅账单支付成功（含首期）发放一个周期的额度
+func subscriptionInvoicePaid(event stripe.Event) {
+	subscriptionId := event.GetObjectValue("subscription")
+	if subscriptionId == "" {
+		// 非订阅账单
+		return
+	}
+	referenceId := event.GetObjectValue("subscription_details", "metadata", subscriptionReferenceMetadataKey)
+	invoiceId := event.GetObjectValue("id")
+	customerId := event.GetObjectValue("customer")
+	// 订阅账单的 period_start/period_end 指向上一周期，以账单明细的周期为准
+	periodStart, _ := strconv.ParseInt(event.GetObjectValue("lines", "data", "0", "period", "start"), 10, 64)
+	periodEnd, _ := strconv.ParseInt(event.GetObjectValue("lines", "data", "0", "period", "end"), 10, 64)
+
+	if referenceId == "" {
+		log.Println("Stripe订阅账单缺少订阅单号", subscriptionId, invoiceId)
+		return
+	}
+	if err := model.RenewSubscription(referenceId, subscriptionId, customerId, invoiceId, periodStart, periodEnd); err != nil {
+		log.Println(err.Error(), referenceId, invoiceId)
+		return
+	}
+	log.Printf("订阅账单支付成功：%s, %s", referenceId, invoiceId)
+}
+
+func subscriptionUpdated(event stripe.Event) {
+	subscriptionId := event.GetObjectValue("id")
+	referenceId := event.GetObjectValue("metadata", subscriptionReferenceMetadataKey)
+	status := event.GetObjectValue("status")
+	switch stripe.SubscriptionStatus(status) {
+	case stripe.SubscriptionStatusCanceled, stripe.SubscriptionStatusUnpaid, stripe.SubscriptionStatusIncompleteExpired:
+		subscriptionLapsed(subscriptionId, referenceId)
+		return
+	}
+	cancelAtPeriodEnd := event.GetObjectValue("cancel_at_period_end") == "true"
+	periodEnd, _ := strconv.ParseInt(event.GetObjectValue("current_period_end"), 10, 64)
+	if err := model.UpdateSubscriptionState(subscriptionId, referenceId, cancelAtPeriodEnd, periodEnd); err != nil {
+		log.Println("更新订阅状态失败", subscriptionId, err.Error())
+	}
+}
+
+func subscriptionDeleted(event stripe.Event) {
+	subscriptionLapsed(event.GetObjectValue("id"), event.GetObjectValue("metadata", subscriptionReferenceMetadataKey))
+}
+
+func subscriptionLapsed(subscriptionId string, referenceId string) {
+	if err := model.LapseSubscription(subscriptionId, referenceId); err != nil {
+		log.Println("订阅失效处理失败", subscriptionId, err.Error())
+		return
+	}
+	log.Println("订阅已失效", subscriptionId)
+}
@@ -61,6 +61,14 @@ func ensureUserGroupsAccessible(c *gin.Context, groups []string) error {
 	return nil
 }
 
+// recordAdminTokenAudit 管理员操作自己的令牌时记录审计日志，普通用户的令牌操作不记录
+func recordAdminTokenAudit(c *gin.Context, action string, tokenId any, before any, after any) {
+	if c.GetInt("role") < common.RoleAdminUser {
+		return
+	}
+	model.RecordAuditLog(c, action, model.AuditTargetToken, tokenId, before, after)
+}
+
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
 	pageInfo := common.GetPageQuery(c)
@@ -257,6 +265,7 @@ func AddToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	recordAdminTokenAudit(c, model.AuditActionTokenCreate, cleanToken.Id, nil, &cleanToken)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -272,6 +281,7 @@ func DeleteToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	recordAdminTokenAudit(c, model.AuditActionTokenDelete, id, nil, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -316,14 +326,18 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	originToken := *cleanToken
 	if statusOnly != "" {
 		cleanToken.Status = tokenReq.Status
 	} else {
 		// If you add more fields, please also update token.Update()
 		cleanToken.Name = tokenReq.Name
 		cleanToken.ExpiredTime = tokenReq.ExpiredTime
-		cleanToken.RemainQuota = tokenReq.RemainQuota
-		cleanToken.UnlimitedQuota = tokenReq.UnlimitedQuota
+		// 兑换码发放的令牌额度不可修改
+		if !cleanToken.Prepaid {
+			cleanToken.RemainQuota = tokenReq.RemainQuota
+			cleanToken.UnlimitedQuota = tokenReq.UnlimitedQuota
+		}
 		cleanToken.ModelLimitsEnabled = tokenReq.ModelLimitsEnabled
 		cleanToken.ModelLimits = tokenReq.ModelLimits
 		cleanToken.AllowIps = tokenReq.AllowIps
@@ -366,6 +380,7 @@ func UpdateToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	recordAdminTokenAudit(c, model.AuditActionTokenUpdate, cleanToken.Id, &originToken, cleanToken)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -393,6 +408,7 @@ func DeleteTokenBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	recordAdminTokenAudit(c, model.AuditActionTokenDelete, "", nil, map[string]any{"ids": tokenBatch.Ids})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -51,6 +51,7 @@ func verifyCreemSignature(payload string, signature string, secret string) bool
 type CreemPayRequest struct {
 	ProductId     string `json:"product_id"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code"`
 }
 
 type CreemProduct struct {
@@ -100,6 +101,11 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 
 	id := c.GetInt("id")
 	user, _ := model.GetUserById(id, false)
+	couponCode, bonusQuota, err := prepareTopUpCoupon(req.CouponCode, user.Id, user.Group, int(selectedProduct.Quota))
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
 
 	// 生成唯一的订单引用ID
 	reference := fmt.Sprintf("creem-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
@@ -113,6 +119,8 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 		TradeNo:    referenceId,
 		CreateTime: time.Now().Unix(),
 		Status:     common.TopUpStatusPending,
+		CouponCode: couponCode,
+		BonusQuota: bonusQuota,
 	}
 	err = topUp.Insert()
 	if err != nil {
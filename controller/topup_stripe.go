@@ -31,6 +31,7 @@ var stripeAdaptor = &StripeAdaptor{}
 type StripePayRequest struct {
 	Amount        int64  `json:"amount"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code"`
 }
 
 type StripeAdaptor struct {
@@ -72,6 +73,11 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	id := c.GetInt("id")
 	user, _ := model.GetUserById(id, false)
 	chargedMoney := GetChargedAmount(float64(req.Amount), *user)
+	couponCode, bonusQuota, err := prepareTopUpCoupon(req.CouponCode, user.Id, user.Group, int(chargedMoney*common.QuotaPerUnit))
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
 
 	reference := fmt.Sprintf("new-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
@@ -91,6 +97,8 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 		PaymentMethod: PaymentMethodStripe,
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
+		CouponCode:    couponCode,
+		BonusQuota:    bonusQuota,
 	}
 	err = topUp.Insert()
 	if err != nil {
@@ -150,6 +158,12 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeInvoicePaid:
+		subscriptionInvoicePaid(event)
+	case stripe.EventTypeCustomerSubscriptionUpdated:
+		subscriptionUpdated(event)
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		subscriptionDeleted(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -166,6 +180,12 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
+	if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+		// 订阅额度在 invoice.paid 中按周期发放
+		subscriptionCheckoutCompleted(event)
+		return
+	}
+
 	err := model.Recharge(referenceId, customerId)
 	if err != nil {
 		log.Println(err.Error(), referenceId)
@@ -190,6 +210,13 @@ func sessionExpired(event stripe.Event) {
 		return
 	}
 
+	if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+		if err := model.ExpirePendingSubscription(referenceId); err != nil {
+			log.Println("过期订阅订单失败", referenceId, ", err:", err.Error())
+		}
+		return
+	}
+
 	topUp := model.GetTopUpByTradeNo(referenceId)
 	if topUp == nil {
 		log.Println("充值订单不存在", referenceId)
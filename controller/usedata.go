@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
@@ -51,3 +53,69 @@ func GetUserQuotaDates(c *gin.Context) {
 	})
 	return
 }
+
+func parseUsageQuery(c *gin.Context) (model.UsageQuery, error) {
+	query := model.UsageQuery{
+		Bucket:      c.DefaultQuery("bucket", model.UsageBucketDay),
+		ModelName:   c.Query("model_name"),
+		Group:       c.Query("group"),
+		RelayFormat: c.Query("relay_format"),
+	}
+	query.StartTime, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	query.EndTime, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	query.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	query.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	query.ChannelId, _ = strconv.Atoi(c.Query("channel_id"))
+	groupBy, err := model.ParseUsageGroupBy(c.Query("group_by"))
+	if err != nil {
+		return query, err
+	}
+	query.GroupBy = groupBy
+	if query.StartTime == 0 || query.EndTime == 0 || query.EndTime < query.StartTime {
+		return query, errors.New("请指定有效的起止时间")
+	}
+	return query, nil
+}
+
+// GetUsageAnalytics 用量分析，bucket 为 hour / day / month / none，group_by 为 user、token、model、channel、group、relay_format 的任意组合
+func GetUsageAnalytics(c *gin.Context) {
+	query, err := parseUsageQuery(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rows, err := model.QueryUsage(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, rows)
+}
+
+// GetSelfUsageAnalytics 用户查询自己的用量分析，不支持按渠道分组或筛选，按小时查询时跨度不能超过 1 个月
+func GetSelfUsageAnalytics(c *gin.Context) {
+	query, err := parseUsageQuery(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	query.UserId = c.GetInt("id")
+	if query.ChannelId != 0 || slices.Contains(query.GroupBy, "channel") {
+		common.ApiError(c, errors.New("不支持按渠道查询"))
+		return
+	}
+	if query.Bucket == model.UsageBucketHour && query.EndTime-query.StartTime > 2592000 {
+		common.ApiError(c, errors.New("按小时查询时时间跨度不能超过 1 个月"))
+		return
+	}
+	if query.EndTime-query.StartTime > 366*86400 {
+		common.ApiError(c, errors.New("时间跨度不能超过 1 年"))
+		return
+	}
+	rows, err := model.QueryUsage(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, rows)
+}
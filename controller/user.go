@@ -646,6 +646,11 @@ func UpdateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if editedUser, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		// 密码只记录是否修改，审计日志中会被掩码
+		editedUser.Password = updatedUser.Password
+		model.RecordAuditLog(c, model.AuditActionUserUpdate, model.AuditTargetUser, updatedUser.Id, originUser, editedUser)
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
@@ -795,6 +800,9 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 	err = model.HardDeleteUserById(id)
+	if err == nil {
+		model.RecordAuditLog(c, model.AuditActionUserDelete, model.AuditTargetUser, id, originUser, nil)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -868,6 +876,12 @@ func CreateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordAuditLog(c, model.AuditActionUserCreate, model.AuditTargetUser, cleanUser.Id, nil, model.User{
+		Id:          cleanUser.Id,
+		Username:    cleanUser.Username,
+		DisplayName: cleanUser.DisplayName,
+		Role:        cleanUser.Role,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -913,6 +927,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -978,6 +993,11 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if req.Action == "delete" {
+		model.RecordAuditLog(c, model.AuditActionUserDelete, model.AuditTargetUser, user.Id, &originUser, nil)
+	} else {
+		model.RecordAuditLog(c, model.AuditActionUserManage, model.AuditTargetUser, user.Id, &originUser, &user)
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1086,15 +1106,22 @@ func TopUp(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	quota, err := model.Redeem(req.Key, id)
+	record, err := model.Redeem(req.Key, id)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	message := ""
+	switch record.RewardType {
+	case model.RedemptionRewardGroup:
+		message = fmt.Sprintf("分组已变更为 %s", record.Group)
+	case model.RedemptionRewardToken:
+		message = "已生成新的令牌，请在令牌页面查看"
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "",
-		"data":    quota,
+		"message": message,
+		"data":    record.Quota,
 	})
 }
 
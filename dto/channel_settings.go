@@ -31,6 +31,7 @@ type ChannelOtherSettings struct {
 	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
 	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	ClaudeViaResponses    bool          `json:"claude_via_responses,omitempty"` // Claude Messages 请求是否通过 Responses API 转发（上游模型只支持 Responses API 时开启）
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -0,0 +1,64 @@
+package dto
+
+import "encoding/json"
+
+// ClaudeMessageBatchRequest https://docs.anthropic.com/en/api/creating-message-batches
+type ClaudeMessageBatchRequest struct {
+	Requests []ClaudeMessageBatchRequestItem `json:"requests"`
+}
+
+type ClaudeMessageBatchRequestItem struct {
+	CustomId string          `json:"custom_id"`
+	Params   json.RawMessage `json:"params"`
+}
+
+type ClaudeMessageBatchRequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+const (
+	ClaudeMessageBatchStatusInProgress = "in_progress"
+	ClaudeMessageBatchStatusCanceling  = "canceling"
+	ClaudeMessageBatchStatusEnded      = "ended"
+)
+
+type ClaudeMessageBatch struct {
+	Id                string                          `json:"id"`
+	Type              string                          `json:"type"`
+	ProcessingStatus  string                          `json:"processing_status"`
+	RequestCounts     ClaudeMessageBatchRequestCounts `json:"request_counts"`
+	EndedAt           *string                         `json:"ended_at"`
+	CreatedAt         string                          `json:"created_at"`
+	ExpiresAt         string                          `json:"expires_at"`
+	ArchivedAt        *string                         `json:"archived_at"`
+	CancelInitiatedAt *string                         `json:"cancel_initiated_at"`
+	ResultsUrl        *string                         `json:"results_url"`
+}
+
+func (b *ClaudeMessageBatch) TotalRequests() int {
+	counts := b.RequestCounts
+	return counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired
+}
+
+type ClaudeMessageBatchList struct {
+	Data    []*ClaudeMessageBatch `json:"data"`
+	HasMore bool                  `json:"has_more"`
+	FirstId *string               `json:"first_id"`
+	LastId  *string               `json:"last_id"`
+}
+
+// ClaudeMessageBatchResult 结果文件（JSONL）中的一行
+type ClaudeMessageBatchResult struct {
+	CustomId string `json:"custom_id"`
+	Result   struct {
+		Type    string `json:"type"`
+		Message *struct {
+			Model string       `json:"model"`
+			Usage *ClaudeUsage `json:"usage"`
+		} `json:"message,omitempty"`
+	} `json:"result"`
+}
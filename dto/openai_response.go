@@ -288,6 +288,21 @@ type OpenAIResponsesResponse struct {
 	Metadata           json.RawMessage    `json:"metadata"`
 }
 
+// ResponsesInputItemList /v1/responses/{id}/input_items 返回的输入条目列表
+type ResponsesInputItemList struct {
+	Object  string            `json:"object"`
+	Data    []json.RawMessage `json:"data"`
+	FirstId *string           `json:"first_id"`
+	LastId  *string           `json:"last_id"`
+	HasMore bool              `json:"has_more"`
+}
+
+type ResponsesDeleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
 func (o *OpenAIResponsesResponse) GetOpenAIError() *types.OpenAIError {
 	return GetOpenAIError(o.Error)
@@ -337,10 +352,16 @@ type ResponsesOutput struct {
 	Type    string                   `json:"type"`
 	ID      string                   `json:"id"`
 	Status  string                   `json:"status"`
-	Role    string                   `json:"role"`
-	Content []ResponsesOutputContent `json:"content"`
-	Quality string                   `json:"quality"`
-	Size    string                   `json:"size"`
+	Role    string                   `json:"role,omitempty"`
+	Content []ResponsesOutputContent `json:"content,omitempty"`
+	Quality string                   `json:"quality,omitempty"`
+	Size    string                   `json:"size,omitempty"`
+	// function_call
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// reasoning
+	Summary []ResponsesOutputContent `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -363,12 +384,46 @@ const (
 	ResponsesOutputTypeItemDone  = "response.output_item.done"
 )
 
+const (
+	ResponsesOutputTypeMessage      = "message"
+	ResponsesOutputTypeFunctionCall = "function_call"
+	ResponsesOutputTypeReasoning    = "reasoning"
+)
+
+const (
+	ResponsesStreamTypeCreated          = "response.created"
+	ResponsesStreamTypeInProgress       = "response.in_progress"
+	ResponsesStreamTypeCompleted        = "response.completed"
+	ResponsesStreamTypeIncomplete       = "response.incomplete"
+	ResponsesStreamTypeFailed           = "response.failed"
+	ResponsesStreamTypeContentPartAdded = "response.content_part.added"
+	ResponsesStreamTypeContentPartDone  = "response.content_part.done"
+	ResponsesStreamTypeOutputTextDelta  = "response.output_text.delta"
+	ResponsesStreamTypeOutputTextDone   = "response.output_text.done"
+	ResponsesStreamTypeArgumentsDelta   = "response.function_call_arguments.delta"
+	ResponsesStreamTypeArgumentsDone    = "response.function_call_arguments.done"
+	ResponsesStreamTypeSummaryPartAdded = "response.reasoning_summary_part.added"
+	ResponsesStreamTypeSummaryPartDone  = "response.reasoning_summary_part.done"
+	ResponsesStreamTypeSummaryTextDelta = "response.reasoning_summary_text.delta"
+	ResponsesStreamTypeSummaryTextDone  = "response.reasoning_summary_text.done"
+	ResponsesStreamTypeOutputItemAdded  = ResponsesOutputTypeItemAdded
+	ResponsesStreamTypeOutputItemDone   = ResponsesOutputTypeItemDone
+)
+
 // ResponsesStreamResponse 用于处理 /v1/responses 流式响应
 type ResponsesStreamResponse struct {
-	Type     string                   `json:"type"`
-	Response *OpenAIResponsesResponse `json:"response,omitempty"`
-	Delta    string                   `json:"delta,omitempty"`
-	Item     *ResponsesOutput         `json:"item,omitempty"`
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	ItemID         string                   `json:"item_id,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	Part           *ResponsesOutputContent  `json:"part,omitempty"`
+	Text           string                   `json:"text,omitempty"`
+	Arguments      string                   `json:"arguments,omitempty"`
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -7,7 +7,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
@@ -31,11 +30,14 @@ var logCount int
 var setupLogLock sync.Mutex
 var setupLogWorking bool
 
+var logFile *rotatingFile
+
+// SetupLogger 按 LOG_OUTPUT 配置日志输出目标，已打开日志文件时切换到新的日志文件
 func SetupLogger() {
 	defer func() {
 		setupLogWorking = false
 	}()
-	if *common.LogDir != "" {
+	if *common.LogDir != "" && common.LogOutputFile {
 		ok := setupLogLock.TryLock()
 		if !ok {
 			log.Println("setup log is already working")
@@ -44,13 +46,24 @@ func SetupLogger() {
 		defer func() {
 			setupLogLock.Unlock()
 		}()
-		logPath := filepath.Join(*common.LogDir, fmt.Sprintf("oneapi-%s.log", time.Now().Format("20060102150405")))
-		fd, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if logFile != nil {
+			if err := logFile.Rotate(); err != nil {
+				log.Println("failed to rotate log file: " + err.Error())
+			}
+			return
+		}
+		fd, err := newRotatingFile(*common.LogDir, common.LogFileMaxSizeMB, common.LogFileMaxBackups)
 		if err != nil {
 			log.Fatal("failed to open log file")
 		}
-		gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
-		gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+		logFile = fd
+		if common.LogOutputStdout {
+			gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
+			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+		} else {
+			gin.DefaultWriter = fd
+			gin.DefaultErrorWriter = fd
+		}
 	}
 }
 
@@ -67,7 +80,7 @@ func LogError(ctx context.Context, msg string) {
 }
 
 func LogDebug(ctx context.Context, msg string, args ...any) {
-	if common.DebugEnabled {
+	if common.LogLevelEnabled(common.LogLevelDebug, 1) {
 		if len(args) > 0 {
 			msg = fmt.Sprintf(msg, args...)
 		}
@@ -75,17 +88,33 @@ func LogDebug(ctx context.Context, msg string, args ...any) {
 	}
 }
 
+var loggerLevels = map[string]int{
+	loggerDebug: common.LogLevelDebug,
+	loggerINFO:  common.LogLevelInfo,
+	loggerWarn:  common.LogLevelWarn,
+	loggerError: common.LogLevelError,
+}
+
 func logHelper(ctx context.Context, level string, msg string) {
+	logLevel := loggerLevels[level]
+	// skip 2：跳过 LogInfo 等包装函数，按实际调用方所在包判断级别
+	if !common.LogLevelEnabled(logLevel, 2) {
+		return
+	}
 	writer := gin.DefaultErrorWriter
 	if level == loggerINFO {
 		writer = gin.DefaultWriter
 	}
-	id := ctx.Value(common.RequestIdKey)
-	if id == nil {
-		id = "SYSTEM"
+	if common.LogJSONEnabled {
+		common.WriteJSONLog(writer, logLevel, common.ContextLogFields(ctx), msg)
+	} else {
+		id := ctx.Value(common.RequestIdKey)
+		if id == nil {
+			id = "SYSTEM"
+		}
+		now := time.Now()
+		_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	}
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	logCount++ // we don't need accurate count, so no lock here
 	if logCount > maxLogCount && !setupLogWorking {
 		logCount = 0
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotatingFile 按体积轮转的日志文件，轮转时按 maxBackups 清理最旧的日志文件
+type rotatingFile struct {
+	mu         sync.Mutex
+	dir        string
+	file       *os.File
+	size       int64
+	maxSize    int64
+	maxBackups int
+}
+
+func newRotatingFile(dir string, maxSizeMB int, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		dir:        dir,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	base := fmt.Sprintf("oneapi-%s", time.Now().Format("20060102150405"))
+	logPath := filepath.Join(r.dir, base+".log")
+	// 同一秒内多次轮转时追加序号，避免写回已满的文件
+	for i := 1; r.maxSize > 0; i++ {
+		info, err := os.Stat(logPath)
+		if err != nil || info.Size() < r.maxSize {
+			break
+		}
+		logPath = filepath.Join(r.dir, fmt.Sprintf("%s-%d.log", base, i))
+	}
+	fd, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return err
+	}
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+	r.file = fd
+	r.size = info.Size()
+	r.removeOldFiles(logPath)
+	return nil
+}
+
+func (r *rotatingFile) removeOldFiles(current string) {
+	if r.maxBackups <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(r.dir, "oneapi-*.log"))
+	if err != nil {
+		return
+	}
+	backups := make([]string, 0, len(files))
+	for _, file := range files {
+		if file != current {
+			backups = append(backups, file)
+		}
+	}
+	if len(backups) <= r.maxBackups {
+		return
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		infoI, errI := os.Stat(backups[i])
+		infoJ, errJ := os.Stat(backups[j])
+		if errI != nil || errJ != nil {
+			return backups[i] < backups[j]
+		}
+		return infoI.ModTime().Before(infoJ.ModTime())
+	})
+	for _, file := range backups[:len(backups)-r.maxBackups] {
+		_ = os.Remove(file)
+	}
+}
+
+// Rotate 切换到新的日志文件
+func (r *rotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.open()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -20,6 +21,7 @@ import (
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/tracing"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-contrib/sessions"
@@ -60,6 +62,14 @@ func main() {
 		}
 	}()
 
+	shutdownTracing, err := tracing.Init()
+	if err != nil {
+		common.FatalLog("failed to initialize tracing: " + err.Error())
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	if common.RedisEnabled {
 		// for compatibility with old versions
 		common.MemoryCacheEnabled = true
@@ -84,6 +94,13 @@ func main() {
 		}()
 
 		go model.SyncChannelCache(common.SyncFrequency)
+
+		model.InitPriceOverrideCache()
+		go model.SyncPriceOverrideCache(common.SyncFrequency)
+		model.InitSubscriptionAllowanceCache()
+		go model.SyncSubscriptionAllowanceCache(common.SyncFrequency)
+		model.InitPayloadCaptureRuleCache()
+		go model.SyncPayloadCaptureRuleCache(common.SyncFrequency)
 	}
 
 	// 热更新配置
@@ -92,6 +109,12 @@ func main() {
 	// 数据看板
 	go model.UpdateQuotaData()
 
+	// 渠道性能汇总
+	go model.UpdateChannelPerformance()
+
+	// 告警请求计数
+	go model.UpdateAlertRequestStats()
+
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
 		if err != nil {
@@ -102,6 +125,19 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	if common.IsMasterNode {
+		go model.AutomaticallyExpireSubscriptions(common.SyncFrequency)
+		go model.AutomaticallyRevertRedemptionGroups(common.SyncFrequency)
+		go model.AutomaticallyCleanPayloadCaptures(common.SyncFrequency)
+		go service.AutomaticallyArchiveLogs(3600)
+		go service.AutomaticallyEvaluateAlertRules(60)
+		go service.AutomaticallyRunStatusProbes()
+		go service.AutomaticallyProcessBatches()
+		go service.AutomaticallyCleanExpiredFiles(3600)
+		go model.AutomaticallyCleanStoredResponses(3600)
+		go service.AutomaticallyProcessBackgroundResponses()
+	}
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -155,6 +191,8 @@ func main() {
 
 	// 设置路由
 	router.SetRouter(server, buildFS, indexPage)
+	service.SetBatchRelayHandler(server)
+	service.SetBackgroundResponseRelay(controller.RelayBackgroundResponse)
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -256,5 +294,8 @@ func InitResources() error {
 	if err != nil {
 		return err
 	}
+
+	// 监控指标，需在数据库与 Redis 初始化之后注册
+	service.InitMetrics()
 	return nil
 }
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "newapi"
+
+var relayLabelNames = []string{"channel_id", "channel_type", "model", "group", "relay_format"}
+
+// 使用独立的 registry，避免第三方库注册到默认 registry 的指标混入
+var registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Total number of relay requests.",
+	}, append(relayLabelNames, "status_code"))
+
+	relayErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_errors_total",
+		Help:      "Total number of failed relay requests by error code.",
+	}, append(relayLabelNames, "error_code", "status_code"))
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_retries_total",
+		Help:      "Total number of relay retries, labelled by the channel retried on.",
+	}, relayLabelNames)
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Relay request latency in seconds.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, relayLabelNames)
+
+	relayFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_time_to_first_token_seconds",
+		Help:      "Time to first streamed response in seconds.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, relayLabelNames)
+
+	promptTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_prompt_tokens_total",
+		Help:      "Total number of prompt tokens consumed.",
+	}, relayLabelNames)
+
+	completionTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_completion_tokens_total",
+		Help:      "Total number of completion tokens consumed.",
+	}, relayLabelNames)
+
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_quota_consumed_total",
+		Help:      "Total quota consumed.",
+	}, relayLabelNames)
+
+	// InFlightRequests 正在处理中的中转请求数
+	InFlightRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "relay_in_flight_requests",
+		Help:      "Number of relay requests currently being served.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayErrors,
+		relayRetries,
+		relayDuration,
+		relayFirstToken,
+		promptTokens,
+		completionTokens,
+		quotaConsumed,
+		InFlightRequests,
+	)
+}
+
+// RelayLabels 中转请求指标的公共标签
+type RelayLabels struct {
+	ChannelId   int
+	ChannelType int
+	Model       string
+	Group       string
+	RelayFormat string
+}
+
+func (l RelayLabels) values() []string {
+	return []string{strconv.Itoa(l.ChannelId), strconv.Itoa(l.ChannelType), l.Model, l.Group, l.RelayFormat}
+}
+
+// RecordRelayRequest 记录一次中转请求的结果与耗时，errorCode 为空表示请求成功
+// firstToken 为 0 表示非流式请求或未返回任何内容
+func RecordRelayRequest(labels RelayLabels, statusCode int, errorCode string, duration time.Duration, firstToken time.Duration) {
+	values := labels.values()
+	status := strconv.Itoa(statusCode)
+	relayRequests.WithLabelValues(append(values, status)...).Inc()
+	if errorCode != "" {
+		relayErrors.WithLabelValues(append(values, errorCode, status)...).Inc()
+	}
+	relayDuration.WithLabelValues(values...).Observe(duration.Seconds())
+	if firstToken > 0 {
+		relayFirstToken.WithLabelValues(values...).Observe(firstToken.Seconds())
+	}
+}
+
+// RecordRetry 记录一次重试，labels 为重试所使用的渠道
+func RecordRetry(labels RelayLabels) {
+	relayRetries.WithLabelValues(labels.values()...).Inc()
+}
+
+// RecordConsume 记录一次计费的 token 与额度消耗
+func RecordConsume(labels RelayLabels, prompt int, completion int, quota int) {
+	values := labels.values()
+	if prompt > 0 {
+		promptTokens.WithLabelValues(values...).Add(float64(prompt))
+	}
+	if completion > 0 {
+		completionTokens.WithLabelValues(values...).Add(float64(completion))
+	}
+	if quota > 0 {
+		quotaConsumed.WithLabelValues(values...).Add(float64(quota))
+	}
+}
+
+// MustRegister 注册额外的采集器，如渠道状态、数据库连接池等需要在抓取时读取的指标
+func MustRegister(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+// Handler 返回 Prometheus 文本格式的指标输出
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
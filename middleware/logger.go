@@ -2,13 +2,41 @@ package middleware
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/gin-gonic/gin"
 )
 
+type accessLogLine struct {
+	Level string `json:"level"`
+	Time  string `json:"time"`
+	common.LogFields
+	Msg       string  `json:"msg"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	ClientIp  string  `json:"client_ip"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+}
+
 func SetUpLogger(server *gin.Engine) {
 	server.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		if common.LogJSONEnabled {
+			line := accessLogLine{
+				Level:     "info",
+				Time:      param.TimeStamp.Format(time.RFC3339Nano),
+				LogFields: common.LogFieldsFromKeys(param.Keys),
+				Msg:       "request",
+				Status:    param.StatusCode,
+				LatencyMs: float64(param.Latency.Microseconds()) / 1000,
+				ClientIp:  param.ClientIP,
+				Method:    param.Method,
+				Path:      param.Path,
+			}
+			data, _ := common.Marshal(line)
+			return string(data) + "\n"
+		}
 		var requestID string
 		if param.Keys != nil {
 			requestID = param.Keys[common.RequestIdKey].(string)
@@ -167,7 +167,8 @@ func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int)
 func ModelRequestRateLimit() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		// 在每个请求时检查是否启用限流
-		if !setting.ModelRequestRateLimitEnabled {
+		// token 计数请求不计费，由 CountTokensRateLimit 单独限流
+		if !setting.ModelRequestRateLimitEnabled || IsCountTokensRequest(c) {
 			c.Next()
 			return
 		}
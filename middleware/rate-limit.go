@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -53,8 +54,7 @@ func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark st
 		// See: https://stackoverflow.com/questions/50970900/why-is-time-since-returning-negative-durations-on-windows
 		if int64(nowTime.Sub(oldTime).Seconds()) < duration {
 			rdb.Expire(ctx, key, common.RateLimitKeyExpirationDuration)
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
+			abortTooManyRequests(c)
 			return
 		} else {
 			rdb.LPush(ctx, key, time.Now().Format(timeFormat))
@@ -67,12 +67,21 @@ func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark st
 func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
 	key := mark + c.ClientIP()
 	if !inMemoryRateLimiter.Request(key, maxRequestNum, duration) {
-		c.Status(http.StatusTooManyRequests)
-		c.Abort()
+		abortTooManyRequests(c)
 		return
 	}
 }
 
+// abortTooManyRequests Gemini 路由返回 Gemini 原生错误，其余保持无响应体的 429
+func abortTooManyRequests(c *gin.Context) {
+	if isGeminiPath(c.Request.URL.Path) {
+		abortWithGeminiMessage(c, http.StatusTooManyRequests, "请求过于频繁，请稍后再试")
+		return
+	}
+	c.Status(http.StatusTooManyRequests)
+	c.Abort()
+}
+
 func rateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
 	if common.RedisEnabled {
 		return func(c *gin.Context) {
@@ -108,6 +117,27 @@ func CriticalRateLimit() func(c *gin.Context) {
 	return defNext
 }
 
+// CountTokensRateLimit 仅对免费的 token 计数请求生效，其余请求直接放行
+func CountTokensRateLimit() func(c *gin.Context) {
+	if !common.CountTokenRateLimitEnable {
+		return defNext
+	}
+	limiter := rateLimitFactory(common.CountTokenRateLimitNum, common.CountTokenRateLimitDuration, "CK")
+	return func(c *gin.Context) {
+		if !IsCountTokensRequest(c) {
+			c.Next()
+			return
+		}
+		limiter(c)
+	}
+}
+
+// IsCountTokensRequest 判断是否为 Claude 或 Gemini 的 token 计数请求
+func IsCountTokensRequest(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	return strings.HasSuffix(path, "/messages/count_tokens") || strings.HasSuffix(path, ":countTokens")
+}
+
 func DownloadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(common.DownloadRateLimitNum, common.DownloadRateLimitDuration, "DW")
 }
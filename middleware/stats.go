@@ -3,6 +3,8 @@ package middleware
 import (
 	"sync/atomic"
 
+	"github.com/QuantumNous/new-api/metrics"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,10 +20,12 @@ func StatsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 增加活跃连接数
 		atomic.AddInt64(&globalStats.activeConnections, 1)
+		metrics.InFlightRequests.Inc()
 
 		// 确保在请求结束时减少连接数
 		defer func() {
 			atomic.AddInt64(&globalStats.activeConnections, -1)
+			metrics.InFlightRequests.Dec()
 		}()
 
 		c.Next()
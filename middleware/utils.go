@@ -2,13 +2,20 @@ package middleware
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
 )
 
 func abortWithOpenAiMessage(c *gin.Context, statusCode int, message string, code ...string) {
+	// Gemini 路由统一返回 Gemini 原生错误格式，保证 SDK 的错误处理与重试逻辑正常工作
+	if isGeminiPath(c.Request.URL.Path) {
+		abortWithGeminiMessage(c, statusCode, message)
+		return
+	}
 	codeStr := ""
 	if len(code) > 0 {
 		codeStr = code[0]
@@ -25,6 +32,22 @@ func abortWithOpenAiMessage(c *gin.Context, statusCode int, message string, code
 	logger.LogError(c.Request.Context(), fmt.Sprintf("user %d | %s", userId, message))
 }
 
+func abortWithGeminiMessage(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.NewGeminiError(statusCode, common.MessageWithRequestId(message, c.GetString(common.RequestIdKey))),
+	})
+	c.Abort()
+	logger.LogError(c.Request.Context(), fmt.Sprintf("user %d | %s", c.GetInt("id"), message))
+}
+
+// isGeminiPath 判断是否为 Gemini 原生接口：/v1beta/models/... 或 /v1/models/{model}:{action}
+func isGeminiPath(path string) bool {
+	if strings.HasPrefix(path, "/v1beta/models") {
+		return true
+	}
+	return strings.HasPrefix(path, "/v1/models/") && strings.Contains(path, ":")
+}
+
 func abortWithMidjourneyMessage(c *gin.Context, statusCode int, code int, description string) {
 	c.JSON(statusCode, gin.H{
 		"description": description,
@@ -0,0 +1,274 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	AlertTypeChannelErrorRate = "channel_error_rate" // 渠道错误率，Target 为渠道 id，为空时检查所有渠道
+	AlertTypeModelErrorRate   = "model_error_rate"   // 模型错误率，Target 为模型名称，为空时检查所有模型
+	AlertTypeChannelBalance   = "channel_balance"    // 渠道余额低于阈值（美元），Target 为渠道 id，为空时检查所有启用渠道
+	AlertTypeModelNoSuccess   = "model_no_success"   // 模型在时间窗口内没有成功请求，Target 为模型名称
+	AlertTypeUserSpendSpike   = "user_spend_spike"   // 用户消费超过基线的倍数，Target 为用户 id，为空时检查所有用户
+	AlertTypeTaskBacklog      = "task_backlog"       // 未完成任务数超过阈值，Target 为平台，为空时按平台分别检查
+)
+
+const (
+	AlertEventStatusFiring   = "firing"
+	AlertEventStatusResolved = "resolved"
+)
+
+// AlertRule 管理员定义的告警规则，由主节点定期评估
+type AlertRule struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name" gorm:"type:varchar(128)"`
+	Type          string  `json:"type" gorm:"type:varchar(32)"`
+	Target        string  `json:"target" gorm:"type:varchar(128)"`
+	Threshold     float64 `json:"threshold"`                       // 错误率为百分比，余额为美元，消费突增为基线倍数，任务积压为任务数
+	WindowMinutes int     `json:"window_minutes" gorm:"default:5"` // 统计时间窗口
+	MinCount      int     `json:"min_count" gorm:"default:0"`      // 错误率规则的最少请求数，消费突增规则的最少消费额度
+	RepeatMinutes int     `json:"repeat_minutes" gorm:"default:0"` // 持续告警时重复通知的间隔，0 表示只通知一次
+	NotifyUserId  int     `json:"notify_user_id" gorm:"default:0"` // 接收通知的管理员，按其通知设置发送，0 表示超级管理员
+	Status        int     `json:"status" gorm:"default:1"`
+	Remark        string  `json:"remark" gorm:"type:varchar(255)"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+}
+
+// AlertEvent 告警事件，同一规则同一对象同时只有一个未恢复的事件
+type AlertEvent struct {
+	Id             int     `json:"id"`
+	RuleId         int     `json:"rule_id" gorm:"index:idx_alert_event_rule_subject,priority:1"`
+	Subject        string  `json:"subject" gorm:"type:varchar(128);index:idx_alert_event_rule_subject,priority:2"` // 告警对象，如 channel:1
+	Status         string  `json:"status" gorm:"type:varchar(16);index"`
+	Value          float64 `json:"value"`
+	Message        string  `json:"message" gorm:"type:varchar(512)"`
+	FiredAt        int64   `json:"fired_at" gorm:"bigint"`
+	ResolvedAt     int64   `json:"resolved_at" gorm:"bigint"`
+	LastNotifiedAt int64   `json:"last_notified_at" gorm:"bigint"`
+}
+
+func (rule *AlertRule) Validate() error {
+	if rule.Name == "" {
+		return errors.New("规则名称不能为空")
+	}
+	switch rule.Type {
+	case AlertTypeChannelErrorRate, AlertTypeModelErrorRate:
+		if rule.Threshold <= 0 || rule.Threshold > 100 {
+			return errors.New("错误率阈值必须在 0-100 之间")
+		}
+	case AlertTypeModelNoSuccess:
+		if rule.Target == "" {
+			return errors.New("模型名称不能为空")
+		}
+	case AlertTypeChannelBalance, AlertTypeTaskBacklog:
+		if rule.Threshold <= 0 {
+			return errors.New("阈值必须大于 0")
+		}
+	case AlertTypeUserSpendSpike:
+		if rule.Threshold <= 1 {
+			return errors.New("消费突增倍数必须大于 1")
+		}
+	default:
+		return fmt.Errorf("不支持的告警类型: %s", rule.Type)
+	}
+	switch rule.Type {
+	case AlertTypeChannelErrorRate, AlertTypeChannelBalance, AlertTypeUserSpendSpike:
+		if rule.Target != "" {
+			if id, err := strconv.Atoi(rule.Target); err != nil || id <= 0 {
+				return errors.New("目标 id 无效")
+			}
+		}
+	}
+	if rule.WindowMinutes <= 0 {
+		rule.WindowMinutes = 5
+	}
+	if rule.WindowMinutes > 24*60 {
+		return errors.New("统计时间窗口不能超过 24 小时")
+	}
+	if rule.MinCount < 0 || rule.RepeatMinutes < 0 {
+		return errors.New("参数不能为负数")
+	}
+	if rule.Status == 0 {
+		rule.Status = common.AlertRuleStatusEnabled
+	}
+	return nil
+}
+
+func GetAllAlertRules(pageInfo *common.PageInfo) (rules []*AlertRule, total int64, err error) {
+	if err = DB.Model(&AlertRule{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&rules).Error
+	return rules, total, err
+}
+
+func GetEnabledAlertRules() (rules []*AlertRule, err error) {
+	err = DB.Where("status = ?", common.AlertRuleStatusEnabled).Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+func GetAlertRuleById(id int) (*AlertRule, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	rule := &AlertRule{}
+	err := DB.First(rule, "id = ?", id).Error
+	return rule, err
+}
+
+func (rule *AlertRule) Insert() error {
+	rule.CreatedTime = common.GetTimestamp()
+	return DB.Create(rule).Error
+}
+
+func (rule *AlertRule) Update() error {
+	return DB.Model(rule).Select("name", "type", "target", "threshold", "window_minutes", "min_count",
+		"repeat_minutes", "notify_user_id", "status", "remark").Updates(rule).Error
+}
+
+// DeleteAlertRuleById 删除规则并恢复其未恢复的告警事件
+func DeleteAlertRuleById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	if err := DB.Delete(&AlertRule{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	return DB.Model(&AlertEvent{}).Where("rule_id = ? AND status = ?", id, AlertEventStatusFiring).
+		Updates(map[string]interface{}{"status": AlertEventStatusResolved, "resolved_at": common.GetTimestamp()}).Error
+}
+
+var alertEventLock sync.Mutex
+
+// AlertTransition 告警状态变化，需要发送通知
+type AlertTransition struct {
+	Event    *AlertEvent
+	Resolved bool
+	Repeat   bool
+}
+
+// ApplyAlertObservations 根据本次评估中触发告警的对象更新事件：新触发的创建事件，
+// 已不再触发的事件标记恢复，返回需要通知的状态变化
+func ApplyAlertObservations(rule *AlertRule, firing map[string]*AlertEvent) ([]*AlertTransition, error) {
+	alertEventLock.Lock()
+	defer alertEventLock.Unlock()
+
+	var openEvents []*AlertEvent
+	if err := DB.Where("rule_id = ? AND status = ?", rule.Id, AlertEventStatusFiring).Find(&openEvents).Error; err != nil {
+		return nil, err
+	}
+	now := common.GetTimestamp()
+	transitions := make([]*AlertTransition, 0)
+	open := make(map[string]bool, len(openEvents))
+	for _, event := range openEvents {
+		open[event.Subject] = true
+		observation, ok := firing[event.Subject]
+		if !ok {
+			event.Status = AlertEventStatusResolved
+			event.ResolvedAt = now
+			if err := DB.Model(event).Select("status", "resolved_at").Updates(event).Error; err != nil {
+				return transitions, err
+			}
+			transitions = append(transitions, &AlertTransition{Event: event, Resolved: true})
+			continue
+		}
+		event.Value = observation.Value
+		event.Message = observation.Message
+		repeat := rule.RepeatMinutes > 0 && now-event.LastNotifiedAt >= int64(rule.RepeatMinutes)*60
+		if repeat {
+			event.LastNotifiedAt = now
+			transitions = append(transitions, &AlertTransition{Event: event, Repeat: true})
+		}
+		if err := DB.Model(event).Select("value", "message", "last_notified_at").Updates(event).Error; err != nil {
+			return transitions, err
+		}
+	}
+	for subject, observation := range firing {
+		if open[subject] {
+			continue
+		}
+		event := &AlertEvent{
+			RuleId:         rule.Id,
+			Subject:        subject,
+			Status:         AlertEventStatusFiring,
+			Value:          observation.Value,
+			Message:        observation.Message,
+			FiredAt:        now,
+			LastNotifiedAt: now,
+		}
+		if err := DB.Create(event).Error; err != nil {
+			return transitions, err
+		}
+		transitions = append(transitions, &AlertTransition{Event: event})
+	}
+	return transitions, nil
+}
+
+func GetAlertEvents(ruleId int, status string, pageInfo *common.PageInfo) (events []*AlertEvent, total int64, err error) {
+	query := DB.Model(&AlertEvent{})
+	if ruleId != 0 {
+		query = query.Where("rule_id = ?", ruleId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&events).Error
+	return events, total, err
+}
+
+// AlertRequestCount 时间窗口内按渠道或模型统计的成功与失败请求尝试次数
+type AlertRequestCount struct {
+	Key     string `gorm:"column:stat_key"`
+	Success int64
+	Failure int64
+}
+
+// GetAlertRequestStats 统计时间窗口内按渠道或模型汇总的成功与失败请求尝试次数，column 为 channel_id 或 model_name
+func GetAlertRequestStats(column string, since int64, target string) (stats []*AlertRequestCount, err error) {
+	if column != "channel_id" && column != "model_name" {
+		return nil, fmt.Errorf("unsupported column: %s", column)
+	}
+	query := DB.Model(&AlertRequestStat{}).
+		Select(fmt.Sprintf("%s AS stat_key, SUM(request_count - error_count) AS success, SUM(error_count) AS failure", column)).
+		Where("bucket_time >= ?", since-since%60)
+	if target != "" {
+		query = query.Where(column+" = ?", target)
+	}
+	err = query.Group(column).Scan(&stats).Error
+	return stats, err
+}
+
+// AlertSpendStat 用户在时间段内的消费额度
+type AlertSpendStat struct {
+	UserId int
+	Quota  int64
+}
+
+func GetAlertUserSpend(startTime int64, endTime int64, userId int) (stats []*AlertSpendStat, err error) {
+	query := LOG_DB.Model(&Log{}).Select("user_id, SUM(quota) AS quota").
+		Where("created_at >= ? AND created_at < ? AND type = ?", startTime, endTime, LogTypeConsume)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	err = query.Group("user_id").Scan(&stats).Error
+	return stats, err
+}
+
+// GetAlertChannelBalances 返回启用且已查询过余额的渠道，channelId 为 0 时返回全部
+func GetAlertChannelBalances(channelId int) (channels []*Channel, err error) {
+	query := DB.Select("id", "name", "balance", "balance_updated_time").
+		Where("status = ? AND balance_updated_time > 0", common.ChannelStatusEnabled)
+	if channelId != 0 {
+		query = query.Where("id = ?", channelId)
+	}
+	err = query.Find(&channels).Error
+	return channels, err
+}
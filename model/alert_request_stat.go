@@ -0,0 +1,96 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// alertRequestStatRetention 请求计数保留时长，覆盖告警规则的最大时间窗口
+const alertRequestStatRetention = 25 * 3600
+
+// AlertRequestStat 按分钟、渠道、模型汇总的请求尝试次数，供错误率类告警使用，不依赖错误日志是否开启
+type AlertRequestStat struct {
+	Id           int    `json:"id"`
+	BucketTime   int64  `json:"bucket_time" gorm:"bigint;uniqueIndex:idx_ars_bucket_channel_model,priority:1;index"`
+	ChannelId    int    `json:"channel_id" gorm:"uniqueIndex:idx_ars_bucket_channel_model,priority:2"`
+	ModelName    string `json:"model_name" gorm:"size:128;uniqueIndex:idx_ars_bucket_channel_model,priority:3"`
+	RequestCount int64  `json:"request_count" gorm:"bigint;default:0"`
+	ErrorCount   int64  `json:"error_count" gorm:"bigint;default:0"`
+}
+
+var alertRequestStatCache = make(map[string]*AlertRequestStat)
+var alertRequestStatCacheLock sync.Mutex
+
+// RecordAlertRequest 记录一次渠道请求尝试及是否失败
+func RecordAlertRequest(channelId int, modelName string, failed bool) {
+	if channelId == 0 {
+		return
+	}
+	bucketTime := common.GetTimestamp()
+	bucketTime -= bucketTime % 60
+	key := fmt.Sprintf("%d-%d-%s", bucketTime, channelId, modelName)
+
+	alertRequestStatCacheLock.Lock()
+	defer alertRequestStatCacheLock.Unlock()
+	stat, ok := alertRequestStatCache[key]
+	if !ok {
+		stat = &AlertRequestStat{BucketTime: bucketTime, ChannelId: channelId, ModelName: modelName}
+		alertRequestStatCache[key] = stat
+	}
+	stat.RequestCount++
+	if failed {
+		stat.ErrorCount++
+	}
+}
+
+func UpdateAlertRequestStats() {
+	for {
+		time.Sleep(time.Minute)
+		SaveAlertRequestStatCache()
+		if common.IsMasterNode {
+			if err := DB.Where("bucket_time < ?", common.GetTimestamp()-alertRequestStatRetention).Delete(&AlertRequestStat{}).Error; err != nil {
+				common.SysLog(fmt.Sprintf("failed to clean alert request stats: %s", err.Error()))
+			}
+		}
+	}
+}
+
+// SaveAlertRequestStatCache 将内存中的请求计数累加写入数据库
+func SaveAlertRequestStatCache() {
+	alertRequestStatCacheLock.Lock()
+	cache := alertRequestStatCache
+	alertRequestStatCache = make(map[string]*AlertRequestStat)
+	alertRequestStatCacheLock.Unlock()
+
+	for _, stat := range cache {
+		if err := increaseAlertRequestStat(stat); err != nil {
+			common.SysLog(fmt.Sprintf("failed to save alert request stat: %s", err.Error()))
+		}
+	}
+}
+
+func increaseAlertRequestStat(stat *AlertRequestStat) error {
+	query := DB.Model(&AlertRequestStat{}).Where("bucket_time = ? AND channel_id = ? AND model_name = ?",
+		stat.BucketTime, stat.ChannelId, stat.ModelName)
+	increase := func() *gorm.DB {
+		return query.Session(&gorm.Session{}).Updates(map[string]interface{}{
+			"request_count": gorm.Expr("request_count + ?", stat.RequestCount),
+			"error_count":   gorm.Expr("error_count + ?", stat.ErrorCount),
+		})
+	}
+	result := increase()
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	created := *stat
+	if err := DB.Create(&created).Error; err != nil {
+		// 其他节点已插入同一行，改为累加
+		return increase().Error
+	}
+	return nil
+}
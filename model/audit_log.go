@@ -0,0 +1,261 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditActionOptionUpdate          = "option.update"
+	AuditActionChannelCreate         = "channel.create"
+	AuditActionChannelUpdate         = "channel.update"
+	AuditActionChannelDelete         = "channel.delete"
+	AuditActionChannelDeleteBatch    = "channel.delete_batch"
+	AuditActionChannelDeleteDisabled = "channel.delete_disabled"
+	AuditActionChannelKeyView        = "channel.key_view"
+	AuditActionTokenCreate           = "token.create"
+	AuditActionTokenUpdate           = "token.update"
+	AuditActionTokenDelete           = "token.delete"
+	AuditActionUserCreate            = "user.create"
+	AuditActionUserUpdate            = "user.update"
+	AuditActionUserManage            = "user.manage"
+	AuditActionUserDelete            = "user.delete"
+	AuditActionRedemptionCreate      = "redemption.create"
+	AuditActionRedemptionUpdate      = "redemption.update"
+	AuditActionRedemptionDelete      = "redemption.delete"
+	AuditActionTopUpComplete         = "topup.complete"
+)
+
+const (
+	AuditTargetOption     = "option"
+	AuditTargetChannel    = "channel"
+	AuditTargetToken      = "token"
+	AuditTargetUser       = "user"
+	AuditTargetRedemption = "redemption"
+	AuditTargetTopUp      = "topup"
+)
+
+const auditMaskedValue = "******"
+
+// AuditLog 管理员操作审计日志，只允许追加，不允许修改或删除
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64);default:''"`
+	ActorRole  int    `json:"actor_role"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(128);index:idx_audit_target,priority:2"`
+	Diff       string `json:"diff"` // JSON 对象，字段名 -> {"before": 旧值, "after": 新值}，敏感字段已掩码
+}
+
+// AuditChange 单个字段的变更
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+var errAuditLogAppendOnly = errors.New("审计日志只允许追加，不能修改或删除")
+
+func (log *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errAuditLogAppendOnly
+}
+
+func (log *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errAuditLogAppendOnly
+}
+
+// auditSensitiveFields 可能包含凭据的配置字段，如渠道请求头覆盖中的 Authorization、额外设置中带认证信息的代理地址
+var auditSensitiveFields = map[string]bool{
+	"header_override": true,
+	"param_override":  true,
+	"setting":         true,
+	"settings":        true,
+}
+
+// isAuditSensitiveField 判断对象字段是否为密钥类敏感字段
+func isAuditSensitiveField(field string) bool {
+	field = strings.ToLower(field)
+	return auditSensitiveFields[field] || field == "key" || field == "password" || field == "secret" || field == "token" ||
+		strings.HasSuffix(field, "_key") || strings.HasSuffix(field, "_secret") ||
+		strings.HasSuffix(field, "_token") || strings.HasSuffix(field, "_password")
+}
+
+// IsSensitiveOptionKey 判断系统设置项是否为密钥类设置，包括 GetOptions 中隐藏的设置项及
+// discord.client_secret 这类以点分隔的设置项
+func IsSensitiveOptionKey(key string) bool {
+	if strings.HasSuffix(key, "Token") || strings.HasSuffix(key, "Secret") ||
+		strings.HasSuffix(key, "Key") || strings.HasSuffix(key, "Password") {
+		return true
+	}
+	return isAuditSensitiveField(key[strings.LastIndex(key, ".")+1:])
+}
+
+func maskAuditValue(value any) any {
+	if value == nil || value == "" {
+		return value
+	}
+	return auditMaskedValue
+}
+
+// auditFields 将对象转换为字段映射，非对象的值以 value 字段表示
+func auditFields(value any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if value == nil {
+		return fields, nil
+	}
+	data, err := common.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err = common.Unmarshal(data, &fields); err != nil {
+		var raw any
+		if err = common.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		fields = map[string]any{"value": raw}
+	}
+	return fields, nil
+}
+
+// BuildAuditDiff 比较操作前后的对象，返回变更字段，before 或 after 为 nil 时分别表示创建和删除
+func BuildAuditDiff(before any, after any) (map[string]*AuditChange, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+	diff := make(map[string]*AuditChange)
+	for field, value := range beforeFields {
+		diff[field] = &AuditChange{Before: value, After: afterFields[field]}
+	}
+	for field, value := range afterFields {
+		if _, ok := diff[field]; !ok {
+			diff[field] = &AuditChange{Before: nil, After: value}
+		}
+	}
+	for field, change := range diff {
+		if reflect.DeepEqual(change.Before, change.After) {
+			delete(diff, field)
+			continue
+		}
+		if isAuditSensitiveField(field) {
+			change.Before = maskAuditValue(change.Before)
+			change.After = maskAuditValue(change.After)
+		}
+	}
+	return diff, nil
+}
+
+// RecordAuditLog 记录管理员操作，before 与 after 为操作前后的对象，均为 nil 时只记录操作本身
+func RecordAuditLog(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	diff, err := BuildAuditDiff(before, after)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to build audit diff for %s: %s", action, err.Error()))
+		diff = map[string]*AuditChange{}
+	}
+	recordAuditLog(c, action, targetType, fmt.Sprintf("%v", targetId), diff)
+}
+
+// RecordOptionAuditLog 记录系统设置变更，密钥类设置只记录是否变更，不记录具体值
+func RecordOptionAuditLog(c *gin.Context, key string, before string, after string) {
+	change := &AuditChange{Before: before, After: after}
+	if IsSensitiveOptionKey(key) {
+		change.Before = maskAuditValue(before)
+		change.After = maskAuditValue(after)
+	}
+	recordAuditLog(c, AuditActionOptionUpdate, AuditTargetOption, key, map[string]*AuditChange{"value": change})
+}
+
+func recordAuditLog(c *gin.Context, action string, targetType string, targetId string, diff map[string]*AuditChange) {
+	log := &AuditLog{
+		CreatedAt:  common.GetTimestamp(),
+		ActorId:    c.GetInt("id"),
+		ActorName:  c.GetString("username"),
+		ActorRole:  c.GetInt("role"),
+		Ip:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Diff:       common.GetJsonString(diff),
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to record audit log %s: %s", action, err.Error()))
+	}
+}
+
+// AuditLogQuery 审计日志查询条件，零值表示不过滤
+type AuditLogQuery struct {
+	ActorId    int
+	Action     string
+	TargetType string
+	TargetId   string
+	StartTime  int64
+	EndTime    int64
+}
+
+func (query *AuditLogQuery) apply(tx *gorm.DB) *gorm.DB {
+	if query.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", query.ActorId)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action = ?", query.Action)
+	}
+	if query.TargetType != "" {
+		tx = tx.Where("target_type = ?", query.TargetType)
+	}
+	if query.TargetId != "" {
+		tx = tx.Where("target_id = ?", query.TargetId)
+	}
+	if query.StartTime != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTime)
+	}
+	if query.EndTime != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTime)
+	}
+	return tx
+}
+
+func GetAuditLogs(query *AuditLogQuery, pageInfo *common.PageInfo) (logs []*AuditLog, total int64, err error) {
+	tx := query.apply(LOG_DB.Model(&AuditLog{}))
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&logs).Error
+	return logs, total, err
+}
+
+// IterateAuditLogs 按 id 顺序分批读取符合条件的审计日志，用于导出
+func IterateAuditLogs(query *AuditLogQuery, batchSize int, fn func(logs []*AuditLog) error) error {
+	lastId := 0
+	for {
+		var logs []*AuditLog
+		err := query.apply(LOG_DB.Model(&AuditLog{})).Where("id > ?", lastId).
+			Order("id asc").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err = fn(logs); err != nil {
+			return err
+		}
+		lastId = logs[len(logs)-1].Id
+		if len(logs) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch OpenAI Batch API 批处理任务，输入文件中的每一行请求由主节点异步执行
+type Batch struct {
+	Id                int    `json:"id"`
+	BatchId           string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	TokenId           int    `json:"token_id"`
+	UsingGroup        string `json:"group" gorm:"column:using_group;type:varchar(64)"` // 创建时的分组，用于估算预留额度
+	Endpoint          string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId       string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId      string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId       string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow  string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status            string `json:"status" gorm:"type:varchar(16);index"`
+	Errors            string `json:"errors" gorm:"type:text"`   // 校验失败时的错误列表 JSON
+	Metadata          string `json:"metadata" gorm:"type:text"` // 用户自定义元数据 JSON
+	TotalRequests     int    `json:"total_requests"`
+	CompletedRequests int    `json:"completed_requests"`
+	FailedRequests    int    `json:"failed_requests"`
+	ReservedQuota     int    `json:"reserved_quota"` // 尚未释放的预留额度
+	CreatedAt         int64  `json:"created_at" gorm:"bigint"`
+	InProgressAt      int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt         int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt      int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt       int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt          int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt         int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt      int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt       int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+// BatchItem 批处理中单行请求的执行结果，批处理结束并生成结果文件后删除，
+// 用于重启后跳过已执行的请求
+type BatchItem struct {
+	Id           int    `json:"id"`
+	BatchId      string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex:idx_batch_item_line,priority:1"`
+	Line         int    `json:"line" gorm:"uniqueIndex:idx_batch_item_line,priority:2"`
+	CustomId     string `json:"custom_id" gorm:"type:varchar(255)"`
+	StatusCode   int    `json:"status_code"`
+	RequestId    string `json:"request_id" gorm:"type:varchar(64)"`
+	Body         string `json:"body" gorm:"type:text"`
+	ErrorCode    string `json:"error_code" gorm:"type:varchar(64)"`
+	ErrorMessage string `json:"error_message" gorm:"type:text"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint"`
+}
+
+// Succeeded 上游返回 2xx 的请求计入 completed，其余计入 failed
+func (item *BatchItem) Succeeded() bool {
+	return item.StatusCode >= 200 && item.StatusCode < 300
+}
+
+func (batch *Batch) Insert() error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(batch).Error
+}
+
+func GetUserBatch(userId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	batch := &Batch{}
+	err := DB.First(batch, "batch_id = ? AND user_id = ?", batchId, userId).Error
+	return batch, err
+}
+
+func GetBatchByBatchId(batchId string) (*Batch, error) {
+	batch := &Batch{}
+	err := DB.First(batch, "batch_id = ?", batchId).Error
+	return batch, err
+}
+
+// GetUserBatches 按创建时间倒序返回用户的批处理，after 为上一页最后一个批处理的 batch_id
+func GetUserBatches(userId int, after string, limit int) (batches []*Batch, err error) {
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var cursor Batch
+		if err = DB.Select("id").First(&cursor, "batch_id = ? AND user_id = ?", after, userId).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("id < ?", cursor.Id)
+	}
+	err = query.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnfinishedBatches 返回需要后台继续处理的批处理
+func GetUnfinishedBatches() (batches []*Batch, err error) {
+	err = DB.Where("status IN ?", []string{BatchStatusInProgress, BatchStatusCancelling, BatchStatusFinalizing}).
+		Order("id asc").Find(&batches).Error
+	return batches, err
+}
+
+// IsFileUsedByUnfinishedBatch 文件是否为未结束批处理的输入文件
+func IsFileUsedByUnfinishedBatch(fileId string) (bool, error) {
+	var count int64
+	err := DB.Model(&Batch{}).Where("input_file_id = ? AND status IN ?", fileId,
+		[]string{BatchStatusValidating, BatchStatusInProgress, BatchStatusCancelling, BatchStatusFinalizing}).Count(&count).Error
+	return count > 0, err
+}
+
+// GetBatchStatus 只查询批处理状态，用于执行过程中感知取消
+func GetBatchStatus(batchId string) (status string, err error) {
+	err = DB.Model(&Batch{}).Where("batch_id = ?", batchId).Select("status").Find(&status).Error
+	return status, err
+}
+
+// TransitBatchStatus 仅当批处理处于 from 中的某个状态时切换到 to，并更新附带的字段，返回是否切换成功
+func TransitBatchStatus(batchId string, from []string, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for key, value := range fields {
+		updates[key] = value
+	}
+	result := DB.Model(&Batch{}).Where("batch_id = ? AND status IN ?", batchId, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// batchReservingStatuses 预留额度仍可被请求扣减或退回的批处理状态
+var batchReservingStatuses = []string{BatchStatusInProgress, BatchStatusCancelling, BatchStatusFinalizing}
+
+// TakeBatchReservedQuota 从未结束批处理的预留额度中扣减至多 quota，返回实际扣减的额度
+func TakeBatchReservedQuota(batchId string, quota int) (int, error) {
+	return takeReservedQuota(&Batch{}, "batch_id", batchId, batchReservingStatuses, quota)
+}
+
+// ReturnBatchReservedQuota 将额度退回未结束批处理的预留额度，批处理已结束时返回 false
+func ReturnBatchReservedQuota(batchId string, quota int) (bool, error) {
+	return returnReservedQuota(&Batch{}, "batch_id", batchId, batchReservingStatuses, quota)
+}
+
+// GetBatchReservedQuota 返回批处理剩余的预留额度
+func GetBatchReservedQuota(batchId string) (quota int, err error) {
+	err = DB.Model(&Batch{}).Where("batch_id = ?", batchId).Select("reserved_quota").Find(&quota).Error
+	return quota, err
+}
+
+// FinishBatch 将批处理从 from 切换到最终状态并清零预留额度，返回清零前剩余的预留额度，调用方负责退还给用户
+func FinishBatch(batchId string, from []string, to string, fields map[string]interface{}) (int, bool, error) {
+	return finishReservation(&Batch{}, "batch_id", batchId, from, to, fields)
+}
+
+// RecordBatchItem 保存单行请求的执行结果并更新批处理的完成计数
+func RecordBatchItem(item *BatchItem) error {
+	if item.CreatedAt == 0 {
+		item.CreatedAt = common.GetTimestamp()
+	}
+	column := "failed_requests"
+	if item.Succeeded() {
+		column = "completed_requests"
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Batch{}).Where("batch_id = ?", item.BatchId).
+			Update(column, gorm.Expr(column+" + 1")).Error
+	})
+}
+
+// GetBatchItemLines 返回已经执行过的行号
+func GetBatchItemLines(batchId string) (lines []int, err error) {
+	err = DB.Model(&BatchItem{}).Where("batch_id = ?", batchId).Pluck("line", &lines).Error
+	return lines, err
+}
+
+// GetBatchItems 按行号顺序分页返回执行结果
+func GetBatchItems(batchId string, afterLine int, limit int) (items []*BatchItem, err error) {
+	err = DB.Where("batch_id = ? AND line > ?", batchId, afterLine).Order("line asc").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+func DeleteBatchItems(batchId string) error {
+	if batchId == "" {
+		return errors.New("batch_id 为空！")
+	}
+	return DB.Where("batch_id = ?", batchId).Delete(&BatchItem{}).Error
+}
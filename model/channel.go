@@ -1003,3 +1003,15 @@ func CountChannelsGroupByType() (map[int64]int64, error) {
 	}
 	return counts, nil
 }
+
+// ChannelStatusStat 渠道状态，用于监控指标
+type ChannelStatusStat struct {
+	Id     int
+	Type   int
+	Status int
+}
+
+func GetChannelStatusStats() (stats []ChannelStatusStat, err error) {
+	err = DB.Model(&Channel{}).Select("id, type, status").Scan(&stats).Error
+	return stats, err
+}
@@ -0,0 +1,390 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChannelPerformanceBucketSeconds 渠道性能汇总的时间粒度，与数据看板一致按小时汇总
+const ChannelPerformanceBucketSeconds = 3600
+
+// 延迟直方图的桶上界（毫秒），最后一个桶记录超过 300s 的请求
+var channelLatencyBounds = []int64{100, 200, 300, 500, 750, 1000, 1500, 2000, 3000, 5000, 7500,
+	10000, 15000, 20000, 30000, 45000, 60000, 120000, 300000}
+
+// ChannelPerformance 按渠道、模型、小时汇总的真实流量性能数据，延迟以直方图存储以便跨时段合并计算分位数
+type ChannelPerformance struct {
+	Id               int    `json:"id"`
+	ChannelId        int    `json:"channel_id" gorm:"uniqueIndex:idx_cp_channel_model_bucket,priority:1"`
+	ModelName        string `json:"model_name" gorm:"size:128;uniqueIndex:idx_cp_channel_model_bucket,priority:2"`
+	BucketTime       int64  `json:"bucket_time" gorm:"bigint;uniqueIndex:idx_cp_channel_model_bucket,priority:3;index"`
+	RequestCount     int    `json:"request_count" gorm:"default:0"`
+	ErrorCount       int    `json:"error_count" gorm:"default:0"`
+	LatencySumMs     int64  `json:"latency_sum_ms" gorm:"bigint;default:0"`
+	LatencyHistogram string `json:"latency_histogram" gorm:"type:varchar(512)"`
+	TtftCount        int    `json:"ttft_count" gorm:"default:0"`
+	TtftSumMs        int64  `json:"ttft_sum_ms" gorm:"bigint;default:0"`
+	TtftHistogram    string `json:"ttft_histogram" gorm:"type:varchar(512)"`
+	OutputTokens     int64  `json:"output_tokens" gorm:"bigint;default:0"`
+	GenerationMs     int64  `json:"generation_ms" gorm:"bigint;default:0"` // 产生输出 token 的耗时，用于计算输出速度
+}
+
+// ChannelPerformanceStat 渠道性能统计结果
+type ChannelPerformanceStat struct {
+	ChannelId             int     `json:"channel_id"`
+	ChannelName           string  `json:"channel_name,omitempty"`
+	ModelName             string  `json:"model_name"`
+	BucketTime            int64   `json:"bucket_time,omitempty"`
+	RequestCount          int     `json:"request_count"`
+	ErrorCount            int     `json:"error_count"`
+	ErrorRate             float64 `json:"error_rate"`
+	AvgLatencyMs          float64 `json:"avg_latency_ms"`
+	LatencyP50Ms          float64 `json:"latency_p50_ms"`
+	LatencyP95Ms          float64 `json:"latency_p95_ms"`
+	LatencyP99Ms          float64 `json:"latency_p99_ms"`
+	TtftP50Ms             float64 `json:"ttft_p50_ms"`
+	TtftP95Ms             float64 `json:"ttft_p95_ms"`
+	TtftP99Ms             float64 `json:"ttft_p99_ms"`
+	OutputTokensPerSecond float64 `json:"output_tokens_per_second"`
+	Score                 float64 `json:"score,omitempty"`
+	SuggestedWeight       int     `json:"suggested_weight,omitempty"`
+}
+
+type channelPerformanceAcc struct {
+	ChannelPerformance
+	latency []int64
+	ttft    []int64
+}
+
+func newChannelPerformanceAcc(channelId int, modelName string, bucketTime int64) *channelPerformanceAcc {
+	return &channelPerformanceAcc{
+		ChannelPerformance: ChannelPerformance{ChannelId: channelId, ModelName: modelName, BucketTime: bucketTime},
+		latency:            make([]int64, len(channelLatencyBounds)+1),
+		ttft:               make([]int64, len(channelLatencyBounds)+1),
+	}
+}
+
+func (acc *channelPerformanceAcc) merge(p *ChannelPerformance) {
+	acc.RequestCount += p.RequestCount
+	acc.ErrorCount += p.ErrorCount
+	acc.LatencySumMs += p.LatencySumMs
+	acc.TtftCount += p.TtftCount
+	acc.TtftSumMs += p.TtftSumMs
+	acc.OutputTokens += p.OutputTokens
+	acc.GenerationMs += p.GenerationMs
+	addHistogram(acc.latency, p.LatencyHistogram)
+	addHistogram(acc.ttft, p.TtftHistogram)
+}
+
+func (acc *channelPerformanceAcc) toRow() *ChannelPerformance {
+	row := acc.ChannelPerformance
+	row.LatencyHistogram = encodeHistogram(acc.latency)
+	row.TtftHistogram = encodeHistogram(acc.ttft)
+	return &row
+}
+
+func (acc *channelPerformanceAcc) stat() *ChannelPerformanceStat {
+	stat := &ChannelPerformanceStat{
+		ChannelId:    acc.ChannelId,
+		ModelName:    acc.ModelName,
+		RequestCount: acc.RequestCount,
+		ErrorCount:   acc.ErrorCount,
+		LatencyP50Ms: histogramPercentile(acc.latency, 0.5),
+		LatencyP95Ms: histogramPercentile(acc.latency, 0.95),
+		LatencyP99Ms: histogramPercentile(acc.latency, 0.99),
+		TtftP50Ms:    histogramPercentile(acc.ttft, 0.5),
+		TtftP95Ms:    histogramPercentile(acc.ttft, 0.95),
+		TtftP99Ms:    histogramPercentile(acc.ttft, 0.99),
+	}
+	if acc.RequestCount > 0 {
+		stat.ErrorRate = float64(acc.ErrorCount) / float64(acc.RequestCount)
+		stat.AvgLatencyMs = float64(acc.LatencySumMs) / float64(acc.RequestCount)
+	}
+	if acc.GenerationMs > 0 {
+		stat.OutputTokensPerSecond = float64(acc.OutputTokens) * 1000 / float64(acc.GenerationMs)
+	}
+	return stat
+}
+
+func histogramIndex(ms int64) int {
+	return sort.Search(len(channelLatencyBounds), func(i int) bool {
+		return ms <= channelLatencyBounds[i]
+	})
+}
+
+func addHistogram(counts []int64, encoded string) {
+	if encoded == "" {
+		return
+	}
+	for i, part := range strings.Split(encoded, ",") {
+		if i >= len(counts) {
+			break
+		}
+		n, _ := strconv.ParseInt(part, 10, 64)
+		counts[i] += n
+	}
+}
+
+func encodeHistogram(counts []int64) string {
+	parts := make([]string, len(counts))
+	for i, n := range counts {
+		parts[i] = strconv.FormatInt(n, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// histogramPercentile 根据直方图估算分位数，桶内按线性插值
+func histogramPercentile(counts []int64, q float64) float64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var cumulative int64
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if float64(cumulative+n) >= rank {
+			lower := int64(0)
+			if i > 0 {
+				lower = channelLatencyBounds[i-1]
+			}
+			if i >= len(channelLatencyBounds) {
+				return float64(lower)
+			}
+			upper := channelLatencyBounds[i]
+			fraction := (rank - float64(cumulative)) / float64(n)
+			return float64(lower) + fraction*float64(upper-lower)
+		}
+		cumulative += n
+	}
+	return float64(channelLatencyBounds[len(channelLatencyBounds)-1])
+}
+
+var channelPerformanceCache = make(map[string]*channelPerformanceAcc)
+var channelPerformanceCacheLock sync.Mutex
+
+func channelPerformanceEntry(channelId int, modelName string) *channelPerformanceAcc {
+	bucketTime := common.GetTimestamp()
+	bucketTime -= bucketTime % ChannelPerformanceBucketSeconds
+	key := fmt.Sprintf("%d-%s-%d", channelId, modelName, bucketTime)
+	acc, ok := channelPerformanceCache[key]
+	if !ok {
+		acc = newChannelPerformanceAcc(channelId, modelName, bucketTime)
+		channelPerformanceCache[key] = acc
+	}
+	return acc
+}
+
+// RecordChannelAttempt 记录一次渠道请求尝试，ttft 为 0 表示非流式或未返回首字
+func RecordChannelAttempt(channelId int, modelName string, latency time.Duration, ttft time.Duration, failed bool) {
+	if !common.ChannelPerformanceEnabled || channelId == 0 {
+		return
+	}
+	channelPerformanceCacheLock.Lock()
+	defer channelPerformanceCacheLock.Unlock()
+	acc := channelPerformanceEntry(channelId, modelName)
+	acc.RequestCount++
+	if failed {
+		acc.ErrorCount++
+	}
+	latencyMs := latency.Milliseconds()
+	acc.LatencySumMs += latencyMs
+	acc.latency[histogramIndex(latencyMs)]++
+	if ttft > 0 {
+		ttftMs := ttft.Milliseconds()
+		acc.TtftCount++
+		acc.TtftSumMs += ttftMs
+		acc.ttft[histogramIndex(ttftMs)]++
+	}
+}
+
+// recordChannelOutput 根据消费日志记录渠道输出 token 数及生成耗时，流式请求的生成耗时从首字开始计算
+func recordChannelOutput(c *gin.Context, params RecordConsumeLogParams) {
+	if !common.ChannelPerformanceEnabled || params.ChannelId == 0 || params.CompletionTokens <= 0 {
+		return
+	}
+	generationStart := common.GetContextKeyTime(c, constant.ContextKeyRelayAttemptStartTime)
+	if generationStart.IsZero() {
+		return
+	}
+	if params.IsStream {
+		if frt, ok := params.Other["frt"].(float64); ok && frt > 0 {
+			requestStart := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
+			if firstResponse := requestStart.Add(time.Duration(frt) * time.Millisecond); firstResponse.After(generationStart) {
+				generationStart = firstResponse
+			}
+		}
+	}
+	generationMs := time.Since(generationStart).Milliseconds()
+	if generationMs <= 0 {
+		return
+	}
+	channelPerformanceCacheLock.Lock()
+	defer channelPerformanceCacheLock.Unlock()
+	acc := channelPerformanceEntry(params.ChannelId, params.ModelName)
+	acc.OutputTokens += int64(params.CompletionTokens)
+	acc.GenerationMs += generationMs
+}
+
+func UpdateChannelPerformance() {
+	for {
+		time.Sleep(time.Minute)
+		if common.ChannelPerformanceEnabled {
+			SaveChannelPerformanceCache()
+		}
+	}
+}
+
+// SaveChannelPerformanceCache 将内存中的汇总数据合并写入数据库
+func SaveChannelPerformanceCache() {
+	channelPerformanceCacheLock.Lock()
+	cache := channelPerformanceCache
+	channelPerformanceCache = make(map[string]*channelPerformanceAcc)
+	channelPerformanceCacheLock.Unlock()
+
+	for _, acc := range cache {
+		row := acc.toRow()
+		err := saveChannelPerformance(row)
+		if err != nil {
+			// 多节点同时插入同一时段时唯一索引冲突，重试一次合并
+			err = saveChannelPerformance(row)
+		}
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to save channel performance: %s", err.Error()))
+		}
+	}
+}
+
+func saveChannelPerformance(row *ChannelPerformance) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		existing := &ChannelPerformance{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("channel_id = ? AND model_name = ? AND bucket_time = ?", row.ChannelId, row.ModelName, row.BucketTime).
+			First(existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			created := *row
+			return tx.Create(&created).Error
+		}
+		if err != nil {
+			return err
+		}
+		acc := newChannelPerformanceAcc(row.ChannelId, row.ModelName, row.BucketTime)
+		acc.merge(existing)
+		acc.merge(row)
+		merged := acc.toRow()
+		merged.Id = existing.Id
+		return tx.Save(merged).Error
+	})
+}
+
+// GetChannelPerformanceStats 查询时间范围内的渠道性能，byBucket 为 true 时按小时返回时间序列
+func GetChannelPerformanceStats(startTime int64, endTime int64, channelId int, modelName string, byBucket bool) ([]*ChannelPerformanceStat, error) {
+	query := DB.Model(&ChannelPerformance{})
+	if startTime != 0 {
+		query = query.Where("bucket_time >= ?", startTime-startTime%ChannelPerformanceBucketSeconds)
+	}
+	if endTime != 0 {
+		query = query.Where("bucket_time <= ?", endTime)
+	}
+	if channelId != 0 {
+		query = query.Where("channel_id = ?", channelId)
+	}
+	if modelName != "" {
+		query = query.Where("model_name = ?", modelName)
+	}
+	var rows []*ChannelPerformance
+	if err := query.Order("bucket_time asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	accs := make(map[string]*channelPerformanceAcc)
+	keys := make([]string, 0)
+	for _, row := range rows {
+		bucketTime := int64(0)
+		if byBucket {
+			bucketTime = row.BucketTime
+		}
+		key := fmt.Sprintf("%d-%s-%d", row.ChannelId, row.ModelName, bucketTime)
+		acc, ok := accs[key]
+		if !ok {
+			acc = newChannelPerformanceAcc(row.ChannelId, row.ModelName, bucketTime)
+			accs[key] = acc
+			keys = append(keys, key)
+		}
+		acc.merge(row)
+	}
+	stats := make([]*ChannelPerformanceStat, 0, len(keys))
+	for _, key := range keys {
+		stat := accs[key].stat()
+		stat.BucketTime = accs[key].BucketTime
+		stats = append(stats, stat)
+	}
+	fillChannelPerformanceNames(stats)
+	return stats, nil
+}
+
+func fillChannelPerformanceNames(stats []*ChannelPerformanceStat) {
+	ids := make([]int, 0, len(stats))
+	for _, stat := range stats {
+		ids = append(ids, stat.ChannelId)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	var channels []*Channel
+	if err := DB.Select("id", "name").Where("id IN ?", ids).Find(&channels).Error; err != nil {
+		return
+	}
+	names := make(map[int]string, len(channels))
+	for _, channel := range channels {
+		names[channel.Id] = channel.Name
+	}
+	for _, stat := range stats {
+		stat.ChannelName = names[stat.ChannelId]
+	}
+}
+
+// RankChannelPerformance 对指定模型的渠道按成功率与 p95 延迟综合打分排序，并按得分占比给出建议权重（1-100）。
+// 请求数少于 minRequests 的渠道样本不足，不参与排名
+func RankChannelPerformance(startTime int64, endTime int64, modelName string, minRequests int) ([]*ChannelPerformanceStat, error) {
+	stats, err := GetChannelPerformanceStats(startTime, endTime, 0, modelName, false)
+	if err != nil {
+		return nil, err
+	}
+	ranked := make([]*ChannelPerformanceStat, 0, len(stats))
+	maxScore := 0.0
+	for _, stat := range stats {
+		if stat.RequestCount < minRequests {
+			continue
+		}
+		stat.Score = (1 - stat.ErrorRate) / (1 + stat.LatencyP95Ms/1000)
+		maxScore = math.Max(maxScore, stat.Score)
+		ranked = append(ranked, stat)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	for _, stat := range ranked {
+		if maxScore > 0 {
+			stat.SuggestedWeight = int(math.Max(1, math.Round(stat.Score/maxScore*100)))
+		}
+	}
+	return ranked, nil
+}
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CouponTypePercentage = "percentage" // 按充值额度的百分比赠送
+	CouponTypeFixed      = "fixed"      // 赠送固定额度
+)
+
+// Coupon 充值优惠码，在线充值时使用，支付成功后按规则赠送额度
+type Coupon struct {
+	Id            int     `json:"id"`
+	Code          string  `json:"code" gorm:"type:varchar(64);uniqueIndex"`
+	Name          string  `json:"name" gorm:"type:varchar(64)"`
+	Type          string  `json:"type" gorm:"type:varchar(16)"`
+	Value         float64 `json:"value"`                                     // percentage: 赠送百分比，如 20 表示 +20%；fixed: 赠送额度
+	MaxBonusQuota int     `json:"max_bonus_quota" gorm:"type:int;default:0"` // 单笔赠送上限，0 表示不限
+	MinAmount     float64 `json:"min_amount"`                                // 最低充值金额（美元），0 表示不限
+	StartTime     int64   `json:"start_time" gorm:"bigint"`                  // 生效时间，0 表示立即生效
+	EndTime       int64   `json:"end_time" gorm:"bigint"`                    // 失效时间，0 表示不过期
+	MaxUses       int     `json:"max_uses" gorm:"type:int;default:0"`        // 全局可用次数，0 表示不限
+	PerUserLimit  int     `json:"per_user_limit" gorm:"type:int;default:0"`  // 每个用户可用次数，0 表示不限
+	UsedCount     int     `json:"used_count" gorm:"type:int;default:0"`
+	AllowedGroups string  `json:"allowed_groups" gorm:"type:varchar(255)"` // 限定可用的用户分组，逗号分隔，为空表示不限
+	Status        int     `json:"status" gorm:"default:1"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+}
+
+func (coupon *Coupon) Validate() error {
+	coupon.Code = strings.TrimSpace(coupon.Code)
+	if coupon.Code == "" {
+		return errors.New("优惠码不能为空")
+	}
+	if len(coupon.Code) > 64 {
+		return errors.New("优惠码长度不能超过 64")
+	}
+	switch coupon.Type {
+	case CouponTypePercentage:
+		if coupon.Value <= 0 || coupon.Value > 1000 {
+			return errors.New("赠送百分比必须在 0-1000 之间")
+		}
+	case CouponTypeFixed:
+		if coupon.Value <= 0 {
+			return errors.New("赠送额度必须大于 0")
+		}
+	default:
+		return fmt.Errorf("不支持的优惠码类型: %s", coupon.Type)
+	}
+	if coupon.MinAmount < 0 || coupon.MaxUses < 0 || coupon.PerUserLimit < 0 || coupon.MaxBonusQuota < 0 {
+		return errors.New("限制条件不能为负数")
+	}
+	if coupon.EndTime != 0 && coupon.EndTime <= coupon.StartTime {
+		return errors.New("失效时间必须晚于生效时间")
+	}
+	if coupon.Status == 0 {
+		coupon.Status = common.CouponStatusEnabled
+	}
+	return nil
+}
+
+// CalculateBonus 根据充值额度计算赠送额度
+func (coupon *Coupon) CalculateBonus(baseQuota int) int {
+	var bonus int
+	if coupon.Type == CouponTypePercentage {
+		bonus = int(float64(baseQuota) * coupon.Value / 100)
+	} else {
+		bonus = int(coupon.Value)
+	}
+	if coupon.MaxBonusQuota > 0 && bonus > coupon.MaxBonusQuota {
+		bonus = coupon.MaxBonusQuota
+	}
+	return bonus
+}
+
+func (coupon *Coupon) allowGroup(group string) bool {
+	if strings.TrimSpace(coupon.AllowedGroups) == "" {
+		return true
+	}
+	for _, g := range strings.Split(coupon.AllowedGroups, ",") {
+		if strings.TrimSpace(g) == group {
+			return true
+		}
+	}
+	return false
+}
+
+func countUserCouponUsage(tx *gorm.DB, couponCode string, userId int) (int64, error) {
+	var count int64
+	err := tx.Model(&TopUp{}).Where("user_id = ? AND coupon_code = ? AND status = ?", userId, couponCode, common.TopUpStatusSuccess).Count(&count).Error
+	return count, err
+}
+
+// CheckCoupon 创建充值订单时校验优惠码，返回优惠码及本次可赠送的额度
+// 次数限制在支付成功发放时会再次校验
+func CheckCoupon(code string, userId int, group string, baseQuota int) (*Coupon, int, error) {
+	code = strings.TrimSpace(code)
+	coupon := &Coupon{}
+	if err := DB.Where("code = ?", code).First(coupon).Error; err != nil {
+		return nil, 0, errors.New("优惠码不存在")
+	}
+	if coupon.Status != common.CouponStatusEnabled {
+		return nil, 0, errors.New("优惠码已停用")
+	}
+	now := common.GetTimestamp()
+	if coupon.StartTime != 0 && now < coupon.StartTime {
+		return nil, 0, errors.New("优惠码尚未生效")
+	}
+	if coupon.EndTime != 0 && now > coupon.EndTime {
+		return nil, 0, errors.New("优惠码已过期")
+	}
+	if !coupon.allowGroup(group) {
+		return nil, 0, errors.New("当前分组不可使用该优惠码")
+	}
+	if coupon.MinAmount > 0 && float64(baseQuota) < coupon.MinAmount*common.QuotaPerUnit {
+		return nil, 0, fmt.Errorf("充值金额需达到 %s 才能使用该优惠码", logger.FormatQuota(int(coupon.MinAmount*common.QuotaPerUnit)))
+	}
+	if coupon.MaxUses > 0 && coupon.UsedCount >= coupon.MaxUses {
+		return nil, 0, errors.New("优惠码已被领完")
+	}
+	if coupon.PerUserLimit > 0 {
+		count, err := countUserCouponUsage(DB, coupon.Code, userId)
+		if err != nil {
+			return nil, 0, err
+		}
+		if count >= int64(coupon.PerUserLimit) {
+			return nil, 0, errors.New("已达到该优惠码的使用次数上限")
+		}
+	}
+	bonus := coupon.CalculateBonus(baseQuota)
+	if bonus <= 0 {
+		return nil, 0, errors.New("充值金额过低，无法使用该优惠码")
+	}
+	return coupon, bonus, nil
+}
+
+// applyTopUpCoupon 在充值事务中核销订单上的优惠码，返回实际赠送的额度
+// 若支付完成时优惠码次数已用完，则不再赠送，并清除订单上的赠送额度
+func applyTopUpCoupon(tx *gorm.DB, topUp *TopUp) (int, error) {
+	if topUp.CouponCode == "" || topUp.BonusQuota <= 0 {
+		return 0, nil
+	}
+	coupon := &Coupon{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", topUp.CouponCode).First(coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			topUp.BonusQuota = 0
+			return 0, nil
+		}
+		return 0, err
+	}
+	if coupon.MaxUses > 0 && coupon.UsedCount >= coupon.MaxUses {
+		topUp.BonusQuota = 0
+		return 0, nil
+	}
+	if coupon.PerUserLimit > 0 {
+		count, err := countUserCouponUsage(tx.Where("id <> ?", topUp.Id), coupon.Code, topUp.UserId)
+		if err != nil {
+			return 0, err
+		}
+		if count >= int64(coupon.PerUserLimit) {
+			topUp.BonusQuota = 0
+			return 0, nil
+		}
+	}
+	// 以剩余次数为条件核销，不支持行锁的数据库上并发充值也不会超出总次数
+	result := tx.Model(&Coupon{}).Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", coupon.Id).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		topUp.BonusQuota = 0
+		return 0, nil
+	}
+	return topUp.BonusQuota, nil
+}
+
+func couponBonusLogSuffix(topUp *TopUp, bonus int) string {
+	if bonus <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("，优惠码 %s 赠送额度: %s", topUp.CouponCode, logger.LogQuota(bonus))
+}
+
+func GetAllCoupons(pageInfo *common.PageInfo) (coupons []*Coupon, total int64, err error) {
+	if err = DB.Model(&Coupon{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&coupons).Error
+	return coupons, total, err
+}
+
+func GetCouponById(id int) (*Coupon, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	coupon := &Coupon{}
+	err := DB.First(coupon, "id = ?", id).Error
+	return coupon, err
+}
+
+func (coupon *Coupon) Insert() error {
+	coupon.CreatedTime = common.GetTimestamp()
+	return DB.Create(coupon).Error
+}
+
+// Update 更新优惠码规则，已使用次数不可修改
+func (coupon *Coupon) Update() error {
+	return DB.Model(coupon).Select("code", "name", "type", "value", "max_bonus_quota", "min_amount", "start_time", "end_time",
+		"max_uses", "per_user_limit", "allowed_groups", "status").Updates(coupon).Error
+}
+
+func DeleteCouponById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Delete(&Coupon{}, "id = ?", id).Error
+}
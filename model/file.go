@@ -0,0 +1,91 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// File 通过 /v1/files 上传或由批处理生成的文件，文件内容保存在文件存储中
+type File struct {
+	Id        int    `json:"id"`
+	FileId    string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id" gorm:"index"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32)"`
+	Filename  string `json:"filename" gorm:"type:varchar(255)"`
+	Bytes     int64  `json:"bytes" gorm:"bigint"`
+	Storage   string `json:"storage" gorm:"type:varchar(16)"` // local / s3
+	ObjectKey string `json:"object_key" gorm:"type:varchar(255)"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint;default:0"` // 0 表示不过期
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(file).Error
+}
+
+// userFileQuery 按用户及令牌筛选文件，tokenId 为 0 时不按令牌筛选
+func userFileQuery(userId int, tokenId int) *gorm.DB {
+	query := DB.Model(&File{}).Where("user_id = ?", userId)
+	if tokenId != 0 {
+		query = query.Where("token_id = ?", tokenId)
+	}
+	return query
+}
+
+// GetUserFile 返回用户的文件，文件不存在或不属于该用户（及令牌）时返回 gorm.ErrRecordNotFound
+func GetUserFile(userId int, tokenId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	file := &File{}
+	err := userFileQuery(userId, tokenId).Where("file_id = ?", fileId).First(file).Error
+	return file, err
+}
+
+// GetUserFiles 按创建时间倒序返回用户的文件，after 为上一页最后一个文件的 file_id
+func GetUserFiles(userId int, tokenId int, purpose string, after string, limit int) (files []*File, err error) {
+	query := userFileQuery(userId, tokenId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var cursor File
+		if err = userFileQuery(userId, tokenId).Select("id").Where("file_id = ?", after).First(&cursor).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("id < ?", cursor.Id)
+	}
+	err = query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// GetUserFileBytes 返回用户所有文件占用的存储空间
+func GetUserFileBytes(userId int) (total int64, err error) {
+	err = DB.Model(&File{}).Where("user_id = ?", userId).Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error
+	return total, err
+}
+
+// GetExpiredFiles 返回 timestamp 之前已过期的文件
+func GetExpiredFiles(timestamp int64, limit int) (files []*File, err error) {
+	err = DB.Where("expires_at > 0 AND expires_at < ?", timestamp).Order("id asc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteFile(file *File) error {
+	if file.Id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Delete(file).Error
+}
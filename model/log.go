@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/metrics"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -154,6 +156,15 @@ type RecordConsumeLogParams struct {
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	metrics.RecordConsume(metrics.RelayLabels{
+		ChannelId:   params.ChannelId,
+		ChannelType: common.GetContextKeyInt(c, constant.ContextKeyChannelType),
+		Model:       params.ModelName,
+		Group:       params.Group,
+		RelayFormat: common.GetContextKeyString(c, constant.ContextKeyRelayFormat),
+	}, params.PromptTokens, params.CompletionTokens, params.Quota)
+	recordChannelOutput(c, params)
+	recordConsumeUsage(c, userId, params)
 	if !common.LogConsumeEnabled {
 		return
 	}
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// LogArchive 日志归档记录，每个归档文件对应一天内的一批日志，存放在日志库
+type LogArchive struct {
+	Id          int    `json:"id"`
+	Day         string `json:"day" gorm:"type:varchar(10);index"` // 归档日期 2006-01-02
+	Storage     string `json:"storage" gorm:"type:varchar(16)"`   // local / s3
+	ObjectKey   string `json:"object_key" gorm:"type:varchar(255)"`
+	RowCount    int64  `json:"row_count"`
+	MinId       int    `json:"min_id"`
+	MaxId       int    `json:"max_id"`
+	StartTime   int64  `json:"start_time" gorm:"bigint"`
+	EndTime     int64  `json:"end_time" gorm:"bigint"`
+	SizeBytes   int64  `json:"size_bytes" gorm:"bigint"`
+	Checksum    string `json:"checksum" gorm:"type:varchar(64)"` // 压缩文件的 sha256
+	RestoredAt  int64  `json:"restored_at" gorm:"bigint"`        // 最近一次重新导入时间，0 表示未导入
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// RestoredLog 从归档重新导入的日志，单独存放以免影响 logs 表及下一次归档
+type RestoredLog struct {
+	Id               int    `json:"id"`
+	ArchiveId        int    `json:"archive_id" gorm:"index"`
+	LogId            int    `json:"log_id"`
+	UserId           int    `json:"user_id"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+	Type             int    `json:"type"`
+	Content          string `json:"content"`
+	Username         string `json:"username" gorm:"default:''"`
+	TokenName        string `json:"token_name" gorm:"default:''"`
+	ModelName        string `json:"model_name" gorm:"default:''"`
+	Quota            int    `json:"quota" gorm:"default:0"`
+	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
+	UseTime          int    `json:"use_time" gorm:"default:0"`
+	IsStream         bool   `json:"is_stream"`
+	ChannelId        int    `json:"channel"`
+	TokenId          int    `json:"token_id" gorm:"default:0"`
+	Group            string `json:"group"`
+	Ip               string `json:"ip" gorm:"default:''"`
+	Other            string `json:"other"`
+}
+
+func (archive *LogArchive) Insert() error {
+	archive.CreatedTime = common.GetTimestamp()
+	return LOG_DB.Create(archive).Error
+}
+
+func GetLogArchives(day string, pageInfo *common.PageInfo) (archives []*LogArchive, total int64, err error) {
+	query := LOG_DB.Model(&LogArchive{})
+	if day != "" {
+		query = query.Where("day = ?", day)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&archives).Error
+	return archives, total, err
+}
+
+func GetLogArchiveById(id int) (*LogArchive, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	archive := &LogArchive{}
+	err := LOG_DB.First(archive, "id = ?", id).Error
+	return archive, err
+}
+
+// GetOldestLogTimestamp 返回早于 before 的最早一条日志时间，没有日志时返回 0
+func GetOldestLogTimestamp(before int64) (int64, error) {
+	var oldest *int64
+	err := LOG_DB.Model(&Log{}).Where("created_at < ?", before).Select("MIN(created_at)").Scan(&oldest).Error
+	if err != nil || oldest == nil {
+		return 0, err
+	}
+	return *oldest, nil
+}
+
+// IterateLogs 按 id 顺序分批读取 [startTime, endTime) 内的日志，maxId 之后写入的日志不在本次范围内
+func IterateLogs(ctx context.Context, startTime int64, endTime int64, maxId int, batchSize int, fn func(logs []*Log) error) error {
+	lastId := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var logs []*Log
+		err := LOG_DB.Where("created_at >= ? AND created_at < ? AND id > ? AND id <= ?", startTime, endTime, lastId, maxId).
+			Order("id asc").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err = fn(logs); err != nil {
+			return err
+		}
+		lastId = logs[len(logs)-1].Id
+		if len(logs) < batchSize {
+			return nil
+		}
+	}
+}
+
+// GetMaxLogId 返回 [startTime, endTime) 内日志的最大 id，用于确定归档范围
+func GetMaxLogId(startTime int64, endTime int64) (int, error) {
+	var maxId *int
+	err := LOG_DB.Model(&Log{}).Where("created_at >= ? AND created_at < ?", startTime, endTime).
+		Select("MAX(id)").Scan(&maxId).Error
+	if err != nil || maxId == nil {
+		return 0, err
+	}
+	return *maxId, nil
+}
+
+// DeleteArchivedLogs 删除已归档的日志，仅删除归档范围（时间段及最大 id）内的日志
+func DeleteArchivedLogs(ctx context.Context, startTime int64, endTime int64, maxId int, limit int) (int64, error) {
+	var total int64 = 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		var ids []int
+		err := LOG_DB.Model(&Log{}).Where("created_at >= ? AND created_at < ? AND id <= ?", startTime, endTime, maxId).
+			Limit(limit).Pluck("id", &ids).Error
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		result := LOG_DB.Where("id IN ?", ids).Delete(&Log{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < limit {
+			break
+		}
+	}
+	return total, nil
+}
+
+// RestoreLogs 将归档中的日志写入 restored_logs 表，重复导入时先清除该归档已导入的数据
+func RestoreLogs(archiveId int, logs []*Log, replace bool) error {
+	if replace {
+		if err := DeleteRestoredLogs(archiveId); err != nil {
+			return err
+		}
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	restored := make([]*RestoredLog, 0, len(logs))
+	for _, log := range logs {
+		restored = append(restored, &RestoredLog{
+			ArchiveId:        archiveId,
+			LogId:            log.Id,
+			UserId:           log.UserId,
+			CreatedAt:        log.CreatedAt,
+			Type:             log.Type,
+			Content:          log.Content,
+			Username:         log.Username,
+			TokenName:        log.TokenName,
+			ModelName:        log.ModelName,
+			Quota:            log.Quota,
+			PromptTokens:     log.PromptTokens,
+			CompletionTokens: log.CompletionTokens,
+			UseTime:          log.UseTime,
+			IsStream:         log.IsStream,
+			ChannelId:        log.ChannelId,
+			TokenId:          log.TokenId,
+			Group:            log.Group,
+			Ip:               log.Ip,
+			Other:            log.Other,
+		})
+	}
+	return LOG_DB.CreateInBatches(restored, 500).Error
+}
+
+func MarkLogArchiveRestored(archiveId int, restoredAt int64) error {
+	return LOG_DB.Model(&LogArchive{}).Where("id = ?", archiveId).Update("restored_at", restoredAt).Error
+}
+
+func GetRestoredLogs(archiveId int, pageInfo *common.PageInfo) (logs []*RestoredLog, total int64, err error) {
+	query := LOG_DB.Model(&RestoredLog{}).Where("archive_id = ?", archiveId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("log_id asc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&logs).Error
+	return logs, total, err
+}
+
+func DeleteRestoredLogs(archiveId int) error {
+	if err := LOG_DB.Where("archive_id = ?", archiveId).Delete(&RestoredLog{}).Error; err != nil {
+		return err
+	}
+	return MarkLogArchiveRestored(archiveId, 0)
+}
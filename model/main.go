@@ -264,6 +264,26 @@ func migrateDB() error {
 		&Model{},
 		&Vendor{},
 		&PrefillGroup{},
+		&PriceOverride{},
+		&SubscriptionPlan{},
+		&Subscription{},
+		&SubscriptionAllowanceUsage{},
+		&Coupon{},
+		&RedemptionRecord{},
+		&QuotaLedger{},
+		&PayloadCaptureRule{},
+		&ChannelPerformance{},
+		&UsageStat{},
+		&AlertRule{},
+		&AlertEvent{},
+		&AlertRequestStat{},
+		&StatusProbe{},
+		&StatusIncident{},
+		&File{},
+		&Batch{},
+		&BatchItem{},
+		&StoredResponse{},
+		&ResponseEvent{},
 		&Setup{},
 		&TwoFA{},
 		&TwoFABackupCode{},
@@ -297,6 +317,26 @@ func migrateDBFast() error {
 		{&Model{}, "Model"},
 		{&Vendor{}, "Vendor"},
 		{&PrefillGroup{}, "PrefillGroup"},
+		{&PriceOverride{}, "PriceOverride"},
+		{&SubscriptionPlan{}, "SubscriptionPlan"},
+		{&Subscription{}, "Subscription"},
+		{&SubscriptionAllowanceUsage{}, "SubscriptionAllowanceUsage"},
+		{&Coupon{}, "Coupon"},
+		{&RedemptionRecord{}, "RedemptionRecord"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&PayloadCaptureRule{}, "PayloadCaptureRule"},
+		{&ChannelPerformance{}, "ChannelPerformance"},
+		{&UsageStat{}, "UsageStat"},
+		{&AlertRule{}, "AlertRule"},
+		{&AlertEvent{}, "AlertEvent"},
+		{&AlertRequestStat{}, "AlertRequestStat"},
+		{&StatusProbe{}, "StatusProbe"},
+		{&StatusIncident{}, "StatusIncident"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&BatchItem{}, "BatchItem"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&ResponseEvent{}, "ResponseEvent"},
 		{&Setup{}, "Setup"},
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
@@ -330,7 +370,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &PayloadCapture{}, &LogArchive{}, &RestoredLog{}, &AuditLog{}); err != nil {
 		return err
 	}
 	return nil
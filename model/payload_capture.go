@@ -0,0 +1,275 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PayloadCaptureScopeUser    = "user"
+	PayloadCaptureScopeToken   = "token"
+	PayloadCaptureScopeChannel = "channel"
+	PayloadCaptureScopeModel   = "model"
+)
+
+const (
+	payloadCaptureMaxWindowSeconds = 7 * 24 * 3600 // 规则最长生效 7 天
+	payloadCaptureMaxRetentionHour = 7 * 24        // 采集数据最长保留 7 天
+)
+
+// PayloadCaptureRule 请求/响应内容采集规则，用于排查问题，命中规则的请求按采样率采集
+type PayloadCaptureRule struct {
+	Id             int     `json:"id"`
+	Scope          string  `json:"scope" gorm:"type:varchar(16)"`
+	Target         string  `json:"target" gorm:"type:varchar(128)"`        // 用户 / 令牌 / 渠道 id 或模型名称
+	SampleRate     float64 `json:"sample_rate"`                            // 采样率 0-1
+	MaxCaptures    int     `json:"max_captures" gorm:"type:int;default:0"` // 最多采集次数，0 表示不限
+	CapturedCount  int     `json:"captured_count" gorm:"type:int;default:0"`
+	EndTime        int64   `json:"end_time" gorm:"bigint;index"`               // 规则失效时间
+	RetentionHours int     `json:"retention_hours" gorm:"type:int;default:24"` // 采集数据保留时长
+	Status         int     `json:"status" gorm:"default:1"`
+	Remark         string  `json:"remark" gorm:"type:varchar(255)"`
+	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
+}
+
+// PayloadCapture 采集到的请求内容，每次尝试（含重试）一条记录，存放在日志库，过期后自动清理
+type PayloadCapture struct {
+	Id                  int    `json:"id"`
+	RequestId           string `json:"request_id" gorm:"type:varchar(64);index"`
+	RuleId              int    `json:"rule_id" gorm:"index"`
+	Attempt             int    `json:"attempt"`
+	UserId              int    `json:"user_id" gorm:"index"`
+	TokenId             int    `json:"token_id"`
+	ChannelId           int    `json:"channel_id"`
+	ModelName           string `json:"model_name" gorm:"type:varchar(128)"`
+	InboundRequest      string `json:"inbound_request" gorm:"type:text"` // 客户端原始请求，仅首次尝试记录
+	UpstreamUrl         string `json:"upstream_url" gorm:"type:varchar(512)"`
+	UpstreamRequest     string `json:"upstream_request" gorm:"type:text"` // 转换及参数覆盖后发往上游的请求
+	StatusCode          int    `json:"status_code"`
+	UpstreamResponse    string `json:"upstream_response" gorm:"type:text"`
+	ReassembledResponse string `json:"reassembled_response" gorm:"type:text"` // 流式响应拼接后的文本
+	Truncated           bool   `json:"truncated"`
+	CreatedTime         int64  `json:"created_time" gorm:"bigint"`
+	ExpiresAt           int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (rule *PayloadCaptureRule) Validate() error {
+	switch rule.Scope {
+	case PayloadCaptureScopeUser, PayloadCaptureScopeToken, PayloadCaptureScopeChannel:
+		if id, err := strconv.Atoi(rule.Target); err != nil || id <= 0 {
+			return errors.New("目标 id 无效")
+		}
+	case PayloadCaptureScopeModel:
+		if rule.Target == "" {
+			return errors.New("模型名称不能为空")
+		}
+	default:
+		return fmt.Errorf("不支持的采集范围: %s", rule.Scope)
+	}
+	if rule.SampleRate <= 0 || rule.SampleRate > 1 {
+		return errors.New("采样率必须在 0-1 之间")
+	}
+	if rule.MaxCaptures < 0 {
+		return errors.New("最多采集次数不能为负数")
+	}
+	now := common.GetTimestamp()
+	if rule.EndTime <= now || rule.EndTime > now+payloadCaptureMaxWindowSeconds {
+		return errors.New("失效时间必须在 7 天以内")
+	}
+	if rule.RetentionHours == 0 {
+		rule.RetentionHours = 24
+	}
+	if rule.RetentionHours < 0 || rule.RetentionHours > payloadCaptureMaxRetentionHour {
+		return errors.New("保留时长必须在 1-168 小时之间")
+	}
+	if rule.Status == 0 {
+		rule.Status = common.PayloadCaptureRuleStatusEnabled
+	}
+	return nil
+}
+
+func (rule *PayloadCaptureRule) match(userId int, tokenId int, channelId int, modelName string) bool {
+	switch rule.Scope {
+	case PayloadCaptureScopeUser:
+		return rule.Target == strconv.Itoa(userId)
+	case PayloadCaptureScopeToken:
+		return rule.Target == strconv.Itoa(tokenId)
+	case PayloadCaptureScopeChannel:
+		return rule.Target == strconv.Itoa(channelId)
+	case PayloadCaptureScopeModel:
+		return rule.Target == modelName
+	}
+	return false
+}
+
+var activePayloadCaptureRules []*PayloadCaptureRule
+var payloadCaptureRuleSyncLock sync.RWMutex
+
+func loadActivePayloadCaptureRules() ([]*PayloadCaptureRule, error) {
+	var rules []*PayloadCaptureRule
+	err := DB.Where("status = ? AND end_time > ?", common.PayloadCaptureRuleStatusEnabled, common.GetTimestamp()).
+		Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+func InitPayloadCaptureRuleCache() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	rules, err := loadActivePayloadCaptureRules()
+	if err != nil {
+		common.SysLog("failed to sync payload capture rules: " + err.Error())
+		return
+	}
+	payloadCaptureRuleSyncLock.Lock()
+	activePayloadCaptureRules = rules
+	payloadCaptureRuleSyncLock.Unlock()
+}
+
+func SyncPayloadCaptureRuleCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		InitPayloadCaptureRuleCache()
+	}
+}
+
+// MatchPayloadCaptureRules 返回与请求匹配且仍在生效期内的采集规则
+func MatchPayloadCaptureRules(userId int, tokenId int, channelId int, modelName string) []*PayloadCaptureRule {
+	var rules []*PayloadCaptureRule
+	if common.MemoryCacheEnabled {
+		payloadCaptureRuleSyncLock.RLock()
+		rules = activePayloadCaptureRules
+		payloadCaptureRuleSyncLock.RUnlock()
+	} else {
+		var err error
+		if rules, err = loadActivePayloadCaptureRules(); err != nil {
+			common.SysLog("failed to get payload capture rules: " + err.Error())
+			return nil
+		}
+	}
+	now := common.GetTimestamp()
+	matched := make([]*PayloadCaptureRule, 0)
+	for _, rule := range rules {
+		if rule.EndTime > now && rule.match(userId, tokenId, channelId, modelName) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// TakePayloadCaptureQuota 占用规则的一次采集次数，已达上限时返回 false
+func TakePayloadCaptureQuota(ruleId int) (bool, error) {
+	result := DB.Model(&PayloadCaptureRule{}).
+		Where("id = ? AND status = ? AND end_time > ? AND (max_captures = 0 OR captured_count < max_captures)",
+			ruleId, common.PayloadCaptureRuleStatusEnabled, common.GetTimestamp()).
+		Update("captured_count", gorm.Expr("captured_count + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func SavePayloadCaptures(captures []*PayloadCapture) error {
+	if len(captures) == 0 {
+		return nil
+	}
+	return LOG_DB.Create(&captures).Error
+}
+
+func GetPayloadCapturesByRequestId(requestId string) (captures []*PayloadCapture, err error) {
+	err = LOG_DB.Where("request_id = ? AND expires_at > ?", requestId, common.GetTimestamp()).
+		Order("attempt asc").Find(&captures).Error
+	return captures, err
+}
+
+// GetPayloadCaptures 分页查询采集记录，列表中不返回内容字段
+func GetPayloadCaptures(ruleId int, userId int, pageInfo *common.PageInfo) (captures []*PayloadCapture, total int64, err error) {
+	query := LOG_DB.Model(&PayloadCapture{}).Where("expires_at > ?", common.GetTimestamp())
+	if ruleId != 0 {
+		query = query.Where("rule_id = ?", ruleId)
+	}
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Omit("inbound_request", "upstream_request", "upstream_response", "reassembled_response").
+		Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&captures).Error
+	return captures, total, err
+}
+
+// DeleteExpiredPayloadCaptures 删除已过期的采集记录
+func DeleteExpiredPayloadCaptures() (int64, error) {
+	result := LOG_DB.Where("expires_at <= ?", common.GetTimestamp()).Delete(&PayloadCapture{})
+	return result.RowsAffected, result.Error
+}
+
+func AutomaticallyCleanPayloadCaptures(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		count, err := DeleteExpiredPayloadCaptures()
+		if err != nil {
+			common.SysLog("failed to delete expired payload captures: " + err.Error())
+			continue
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("deleted %d expired payload captures", count))
+		}
+	}
+}
+
+func GetAllPayloadCaptureRules(pageInfo *common.PageInfo) (rules []*PayloadCaptureRule, total int64, err error) {
+	if err = DB.Model(&PayloadCaptureRule{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&rules).Error
+	return rules, total, err
+}
+
+func GetPayloadCaptureRuleById(id int) (*PayloadCaptureRule, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	rule := &PayloadCaptureRule{}
+	err := DB.First(rule, "id = ?", id).Error
+	return rule, err
+}
+
+func (rule *PayloadCaptureRule) Insert() error {
+	rule.CreatedTime = common.GetTimestamp()
+	if err := DB.Create(rule).Error; err != nil {
+		return err
+	}
+	InitPayloadCaptureRuleCache()
+	return nil
+}
+
+// Update 更新采集规则，已采集次数不可修改
+func (rule *PayloadCaptureRule) Update() error {
+	err := DB.Model(rule).Select("scope", "target", "sample_rate", "max_captures", "end_time", "retention_hours",
+		"status", "remark").Updates(rule).Error
+	if err != nil {
+		return err
+	}
+	InitPayloadCaptureRuleCache()
+	return nil
+}
+
+func DeletePayloadCaptureRuleById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	if err := DB.Delete(&PayloadCaptureRule{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	InitPayloadCaptureRuleCache()
+	return nil
+}
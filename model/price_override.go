@@ -0,0 +1,208 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"gorm.io/gorm"
+)
+
+// PriceOverride 用户或令牌级别的自定义价格规则
+// TokenId 为 0 表示对该用户的所有令牌生效；不为 0 时仅对指定令牌生效，且优先于用户级规则。
+// Model 支持 * 通配符，例如 claude-*、*-thinking。
+// Type 为 ratio 时 Value 替换分组倍率；为 price 时 Value 为按次计费的固定价格（美元）。
+type PriceOverride struct {
+	Id          int     `json:"id"`
+	UserId      int     `json:"user_id" gorm:"index"`
+	TokenId     int     `json:"token_id" gorm:"index;default:0"`
+	Model       string  `json:"model" gorm:"type:varchar(255);not null"`
+	Type        string  `json:"type" gorm:"type:varchar(16);not null"`
+	Value       float64 `json:"value"`
+	Remark      string  `json:"remark,omitempty" gorm:"type:varchar(255)"`
+	CreatedTime int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64   `json:"updated_time" gorm:"bigint"`
+}
+
+var user2PriceOverrides = make(map[int][]*PriceOverride)
+var priceOverrideSyncLock sync.RWMutex
+
+func (o *PriceOverride) Validate() error {
+	o.Model = strings.TrimSpace(o.Model)
+	if o.Model == "" {
+		return errors.New("模型名称不能为空")
+	}
+	if o.Type != types.PriceOverrideTypeRatio && o.Type != types.PriceOverrideTypePrice {
+		return fmt.Errorf("无效的价格规则类型: %s", o.Type)
+	}
+	if o.Value < 0 {
+		return errors.New("倍率或价格不能为负数")
+	}
+	return nil
+}
+
+func (o *PriceOverride) ToInfo() *types.PriceOverrideInfo {
+	scope := types.PriceOverrideScopeUser
+	if o.TokenId != 0 {
+		scope = types.PriceOverrideScopeToken
+	}
+	return &types.PriceOverrideInfo{
+		Id:    o.Id,
+		Scope: scope,
+		Model: o.Model,
+		Type:  o.Type,
+		Value: o.Value,
+	}
+}
+
+// MatchPriceOverrideModel 判断模型名称是否匹配规则，返回匹配的精确程度，数值越大越精确
+func MatchPriceOverrideModel(pattern string, modelName string) (bool, int) {
+	if pattern == modelName {
+		return true, len(pattern) + 1<<16
+	}
+	if !strings.Contains(pattern, "*") {
+		return false, 0
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(modelName, parts[0]) {
+		return false, 0
+	}
+	rest := modelName[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false, 0
+		}
+		rest = rest[idx+len(part):]
+	}
+	if len(rest) < len(last) || !strings.HasSuffix(rest, last) {
+		return false, 0
+	}
+	return true, len(pattern) - strings.Count(pattern, "*")
+}
+
+// SelectPriceOverride 从规则列表中选出生效的规则：令牌级规则优先于用户级规则，同级内精确匹配优先于通配匹配
+func SelectPriceOverride(overrides []*PriceOverride, tokenId int, modelName string) *PriceOverride {
+	var best *PriceOverride
+	bestScore := -1
+	for _, o := range overrides {
+		if o.TokenId != 0 && o.TokenId != tokenId {
+			continue
+		}
+		ok, score := MatchPriceOverrideModel(o.Model, modelName)
+		if !ok {
+			continue
+		}
+		if o.TokenId != 0 {
+			score += 1 << 24
+		}
+		if score > bestScore {
+			best = o
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func GetPriceOverridesByUserId(userId int) ([]*PriceOverride, error) {
+	var overrides []*PriceOverride
+	err := DB.Where("user_id = ?", userId).Order("token_id desc, id asc").Find(&overrides).Error
+	return overrides, err
+}
+
+// GetMatchedPriceOverride 获取当前请求生效的自定义价格规则，没有匹配时返回 nil
+func GetMatchedPriceOverride(userId int, tokenId int, modelName string) *PriceOverride {
+	if userId == 0 || modelName == "" {
+		return nil
+	}
+	if !common.MemoryCacheEnabled {
+		overrides, err := GetPriceOverridesByUserId(userId)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to get price overrides of user %d: %s", userId, err.Error()))
+			return nil
+		}
+		return SelectPriceOverride(overrides, tokenId, modelName)
+	}
+	priceOverrideSyncLock.RLock()
+	defer priceOverrideSyncLock.RUnlock()
+	return SelectPriceOverride(user2PriceOverrides[userId], tokenId, modelName)
+}
+
+// ReplaceUserPriceOverrides 覆盖保存某个用户的全部自定义价格规则
+func ReplaceUserPriceOverrides(userId int, overrides []*PriceOverride) error {
+	now := common.GetTimestamp()
+	for _, o := range overrides {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+		o.Id = 0
+		o.UserId = userId
+		if o.CreatedTime == 0 {
+			o.CreatedTime = now
+		}
+		o.UpdatedTime = now
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&PriceOverride{}).Error; err != nil {
+			return err
+		}
+		if len(overrides) == 0 {
+			return nil
+		}
+		return tx.Create(&overrides).Error
+	})
+	if err != nil {
+		return err
+	}
+	refreshUserPriceOverrideCache(userId)
+	return nil
+}
+
+func refreshUserPriceOverrideCache(userId int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	overrides, err := GetPriceOverridesByUserId(userId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to refresh price overrides of user %d: %s", userId, err.Error()))
+		return
+	}
+	priceOverrideSyncLock.Lock()
+	if len(overrides) == 0 {
+		delete(user2PriceOverrides, userId)
+	} else {
+		user2PriceOverrides[userId] = overrides
+	}
+	priceOverrideSyncLock.Unlock()
+}
+
+func InitPriceOverrideCache() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	var overrides []*PriceOverride
+	if err := DB.Order("token_id desc, id asc").Find(&overrides).Error; err != nil {
+		common.SysLog("failed to sync price overrides: " + err.Error())
+		return
+	}
+	newUser2PriceOverrides := make(map[int][]*PriceOverride)
+	for _, o := range overrides {
+		newUser2PriceOverrides[o.UserId] = append(newUser2PriceOverrides[o.UserId], o)
+	}
+	priceOverrideSyncLock.Lock()
+	user2PriceOverrides = newUser2PriceOverrides
+	priceOverrideSyncLock.Unlock()
+}
+
+func SyncPriceOverrideCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		InitPriceOverrideCache()
+	}
+}
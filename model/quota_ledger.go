@@ -0,0 +1,333 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	LedgerAccountUser   = "user"
+	LedgerAccountToken  = "token"
+	LedgerAccountSystem = "system" // 对方科目，所有额度的来源与去向
+)
+
+const (
+	LedgerReasonOpening      = "opening" // 账户首次记账时补记的期初余额
+	LedgerReasonConsume      = "consume"
+	LedgerReasonRefund       = "refund"
+	LedgerReasonTopUp        = "topup"
+	LedgerReasonCoupon       = "coupon"
+	LedgerReasonRedemption   = "redemption"
+	LedgerReasonSubscription = "subscription"
+	LedgerReasonAffTransfer  = "aff_transfer"
+	LedgerReasonInvite       = "invite"
+	LedgerReasonAdmin        = "admin"
+	LedgerReasonTokenEdit    = "token_edit"
+	LedgerReasonTask         = "task"
+	LedgerReasonBatchJob     = "batch_job"  // 批处理任务预留及退还的额度
+	LedgerReasonBackground   = "background" // 后台响应预留及退还的额度
+)
+
+// QuotaLedger 额度账本（复式记账）
+// 每次额度变动写入两条分录：账户分录记录变动及变动后余额，对方分录记入 system 科目，同一笔变动的分录 delta 之和为 0
+type QuotaLedger struct {
+	Id            int64  `json:"id"`
+	TransactionId string `json:"transaction_id" gorm:"type:varchar(64);index"`
+	AccountType   string `json:"account_type" gorm:"type:varchar(16);index:idx_ledger_account,priority:1"`
+	AccountId     int    `json:"account_id" gorm:"index:idx_ledger_account,priority:2"`
+	Delta         int    `json:"delta"`
+	BalanceAfter  int    `json:"balance_after"`
+	Reason        string `json:"reason" gorm:"type:varchar(32);index"`
+	ReferenceId   string `json:"reference_id" gorm:"type:varchar(128)"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+// 已提交期初分录的账户，避免每次记账都查询是否需要补记期初余额，只在记账事务提交后写入
+var ledgerOpenedAccounts sync.Map
+
+func ledgerAccountKey(accountType string, accountId int) string {
+	return fmt.Sprintf("%s:%d", accountType, accountId)
+}
+
+func getLedgerBalance(tx *gorm.DB, accountType string, accountId int) (int, error) {
+	var balance int
+	var err error
+	switch accountType {
+	case LedgerAccountUser:
+		err = tx.Model(&User{}).Unscoped().Where("id = ?", accountId).Select("quota").Scan(&balance).Error
+	case LedgerAccountToken:
+		err = tx.Model(&Token{}).Unscoped().Where("id = ?", accountId).Select("remain_quota").Scan(&balance).Error
+	default:
+		err = fmt.Errorf("unknown ledger account type: %s", accountType)
+	}
+	return balance, err
+}
+
+// ledgerChange 一笔额度变动及其记账原因
+type ledgerChange struct {
+	delta       int
+	reason      string
+	referenceId string
+}
+
+// ledgerChangesDelta 返回各笔变动之和，以及是否有需要记账的变动
+func ledgerChangesDelta(changes []ledgerChange) (int, bool) {
+	total, recorded := 0, false
+	for _, change := range changes {
+		total += change.delta
+		recorded = recorded || change.delta != 0
+	}
+	return total, recorded
+}
+
+// recordQuotaLedger 在余额更新所在的事务中记账，必须在余额更新之后调用
+func recordQuotaLedger(tx *gorm.DB, accountType string, accountId int, delta int, reason string, referenceId string) error {
+	return recordQuotaLedgerChanges(tx, accountType, accountId, []ledgerChange{{delta: delta, reason: reason, referenceId: referenceId}})
+}
+
+// recordQuotaLedgerChanges 在余额更新所在的事务中按顺序逐笔记账，余额更新的额度必须等于各笔变动之和
+func recordQuotaLedgerChanges(tx *gorm.DB, accountType string, accountId int, changes []ledgerChange) error {
+	delta, recorded := ledgerChangesDelta(changes)
+	if !recorded || accountId == 0 {
+		return nil
+	}
+	balance, err := getLedgerBalance(tx, accountType, accountId)
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+
+	if _, ok := ledgerOpenedAccounts.Load(ledgerAccountKey(accountType, accountId)); !ok {
+		// 余额更新已锁定账户行，同一账户的并发记账在此串行；锁定读取保证读到其他事务已提交的期初分录
+		var openingId int64
+		err = tx.Model(&QuotaLedger{}).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("account_type = ? AND account_id = ? AND reason = ?", accountType, accountId, LedgerReasonOpening).
+			Limit(1).Scan(&openingId).Error
+		if err != nil {
+			return err
+		}
+		if openingId == 0 {
+			opening := balance - delta
+			if err = createLedgerEntries(tx, accountType, accountId, opening, opening, LedgerReasonOpening, "", now); err != nil {
+				return err
+			}
+		}
+	}
+	balanceAfter := balance - delta
+	for _, change := range changes {
+		if change.delta == 0 {
+			continue
+		}
+		balanceAfter += change.delta
+		if err = createLedgerEntries(tx, accountType, accountId, change.delta, balanceAfter, change.reason, change.referenceId, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createLedgerEntries(tx *gorm.DB, accountType string, accountId int, delta int, balanceAfter int, reason string, referenceId string, now int64) error {
+	transactionId := common.GetUUID()
+	entries := []*QuotaLedger{
+		{
+			TransactionId: transactionId,
+			AccountType:   accountType,
+			AccountId:     accountId,
+			Delta:         delta,
+			BalanceAfter:  balanceAfter,
+			Reason:        reason,
+			ReferenceId:   referenceId,
+			CreatedTime:   now,
+		},
+		{
+			TransactionId: transactionId,
+			AccountType:   LedgerAccountSystem,
+			Delta:         -delta,
+			Reason:        reason,
+			ReferenceId:   referenceId,
+			CreatedTime:   now,
+		},
+	}
+	return tx.Create(&entries).Error
+}
+
+// markLedgerOpened 记账事务提交后记录账户已有期初分录，事务回滚时不记录
+func markLedgerOpened(err error, accountType string, accountId int, changes []ledgerChange) error {
+	if _, recorded := ledgerChangesDelta(changes); err == nil && accountId != 0 && recorded {
+		ledgerOpenedAccounts.Store(ledgerAccountKey(accountType, accountId), struct{}{})
+	}
+	return err
+}
+
+// updateUserQuotaWithLedger 增减用户额度并记账
+func updateUserQuotaWithLedger(id int, delta int, reason string, referenceId string) error {
+	return updateUserQuotaWithLedgerChanges(id, []ledgerChange{{delta: delta, reason: reason, referenceId: referenceId}})
+}
+
+// updateUserQuotaWithLedgerChanges 按各笔变动之和增减用户额度，并逐笔记账
+func updateUserQuotaWithLedgerChanges(id int, changes []ledgerChange) error {
+	delta, _ := ledgerChangesDelta(changes)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", delta)).Error; err != nil {
+			return err
+		}
+		return recordQuotaLedgerChanges(tx, LedgerAccountUser, id, changes)
+	})
+	return markLedgerOpened(err, LedgerAccountUser, id, changes)
+}
+
+// updateTokenQuotaWithLedger 增减令牌剩余额度并记账
+func updateTokenQuotaWithLedger(id int, delta int, reason string, referenceId string) error {
+	return updateTokenQuotaWithLedgerChanges(id, []ledgerChange{{delta: delta, reason: reason, referenceId: referenceId}})
+}
+
+// updateTokenQuotaWithLedgerChanges 按各笔变动之和增减令牌剩余额度，并逐笔记账
+func updateTokenQuotaWithLedgerChanges(id int, changes []ledgerChange) error {
+	delta, _ := ledgerChangesDelta(changes)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Token{}).Where("id = ?", id).Updates(
+			map[string]interface{}{
+				"remain_quota":  gorm.Expr("remain_quota + ?", delta),
+				"used_quota":    gorm.Expr("used_quota - ?", delta),
+				"accessed_time": common.GetTimestamp(),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		return recordQuotaLedgerChanges(tx, LedgerAccountToken, id, changes)
+	})
+	return markLedgerOpened(err, LedgerAccountToken, id, changes)
+}
+
+func GetQuotaLedgers(accountType string, accountId int, pageInfo *common.PageInfo) (ledgers []*QuotaLedger, total int64, err error) {
+	query := DB.Model(&QuotaLedger{}).Where("account_type = ? AND account_id = ?", accountType, accountId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&ledgers).Error
+	return ledgers, total, err
+}
+
+// LedgerMismatch 账本合计与实际余额不一致的账户
+type LedgerMismatch struct {
+	AccountType string `json:"account_type"`
+	AccountId   int    `json:"account_id"`
+	LedgerSum   int    `json:"ledger_sum"`
+	Balance     int    `json:"balance"`
+	Diff        int    `json:"diff"`
+}
+
+// LedgerCheckResult 账本一致性检查结果
+type LedgerCheckResult struct {
+	CheckedUsers   int               `json:"checked_users"`
+	CheckedTokens  int               `json:"checked_tokens"`
+	UnbalancedSum  int64             `json:"unbalanced_sum"` // 全部分录 delta 之和，复式记账下应为 0
+	Mismatches     []*LedgerMismatch `json:"mismatches"`
+	PendingBatched bool              `json:"pending_batched"` // 批量更新模式下尚未落库的变动会导致短暂不一致
+}
+
+type ledgerSum struct {
+	AccountId int
+	Total     int
+}
+
+type accountBalance struct {
+	Id      int
+	Balance int
+}
+
+// CheckQuotaLedgerConsistency 对比账本合计与 User.Quota / Token.RemainQuota
+// 只检查已有账本分录的账户，已删除的账户跳过
+func CheckQuotaLedgerConsistency() (*LedgerCheckResult, error) {
+	result := &LedgerCheckResult{
+		Mismatches:     make([]*LedgerMismatch, 0),
+		PendingBatched: common.BatchUpdateEnabled,
+	}
+	var total struct{ Total int64 }
+	if err := DB.Model(&QuotaLedger{}).Select("COALESCE(SUM(delta), 0) AS total").Scan(&total).Error; err != nil {
+		return nil, err
+	}
+	result.UnbalancedSum = total.Total
+
+	checked, mismatches, err := checkLedgerAccounts(LedgerAccountUser, &User{}, "quota")
+	if err != nil {
+		return nil, err
+	}
+	result.CheckedUsers = checked
+	result.Mismatches = append(result.Mismatches, mismatches...)
+
+	checked, mismatches, err = checkLedgerAccounts(LedgerAccountToken, &Token{}, "remain_quota")
+	if err != nil {
+		return nil, err
+	}
+	result.CheckedTokens = checked
+	result.Mismatches = append(result.Mismatches, mismatches...)
+	return result, nil
+}
+
+func checkLedgerAccounts(accountType string, table interface{}, balanceCol string) (int, []*LedgerMismatch, error) {
+	var sums []ledgerSum
+	err := DB.Model(&QuotaLedger{}).Select("account_id, SUM(delta) AS total").
+		Where("account_type = ?", accountType).Group("account_id").Scan(&sums).Error
+	if err != nil {
+		return 0, nil, err
+	}
+	mismatches := make([]*LedgerMismatch, 0)
+	checked := 0
+	const chunkSize = 500
+	for start := 0; start < len(sums); start += chunkSize {
+		end := start + chunkSize
+		if end > len(sums) {
+			end = len(sums)
+		}
+		ids := make([]int, 0, end-start)
+		for _, s := range sums[start:end] {
+			ids = append(ids, s.AccountId)
+		}
+		var balances []accountBalance
+		err = DB.Model(table).Select("id, "+balanceCol+" AS balance").Where("id IN ?", ids).Scan(&balances).Error
+		if err != nil {
+			return 0, nil, err
+		}
+		balanceMap := make(map[int]int, len(balances))
+		for _, b := range balances {
+			balanceMap[b.Id] = b.Balance
+		}
+		for _, s := range sums[start:end] {
+			balance, ok := balanceMap[s.AccountId]
+			if !ok {
+				continue
+			}
+			checked++
+			if balance != s.Total {
+				mismatches = append(mismatches, &LedgerMismatch{
+					AccountType: accountType,
+					AccountId:   s.AccountId,
+					LedgerSum:   s.Total,
+					Balance:     balance,
+					Diff:        balance - s.Total,
+				})
+			}
+		}
+	}
+	return checked, mismatches, nil
+}
+
+// CheckTokenLedgerOwner 校验令牌属于该用户，用于用户查看令牌账本
+func CheckTokenLedgerOwner(tokenId int, userId int) error {
+	var count int64
+	if err := DB.Model(&Token{}).Unscoped().Where("id = ? AND user_id = ?", tokenId, userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("令牌不存在")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 批处理、后台响应等异步执行的任务在提交时按估算结果预留用户额度，记录在各自的 reserved_quota 字段中。
+// 执行期间请求的实际费用从预留额度中扣减，超出部分再扣减用户额度，结束时退还剩余的预留额度。
+// 扣减优先使用带条件的原子更新，预留额度不足以及结束时的清零在锁定记录的事务中读取并更新，并发时排队等待而不会失败
+
+type reservedQuotaRow struct {
+	Status        string
+	ReservedQuota int
+}
+
+// lockReservedQuotaRow 在事务中锁定记录并读取状态及预留额度，记录不存在时返回 nil
+func lockReservedQuotaRow(tx *gorm.DB, table interface{}, column string, id string) (*reservedQuotaRow, error) {
+	var rows []reservedQuotaRow
+	err := tx.Model(table).Clauses(clause.Locking{Strength: "UPDATE"}).Select("status", "reserved_quota").
+		Where(column+" = ?", id).Limit(1).Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// takeReservedQuota 从状态属于 statuses 的记录的预留额度中扣减至多 quota，返回实际扣减的额度
+func takeReservedQuota(table interface{}, column string, id string, statuses []string, quota int) (int, error) {
+	if quota <= 0 {
+		return 0, nil
+	}
+	result := DB.Model(table).Where(column+" = ? AND status IN ? AND reserved_quota >= ?", id, statuses, quota).
+		Update("reserved_quota", gorm.Expr("reserved_quota - ?", quota))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return quota, nil
+	}
+	// 预留额度不足时扣减剩余的全部预留额度
+	taken := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		row, err := lockReservedQuotaRow(tx, table, column, id)
+		if err != nil || row == nil || row.ReservedQuota <= 0 || !common.StringsContains(statuses, row.Status) {
+			return err
+		}
+		taken = min(quota, row.ReservedQuota)
+		return tx.Model(table).Where(column+" = ?", id).Update("reserved_quota", row.ReservedQuota-taken).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return taken, nil
+}
+
+// returnReservedQuota 将额度退回状态属于 statuses 的记录的预留额度，记录已结束时返回 false，由调用方退还给用户
+func returnReservedQuota(table interface{}, column string, id string, statuses []string, quota int) (bool, error) {
+	if quota <= 0 {
+		return true, nil
+	}
+	result := DB.Model(table).Where(column+" = ? AND status IN ?", id, statuses).
+		Update("reserved_quota", gorm.Expr("reserved_quota + ?", quota))
+	return result.RowsAffected > 0, result.Error
+}
+
+// finishReservation 将记录从 from 切换到最终状态 to 并清零预留额度，返回清零前的预留额度，调用方负责退还给用户
+func finishReservation(table interface{}, column string, id string, from []string, to string, fields map[string]interface{}) (int, bool, error) {
+	updates := map[string]interface{}{"status": to, "reserved_quota": 0}
+	for field, value := range fields {
+		updates[field] = value
+	}
+	released, finished := 0, false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		row, err := lockReservedQuotaRow(tx, table, column, id)
+		if err != nil || row == nil || !common.StringsContains(from, row.Status) {
+			return err
+		}
+		if err = tx.Model(table).Where(column+" = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		released, finished = row.ReservedQuota, true
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return released, finished, nil
+}
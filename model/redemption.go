@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Redemption struct {
@@ -24,6 +26,55 @@ type Redemption struct {
 	UsedUserId   int            `json:"used_user_id"`
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 	ExpiredTime  int64          `json:"expired_time" gorm:"bigint"` // 过期时间，0 表示不过期
+	// 兑换奖励：quota 直接增加额度；group 变更用户分组；token 生成一个带额度预算的新令牌
+	RewardType     string `json:"reward_type" gorm:"type:varchar(16);default:'quota'"`
+	RewardGroup    string `json:"reward_group" gorm:"type:varchar(64);default:''"`
+	RewardDuration int64  `json:"reward_duration" gorm:"bigint;default:0"` // 分组/令牌有效时长（秒），0 表示永久
+	MaxUses        int    `json:"max_uses" gorm:"default:1"`               // 最多可被多少次兑换
+	PerUserLimit   int    `json:"per_user_limit" gorm:"default:1"`         // 每个用户最多兑换次数
+	UsedCount      int    `json:"used_count" gorm:"default:0"`
+}
+
+const (
+	RedemptionRewardQuota = "quota"
+	RedemptionRewardGroup = "group"
+	RedemptionRewardToken = "token"
+)
+
+// RedemptionRecord 兑换记录
+type RedemptionRecord struct {
+	Id            int    `json:"id"`
+	RedemptionId  int    `json:"redemption_id" gorm:"index"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	RewardType    string `json:"reward_type" gorm:"type:varchar(16)"`
+	Quota         int    `json:"quota"`
+	Group         string `json:"group" gorm:"type:varchar(64)"`
+	OriginalGroup string `json:"original_group" gorm:"type:varchar(64)"`
+	TokenId       int    `json:"token_id"`
+	ExpiresAt     int64  `json:"expires_at" gorm:"bigint;index"` // 限时分组的到期时间，0 表示永久
+	Reverted      bool   `json:"reverted" gorm:"index"`          // 限时分组是否已回退或被新的兑换覆盖
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+func (redemption *Redemption) GetMaxUses() int {
+	if redemption.MaxUses <= 0 {
+		return 1
+	}
+	return redemption.MaxUses
+}
+
+func (redemption *Redemption) GetPerUserLimit() int {
+	if redemption.PerUserLimit <= 0 {
+		return 1
+	}
+	return redemption.PerUserLimit
+}
+
+func (redemption *Redemption) GetRewardType() string {
+	if redemption.RewardType == "" {
+		return RedemptionRewardQuota
+	}
+	return redemption.RewardType
 }
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
@@ -112,12 +163,14 @@ func GetRedemptionById(id int) (*Redemption, error) {
 	return &redemption, err
 }
 
-func Redeem(key string, userId int) (quota int, err error) {
+// Redeem 兑换兑换码
+// 兑换码行加锁后再检查每用户次数，并通过带条件的 used_count 自增保证并发兑换时次数不会超出限制
+func Redeem(key string, userId int) (record *RedemptionRecord, err error) {
 	if key == "" {
-		return 0, errors.New("未提供兑换码")
+		return nil, errors.New("未提供兑换码")
 	}
 	if userId == 0 {
-		return 0, errors.New("无效的 user id")
+		return nil, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
 
@@ -127,7 +180,7 @@ func Redeem(key string, userId int) (quota int, err error) {
 	}
 	common.RandomSleep()
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
@@ -137,21 +190,190 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < common.GetTimestamp() {
 			return errors.New("该兑换码已过期")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		// 兑换码行已加锁，同一兑换码的并发兑换在此串行，此时统计的兑换记录包含已提交的兑换
+		var userCount int64
+		err = tx.Model(&RedemptionRecord{}).Where("redemption_id = ? AND user_id = ?", redemption.Id, userId).Count(&userCount).Error
 		if err != nil {
 			return err
 		}
-		redemption.RedeemedTime = common.GetTimestamp()
-		redemption.Status = common.RedemptionCodeStatusUsed
-		redemption.UsedUserId = userId
-		err = tx.Save(redemption).Error
-		return err
+		if userCount >= int64(redemption.GetPerUserLimit()) {
+			return errors.New("已达到该兑换码的兑换次数上限")
+		}
+		maxUses := redemption.GetMaxUses()
+		result := tx.Model(&Redemption{}).
+			Where("id = ? AND status = ? AND used_count < ?", redemption.Id, common.RedemptionCodeStatusEnabled, maxUses).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该兑换码已被使用")
+		}
+
+		record, err = grantRedemptionReward(tx, redemption, userId)
+		if err != nil {
+			return err
+		}
+		if err = tx.Create(record).Error; err != nil {
+			return err
+		}
+
+		err = tx.Model(&Redemption{}).Where("id = ?", redemption.Id).
+			Updates(map[string]interface{}{"redeemed_time": record.CreatedTime, "used_user_id": userId}).Error
+		if err != nil {
+			return err
+		}
+		// 次数用尽后标记为已使用
+		return tx.Model(&Redemption{}).Where("id = ? AND used_count >= ?", redemption.Id, maxUses).
+			Update("status", common.RedemptionCodeStatusUsed).Error
 	})
 	if err != nil {
-		return 0, errors.New("兑换失败，" + err.Error())
+		return nil, errors.New("兑换失败，" + err.Error())
+	}
+	switch record.RewardType {
+	case RedemptionRewardGroup:
+		_ = invalidateUserCache(userId)
+		msg := fmt.Sprintf("通过兑换码将分组变更为 %s，兑换码ID %d", record.Group, redemption.Id)
+		if record.ExpiresAt != 0 {
+			msg += fmt.Sprintf("，有效期至 %s", time.Unix(record.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+		}
+		RecordLog(userId, LogTypeTopup, msg)
+	case RedemptionRewardToken:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码获得令牌额度 %s，令牌ID %d，兑换码ID %d", logger.LogQuota(record.Quota), record.TokenId, redemption.Id))
+	default:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(record.Quota), redemption.Id))
+	}
+	return record, nil
+}
+
+// grantRedemptionReward 在兑换事务中发放奖励并生成兑换记录
+func grantRedemptionReward(tx *gorm.DB, redemption *Redemption, userId int) (*RedemptionRecord, error) {
+	now := common.GetTimestamp()
+	record := &RedemptionRecord{
+		RedemptionId: redemption.Id,
+		UserId:       userId,
+		RewardType:   redemption.GetRewardType(),
+		CreatedTime:  now,
+	}
+	switch record.RewardType {
+	case RedemptionRewardGroup:
+		var user User
+		if err := tx.Where("id = ?", userId).First(&user).Error; err != nil {
+			return nil, err
+		}
+		record.Group = redemption.RewardGroup
+		record.OriginalGroup = user.Group
+		startTime := now
+		// 仍在生效的限时分组会被本次兑换覆盖，回退时恢复到最初的分组
+		var active RedemptionRecord
+		err := tx.Where("user_id = ? AND reward_type = ? AND expires_at > 0 AND reverted = ?", userId, RedemptionRewardGroup, false).
+			Order("id desc").Limit(1).Find(&active).Error
+		if err != nil {
+			return nil, err
+		}
+		if active.Id != 0 {
+			record.OriginalGroup = active.OriginalGroup
+			if active.Group == redemption.RewardGroup && active.ExpiresAt > startTime {
+				startTime = active.ExpiresAt
+			}
+			if err = tx.Model(&RedemptionRecord{}).Where("user_id = ? AND reward_type = ? AND expires_at > 0 AND reverted = ?", userId, RedemptionRewardGroup, false).
+				Update("reverted", true).Error; err != nil {
+				return nil, err
+			}
+		}
+		if redemption.RewardDuration > 0 {
+			record.ExpiresAt = startTime + redemption.RewardDuration
+		}
+		if err = tx.Model(&User{}).Where("id = ?", userId).Update("group", redemption.RewardGroup).Error; err != nil {
+			return nil, err
+		}
+	case RedemptionRewardToken:
+		key, err := common.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		token := &Token{
+			UserId:       userId,
+			Name:         fmt.Sprintf("兑换码-%s", redemption.Name),
+			Key:          key,
+			CreatedTime:  now,
+			AccessedTime: now,
+			ExpiredTime:  -1,
+			RemainQuota:  redemption.Quota,
+			Prepaid:      true,
+		}
+		if redemption.RewardDuration > 0 {
+			token.ExpiredTime = now + redemption.RewardDuration
+		}
+		// 额度只发放到令牌，令牌消耗时不扣减用户额度，其他令牌无法使用这部分额度
+		if err = tx.Create(token).Error; err != nil {
+			return nil, err
+		}
+		if err = recordQuotaLedger(tx, LedgerAccountToken, token.Id, redemption.Quota, LedgerReasonRedemption, strconv.Itoa(redemption.Id)); err != nil {
+			return nil, err
+		}
+		record.Quota = redemption.Quota
+		record.TokenId = token.Id
+	default:
+		if err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error; err != nil {
+			return nil, err
+		}
+		if err := recordQuotaLedger(tx, LedgerAccountUser, userId, redemption.Quota, LedgerReasonRedemption, strconv.Itoa(redemption.Id)); err != nil {
+			return nil, err
+		}
+		record.Quota = redemption.Quota
+	}
+	return record, nil
+}
+
+// GetRedemptionRecords 获取兑换码的兑换记录
+func GetRedemptionRecords(redemptionId int, pageInfo *common.PageInfo) (records []*RedemptionRecord, total int64, err error) {
+	query := DB.Model(&RedemptionRecord{}).Where("redemption_id = ?", redemptionId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&records).Error
+	return records, total, err
+}
+
+// RevertExpiredRedemptionGroups 回退到期的限时分组
+// 仅当用户分组仍为兑换获得的分组时才回退，避免覆盖管理员或订阅的调整
+func RevertExpiredRedemptionGroups() {
+	var records []*RedemptionRecord
+	err := DB.Where("reward_type = ? AND expires_at > 0 AND expires_at < ? AND reverted = ?", RedemptionRewardGroup, common.GetTimestamp(), false).
+		Find(&records).Error
+	if err != nil {
+		common.SysLog("failed to query expired redemption groups: " + err.Error())
+		return
+	}
+	for _, record := range records {
+		var reverted bool
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&RedemptionRecord{}).Where("id = ? AND reverted = ?", record.Id, false).Update("reverted", true)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			result = tx.Model(&User{}).Where("id = ?", record.UserId).Where(map[string]interface{}{"group": record.Group}).
+				Update("group", record.OriginalGroup)
+			reverted = result.RowsAffected > 0
+			return result.Error
+		})
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to revert redemption group of record %d: %s", record.Id, err.Error()))
+			continue
+		}
+		if reverted {
+			_ = invalidateUserCache(record.UserId)
+			RecordLog(record.UserId, LogTypeSystem, fmt.Sprintf("兑换码获得的分组 %s 已到期，分组已恢复为 %s", record.Group, record.OriginalGroup))
+		}
+	}
+}
+
+func AutomaticallyRevertRedemptionGroups(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		RevertExpiredRedemptionGroups()
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
-	return redemption.Quota, nil
 }
 
 func (redemption *Redemption) Insert() error {
@@ -168,7 +390,8 @@ func (redemption *Redemption) SelectUpdate() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "expired_time").Updates(redemption).Error
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "expired_time",
+		"reward_type", "reward_group", "reward_duration", "max_uses", "per_user_limit").Updates(redemption).Error
 	return err
 }
 
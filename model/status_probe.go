@@ -0,0 +1,270 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StatusProbeUsername        = "status-probe"
+	StatusProbeTokenNamePrefix = "status-probe-"
+)
+
+// StatusProbe 状态页探测记录，每次对某个模型及分组发起的最小请求对应一条记录
+type StatusProbe struct {
+	Id           int    `json:"id"`
+	ModelName    string `json:"model_name" gorm:"size:128;index:idx_status_probe_target,priority:1"`
+	UsingGroup   string `json:"group" gorm:"column:using_group;size:64;index:idx_status_probe_target,priority:2"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index:idx_status_probe_target,priority:3;index"`
+	Success      bool   `json:"success"`
+	StatusCode   int    `json:"status_code"`
+	LatencyMs    int    `json:"latency_ms"`
+	ErrorMessage string `json:"error_message" gorm:"type:varchar(512)"`
+}
+
+// StatusIncident 故障区间，从第一次探测失败开始，到下一次探测成功结束
+type StatusIncident struct {
+	Id         int    `json:"id"`
+	ModelName  string `json:"model_name" gorm:"size:128;index:idx_status_incident_target,priority:1"`
+	UsingGroup string `json:"group" gorm:"column:using_group;size:64;index:idx_status_incident_target,priority:2"`
+	StartedAt  int64  `json:"started_at" gorm:"bigint;index"`
+	ResolvedAt int64  `json:"resolved_at" gorm:"bigint;default:0"` // 0 表示故障仍在持续
+	Failures   int    `json:"failures"`
+	LastError  string `json:"last_error" gorm:"type:varchar(512)"` // 上游原始错误信息，可能包含上游地址等内部信息，不在公开状态页展示
+	ErrorType  string `json:"error_type" gorm:"type:varchar(32)"`  // 最近一次失败的错误类别，见 StatusProbeErrorType
+}
+
+const (
+	StatusProbeErrorTimeout     = "timeout"
+	StatusProbeErrorNetwork     = "network"
+	StatusProbeErrorAuth        = "auth"
+	StatusProbeErrorRateLimit   = "rate_limit"
+	StatusProbeErrorClientError = "4xx"
+	StatusProbeErrorServerError = "5xx"
+)
+
+// StatusProbeErrorType 按状态码将失败的探测归类，公开状态页只展示类别
+func StatusProbeErrorType(probe *StatusProbe) string {
+	switch {
+	case probe.StatusCode == 0:
+		message := strings.ToLower(probe.ErrorMessage)
+		if strings.Contains(message, "timeout") || strings.Contains(message, "deadline exceeded") {
+			return StatusProbeErrorTimeout
+		}
+		return StatusProbeErrorNetwork
+	case probe.StatusCode == http.StatusUnauthorized || probe.StatusCode == http.StatusForbidden:
+		return StatusProbeErrorAuth
+	case probe.StatusCode == http.StatusTooManyRequests:
+		return StatusProbeErrorRateLimit
+	case probe.StatusCode == http.StatusGatewayTimeout:
+		return StatusProbeErrorTimeout
+	case probe.StatusCode >= 500:
+		return StatusProbeErrorServerError
+	default:
+		return StatusProbeErrorClientError
+	}
+}
+
+var statusIncidentLock sync.Mutex
+
+// RecordStatusProbe 保存探测结果，失败时打开或延续故障区间，成功时关闭未结束的故障区间
+func RecordStatusProbe(probe *StatusProbe) error {
+	if probe.CreatedAt == 0 {
+		probe.CreatedAt = common.GetTimestamp()
+	}
+	if err := DB.Create(probe).Error; err != nil {
+		return err
+	}
+
+	statusIncidentLock.Lock()
+	defer statusIncidentLock.Unlock()
+	var incidents []*StatusIncident
+	err := DB.Where("model_name = ? AND using_group = ? AND resolved_at = 0", probe.ModelName, probe.UsingGroup).
+		Order("id desc").Limit(1).Find(&incidents).Error
+	if err != nil {
+		return err
+	}
+	if probe.Success {
+		if len(incidents) == 0 {
+			return nil
+		}
+		return DB.Model(incidents[0]).Update("resolved_at", probe.CreatedAt).Error
+	}
+	if len(incidents) > 0 {
+		return DB.Model(incidents[0]).Updates(map[string]interface{}{
+			"failures":   gorm.Expr("failures + 1"),
+			"last_error": probe.ErrorMessage,
+			"error_type": StatusProbeErrorType(probe),
+		}).Error
+	}
+	return DB.Create(&StatusIncident{
+		ModelName:  probe.ModelName,
+		UsingGroup: probe.UsingGroup,
+		StartedAt:  probe.CreatedAt,
+		Failures:   1,
+		LastError:  probe.ErrorMessage,
+		ErrorType:  StatusProbeErrorType(probe),
+	}).Error
+}
+
+// StatusProbeStat 按探测对象（及日期）汇总的探测次数
+type StatusProbeStat struct {
+	ModelName    string `json:"model_name"`
+	UsingGroup   string `json:"group" gorm:"column:using_group"`
+	Day          int64  `json:"day"`
+	Total        int64  `json:"total"`
+	Success      int64  `json:"success"`
+	LatencyTotal int64  `json:"-"`
+}
+
+// GetStatusProbeStats 汇总 since 之后的探测结果，byDay 为 true 时按 UTC 自然日分桶
+func GetStatusProbeStats(since int64, byDay bool) (stats []*StatusProbeStat, err error) {
+	columns := "model_name, using_group"
+	groupBy := "model_name, using_group"
+	if byDay {
+		columns += ", created_at - created_at % 86400 AS day"
+		groupBy += ", created_at - created_at % 86400"
+	}
+	err = DB.Model(&StatusProbe{}).
+		Select(fmt.Sprintf("%s, COUNT(*) AS total, SUM(CASE WHEN success THEN 1 ELSE 0 END) AS success, SUM(latency_ms) AS latency_total", columns)).
+		Where("created_at >= ?", since).Group(groupBy).Scan(&stats).Error
+	return stats, err
+}
+
+// GetLatestStatusProbes 返回每个探测对象最近一次的探测结果
+func GetLatestStatusProbes() (probes []*StatusProbe, err error) {
+	latest := DB.Model(&StatusProbe{}).Select("MAX(id)").Group("model_name, using_group")
+	err = DB.Where("id IN (?)", latest).Order("model_name asc, using_group asc").Find(&probes).Error
+	return probes, err
+}
+
+// GetStatusIncidents 返回 since 之后开始或仍未结束的故障区间
+func GetStatusIncidents(since int64) (incidents []*StatusIncident, err error) {
+	err = DB.Where("started_at >= ? OR resolved_at = 0 OR resolved_at >= ?", since, since).
+		Order("started_at desc").Find(&incidents).Error
+	return incidents, err
+}
+
+// DeleteStatusProbesBefore 清理过期的探测记录及已结束的故障区间
+func DeleteStatusProbesBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&StatusProbe{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	err := DB.Where("resolved_at > 0 AND resolved_at < ?", timestamp).Delete(&StatusIncident{}).Error
+	return result.RowsAffected, err
+}
+
+var (
+	statusProbeUserId        atomic.Int64
+	statusProbeUserCheckedAt atomic.Int64
+)
+
+// getOrCreateStatusProbeUser 返回状态探测专用的系统用户，不存在时创建。探测请求不计费，因此系统用户不需要额度
+func getOrCreateStatusProbeUser() (*User, error) {
+	user := &User{}
+	err := DB.Where("username = ?", StatusProbeUsername).First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 随机密码只用于满足非空约束，系统用户不用于登录
+		password, hashErr := common.Password2Hash(common.GetRandomString(32))
+		if hashErr != nil {
+			return nil, hashErr
+		}
+		user = &User{
+			Username:    StatusProbeUsername,
+			Password:    password,
+			DisplayName: "Status Probe",
+			Role:        common.RoleCommonUser,
+			Status:      common.UserStatusEnabled,
+			Group:       "default",
+			AffCode:     common.GetRandomString(8),
+			Remark:      "状态页探测系统用户",
+		}
+		err = DB.Create(user).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != common.UserStatusEnabled {
+		if err = DB.Model(user).Update("status", common.UserStatusEnabled).Error; err != nil {
+			return nil, err
+		}
+		_ = invalidateUserCache(user.Id)
+	}
+	statusProbeUserId.Store(int64(user.Id))
+	return user, nil
+}
+
+// IsStatusProbeUser 判断是否为状态探测系统用户，其请求不检查及扣减用户和令牌额度
+func IsStatusProbeUser(userId int) bool {
+	if userId == 0 {
+		return false
+	}
+	if id := statusProbeUserId.Load(); id != 0 {
+		return int(id) == userId
+	}
+	// 探测请求可能由其他节点处理，此时从数据库查询，系统用户不存在时每分钟最多查询一次
+	now := common.GetTimestamp()
+	if checkedAt := statusProbeUserCheckedAt.Load(); now-checkedAt < 60 || !statusProbeUserCheckedAt.CompareAndSwap(checkedAt, now) {
+		return false
+	}
+	var id int
+	if err := DB.Model(&User{}).Where("username = ?", StatusProbeUsername).Select("id").Scan(&id).Error; err != nil || id == 0 {
+		return false
+	}
+	statusProbeUserId.Store(int64(id))
+	return id == userId
+}
+
+// GetOrCreateStatusProbeToken 返回状态探测系统用户名下用于探测指定分组的令牌，不存在时创建，
+// 令牌被禁用、过期或修改过分组时恢复为可用状态
+func GetOrCreateStatusProbeToken(group string) (*Token, error) {
+	user, err := getOrCreateStatusProbeUser()
+	if err != nil {
+		return nil, err
+	}
+	name := StatusProbeTokenNamePrefix + group
+	token := &Token{}
+	err = DB.Where("user_id = ? AND name = ?", user.Id, name).First(token).Error
+	if err == nil {
+		if token.Status != common.TokenStatusEnabled || token.ExpiredTime != -1 || !token.UnlimitedQuota || token.Group != group {
+			token.Status = common.TokenStatusEnabled
+			token.ExpiredTime = -1
+			token.UnlimitedQuota = true
+			token.Group = group
+			if err = token.Update(); err != nil {
+				return nil, err
+			}
+		}
+		return token, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	token = &Token{
+		UserId:         user.Id,
+		Name:           name,
+		Key:            key,
+		CreatedTime:    common.GetTimestamp(),
+		AccessedTime:   common.GetTimestamp(),
+		ExpiredTime:    -1,
+		UnlimitedQuota: true,
+		Group:          group,
+	}
+	if err = token.Insert(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
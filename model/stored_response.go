@@ -0,0 +1,180 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ResponseStatusQueued     = "queued"
+	ResponseStatusInProgress = "in_progress"
+	ResponseStatusCompleted  = "completed"
+	ResponseStatusFailed     = "failed"
+	ResponseStatusCancelled  = "cancelled"
+)
+
+// StoredResponse 网关保存的 Responses API 响应，用于 previous_response_id 展开及 /v1/responses/{id} 查询。
+// 后台模式（background）的响应在提交时创建，由主节点执行后更新
+type StoredResponse struct {
+	Id            int             `json:"id"`
+	ResponseId    string          `json:"response_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId        int             `json:"user_id" gorm:"index"`
+	TokenId       int             `json:"token_id"`
+	Model         string          `json:"model" gorm:"type:varchar(255)"`
+	Status        string          `json:"status" gorm:"type:varchar(20);index"`
+	Input         json.RawMessage `json:"input" gorm:"type:json"`    // 展开 previous_response_id 后发送给上游的完整输入条目
+	Response      json.RawMessage `json:"response" gorm:"type:json"` // 响应对象
+	Background    bool            `json:"background" gorm:"default:false"`
+	Stream        bool            `json:"stream" gorm:"default:false"` // 后台响应是否以流式执行，流式执行时保存事件以便续传
+	Request       json.RawMessage `json:"-" gorm:"type:json"`          // 后台响应待执行的请求体
+	UsingGroup    string          `json:"using_group" gorm:"type:varchar(64)"`
+	ClientIp      string          `json:"-" gorm:"type:varchar(64)"`       // 提交后台响应的客户端 IP，执行时沿用
+	ReservedQuota int             `json:"reserved_quota" gorm:"default:0"` // 后台响应提交时预留、执行费用从中扣减、结束时退还剩余部分的额度
+	CreatedAt     int64           `json:"created_at" gorm:"bigint"`
+	ExpiresAt     int64           `json:"expires_at" gorm:"bigint;default:0;index"` // 0 表示不过期
+}
+
+// ResponseEvent 后台流式响应的事件，用于 starting_after 续传
+type ResponseEvent struct {
+	Id             int             `json:"id"`
+	ResponseId     string          `json:"response_id" gorm:"type:varchar(64);index:idx_response_event_seq,priority:1"`
+	SequenceNumber int             `json:"sequence_number" gorm:"index:idx_response_event_seq,priority:2"`
+	Type           string          `json:"type" gorm:"type:varchar(64)"`
+	Data           json.RawMessage `json:"data" gorm:"type:json"`
+}
+
+// IsResponseFinished 响应是否已结束，queued 及 in_progress 以外的状态都视为结束
+func IsResponseFinished(status string) bool {
+	return status != ResponseStatusQueued && status != ResponseStatusInProgress
+}
+
+func (response *StoredResponse) Insert() error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(response).Error
+}
+
+// GetUserStoredResponse 返回用户保存的响应，不存在、不属于该用户或已过期时返回 gorm.ErrRecordNotFound
+func GetUserStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	response := &StoredResponse{}
+	err := DB.Where("user_id = ? AND response_id = ?", userId, responseId).
+		Where("expires_at = 0 OR expires_at > ?", common.GetTimestamp()).First(response).Error
+	return response, err
+}
+
+// GetStoredResponseStatus 只查询响应状态，用于执行及续传过程中感知取消和结束
+func GetStoredResponseStatus(responseId string) (string, error) {
+	var status string
+	err := DB.Model(&StoredResponse{}).Where("response_id = ?", responseId).Select("status").Scan(&status).Error
+	return status, err
+}
+
+// GetBackgroundResponsesByStatus 按提交顺序返回指定状态的后台响应
+func GetBackgroundResponsesByStatus(status string) (responses []*StoredResponse, err error) {
+	err = DB.Where("background = ? AND status = ?", true, status).Order("id asc").Find(&responses).Error
+	return responses, err
+}
+
+// TransitStoredResponseStatus 仅当响应处于 from 中的状态时更新为 to，返回是否更新成功
+func TransitStoredResponseStatus(responseId string, from []string, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for key, value := range fields {
+		updates[key] = value
+	}
+	result := DB.Model(&StoredResponse{}).Where("response_id = ? AND status IN ?", responseId, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// responseReservingStatuses 预留额度仍可被请求扣减或退回的后台响应状态
+var responseReservingStatuses = []string{ResponseStatusQueued, ResponseStatusInProgress}
+
+// TakeStoredResponseReservedQuota 从未结束后台响应的预留额度中扣减至多 quota，返回实际扣减的额度
+func TakeStoredResponseReservedQuota(responseId string, quota int) (int, error) {
+	return takeReservedQuota(&StoredResponse{}, "response_id", responseId, responseReservingStatuses, quota)
+}
+
+// ReturnStoredResponseReservedQuota 将额度退回未结束后台响应的预留额度，响应已结束时返回 false
+func ReturnStoredResponseReservedQuota(responseId string, quota int) (bool, error) {
+	return returnReservedQuota(&StoredResponse{}, "response_id", responseId, responseReservingStatuses, quota)
+}
+
+// GetStoredResponseReservedQuota 返回后台响应剩余的预留额度
+func GetStoredResponseReservedQuota(responseId string) (quota int, err error) {
+	err = DB.Model(&StoredResponse{}).Where("response_id = ?", responseId).Select("reserved_quota").Find(&quota).Error
+	return quota, err
+}
+
+// FinishStoredResponse 将后台响应从 from 切换到最终状态并清零预留额度，返回清零前剩余的预留额度，调用方负责退还给用户
+func FinishStoredResponse(responseId string, from []string, to string, fields map[string]interface{}) (int, bool, error) {
+	return finishReservation(&StoredResponse{}, "response_id", responseId, from, to, fields)
+}
+
+func InsertResponseEvent(event *ResponseEvent) error {
+	return DB.Create(event).Error
+}
+
+// GetResponseEvents 按顺序返回序号大于 after 的事件
+func GetResponseEvents(responseId string, after int, limit int) (events []*ResponseEvent, err error) {
+	err = DB.Where("response_id = ? AND sequence_number > ?", responseId, after).
+		Order("sequence_number asc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// GetLastResponseEventSequence 返回已保存事件的最大序号，没有事件时返回 -1
+func GetLastResponseEventSequence(responseId string) (sequence int, err error) {
+	err = DB.Model(&ResponseEvent{}).Where("response_id = ?", responseId).
+		Select("COALESCE(MAX(sequence_number), -1)").Scan(&sequence).Error
+	return sequence, err
+}
+
+func DeleteResponseEvents(responseId string) error {
+	return DB.Where("response_id = ?", responseId).Delete(&ResponseEvent{}).Error
+}
+
+func DeleteStoredResponse(response *StoredResponse) error {
+	if response.Id == 0 {
+		return errors.New("id 为空！")
+	}
+	if err := DeleteResponseEvents(response.ResponseId); err != nil {
+		return err
+	}
+	return DB.Delete(response).Error
+}
+
+func DeleteExpiredStoredResponses() (int64, error) {
+	var responseIds []string
+	err := DB.Model(&StoredResponse{}).Where("expires_at > 0 AND expires_at <= ?", common.GetTimestamp()).
+		Limit(1000).Pluck("response_id", &responseIds).Error
+	if err != nil || len(responseIds) == 0 {
+		return 0, err
+	}
+	if err = DB.Where("response_id IN ?", responseIds).Delete(&ResponseEvent{}).Error; err != nil {
+		return 0, err
+	}
+	result := DB.Where("response_id IN ?", responseIds).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
+
+func AutomaticallyCleanStoredResponses(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		count, err := DeleteExpiredStoredResponses()
+		if err != nil {
+			common.SysLog("failed to delete expired stored responses: " + err.Error())
+			continue
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("deleted %d expired stored responses", count))
+		}
+	}
+}
@@ -0,0 +1,601 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionStatusPending  = "pending"  // 已创建支付链接，等待首次付款
+	SubscriptionStatusActive   = "active"   // 生效中
+	SubscriptionStatusCanceled = "canceled" // 已取消（周期结束前仍生效），等待到期
+	SubscriptionStatusExpired  = "expired"  // 已失效，分组已回退
+)
+
+// 订阅周期结束后等待续费 webhook 的宽限时间，超过后自动失效
+const subscriptionLapseGraceSeconds = 3 * 24 * 3600
+
+// SubscriptionPlan 订阅套餐
+// ModelAllowances 为 JSON 对象，表示每个周期内对应模型（支持 * 通配）的最大请求次数，例如 {"gpt-4o": 1000}
+type SubscriptionPlan struct {
+	Id              int     `json:"id"`
+	Name            string  `json:"name" gorm:"type:varchar(64);not null"`
+	Description     string  `json:"description" gorm:"type:varchar(255)"`
+	Price           float64 `json:"price"`                                      // 每月价格，仅用于展示
+	StripePriceId   string  `json:"stripe_price_id" gorm:"type:varchar(128)"`   // Stripe 周期性价格 ID
+	QuotaPerPeriod  int     `json:"quota_per_period" gorm:"type:int;default:0"` // 每个周期发放的额度
+	Rollover        bool    `json:"rollover" gorm:"default:false"`              // 未用完的额度是否结转到下个周期
+	UpgradeGroup    string  `json:"upgrade_group" gorm:"type:varchar(64)"`      // 订阅期间用户所在分组，为空则不变更
+	ModelAllowances string  `json:"model_allowances" gorm:"type:text"`          // 模型请求次数限制
+	Enabled         bool    `json:"enabled"`
+	CreatedTime     int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime     int64   `json:"updated_time" gorm:"bigint"`
+}
+
+// Subscription 用户订阅记录
+type Subscription struct {
+	Id                     int    `json:"id"`
+	UserId                 int    `json:"user_id" gorm:"index"`
+	PlanId                 int    `json:"plan_id" gorm:"index"`
+	ReferenceId            string `json:"reference_id" gorm:"type:varchar(64);uniqueIndex"`
+	StripeSubscriptionId   string `json:"stripe_subscription_id" gorm:"type:varchar(64);index"`
+	Status                 string `json:"status" gorm:"type:varchar(16);index"`
+	CurrentPeriodStart     int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd       int64  `json:"current_period_end" gorm:"bigint"`
+	CancelAtPeriodEnd      bool   `json:"cancel_at_period_end"`
+	OriginalGroup          string `json:"original_group" gorm:"type:varchar(64)"`
+	LastInvoiceId          string `json:"-" gorm:"type:varchar(64)"`
+	PeriodGrantedQuota     int    `json:"period_granted_quota" gorm:"type:int;default:0"`
+	UsedQuotaAtPeriodStart int    `json:"-" gorm:"type:int;default:0"`
+	CreatedTime            int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime            int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// SubscriptionAllowanceUsage 订阅周期内模型请求次数的使用情况
+type SubscriptionAllowanceUsage struct {
+	Id             int    `json:"id"`
+	SubscriptionId int    `json:"subscription_id" gorm:"uniqueIndex:idx_sub_allowance"`
+	Model          string `json:"model" gorm:"type:varchar(255);uniqueIndex:idx_sub_allowance"`
+	PeriodStart    int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_sub_allowance"`
+	Used           int    `json:"used" gorm:"type:int;default:0"`
+}
+
+// ActiveSubscriptionAllowance 生效订阅的模型次数限制，用于请求时快速检查
+type ActiveSubscriptionAllowance struct {
+	SubscriptionId int
+	PeriodStart    int64
+	Allowances     map[string]int
+}
+
+var user2SubscriptionAllowance = make(map[int]*ActiveSubscriptionAllowance)
+var subscriptionAllowanceSyncLock sync.RWMutex
+
+func (plan *SubscriptionPlan) GetModelAllowances() map[string]int {
+	allowances := make(map[string]int)
+	if plan.ModelAllowances == "" {
+		return allowances
+	}
+	if err := json.Unmarshal([]byte(plan.ModelAllowances), &allowances); err != nil {
+		common.SysLog(fmt.Sprintf("failed to unmarshal model allowances of plan %d: %s", plan.Id, err.Error()))
+	}
+	return allowances
+}
+
+func (plan *SubscriptionPlan) Validate() error {
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if plan.QuotaPerPeriod < 0 {
+		return errors.New("每周期额度不能为负数")
+	}
+	if plan.ModelAllowances != "" {
+		var allowances map[string]int
+		if err := json.Unmarshal([]byte(plan.ModelAllowances), &allowances); err != nil {
+			return errors.New("模型次数限制必须是 JSON 对象，例如 {\"gpt-4o\": 1000}")
+		}
+	}
+	return nil
+}
+
+func (plan *SubscriptionPlan) Insert() error {
+	now := common.GetTimestamp()
+	plan.CreatedTime = now
+	plan.UpdatedTime = now
+	return DB.Create(plan).Error
+}
+
+func (plan *SubscriptionPlan) Update() error {
+	plan.UpdatedTime = common.GetTimestamp()
+	err := DB.Save(plan).Error
+	if err == nil {
+		InitSubscriptionAllowanceCache()
+	}
+	return err
+}
+
+func DeleteSubscriptionPlanById(id int) error {
+	var count int64
+	err := DB.Model(&Subscription{}).Where("plan_id = ? AND status IN ?", id, []string{SubscriptionStatusActive, SubscriptionStatusCanceled}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐仍有生效中的订阅，无法删除，请先停用")
+	}
+	return DB.Delete(&SubscriptionPlan{}, id).Error
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	var plan SubscriptionPlan
+	err := DB.First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func GetAllSubscriptionPlans(enabledOnly bool) ([]*SubscriptionPlan, error) {
+	var plans []*SubscriptionPlan
+	query := DB.Model(&SubscriptionPlan{})
+	if enabledOnly {
+		query = query.Where("enabled = ?", true)
+	}
+	err := query.Order("price asc, id asc").Find(&plans).Error
+	return plans, err
+}
+
+func (sub *Subscription) IsEffective() bool {
+	return sub.Status == SubscriptionStatusActive || sub.Status == SubscriptionStatusCanceled
+}
+
+func CreatePendingSubscription(userId int, planId int, referenceId string) (*Subscription, error) {
+	now := common.GetTimestamp()
+	sub := &Subscription{
+		UserId:      userId,
+		PlanId:      planId,
+		ReferenceId: referenceId,
+		Status:      SubscriptionStatusPending,
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+	return sub, DB.Create(sub).Error
+}
+
+// GetEffectiveSubscriptionByUserId 获取用户当前生效的订阅，没有时返回 nil
+func GetEffectiveSubscriptionByUserId(userId int) (*Subscription, error) {
+	var subs []*Subscription
+	err := DB.Where("user_id = ? AND status IN ?", userId, []string{SubscriptionStatusActive, SubscriptionStatusCanceled}).
+		Order("id desc").Limit(1).Find(&subs).Error
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	return subs[0], nil
+}
+
+func GetUserSubscriptions(userId int) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := DB.Where("user_id = ? AND status <> ?", userId, SubscriptionStatusPending).Order("id desc").Find(&subs).Error
+	return subs, err
+}
+
+func GetAllSubscriptions(pageInfo *common.PageInfo, status string) (subs []*Subscription, total int64, err error) {
+	query := DB.Model(&Subscription{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&subs).Error
+	return subs, total, err
+}
+
+// RenewSubscription 处理一次成功的订阅付款（首次付款或续费），发放本周期额度
+// invoiceId 用于幂等，同一账单重复通知不会重复发放
+func RenewSubscription(referenceId string, stripeSubscriptionId string, customerId string, invoiceId string, periodStart int64, periodEnd int64) error {
+	if referenceId == "" {
+		return errors.New("未提供订阅单号")
+	}
+	sub := &Subscription{}
+	var plan SubscriptionPlan
+	var quotaToAdd, quotaToRemove int
+	var firstActivation bool
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference_id = ?", referenceId).First(sub).Error
+		if err != nil {
+			return errors.New("订阅记录不存在")
+		}
+		if invoiceId != "" && sub.LastInvoiceId == invoiceId {
+			return nil
+		}
+		if sub.Status == SubscriptionStatusExpired {
+			return errors.New("订阅已失效")
+		}
+		if invoiceId != "" {
+			// 以账单号为条件更新，不支持行锁的数据库上并发的重复通知也只有一次能发放额度
+			result := tx.Model(&Subscription{}).Where("id = ? AND (last_invoice_id IS NULL OR last_invoice_id <> ?)", sub.Id, invoiceId).
+				Update("last_invoice_id", invoiceId)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+		}
+		if err = tx.First(&plan, "id = ?", sub.PlanId).Error; err != nil {
+			return errors.New("订阅套餐不存在")
+		}
+		var user User
+		if err = tx.Where("id = ?", sub.UserId).First(&user).Error; err != nil {
+			return err
+		}
+
+		firstActivation = sub.Status == SubscriptionStatusPending
+		if !firstActivation && !plan.Rollover {
+			// 不结转：优先认为本周期消耗的是订阅额度，回收剩余部分
+			usedInPeriod := user.UsedQuota - sub.UsedQuotaAtPeriodStart
+			quotaToRemove = sub.PeriodGrantedQuota - usedInPeriod
+			if quotaToRemove > user.Quota {
+				quotaToRemove = user.Quota
+			}
+			if quotaToRemove < 0 {
+				quotaToRemove = 0
+			}
+		}
+		quotaToAdd = plan.QuotaPerPeriod
+
+		updates := map[string]interface{}{
+			"quota": gorm.Expr("quota + ?", quotaToAdd-quotaToRemove),
+		}
+		if customerId != "" {
+			updates["stripe_customer"] = customerId
+		}
+		if firstActivation {
+			sub.OriginalGroup = user.Group
+			if plan.UpgradeGroup != "" {
+				updates["group"] = plan.UpgradeGroup
+			}
+		}
+		if err = tx.Model(&User{}).Where("id = ?", sub.UserId).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err = recordQuotaLedger(tx, LedgerAccountUser, sub.UserId, -quotaToRemove, LedgerReasonSubscription, invoiceId); err != nil {
+			return err
+		}
+		if err = recordQuotaLedger(tx, LedgerAccountUser, sub.UserId, quotaToAdd, LedgerReasonSubscription, invoiceId); err != nil {
+			return err
+		}
+
+		if sub.Status == SubscriptionStatusPending {
+			sub.Status = SubscriptionStatusActive
+		}
+		if stripeSubscriptionId != "" {
+			sub.StripeSubscriptionId = stripeSubscriptionId
+		}
+		sub.LastInvoiceId = invoiceId
+		sub.CurrentPeriodStart = periodStart
+		sub.CurrentPeriodEnd = periodEnd
+		sub.PeriodGrantedQuota = quotaToAdd
+		sub.UsedQuotaAtPeriodStart = user.UsedQuota
+		sub.UpdatedTime = common.GetTimestamp()
+		return tx.Save(sub).Error
+	})
+	if err != nil {
+		return errors.New("订阅续费失败，" + err.Error())
+	}
+	if plan.Id == 0 {
+		// 重复通知，已处理
+		return nil
+	}
+
+	_ = invalidateUserCache(sub.UserId)
+	refreshUserSubscriptionAllowance(sub.UserId)
+	if firstActivation {
+		RecordLog(sub.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 开通成功，发放额度: %s", plan.Name, logger.LogQuota(quotaToAdd)))
+	} else {
+		msg := fmt.Sprintf("订阅套餐 %s 续费成功，发放额度: %s", plan.Name, logger.LogQuota(quotaToAdd))
+		if quotaToRemove > 0 {
+			msg += fmt.Sprintf("，回收上周期未使用额度: %s", logger.LogQuota(quotaToRemove))
+		}
+		RecordLog(sub.UserId, LogTypeTopup, msg)
+	}
+	return nil
+}
+
+// UpdateSubscriptionState 同步 Stripe 订阅状态（周期、是否在周期末取消）
+func UpdateSubscriptionState(stripeSubscriptionId string, referenceId string, cancelAtPeriodEnd bool, periodEnd int64) error {
+	sub, err := getSubscriptionByStripeId(stripeSubscriptionId, referenceId)
+	if err != nil {
+		return err
+	}
+	if !sub.IsEffective() {
+		return nil
+	}
+	sub.CancelAtPeriodEnd = cancelAtPeriodEnd
+	if cancelAtPeriodEnd {
+		sub.Status = SubscriptionStatusCanceled
+	} else {
+		sub.Status = SubscriptionStatusActive
+	}
+	if periodEnd > sub.CurrentPeriodEnd {
+		sub.CurrentPeriodEnd = periodEnd
+	}
+	sub.UpdatedTime = common.GetTimestamp()
+	return DB.Save(sub).Error
+}
+
+// LapseSubscription 订阅失效：标记状态并将用户分组回退到订阅前的分组
+func LapseSubscription(stripeSubscriptionId string, referenceId string) error {
+	sub, err := getSubscriptionByStripeId(stripeSubscriptionId, referenceId)
+	if err != nil {
+		return err
+	}
+	return lapseSubscription(sub.Id)
+}
+
+func lapseSubscription(subscriptionId int) error {
+	sub := &Subscription{}
+	var plan SubscriptionPlan
+	var downgraded bool
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(sub, "id = ?", subscriptionId).Error; err != nil {
+			return err
+		}
+		if !sub.IsEffective() {
+			return nil
+		}
+		_ = tx.First(&plan, "id = ?", sub.PlanId).Error
+		if plan.UpgradeGroup != "" && sub.OriginalGroup != "" {
+			// 仅当用户分组仍为套餐分组时才回退，避免覆盖管理员的手动调整
+			result := tx.Model(&User{}).Where("id = ? AND "+commonGroupCol+" = ?", sub.UserId, plan.UpgradeGroup).
+				Update("group", sub.OriginalGroup)
+			if result.Error != nil {
+				return result.Error
+			}
+			downgraded = result.RowsAffected > 0
+		}
+		sub.Status = SubscriptionStatusExpired
+		sub.UpdatedTime = common.GetTimestamp()
+		return tx.Save(sub).Error
+	})
+	if err != nil {
+		return err
+	}
+	_ = invalidateUserCache(sub.UserId)
+	refreshUserSubscriptionAllowance(sub.UserId)
+	msg := fmt.Sprintf("订阅套餐 %s 已到期失效", plan.Name)
+	if downgraded {
+		msg += fmt.Sprintf("，分组已恢复为 %s", sub.OriginalGroup)
+	}
+	RecordLog(sub.UserId, LogTypeSystem, msg)
+	return nil
+}
+
+func getSubscriptionByStripeId(stripeSubscriptionId string, referenceId string) (*Subscription, error) {
+	sub := &Subscription{}
+	var err error
+	if referenceId != "" {
+		err = DB.Where("reference_id = ?", referenceId).First(sub).Error
+	} else if stripeSubscriptionId != "" {
+		err = DB.Where("stripe_subscription_id = ?", stripeSubscriptionId).First(sub).Error
+	} else {
+		return nil, errors.New("未提供订阅标识")
+	}
+	if err != nil {
+		return nil, errors.New("订阅记录不存在")
+	}
+	return sub, nil
+}
+
+// ExpireOverdueSubscriptions 使周期结束且超过宽限期仍未续费的订阅失效，兜底 webhook 丢失的情况
+func ExpireOverdueSubscriptions() {
+	var subs []*Subscription
+	deadline := common.GetTimestamp() - subscriptionLapseGraceSeconds
+	err := DB.Where("status IN ? AND current_period_end > 0 AND current_period_end < ?",
+		[]string{SubscriptionStatusActive, SubscriptionStatusCanceled}, deadline).Find(&subs).Error
+	if err != nil {
+		common.SysLog("failed to query overdue subscriptions: " + err.Error())
+		return
+	}
+	for _, sub := range subs {
+		if err := lapseSubscription(sub.Id); err != nil {
+			common.SysLog(fmt.Sprintf("failed to expire subscription %d: %s", sub.Id, err.Error()))
+		}
+	}
+}
+
+func AutomaticallyExpireSubscriptions(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		ExpireOverdueSubscriptions()
+	}
+}
+
+func loadActiveSubscriptionAllowances(userId int) (map[int]*ActiveSubscriptionAllowance, error) {
+	var subs []*Subscription
+	query := DB.Where("status IN ?", []string{SubscriptionStatusActive, SubscriptionStatusCanceled})
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if err := query.Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[int]*ActiveSubscriptionAllowance)
+	plans := make(map[int]*SubscriptionPlan)
+	for _, sub := range subs {
+		plan, ok := plans[sub.PlanId]
+		if !ok {
+			plan, _ = GetSubscriptionPlanById(sub.PlanId)
+			plans[sub.PlanId] = plan
+		}
+		allowances := plan.GetModelAllowances()
+		if len(allowances) == 0 {
+			continue
+		}
+		result[sub.UserId] = &ActiveSubscriptionAllowance{
+			SubscriptionId: sub.Id,
+			PeriodStart:    sub.CurrentPeriodStart,
+			Allowances:     allowances,
+		}
+	}
+	return result, nil
+}
+
+func InitSubscriptionAllowanceCache() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	allowances, err := loadActiveSubscriptionAllowances(0)
+	if err != nil {
+		common.SysLog("failed to sync subscription allowances: " + err.Error())
+		return
+	}
+	subscriptionAllowanceSyncLock.Lock()
+	user2SubscriptionAllowance = allowances
+	subscriptionAllowanceSyncLock.Unlock()
+}
+
+func SyncSubscriptionAllowanceCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		InitSubscriptionAllowanceCache()
+	}
+}
+
+func refreshUserSubscriptionAllowance(userId int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	allowances, err := loadActiveSubscriptionAllowances(userId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to refresh subscription allowance of user %d: %s", userId, err.Error()))
+		return
+	}
+	subscriptionAllowanceSyncLock.Lock()
+	if allowance, ok := allowances[userId]; ok {
+		user2SubscriptionAllowance[userId] = allowance
+	} else {
+		delete(user2SubscriptionAllowance, userId)
+	}
+	subscriptionAllowanceSyncLock.Unlock()
+}
+
+func getUserSubscriptionAllowance(userId int) *ActiveSubscriptionAllowance {
+	if !common.MemoryCacheEnabled {
+		allowances, err := loadActiveSubscriptionAllowances(userId)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to get subscription allowance of user %d: %s", userId, err.Error()))
+			return nil
+		}
+		return allowances[userId]
+	}
+	subscriptionAllowanceSyncLock.RLock()
+	defer subscriptionAllowanceSyncLock.RUnlock()
+	return user2SubscriptionAllowance[userId]
+}
+
+// ConsumeSubscriptionAllowance 占用一次订阅的模型请求次数
+// 返回匹配到的限制规则（为空表示该模型不受订阅限制）以及是否已超出限制
+func ConsumeSubscriptionAllowance(userId int, modelName string) (string, bool, error) {
+	allowance := getUserSubscriptionAllowance(userId)
+	if allowance == nil {
+		return "", false, nil
+	}
+	var pattern string
+	bestScore := -1
+	for p := range allowance.Allowances {
+		if ok, score := MatchPriceOverrideModel(p, modelName); ok && score > bestScore {
+			pattern = p
+			bestScore = score
+		}
+	}
+	if pattern == "" {
+		return "", false, nil
+	}
+	limit := allowance.Allowances[pattern]
+
+	result := DB.Model(&SubscriptionAllowanceUsage{}).
+		Where("subscription_id = ? AND model = ? AND period_start = ? AND used < ?", allowance.SubscriptionId, pattern, allowance.PeriodStart, limit).
+		Update("used", gorm.Expr("used + 1"))
+	if result.Error != nil {
+		return pattern, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return pattern, false, nil
+	}
+	if limit <= 0 {
+		return pattern, true, nil
+	}
+	var count int64
+	err := DB.Model(&SubscriptionAllowanceUsage{}).
+		Where("subscription_id = ? AND model = ? AND period_start = ?", allowance.SubscriptionId, pattern, allowance.PeriodStart).
+		Count(&count).Error
+	if err != nil {
+		return pattern, false, err
+	}
+	if count > 0 {
+		return pattern, true, nil
+	}
+	err = DB.Create(&SubscriptionAllowanceUsage{
+		SubscriptionId: allowance.SubscriptionId,
+		Model:          pattern,
+		PeriodStart:    allowance.PeriodStart,
+		Used:           1,
+	}).Error
+	if err != nil {
+		// 并发创建冲突时重新走一次累加逻辑
+		result = DB.Model(&SubscriptionAllowanceUsage{}).
+			Where("subscription_id = ? AND model = ? AND period_start = ? AND used < ?", allowance.SubscriptionId, pattern, allowance.PeriodStart, limit).
+			Update("used", gorm.Expr("used + 1"))
+		if result.Error != nil {
+			return pattern, false, result.Error
+		}
+		return pattern, result.RowsAffected == 0, nil
+	}
+	return pattern, false, nil
+}
+
+// ReturnSubscriptionAllowance 请求失败时归还占用的模型请求次数
+func ReturnSubscriptionAllowance(userId int, pattern string) {
+	allowance := getUserSubscriptionAllowance(userId)
+	if allowance == nil || pattern == "" {
+		return
+	}
+	err := DB.Model(&SubscriptionAllowanceUsage{}).
+		Where("subscription_id = ? AND model = ? AND period_start = ? AND used > 0", allowance.SubscriptionId, pattern, allowance.PeriodStart).
+		Update("used", gorm.Expr("used - 1")).Error
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to return subscription allowance of user %d: %s", userId, err.Error()))
+	}
+}
+
+func GetSubscriptionAllowanceUsages(subscriptionId int, periodStart int64) ([]*SubscriptionAllowanceUsage, error) {
+	var usages []*SubscriptionAllowanceUsage
+	err := DB.Where("subscription_id = ? AND period_start = ?", subscriptionId, periodStart).Find(&usages).Error
+	return usages, err
+}
+
+// BindStripeSubscription 结账完成后记录 Stripe 订阅 ID，额度发放以 invoice.paid 通知为准
+func BindStripeSubscription(referenceId string, stripeSubscriptionId string) error {
+	if referenceId == "" || stripeSubscriptionId == "" {
+		return errors.New("未提供订阅标识")
+	}
+	return DB.Model(&Subscription{}).Where("reference_id = ?", referenceId).Updates(map[string]interface{}{
+		"stripe_subscription_id": stripeSubscriptionId,
+		"updated_time":           common.GetTimestamp(),
+	}).Error
+}
+
+// ExpirePendingSubscription 订阅结账会话过期，未付款的订阅记录直接标记为失效
+func ExpirePendingSubscription(referenceId string) error {
+	return DB.Model(&Subscription{}).
+		Where("reference_id = ? AND status = ?", referenceId, SubscriptionStatusPending).
+		Updates(map[string]interface{}{"status": SubscriptionStatusExpired, "updated_time": common.GetTimestamp()}).Error
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"slices"
 	"time"
 
 	"github.com/QuantumNous/new-api/constant"
@@ -290,6 +291,22 @@ func GetByTaskIds(userId int, taskIds []any) ([]*Task, error) {
 	return task, nil
 }
 
+// GetUserPlatformTasks 按 id 倒序查询用户某个平台的任务，afterId 返回比该任务更早的任务，beforeId 返回比该任务更新的任务
+func GetUserPlatformTasks(userId int, platform constant.TaskPlatform, beforeId int64, afterId int64, limit int) ([]*Task, error) {
+	var tasks []*Task
+	query := DB.Where("user_id = ? and platform = ?", userId, platform)
+	if beforeId > 0 {
+		err := query.Where("id > ?", beforeId).Order("id").Limit(limit).Find(&tasks).Error
+		slices.Reverse(tasks)
+		return tasks, err
+	}
+	if afterId > 0 {
+		query = query.Where("id < ?", afterId)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
 func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
@@ -440,3 +457,24 @@ func (t *Task) ToOpenAIVideo() *dto.OpenAIVideo {
 	openAIVideo.SetMetadata("url", t.FailReason)
 	return openAIVideo
 }
+
+// TaskQueueStat 各平台未完成的任务数，用于监控指标
+type TaskQueueStat struct {
+	Platform string
+	Count    int64
+}
+
+func CountUnfinishedTasksByPlatform() (stats []TaskQueueStat, err error) {
+	err = DB.Model(&Task{}).Select("platform, COUNT(*) AS count").
+		Where("progress != ?", "100%").Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Group("platform").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	var mjCount int64
+	if err = DB.Model(&Midjourney{}).Where("progress != ?", "100%").Count(&mjCount).Error; err != nil {
+		return nil, err
+	}
+	stats = append(stats, TaskQueueStat{Platform: string(constant.TaskPlatformMidjourney), Count: mjCount})
+	return stats, nil
+}
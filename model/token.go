@@ -33,6 +33,7 @@ type Token struct {
 	Group              string         `json:"group" gorm:"default:''"`                               // 单分组(向后兼容)
 	GroupPriorities    string         `json:"group_priorities" gorm:"type:varchar(2048);default:''"` // 多分组优先级(JSON)
 	AutoSmartGroup     bool           `json:"auto_smart_group" gorm:"default:false"`                 // 自动智能分组
+	Prepaid            bool           `json:"prepaid" gorm:"default:false"`                          // 兑换码发放的令牌，额度由令牌自身承担，不扣减用户额度
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -270,8 +271,18 @@ func (token *Token) Update() (err error) {
 			})
 		}
 	}()
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "group_priorities", "auto_smart_group").Updates(token).Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var oldRemainQuota int
+		if err := tx.Model(&Token{}).Where("id = ?", token.Id).Select("remain_quota").Scan(&oldRemainQuota).Error; err != nil {
+			return err
+		}
+		err := tx.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
+			"model_limits_enabled", "model_limits", "allow_ips", "group", "group_priorities", "auto_smart_group").Updates(token).Error
+		if err != nil {
+			return err
+		}
+		return recordQuotaLedger(tx, LedgerAccountToken, token.Id, token.RemainQuota-oldRemainQuota, LedgerReasonTokenEdit, "")
+	})
 	return err
 }
 
@@ -348,7 +359,7 @@ func DeleteTokenById(id int, userId int) (err error) {
 	return token.Delete()
 }
 
-func IncreaseTokenQuota(id int, key string, quota int) (err error) {
+func IncreaseTokenQuota(id int, key string, quota int, reason string, referenceId string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -361,24 +372,17 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 		})
 	}
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
+		addNewQuotaRecord(BatchUpdateTypeTokenQuota, id, quota, reason, referenceId)
 		return nil
 	}
-	return increaseTokenQuota(id, quota)
+	return increaseTokenQuota(id, quota, reason, referenceId)
 }
 
-func increaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
-			"used_quota":    gorm.Expr("used_quota - ?", quota),
-			"accessed_time": common.GetTimestamp(),
-		},
-	).Error
-	return err
+func increaseTokenQuota(id int, quota int, reason string, referenceId string) (err error) {
+	return updateTokenQuotaWithLedger(id, quota, reason, referenceId)
 }
 
-func DecreaseTokenQuota(id int, key string, quota int) (err error) {
+func DecreaseTokenQuota(id int, key string, quota int, reason string, referenceId string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -391,21 +395,14 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 		})
 	}
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
+		addNewQuotaRecord(BatchUpdateTypeTokenQuota, id, -quota, reason, referenceId)
 		return nil
 	}
-	return decreaseTokenQuota(id, quota)
+	return decreaseTokenQuota(id, quota, reason, referenceId)
 }
 
-func decreaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
-			"used_quota":    gorm.Expr("used_quota + ?", quota),
-			"accessed_time": common.GetTimestamp(),
-		},
-	).Error
-	return err
+func decreaseTokenQuota(id int, quota int, reason string, referenceId string) (err error) {
+	return updateTokenQuotaWithLedger(id, -quota, reason, referenceId)
 }
 
 // CountUserTokens returns total number of tokens for the given user, used for pagination
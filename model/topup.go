@@ -9,6 +9,7 @@ import (
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TopUp struct {
@@ -21,6 +22,8 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	CouponCode    string  `json:"coupon_code" gorm:"type:varchar(64);index"`
+	BonusQuota    int     `json:"bonus_quota" gorm:"type:int;default:0"` // 优惠码赠送额度，支付成功时发放
 }
 
 func (topUp *TopUp) Insert() error {
@@ -60,7 +63,8 @@ func Recharge(referenceId string, customerId string) (err error) {
 		return errors.New("未提供支付单号")
 	}
 
-	var quota float64
+	var quota int
+	var bonus int
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -78,6 +82,11 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return errors.New("充值订单状态错误")
 		}
 
+		bonus, err = applyTopUpCoupon(tx, topUp)
+		if err != nil {
+			return err
+		}
+
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
 		err = tx.Save(topUp).Error
@@ -85,11 +94,15 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
+		// 余额与账本使用同一个整数额度
+		quota = int(decimal.NewFromFloat(topUp.Money).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).IntPart())
+		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota+bonus)}).Error
 		if err != nil {
 			return err
 		}
+		if err = recordTopUpLedger(tx, topUp, quota, bonus); err != nil {
+			return err
+		}
 
 		return nil
 	})
@@ -98,11 +111,79 @@ func Recharge(referenceId string, customerId string) (err error) {
 		return errors.New("充值失败，" + err.Error())
 	}
 
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(quota), topUp.Amount)+couponBonusLogSuffix(topUp, bonus))
+
+	return nil
+}
+
+// RechargeEpay 易支付回调完成订单：在同一事务中标记订单成功、核销优惠码并增加用户额度，订单已处理时直接返回
+func RechargeEpay(tradeNo string) error {
+	if tradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+
+	var quotaToAdd int
+	var bonus int
+	var completed bool
+	topUp := &TopUp{}
+
+	refCol := "`trade_no`"
+	if common.UsingPostgreSQL {
+		refCol = `"trade_no"`
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if topUp.Status != common.TopUpStatusPending {
+			return nil
+		}
+
+		dAmount := decimal.NewFromInt(topUp.Amount)
+		dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+		quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
+
+		var err error
+		bonus, err = applyTopUpCoupon(tx, topUp)
+		if err != nil {
+			return err
+		}
+
+		topUp.CompleteTime = common.GetTimestamp()
+		topUp.Status = common.TopUpStatusSuccess
+		if err = tx.Save(topUp).Error; err != nil {
+			return err
+		}
+		if err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd+bonus)).Error; err != nil {
+			return err
+		}
+		if err = recordTopUpLedger(tx, topUp, quotaToAdd, bonus); err != nil {
+			return err
+		}
+		completed = true
+		return nil
+	})
+	if err != nil {
+		return errors.New("充值失败，" + err.Error())
+	}
+	if !completed {
+		return nil
+	}
 
+	_ = invalidateUserCache(topUp.UserId)
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", logger.LogQuota(quotaToAdd), topUp.Money)+couponBonusLogSuffix(topUp, bonus))
 	return nil
 }
 
+// recordTopUpLedger 充值到账记账，优惠码赠送额度单独记一笔
+func recordTopUpLedger(tx *gorm.DB, topUp *TopUp, quota int, bonus int) error {
+	if err := recordQuotaLedger(tx, LedgerAccountUser, topUp.UserId, quota, LedgerReasonTopUp, topUp.TradeNo); err != nil {
+		return err
+	}
+	return recordQuotaLedger(tx, LedgerAccountUser, topUp.UserId, bonus, LedgerReasonCoupon, topUp.TradeNo)
+}
+
 func GetUserTopUps(userId int, pageInfo *common.PageInfo) (topups []*TopUp, total int64, err error) {
 	// Start transaction
 	tx := DB.Begin()
@@ -247,10 +328,11 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	var userId int
 	var quotaToAdd int
+	var bonus int
 	var payMoney float64
+	topUp := &TopUp{}
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
-		topUp := &TopUp{}
 		// 行级锁，避免并发补单
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
 			return errors.New("充值订单不存在")
@@ -280,6 +362,12 @@ func ManualCompleteTopUp(tradeNo string) error {
 			return errors.New("无效的充值额度")
 		}
 
+		var err error
+		bonus, err = applyTopUpCoupon(tx, topUp)
+		if err != nil {
+			return err
+		}
+
 		// 标记完成
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
@@ -288,7 +376,10 @@ func ManualCompleteTopUp(tradeNo string) error {
 		}
 
 		// 增加用户额度（立即写库，保持一致性）
-		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd+bonus)).Error; err != nil {
+			return err
+		}
+		if err := recordTopUpLedger(tx, topUp, quotaToAdd, bonus); err != nil {
 			return err
 		}
 
@@ -302,7 +393,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 	}
 
 	// 事务外记录日志，避免阻塞
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney)+couponBonusLogSuffix(topUp, bonus))
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -311,6 +402,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	var quota int64
+	var bonus int
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -328,6 +420,11 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return errors.New("充值订单状态错误")
 		}
 
+		bonus, err = applyTopUpCoupon(tx, topUp)
+		if err != nil {
+			return err
+		}
+
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
 		err = tx.Save(topUp).Error
@@ -340,7 +437,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 
 		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
 		updateFields := map[string]interface{}{
-			"quota": gorm.Expr("quota + ?", quota),
+			"quota": gorm.Expr("quota + ?", quota+int64(bonus)),
 		}
 
 		// 如果有客户邮箱，尝试更新用户邮箱（仅当用户邮箱为空时）
@@ -362,6 +459,9 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 		if err != nil {
 			return err
 		}
+		if err = recordTopUpLedger(tx, topUp, int(quota), bonus); err != nil {
+			return err
+		}
 
 		return nil
 	})
@@ -370,7 +470,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 		return errors.New("充值失败，" + err.Error())
 	}
 
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money)+couponBonusLogSuffix(topUp, bonus))
 
 	return nil
 }
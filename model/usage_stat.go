@@ -0,0 +1,372 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	UsageBucketHour  = "hour"
+	UsageBucketDay   = "day"
+	UsageBucketMonth = "month"
+	UsageBucketNone  = "none" // 不按时间分桶，仅按维度汇总
+)
+
+// usageDimensionColumns 可用于分组及筛选的维度与 usage_stats 表列的对应关系
+var usageDimensionColumns = map[string]string{
+	"user":         "user_id",
+	"token":        "token_id",
+	"model":        "model_name",
+	"channel":      "channel_id",
+	"group":        "using_group",
+	"relay_format": "relay_format",
+}
+
+// UsageStat 按小时及用户、令牌、模型、渠道、分组、请求格式汇总的用量，用于用量分析，避免直接聚合 logs 表
+type UsageStat struct {
+	Id               int    `json:"id"`
+	BucketTime       int64  `json:"bucket_time" gorm:"bigint;uniqueIndex:idx_us_dims,priority:1;index"`
+	UserId           int    `json:"user_id" gorm:"uniqueIndex:idx_us_dims,priority:2;index"`
+	TokenId          int    `json:"token_id" gorm:"uniqueIndex:idx_us_dims,priority:3"`
+	ModelName        string `json:"model_name" gorm:"size:128;uniqueIndex:idx_us_dims,priority:4"`
+	ChannelId        int    `json:"channel_id" gorm:"uniqueIndex:idx_us_dims,priority:5"`
+	UsingGroup       string `json:"group" gorm:"column:using_group;size:64;uniqueIndex:idx_us_dims,priority:6"`
+	RelayFormat      string `json:"relay_format" gorm:"size:32;uniqueIndex:idx_us_dims,priority:7"`
+	RequestCount     int64  `json:"request_count" gorm:"bigint;default:0"`
+	ErrorCount       int64  `json:"error_count" gorm:"bigint;default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+}
+
+// UsageQuery 用量分析查询条件，GroupBy 取值见 usageDimensionColumns
+type UsageQuery struct {
+	StartTime   int64
+	EndTime     int64
+	Bucket      string
+	GroupBy     []string
+	UserId      int
+	TokenId     int
+	ModelName   string
+	ChannelId   int
+	Group       string
+	RelayFormat string
+}
+
+// UsageRow 用量分析结果，未参与分组的维度不返回
+type UsageRow struct {
+	BucketTime       int64  `json:"bucket_time,omitempty"`
+	UserId           int    `json:"user_id,omitempty"`
+	Username         string `json:"username,omitempty"`
+	TokenId          int    `json:"token_id,omitempty"`
+	TokenName        string `json:"token_name,omitempty"`
+	ModelName        string `json:"model_name,omitempty"`
+	ChannelId        int    `json:"channel_id,omitempty"`
+	ChannelName      string `json:"channel_name,omitempty"`
+	UsingGroup       string `json:"group,omitempty" gorm:"column:using_group"`
+	RelayFormat      string `json:"relay_format,omitempty"`
+	RequestCount     int64  `json:"request_count"`
+	ErrorCount       int64  `json:"error_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens" gorm:"-"`
+	Quota            int64  `json:"quota"`
+}
+
+var usageStatCache = make(map[string]*UsageStat)
+var usageStatCacheLock sync.Mutex
+
+func recordUsage(stat UsageStat) {
+	if !common.DataExportEnabled {
+		return
+	}
+	bucketTime := common.GetTimestamp()
+	stat.BucketTime = bucketTime - bucketTime%3600
+	key := fmt.Sprintf("%d-%d-%d-%s-%d-%s-%s", stat.BucketTime, stat.UserId, stat.TokenId, stat.ModelName,
+		stat.ChannelId, stat.UsingGroup, stat.RelayFormat)
+
+	usageStatCacheLock.Lock()
+	defer usageStatCacheLock.Unlock()
+	cached, ok := usageStatCache[key]
+	if !ok {
+		usageStatCache[key] = &stat
+		return
+	}
+	cached.RequestCount += stat.RequestCount
+	cached.ErrorCount += stat.ErrorCount
+	cached.PromptTokens += stat.PromptTokens
+	cached.CompletionTokens += stat.CompletionTokens
+	cached.Quota += stat.Quota
+}
+
+// recordConsumeUsage 根据消费日志累计用量
+func recordConsumeUsage(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	recordUsage(UsageStat{
+		UserId:           userId,
+		TokenId:          params.TokenId,
+		ModelName:        params.ModelName,
+		ChannelId:        params.ChannelId,
+		UsingGroup:       params.Group,
+		RelayFormat:      common.GetContextKeyString(c, constant.ContextKeyRelayFormat),
+		RequestCount:     1,
+		PromptTokens:     int64(params.PromptTokens),
+		CompletionTokens: int64(params.CompletionTokens),
+		Quota:            int64(params.Quota),
+	})
+}
+
+// RecordUsageError 记录一次失败的请求，维度取自请求上下文，渠道为最后一次尝试的渠道
+func RecordUsageError(c *gin.Context) {
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	if userId == 0 {
+		return
+	}
+	recordUsage(UsageStat{
+		UserId:       userId,
+		TokenId:      common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		ModelName:    common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		ChannelId:    common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		UsingGroup:   common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		RelayFormat:  common.GetContextKeyString(c, constant.ContextKeyRelayFormat),
+		RequestCount: 1,
+		ErrorCount:   1,
+	})
+}
+
+// SaveUsageStatCache 将内存中的用量累加写入 usage_stats 表
+func SaveUsageStatCache() {
+	usageStatCacheLock.Lock()
+	cache := usageStatCache
+	usageStatCache = make(map[string]*UsageStat)
+	usageStatCacheLock.Unlock()
+
+	for _, stat := range cache {
+		err := increaseUsageStat(stat)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to save usage stat: %s", err.Error()))
+		}
+	}
+}
+
+func increaseUsageStat(stat *UsageStat) error {
+	query := DB.Model(&UsageStat{}).Where(
+		"bucket_time = ? AND user_id = ? AND token_id = ? AND model_name = ? AND channel_id = ? AND using_group = ? AND relay_format = ?",
+		stat.BucketTime, stat.UserId, stat.TokenId, stat.ModelName, stat.ChannelId, stat.UsingGroup, stat.RelayFormat)
+	increase := func() *gorm.DB {
+		return query.Session(&gorm.Session{}).Updates(map[string]interface{}{
+			"request_count":     gorm.Expr("request_count + ?", stat.RequestCount),
+			"error_count":       gorm.Expr("error_count + ?", stat.ErrorCount),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", stat.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", stat.CompletionTokens),
+			"quota":             gorm.Expr("quota + ?", stat.Quota),
+		})
+	}
+	result := increase()
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	created := *stat
+	if err := DB.Create(&created).Error; err != nil {
+		// 其他节点已插入同一行，改为累加
+		return increase().Error
+	}
+	return nil
+}
+
+func usageBucketExpr(bucket string) (string, error) {
+	switch bucket {
+	case UsageBucketHour:
+		return "bucket_time", nil
+	case UsageBucketDay, UsageBucketMonth:
+		// 按服务器所在时区的自然日分桶，按月分桶时先按天汇总再合并
+		_, offset := time.Now().Zone()
+		return fmt.Sprintf("bucket_time - ((bucket_time + %d) %% 86400)", offset), nil
+	case UsageBucketNone, "":
+		return "", nil
+	}
+	return "", fmt.Errorf("不支持的时间粒度: %s", bucket)
+}
+
+// QueryUsage 按时间粒度及任意维度组合查询用量
+func QueryUsage(q UsageQuery) ([]*UsageRow, error) {
+	bucketExpr, err := usageBucketExpr(q.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	selects := make([]string, 0)
+	groups := make([]string, 0)
+	if bucketExpr != "" {
+		selects = append(selects, bucketExpr+" AS bucket_time")
+		groups = append(groups, bucketExpr)
+	}
+	seen := make(map[string]bool)
+	for _, dimension := range q.GroupBy {
+		column, ok := usageDimensionColumns[dimension]
+		if !ok {
+			return nil, fmt.Errorf("不支持的分组维度: %s", dimension)
+		}
+		if seen[column] {
+			continue
+		}
+		seen[column] = true
+		selects = append(selects, column)
+		groups = append(groups, column)
+	}
+	selects = append(selects, "SUM(request_count) AS request_count", "SUM(error_count) AS error_count",
+		"SUM(prompt_tokens) AS prompt_tokens", "SUM(completion_tokens) AS completion_tokens", "SUM(quota) AS quota")
+
+	query := DB.Model(&UsageStat{}).Select(strings.Join(selects, ", "))
+	if q.StartTime != 0 {
+		query = query.Where("bucket_time >= ?", q.StartTime-q.StartTime%3600)
+	}
+	if q.EndTime != 0 {
+		query = query.Where("bucket_time <= ?", q.EndTime)
+	}
+	filters := map[string]interface{}{}
+	if q.UserId != 0 {
+		filters["user_id"] = q.UserId
+	}
+	if q.TokenId != 0 {
+		filters["token_id"] = q.TokenId
+	}
+	if q.ModelName != "" {
+		filters["model_name"] = q.ModelName
+	}
+	if q.ChannelId != 0 {
+		filters["channel_id"] = q.ChannelId
+	}
+	if q.Group != "" {
+		filters["using_group"] = q.Group
+	}
+	if q.RelayFormat != "" {
+		filters["relay_format"] = q.RelayFormat
+	}
+	if len(filters) > 0 {
+		query = query.Where(filters)
+	}
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", "))
+	}
+	var rows []*UsageRow
+	if err = query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if q.Bucket == UsageBucketMonth {
+		rows = mergeUsageRowsByMonth(rows)
+	}
+	for _, row := range rows {
+		row.TotalTokens = row.PromptTokens + row.CompletionTokens
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].BucketTime != rows[j].BucketTime {
+			return rows[i].BucketTime < rows[j].BucketTime
+		}
+		return rows[i].Quota > rows[j].Quota
+	})
+	fillUsageRowNames(rows, seen)
+	return rows, nil
+}
+
+func mergeUsageRowsByMonth(rows []*UsageRow) []*UsageRow {
+	merged := make(map[string]*UsageRow)
+	result := make([]*UsageRow, 0)
+	for _, row := range rows {
+		day := time.Unix(row.BucketTime, 0)
+		row.BucketTime = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location()).Unix()
+		key := fmt.Sprintf("%d-%d-%d-%s-%d-%s-%s", row.BucketTime, row.UserId, row.TokenId, row.ModelName,
+			row.ChannelId, row.UsingGroup, row.RelayFormat)
+		existing, ok := merged[key]
+		if !ok {
+			merged[key] = row
+			result = append(result, row)
+			continue
+		}
+		existing.RequestCount += row.RequestCount
+		existing.ErrorCount += row.ErrorCount
+		existing.PromptTokens += row.PromptTokens
+		existing.CompletionTokens += row.CompletionTokens
+		existing.Quota += row.Quota
+	}
+	return result
+}
+
+// fillUsageRowNames 为分组结果补充用户名、令牌名及渠道名
+func fillUsageRowNames(rows []*UsageRow, columns map[string]bool) {
+	if len(rows) == 0 {
+		return
+	}
+	if columns["user_id"] {
+		ids := make([]int, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.UserId)
+		}
+		var users []*User
+		if err := DB.Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err == nil {
+			names := make(map[int]string, len(users))
+			for _, user := range users {
+				names[user.Id] = user.Username
+			}
+			for _, row := range rows {
+				row.Username = names[row.UserId]
+			}
+		}
+	}
+	if columns["token_id"] {
+		ids := make([]int, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.TokenId)
+		}
+		var tokens []*Token
+		if err := DB.Select("id", "name").Where("id IN ?", ids).Find(&tokens).Error; err == nil {
+			names := make(map[int]string, len(tokens))
+			for _, token := range tokens {
+				names[token.Id] = token.Name
+			}
+			for _, row := range rows {
+				row.TokenName = names[row.TokenId]
+			}
+		}
+	}
+	if columns["channel_id"] {
+		ids := make([]int, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ChannelId)
+		}
+		var channels []*Channel
+		if err := DB.Select("id", "name").Where("id IN ?", ids).Find(&channels).Error; err == nil {
+			names := make(map[int]string, len(channels))
+			for _, channel := range channels {
+				names[channel.Id] = channel.Name
+			}
+			for _, row := range rows {
+				row.ChannelName = names[row.ChannelId]
+			}
+		}
+	}
+}
+
+// ParseUsageGroupBy 解析逗号分隔的分组维度
+func ParseUsageGroupBy(groupBy string) ([]string, error) {
+	dimensions := make([]string, 0)
+	for _, dimension := range strings.Split(groupBy, ",") {
+		dimension = strings.TrimSpace(dimension)
+		if dimension == "" {
+			continue
+		}
+		if _, ok := usageDimensionColumns[dimension]; !ok {
+			return nil, errors.New("不支持的分组维度: " + dimension)
+		}
+		dimensions = append(dimensions, dimension)
+	}
+	return dimensions, nil
+}
@@ -368,6 +368,9 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := recordQuotaLedger(tx, LedgerAccountUser, user.Id, quota, LedgerReasonAffTransfer, ""); err != nil {
+		return err
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -417,7 +420,7 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, LedgerReasonInvite, strconv.Itoa(inviterId))
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -439,7 +442,8 @@ func (user *User) Update(updatePassword bool) error {
 	}
 	newUser := *user
 	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(newUser).Error; err != nil {
+	// 额度只能通过记账的方法变动，避免用旧数据覆盖余额
+	if err = DB.Model(user).Omit("quota").Updates(newUser).Error; err != nil {
 		return err
 	}
 
@@ -468,10 +472,20 @@ func (user *User) Edit(updatePassword bool) error {
 		updates["password"] = newUser.Password
 	}
 
-	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var oldQuota int
+		if err := tx.Model(&User{}).Where("id = ?", user.Id).Select("quota").Scan(&oldQuota).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordQuotaLedger(tx, LedgerAccountUser, user.Id, newUser.Quota-oldQuota, LedgerReasonAdmin, "")
+	})
+	if err != nil {
 		return err
 	}
+	DB.First(&user, user.Id)
 
 	// Update cache
 	return updateUserCache(*user)
@@ -763,7 +777,9 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
-func IncreaseUserQuota(id int, quota int, db bool) (err error) {
+// IncreaseUserQuota 增加用户额度，reason 和 referenceId 写入额度账本
+// 批量更新模式下余额变动合并写入，账本在写入时仍逐笔记录 reason 和 referenceId
+func IncreaseUserQuota(id int, quota int, db bool, reason string, referenceId string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -774,21 +790,17 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 		}
 	})
 	if !db && common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
+		addNewQuotaRecord(BatchUpdateTypeUserQuota, id, quota, reason, referenceId)
 		return nil
 	}
-	return increaseUserQuota(id, quota)
+	return increaseUserQuota(id, quota, reason, referenceId)
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	if err != nil {
-		return err
-	}
-	return err
+func increaseUserQuota(id int, quota int, reason string, referenceId string) (err error) {
+	return updateUserQuotaWithLedger(id, quota, reason, referenceId)
 }
 
-func DecreaseUserQuota(id int, quota int) (err error) {
+func DecreaseUserQuota(id int, quota int, reason string, referenceId string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -799,28 +811,24 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 		}
 	})
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+		addNewQuotaRecord(BatchUpdateTypeUserQuota, id, -quota, reason, referenceId)
 		return nil
 	}
-	return decreaseUserQuota(id, quota)
+	return decreaseUserQuota(id, quota, reason, referenceId)
 }
 
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	if err != nil {
-		return err
-	}
-	return err
+func decreaseUserQuota(id int, quota int, reason string, referenceId string) (err error) {
+	return updateUserQuotaWithLedger(id, -quota, reason, referenceId)
 }
 
-func DeltaUpdateUserQuota(id int, delta int) (err error) {
+func DeltaUpdateUserQuota(id int, delta int, reason string, referenceId string) (err error) {
 	if delta == 0 {
 		return nil
 	}
 	if delta > 0 {
-		return IncreaseUserQuota(id, delta, false)
+		return IncreaseUserQuota(id, delta, false, reason, referenceId)
 	} else {
-		return DecreaseUserQuota(id, -delta)
+		return DecreaseUserQuota(id, -delta, reason, referenceId)
 	}
 }
 
@@ -23,10 +23,14 @@ const (
 var batchUpdateStores []map[int]int
 var batchUpdateLocks []sync.Mutex
 
+// batchLedgerChanges 批量更新模式下用户、令牌额度待记账的每笔变动，余额合并写入，账本仍逐笔记录原因
+var batchLedgerChanges []map[int][]ledgerChange
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int))
 		batchUpdateLocks = append(batchUpdateLocks, sync.Mutex{})
+		batchLedgerChanges = append(batchLedgerChanges, make(map[int][]ledgerChange))
 	}
 }
 
@@ -49,6 +53,14 @@ func addNewRecord(type_ int, id int, value int) {
 	}
 }
 
+// addNewQuotaRecord 合并用户、令牌额度变动，并保留该笔变动的记账原因
+func addNewQuotaRecord(type_ int, id int, value int, reason string, referenceId string) {
+	batchUpdateLocks[type_].Lock()
+	defer batchUpdateLocks[type_].Unlock()
+	batchUpdateStores[type_][id] += value
+	batchLedgerChanges[type_][id] = append(batchLedgerChanges[type_][id], ledgerChange{delta: value, reason: reason, referenceId: referenceId})
+}
+
 func batchUpdate() {
 	// check if there's any data to update
 	hasData := false
@@ -71,17 +83,19 @@ func batchUpdate() {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
 		batchUpdateStores[i] = make(map[int]int)
+		changes := batchLedgerChanges[i]
+		batchLedgerChanges[i] = make(map[int][]ledgerChange)
 		batchUpdateLocks[i].Unlock()
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
 			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
+				err := updateUserQuotaWithLedgerChanges(key, changes[key])
 				if err != nil {
 					common.SysLog("failed to batch update user quota: " + err.Error())
 				}
 			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
+				err := updateTokenQuotaWithLedgerChanges(key, changes[key])
 				if err != nil {
 					common.SysLog("failed to batch update token quota: " + err.Error())
 				}
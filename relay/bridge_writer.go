@@ -0,0 +1,133 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatBridge 负责在两种接口格式之间转换响应，由 bridgeWriter 调用
+type formatBridge interface {
+	// ConvertData 转换一条 SSE data 数据，返回需要写出的内容
+	ConvertData(data string) []byte
+	// FinishStream 在处理函数返回后结束流式响应，返回需要补发的内容
+	FinishStream(newAPIError *types.NewAPIError) []byte
+	// ConvertBody 转换完整的非流式响应体
+	ConvertBody(body []byte) []byte
+}
+
+// bridgeWriter 拦截处理函数写出的响应并交给 formatBridge 转换。
+// 流式响应按行转换后立即发送，非流式响应缓存完整响应体，在 finish 时转换发送
+type bridgeWriter struct {
+	gin.ResponseWriter
+	stream bool
+	status int
+	buffer bytes.Buffer
+	bridge formatBridge
+}
+
+func newBridgeWriter(writer gin.ResponseWriter, stream bool, bridge formatBridge) *bridgeWriter {
+	return &bridgeWriter{ResponseWriter: writer, stream: stream, bridge: bridge}
+}
+
+func (w *bridgeWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bridgeWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *bridgeWriter) Status() int {
+	if !w.stream && w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *bridgeWriter) Flush() {
+	if w.stream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *bridgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bridgeWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区，等待后续数据
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.handleStreamLine(strings.TrimRight(line, "\r\n"))
+	}
+	return len(data), nil
+}
+
+func (w *bridgeWriter) handleStreamLine(line string) {
+	switch {
+	case strings.HasPrefix(line, "data:"):
+		w.writeStream(w.bridge.ConvertData(strings.TrimSpace(strings.TrimPrefix(line, "data:"))))
+	case strings.HasPrefix(line, ":"):
+		// 心跳等注释行原样转发
+		w.writeStream([]byte(line + "\n\n"))
+	}
+}
+
+func (w *bridgeWriter) writeStream(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	_, _ = w.ResponseWriter.Write(data)
+	w.ResponseWriter.Flush()
+}
+
+// finish 在处理函数返回后结束响应：流式补发结束事件，非流式转换并发送缓存的响应体
+func (w *bridgeWriter) finish(newAPIError *types.NewAPIError) {
+	if w.stream {
+		if w.buffer.Len() > 0 {
+			w.handleStreamLine(strings.TrimRight(w.buffer.String(), "\r\n"))
+			w.buffer.Reset()
+		}
+		w.writeStream(w.bridge.FinishStream(newAPIError))
+		return
+	}
+	if newAPIError != nil {
+		return
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := w.bridge.ConvertBody(w.buffer.Bytes())
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// sseEvent 按 "event: 类型" + "data: 数据" 的格式编码一个 SSE 事件
+func sseEvent(eventType string, data []byte) []byte {
+	return []byte("event: " + eventType + "\ndata: " + string(data) + "\n\n")
+}
@@ -52,6 +52,12 @@ type TaskAdaptor interface {
 	ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error)
 }
 
+// NativeResponsesAdaptor 由真正实现了 ConvertOpenAIResponsesRequest 的适配器实现，
+// 其余渠道的 Responses API 请求通过 Chat Completions 桥接
+type NativeResponsesAdaptor interface {
+	SupportsNativeResponses() bool
+}
+
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
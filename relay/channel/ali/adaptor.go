@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel"
@@ -46,7 +45,7 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 			fullRequestURL = fmt.Sprintf("%s/api/v1/services/rerank/text-rerank/text-rerank", info.ChannelBaseUrl)
 		case constant.RelayModeImagesGenerations:
 			fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", info.ChannelBaseUrl)
-		case constant.RelayModeImagesEdits:
+		case constant.RelayModeImagesEdits, constant.RelayModeImagesVariations:
 			if isWanModel(info.OriginModelName) {
 				fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/image2image/image-synthesis", info.ChannelBaseUrl)
 			} else {
@@ -74,7 +73,7 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *rel
 	if info.RelayMode == constant.RelayModeImagesGenerations {
 		req.Set("X-DashScope-Async", "enable")
 	}
-	if info.RelayMode == constant.RelayModeImagesEdits {
+	if info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
 		if isWanModel(info.OriginModelName) {
 			req.Set("X-DashScope-Async", "enable")
 		}
@@ -113,25 +112,24 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 			return nil, fmt.Errorf("convert image request failed: %w", err)
 		}
 		return aliRequest, nil
-	} else if info.RelayMode == constant.RelayModeImagesEdits {
+	} else if info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
 		if isWanModel(info.OriginModelName) {
-			return oaiFormEdit2WanxImageEdit(c, info, request)
+			return oaiImageEdit2WanxImageEdit(c, info, request)
 		}
 		// ali image edit https://bailian.console.aliyun.com/?tab=api#/api/?type=model&url=2976416
-		// 如果用户使用表单，则需要解析表单数据
-		if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
-			aliRequest, err := oaiFormEdit2AliImageEdit(c, info, request)
-			if err != nil {
-				return nil, fmt.Errorf("convert image edit form request failed: %w", err)
-			}
-			return aliRequest, nil
-		} else {
+		// 请求中直接给出 DashScope 格式的 input 时原样使用，否则由 OpenAI 格式的表单或 JSON 转换
+		if _, ok := request.Extra["input"]; ok {
 			aliRequest, err := oaiImage2Ali(request)
 			if err != nil {
 				return nil, fmt.Errorf("convert image request failed: %w", err)
 			}
 			return aliRequest, nil
 		}
+		aliRequest, err := oaiImageEdit2AliImageEdit(c, info, request)
+		if err != nil {
+			return nil, fmt.Errorf("convert image edit request failed: %w", err)
+		}
+		return aliRequest, nil
 	}
 	return nil, fmt.Errorf("unsupported image relay mode: %d", info.RelayMode)
 }
@@ -170,7 +168,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		switch info.RelayMode {
 		case constant.RelayModeImagesGenerations:
 			err, usage = aliImageHandler(c, resp, info)
-		case constant.RelayModeImagesEdits:
+		case constant.RelayModeImagesEdits, constant.RelayModeImagesVariations:
 			if isWanModel(info.OriginModelName) {
 				err, usage = aliImageHandler(c, resp, info)
 			} else {
@@ -11,7 +11,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func oaiFormEdit2WanxImageEdit(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (*AliImageRequest, error) {
+// oaiImageEdit2WanxImageEdit 将表单或 JSON 格式的编辑请求转换为万相图生图请求
+func oaiImageEdit2WanxImageEdit(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (*AliImageRequest, error) {
 	var err error
 	var imageRequest AliImageRequest
 	imageRequest.Model = request.Model
@@ -20,14 +21,19 @@ func oaiFormEdit2WanxImageEdit(c *gin.Context, info *relaycommon.RelayInfo, requ
 		Prompt: request.Prompt,
 	}
 
-	if err := common.UnmarshalBodyReusable(c, &wanInput); err != nil {
+	var extra struct {
+		NegativePrompt string `json:"negative_prompt"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &extra); err != nil {
 		return nil, err
 	}
-	if wanInput.Images, err = getImageBase64sFromForm(c, "image"); err != nil {
-		return nil, fmt.Errorf("get image base64s from form failed: %w", err)
+	wanInput.NegativePrompt = extra.NegativePrompt
+	if wanInput.Images, err = relaycommon.GetImageInputs(c, request); err != nil {
+		return nil, fmt.Errorf("get image inputs failed: %w", err)
 	}
 	wanParams := WanImageParameters{
-		N: int(request.N),
+		N:         int(request.N),
+		Watermark: request.Watermark,
 	}
 	imageRequest.Input = wanInput
 	imageRequest.Parameters = wanParams
@@ -142,23 +142,28 @@ func processSizeParameters(size, quality string) ImageConfig {
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	isEdit := info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations
 	if model_setting.IsGeminiModelSupportImagine(info.UpstreamModelName) {
-		var content any
-		if base64Data, err := relaycommon.GetImageBase64sFromForm(c); err == nil {
-			content = []any{
+		var content any = request.Prompt
+		if isEdit {
+			// 编辑及变体请求把输入图片与提示词放在同一条消息中
+			images, err := relaycommon.GetImageInputs(c, request)
+			if err != nil {
+				return nil, err
+			}
+			contents := []any{
 				dto.MediaContent{
 					Type: dto.ContentTypeText,
 					Text: request.Prompt,
 				},
-				dto.MediaContent{
-					Type: dto.ContentTypeFile,
-					File: &dto.MessageFile{
-						FileData: base64Data.String(),
-					},
-				},
 			}
-		} else {
-			content = request.Prompt
+			for _, image := range images {
+				contents = append(contents, dto.MediaContent{
+					Type:     dto.ContentTypeImageURL,
+					ImageUrl: &dto.MessageImageUrl{Url: image},
+				})
+			}
+			content = contents
 		}
 
 		chatRequest := dto.GeneralOpenAIRequest{
@@ -185,6 +190,10 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 		return a.ConvertOpenAIRequest(c, info, &chatRequest)
 	}
 
+	if isEdit {
+		return nil, fmt.Errorf("模型 %s 不支持图片编辑，请使用支持图片输出的 Gemini 模型", info.UpstreamModelName)
+	}
+
 	// convert size to aspect ratio but allow user to specify aspect ratio
 	aspectRatio := "1:1" // default aspect ratio
 	size := strings.TrimSpace(request.Size)
@@ -123,10 +123,21 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 		inputPayload["prompt_upsampling"] = true
 	}
 
-	if info.RelayMode == relayconstant.RelayModeImagesEdits {
-		imageURL, err := uploadFileFromForm(c, info, "image", "image[]", "image_prompt")
-		if err != nil {
-			return nil, err
+	if info.RelayMode == relayconstant.RelayModeImagesEdits || info.RelayMode == relayconstant.RelayModeImagesVariations {
+		var imageURL string
+		if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+			uploadedURL, err := uploadFileFromForm(c, info, "image", "image[]", "image_prompt")
+			if err != nil {
+				return nil, err
+			}
+			imageURL = uploadedURL
+		} else {
+			// JSON 请求中的图片 URL 或 data URL 直接交给 Replicate
+			images, err := relaycommon.GetImageInputs(c, request)
+			if err != nil {
+				return nil, err
+			}
+			imageURL = images[0]
 		}
 		if imageURL == "" {
 			return nil, errors.New("replicate adaptor: image file is required for edits")
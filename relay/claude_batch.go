@@ -0,0 +1,537 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// claudeBatchMaxRequests Anthropic 单个消息批处理的请求数上限
+const claudeBatchMaxRequests = 100000
+
+// ClaudeBatchModelPrice 消息批处理中一个模型的计费信息，提交时按当时的倍率及批处理折扣确定
+type ClaudeBatchModelPrice struct {
+	OriginModelName   string          `json:"origin_model_name"`
+	UpstreamModelName string          `json:"upstream_model_name"`
+	PriceData         types.PriceData `json:"price_data"`
+}
+
+// ClaudeBatchTaskData 消息批处理任务的 Data，保存最近一次查询到的上游批处理对象及结算所需的信息
+type ClaudeBatchTaskData struct {
+	Batch   *dto.ClaudeMessageBatch  `json:"batch"`
+	TokenId int                      `json:"token_id"`
+	Models  []*ClaudeBatchModelPrice `json:"models"`
+	// RequestModels 批处理包含多个模型时记录每个 custom_id 对应的模型下标
+	RequestModels map[string]int `json:"request_models,omitempty"`
+}
+
+// claudeBatchUsage 结算时按模型汇总的成功结果用量
+type claudeBatchUsage struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Quota            int
+}
+
+func GetClaudeBatchTaskData(task *model.Task) (*ClaudeBatchTaskData, error) {
+	var data ClaudeBatchTaskData
+	if err := task.GetData(&data); err != nil {
+		return nil, err
+	}
+	if data.Batch == nil || len(data.Models) == 0 {
+		return nil, fmt.Errorf("invalid message batch task data: %s", task.TaskID)
+	}
+	return &data, nil
+}
+
+// ClaudeBatchResponse 返回给用户的批处理对象，results_url 指向本站的结果接口
+func ClaudeBatchResponse(batch *dto.ClaudeMessageBatch) *dto.ClaudeMessageBatch {
+	response := *batch
+	if batch.ResultsUrl != nil {
+		resultsUrl := fmt.Sprintf("%s/v1/messages/batches/%s/results", strings.TrimSuffix(system_setting.ServerAddress, "/"), batch.Id)
+		response.ResultsUrl = &resultsUrl
+	}
+	return &response
+}
+
+func doClaudeBatchRequest(ctx context.Context, channel *model.Channel, key string, method string, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[channel.Type]
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+"/v1/messages/batches"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	anthropicVersion := "2023-06-01"
+	if header != nil {
+		if version := header.Get("anthropic-version"); version != "" {
+			anthropicVersion = version
+		}
+		if beta := header.Get("anthropic-beta"); beta != "" {
+			req.Header.Set("anthropic-beta", beta)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", key)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	client := service.GetHttpClient()
+	if proxy := channel.GetSetting().Proxy; proxy != "" {
+		client, err = service.NewProxyHttpClient(proxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client.Do(req)
+}
+
+// claudeBatchTaskRequest 使用提交批处理时的渠道及密钥请求上游，非 200 响应转换为错误
+func claudeBatchTaskRequest(ctx context.Context, task *model.Task, method string, path string, header http.Header) (*http.Response, *types.NewAPIError) {
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+	}
+	key := task.PrivateData.Key
+	if key == "" {
+		key = channel.Key
+	}
+	resp, err := doClaudeBatchRequest(ctx, channel, key, method, path, nil, header)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, service.RelayErrorHandler(ctx, resp, false)
+	}
+	return resp, nil
+}
+
+func decodeClaudeBatch(resp *http.Response) (*dto.ClaudeMessageBatch, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeReadResponseBodyFailed, types.ErrOptionWithSkipRetry())
+	}
+	var batch dto.ClaudeMessageBatch
+	if err = common.Unmarshal(body, &batch); err != nil || batch.Id == "" {
+		return nil, types.NewError(fmt.Errorf("invalid message batch response: %s", string(body)), types.ErrorCodeBadResponseBody, types.ErrOptionWithSkipRetry())
+	}
+	return &batch, nil
+}
+
+func FetchClaudeBatch(ctx context.Context, task *model.Task, header http.Header) (*dto.ClaudeMessageBatch, *types.NewAPIError) {
+	resp, apiErr := claudeBatchTaskRequest(ctx, task, http.MethodGet, "/"+task.TaskID, header)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return decodeClaudeBatch(resp)
+}
+
+func CancelClaudeBatch(ctx context.Context, task *model.Task, header http.Header) (*dto.ClaudeMessageBatch, *types.NewAPIError) {
+	resp, apiErr := claudeBatchTaskRequest(ctx, task, http.MethodPost, "/"+task.TaskID+"/cancel", header)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return decodeClaudeBatch(resp)
+}
+
+// OpenClaudeBatchResults 打开上游的结果 JSONL，调用方负责关闭响应
+func OpenClaudeBatchResults(ctx context.Context, task *model.Task, header http.Header) (*http.Response, *types.NewAPIError) {
+	return claudeBatchTaskRequest(ctx, task, http.MethodGet, "/"+task.TaskID+"/results", header)
+}
+
+// claudeBatchModelPrice 校验令牌及渠道是否可以使用该模型，并按渠道的模型重定向及批处理折扣计算计费信息
+func claudeBatchModelPrice(c *gin.Context, channel *model.Channel, modelName string) (*ClaudeBatchModelPrice, *types.NewAPIError) {
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+		if !tokenModelLimit[ratio_setting.FormatMatchingModelName(modelName)] {
+			return nil, types.NewErrorWithStatusCode(fmt.Errorf("该令牌无权访问模型 %s", modelName), types.ErrorCodeAccessDenied, http.StatusForbidden, types.ErrOptionWithSkipRetry())
+		}
+	}
+	if !lo.Contains(channel.GetModels(), modelName) {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("渠道 #%d 不支持模型 %s，同一消息批处理中的模型需由同一渠道提供", channel.Id, modelName),
+			types.ErrorCodeModelNotFound, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	info := relaycommon.GenRelayInfoClaude(c, nil)
+	if info.TokenPrepaid {
+		return nil, types.NewErrorWithStatusCode(service.ErrPrepaidTokenUnsupported, types.ErrorCodeInvalidRequest, http.StatusForbidden, types.ErrOptionWithSkipRetry())
+	}
+	info.InitChannelMeta(c)
+	info.OriginModelName = modelName
+	info.UpstreamModelName = modelName
+	if err := helper.ModelMappedHelper(c, info, nil); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+	priceData, err := helper.ModelPriceHelper(c, info, 0, &types.TokenCountMeta{})
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithSkipRetry())
+	}
+	return &ClaudeBatchModelPrice{
+		OriginModelName:   modelName,
+		UpstreamModelName: info.UpstreamModelName,
+		PriceData:         priceData,
+	}, nil
+}
+
+// estimateClaudeBatchRequestQuota 按预扣费方式估算单条请求的额度
+func estimateClaudeBatchRequestQuota(price *ClaudeBatchModelPrice, params []byte) int {
+	priceData := price.PriceData
+	groupRatio := priceData.GroupRatioInfo.GroupRatio
+	if priceData.UsePrice {
+		return int(priceData.ModelPrice * common.QuotaPerUnit * groupRatio)
+	}
+	tokens := common.Max(service.CountTextToken(string(params), price.OriginModelName), common.PreConsumedQuota)
+	tokens += int(gjson.GetBytes(params, "max_tokens").Int())
+	return int(float64(tokens) * priceData.ModelRatio * groupRatio)
+}
+
+// claudeBatchResultQuota 按单条成功结果返回的用量计算额度，计算方式与 Claude 请求的后扣费一致
+func claudeBatchResultQuota(priceData types.PriceData, usage *dto.ClaudeUsage) int {
+	groupRatio := priceData.GroupRatioInfo.GroupRatio
+	if priceData.UsePrice {
+		return int(priceData.ModelPrice * common.QuotaPerUnit * groupRatio)
+	}
+	if usage == nil {
+		return 0
+	}
+	cacheCreationTokens5m := usage.GetCacheCreation5mTokens()
+	cacheCreationTokens1h := usage.GetCacheCreation1hTokens()
+	quota := float64(usage.InputTokens)
+	quota += float64(usage.CacheReadInputTokens) * priceData.CacheRatio
+	quota += float64(cacheCreationTokens5m) * priceData.CacheCreation5mRatio
+	quota += float64(cacheCreationTokens1h) * priceData.CacheCreation1hRatio
+	if remaining := usage.CacheCreationInputTokens - cacheCreationTokens5m - cacheCreationTokens1h; remaining > 0 {
+		quota += float64(remaining) * priceData.CacheCreationRatio
+	}
+	quota += float64(usage.OutputTokens) * priceData.CompletionRatio
+	quota = quota * groupRatio * priceData.ModelRatio
+	if priceData.ModelRatio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return int(quota)
+}
+
+// RelayClaudeBatchSubmit 校验并预扣费后将消息批处理原样提交给 Anthropic 渠道，批处理记录为异步任务，由任务轮询在结束后结算
+func RelayClaudeBatchSubmit(c *gin.Context) (*model.Task, *types.NewAPIError) {
+	var request dto.ClaudeMessageBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if len(request.Requests) == 0 || len(request.Requests) > claudeBatchMaxRequests {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("requests 数量需在 1 到 %d 之间", claudeBatchMaxRequests),
+			types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	info := relaycommon.GenRelayInfoClaude(c, nil)
+	info.InitChannelMeta(c)
+	if info.ChannelType != constant.ChannelTypeAnthropic {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("渠道类型 %s 不支持消息批处理", constant.GetChannelTypeName(info.ChannelType)),
+			types.ErrorCodeInvalidApiType, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	channel, err := model.CacheGetChannel(info.ChannelId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+	}
+	// 带上批处理标记，计费信息按批处理折扣计算
+	c.Request = c.Request.WithContext(common.WithBatchRequest(c.Request.Context(), info.RequestId))
+
+	data := &ClaudeBatchTaskData{TokenId: info.TokenId}
+	modelIndex := make(map[string]int)
+	requestModels := make(map[string]int, len(request.Requests))
+	quota := 0
+	for i := range request.Requests {
+		item := &request.Requests[i]
+		if item.CustomId == "" {
+			return nil, types.NewErrorWithStatusCode(fmt.Errorf("requests[%d].custom_id 不能为空", i), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		if _, ok := requestModels[item.CustomId]; ok {
+			return nil, types.NewErrorWithStatusCode(fmt.Errorf("requests[%d].custom_id 重复: %s", i, item.CustomId), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		modelName := gjson.GetBytes(item.Params, "model").String()
+		if modelName == "" {
+			return nil, types.NewErrorWithStatusCode(fmt.Errorf("requests[%d].params.model 不能为空", i), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		index, ok := modelIndex[modelName]
+		if !ok {
+			price, apiErr := claudeBatchModelPrice(c, channel, modelName)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			index = len(data.Models)
+			modelIndex[modelName] = index
+			data.Models = append(data.Models, price)
+		}
+		requestModels[item.CustomId] = index
+		price := data.Models[index]
+		if price.UpstreamModelName != modelName {
+			if item.Params, err = sjson.SetBytes(item.Params, "model", price.UpstreamModelName); err != nil {
+				return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+			}
+		}
+		quota += estimateClaudeBatchRequestQuota(price, item.Params)
+	}
+	if len(data.Models) > 1 {
+		data.RequestModels = requestModels
+	}
+
+	// 批处理可能包含大量请求，不使用额度充足时免预扣的信任策略，按估算额度全部预扣
+	if quota > 0 {
+		userQuota, err := model.GetUserQuota(info.UserId, false)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		if userQuota < quota {
+			return nil, types.NewErrorWithStatusCode(fmt.Errorf("预扣费额度失败, 用户剩余额度: %s, 需要预扣费额度: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota)),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		if err = service.PreConsumeTokenQuota(info, quota); err != nil {
+			return nil, types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		if err = model.DecreaseUserQuota(info.UserId, quota, model.LedgerReasonBatchJob, info.RequestId); err != nil {
+			_ = model.IncreaseTokenQuota(info.TokenId, info.TokenKey, quota, model.LedgerReasonRefund, info.RequestId)
+			return nil, types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+	}
+	refund := func() {
+		if quota > 0 {
+			if err := service.PostConsumeQuota(info, -quota, 0, false); err != nil {
+				logger.LogError(c, "error return message batch quota: "+err.Error())
+			}
+		}
+	}
+
+	body, err := common.Marshal(request)
+	if err != nil {
+		refund()
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	resp, err := doClaudeBatchRequest(c.Request.Context(), channel, info.ApiKey, http.MethodPost, "", bytes.NewReader(body), c.Request.Header)
+	if err != nil {
+		refund()
+		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if resp.StatusCode != http.StatusOK {
+		refund()
+		return nil, service.RelayErrorHandler(c.Request.Context(), resp, false)
+	}
+	batch, apiErr := decodeClaudeBatch(resp)
+	if apiErr != nil {
+		refund()
+		return nil, apiErr
+	}
+
+	data.Batch = batch
+	task := model.InitTask(constant.TaskPlatformClaudeBatch, info)
+	task.TaskID = batch.Id
+	task.Action = constant.TaskActionMessageBatch
+	task.Quota = quota
+	task.Status = model.TaskStatusInProgress
+	task.StartTime = task.SubmitTime
+	task.PrivateData.Key = info.ApiKey
+	task.Properties.OriginModelName = data.Models[0].OriginModelName
+	task.Properties.UpstreamModelName = data.Models[0].UpstreamModelName
+	task.SetData(data)
+	if err = task.Insert(); err != nil {
+		// 上游批处理已创建，保留预扣额度，由管理员根据日志处理
+		logger.LogError(c, fmt.Sprintf("insert message batch task %s failed: %s", batch.Id, err.Error()))
+		return nil, types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+	}
+	return task, nil
+}
+
+// UpdateClaudeBatchTask 根据上游批处理对象更新任务，批处理结束后读取结果并结算
+func UpdateClaudeBatchTask(ctx context.Context, task *model.Task, batch *dto.ClaudeMessageBatch) error {
+	data, err := GetClaudeBatchTaskData(task)
+	if err != nil {
+		return err
+	}
+	data.Batch = batch
+	if batch.ProcessingStatus == dto.ClaudeMessageBatchStatusEnded {
+		return settleClaudeBatch(ctx, task, data)
+	}
+	if total := batch.TotalRequests(); total > 0 {
+		task.Progress = fmt.Sprintf("%d%%", (total-batch.RequestCounts.Processing)*100/total)
+		if task.Progress == "100%" {
+			task.Progress = "99%"
+		}
+	}
+	task.SetData(data)
+	return task.Update()
+}
+
+// FailClaudeBatch 上游批处理已不存在时将任务标记为失败，并将预扣额度退还到用户及令牌
+func FailClaudeBatch(task *model.Task, reason string) error {
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FinishTime = time.Now().Unix()
+	task.FailReason = reason
+	quota := task.Quota
+	task.Quota = 0
+	if err := task.Update(); err != nil {
+		return err
+	}
+	if quota > 0 {
+		relayInfo := &relaycommon.RelayInfo{UserId: task.UserId, RequestId: task.TaskID, IsPlayground: true}
+		if data, err := GetClaudeBatchTaskData(task); err == nil {
+			if token, err := model.GetTokenById(data.TokenId); err == nil {
+				relayInfo.TokenId = token.Id
+				relayInfo.TokenKey = token.Key
+				relayInfo.IsPlayground = false
+			}
+		}
+		// 令牌已被删除时只退还用户额度
+		if err := service.PostConsumeQuota(relayInfo, -quota, 0, false); err != nil {
+			return err
+		}
+		model.RecordLog(task.UserId, model.LogTypeSystem, fmt.Sprintf("消息批处理 %s 失败，退还预扣额度 %s", task.TaskID, logger.LogQuota(quota)))
+	}
+	return nil
+}
+
+// readClaudeBatchUsage 读取结果 JSONL，按模型汇总成功结果的用量及额度，失败、取消及过期的请求不计费
+func readClaudeBatchUsage(reader io.Reader, data *ClaudeBatchTaskData) ([]claudeBatchUsage, error) {
+	usages := make([]claudeBatchUsage, len(data.Models))
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var result dto.ClaudeMessageBatchResult
+		if err := common.Unmarshal(line, &result); err != nil {
+			return nil, err
+		}
+		if result.Result.Type != "succeeded" || result.Result.Message == nil {
+			continue
+		}
+		index := data.RequestModels[result.CustomId]
+		if index < 0 || index >= len(usages) {
+			index = 0
+		}
+		usage := result.Result.Message.Usage
+		usages[index].Requests++
+		usages[index].Quota += claudeBatchResultQuota(data.Models[index].PriceData, usage)
+		if usage != nil {
+			usages[index].PromptTokens += usage.InputTokens + usage.CacheReadInputTokens + usage.GetCacheCreationTotalTokens()
+			usages[index].CompletionTokens += usage.OutputTokens
+		}
+	}
+	return usages, scanner.Err()
+}
+
+func settleClaudeBatch(ctx context.Context, task *model.Task, data *ClaudeBatchTaskData) error {
+	resp, apiErr := OpenClaudeBatchResults(ctx, task, nil)
+	if apiErr != nil {
+		return apiErr
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+	usages, err := readClaudeBatchUsage(resp.Body, data)
+	if err != nil {
+		return fmt.Errorf("read message batch results failed: %w", err)
+	}
+	actualQuota := 0
+	for _, usage := range usages {
+		actualQuota += usage.Quota
+	}
+	preConsumedQuota := task.Quota
+
+	// 先更新任务状态再结算，避免更新失败时重复计费
+	task.Status = model.TaskStatusSuccess
+	task.Progress = "100%"
+	task.FinishTime = time.Now().Unix()
+	task.Quota = actualQuota
+	task.SetData(data)
+	if err = task.Update(); err != nil {
+		return err
+	}
+
+	relayInfo := &relaycommon.RelayInfo{UserId: task.UserId, TokenId: data.TokenId, RequestId: task.TaskID}
+	tokenName := ""
+	if token, err := model.GetTokenById(data.TokenId); err == nil {
+		relayInfo.TokenKey = token.Key
+		tokenName = token.Name
+	} else {
+		// 令牌已被删除时只结算用户额度
+		relayInfo.IsPlayground = true
+	}
+	if quotaDelta := actualQuota - preConsumedQuota; quotaDelta != 0 {
+		if err = service.PostConsumeQuota(relayInfo, quotaDelta, preConsumedQuota, false); err != nil {
+			return fmt.Errorf("settle message batch quota failed: %w", err)
+		}
+	}
+
+	c := newClaudeBatchLogContext(ctx, task)
+	for i, usage := range usages {
+		if usage.Requests == 0 {
+			continue
+		}
+		price := data.Models[i]
+		priceData := price.PriceData
+		other := map[string]interface{}{
+			"batch_id":             task.TaskID,
+			"batch_ratio":          priceData.GroupRatioInfo.BatchRatio,
+			"request_count":        usage.Requests,
+			"model_ratio":          priceData.ModelRatio,
+			"group_ratio":          priceData.GroupRatioInfo.GroupRatio,
+			"completion_ratio":     priceData.CompletionRatio,
+			"cache_ratio":          priceData.CacheRatio,
+			"cache_creation_ratio": priceData.CacheCreationRatio,
+			"model_price":          -1,
+		}
+		if priceData.UsePrice {
+			other["model_price"] = priceData.ModelPrice
+		}
+		if price.UpstreamModelName != price.OriginModelName {
+			other["is_model_mapped"] = true
+			other["upstream_model_name"] = price.UpstreamModelName
+		}
+		model.RecordConsumeLog(c, task.UserId, model.RecordConsumeLogParams{
+			ChannelId:        task.ChannelId,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			ModelName:        price.OriginModelName,
+			TokenName:        tokenName,
+			Quota:            usage.Quota,
+			Content:          fmt.Sprintf("消息批处理 %s，成功 %d 条", task.TaskID, usage.Requests),
+			TokenId:          data.TokenId,
+			Group:            task.Group,
+			Other:            other,
+		})
+		model.UpdateUserUsedQuotaAndRequestCount(task.UserId, usage.Quota)
+		model.UpdateChannelUsedQuota(task.ChannelId, usage.Quota)
+	}
+	return nil
+}
+
+// newClaudeBatchLogContext 构造记录消费日志所需的请求上下文，结算在后台任务轮询中进行，没有原始请求
+func newClaudeBatchLogContext(ctx context.Context, task *model.Task) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequestWithContext(common.WithBatchRequest(ctx, task.TaskID), http.MethodGet, "/v1/messages/batches/"+task.TaskID+"/results", nil)
+	username, _ := model.GetUsernameById(task.UserId, false)
+	c.Set("username", username)
+	common.SetContextKey(c, constant.ContextKeyChannelType, constant.ChannelTypeAnthropic)
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(types.RelayFormatClaude))
+	return c
+}
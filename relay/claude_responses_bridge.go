@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldRelayClaudeViaResponses 判断 Claude Messages 请求是否需要通过 Responses API 转发：
+// 渠道原生支持 Responses API，且渠道开启了对应设置或模型配置为只支持 Responses API
+func shouldRelayClaudeViaResponses(info *relaycommon.RelayInfo) bool {
+	if !supportsNativeResponses(info.ApiType) {
+		return false
+	}
+	return info.ChannelOtherSettings.ClaudeViaResponses ||
+		model_setting.IsResponsesOnlyModel(info.OriginModelName) ||
+		model_setting.IsResponsesOnlyModel(info.UpstreamModelName)
+}
+
+// responsesToClaudeBridge 将 Responses API 响应转换为 Claude Messages 响应
+type responsesToClaudeBridge struct {
+	converter *service.ClaudeResponsesStreamConverter
+}
+
+func (b *responsesToClaudeBridge) encode(responses []*dto.ClaudeResponse) []byte {
+	var buffer bytes.Buffer
+	for _, response := range responses {
+		data, err := common.Marshal(response)
+		if err != nil {
+			common.SysError("failed to marshal claude stream event: " + err.Error())
+			continue
+		}
+		buffer.Write(sseEvent(response.Type, data))
+	}
+	return buffer.Bytes()
+}
+
+func (b *responsesToClaudeBridge) ConvertData(data string) []byte {
+	var event dto.ResponsesStreamResponse
+	if err := common.UnmarshalJsonStr(data, &event); err != nil {
+		common.SysError("failed to unmarshal bridged responses event: " + err.Error())
+		return nil
+	}
+	return b.encode(b.converter.ConvertEvent(&event))
+}
+
+func (b *responsesToClaudeBridge) FinishStream(newAPIError *types.NewAPIError) []byte {
+	if newAPIError != nil {
+		return nil
+	}
+	return b.encode(b.converter.Finish())
+}
+
+func (b *responsesToClaudeBridge) ConvertBody(body []byte) []byte {
+	var response dto.OpenAIResponsesResponse
+	if err := common.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	data, err := common.Marshal(service.ResponsesResponse2Claude(&response))
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// claudeViaResponses 将 Claude Messages 请求转换为 Responses API 请求交给 ResponsesHelper 处理，
+// 并将响应转换回 Claude Messages 格式，用于只能通过 Responses API 调用的上游模型
+func claudeViaResponses(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) *types.NewAPIError {
+	responsesRequest, err := service.ClaudeToResponsesRequest(request)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeConvertRequestFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	bridge := &responsesToClaudeBridge{converter: service.NewClaudeResponsesStreamConverter(info.OriginModelName)}
+	return relayViaBridge(c, info, responsesRequest, relayconstant.RelayModeResponses, types.RelayFormatOpenAIResponses,
+		"/v1/responses", bridge, ResponsesHelper)
+}
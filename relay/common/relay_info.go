@@ -74,18 +74,22 @@ type ChannelMeta struct {
 }
 
 type RelayInfo struct {
+	RequestId         string
 	TokenId           int
 	TokenKey          string
 	UserId            int
 	UsingGroup        string // 使用的分组
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	TokenPrepaid      bool   // 令牌额度由令牌自身承担，不检查及扣减用户额度
+	BatchId           string // 进程内执行的批处理请求所属的批处理，费用优先从批处理预留额度中扣减
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
 	//SendLastReasoningResponse bool
 	IsStream               bool
 	IsGeminiBatchEmbedding bool
+	BackgroundResponseId   string // 进程内执行的后台响应 id，费用优先从后台响应的预留额度中扣减
 	IsPlayground           bool
 	UsePrice               bool
 	RelayMode              int
@@ -382,7 +386,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 	// firstResponseTime = time.Now() - 1 second
 
 	info := &RelayInfo{
-		Request: request,
+		Request:   request,
+		RequestId: c.GetString(common.RequestIdKey),
 
 		UserId:     common.GetContextKeyInt(c, constant.ContextKeyUserId),
 		UsingGroup: common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
@@ -396,6 +401,10 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		TokenPrepaid:   common.GetContextKeyBool(c, constant.ContextKeyTokenPrepaid),
+		BatchId:        common.GetBatchRequestId(c),
+
+		BackgroundResponseId: common.GetBackgroundResponseId(c),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
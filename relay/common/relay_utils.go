@@ -2,10 +2,14 @@ package common
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -230,7 +234,14 @@ func ValidateBasicTaskRequest(c *gin.Context, info *RelayInfo, action string) *d
 	return nil
 }
 func GetImagesBase64sFromForm(c *gin.Context) ([]*Base64Data, error) {
-	return GetBase64sFromForm(c, "image")
+	imageFiles, err := GetImageFormFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageFiles) == 0 {
+		return nil, errors.New("image is required")
+	}
+	return readFormFilesBase64(imageFiles)
 }
 func GetImageBase64sFromForm(c *gin.Context) (*Base64Data, error) {
 	base64s, err := GetImagesBase64sFromForm(c)
@@ -248,35 +259,137 @@ type Base64Data struct {
 func (m Base64Data) String() string {
 	return fmt.Sprintf("data:%s;base64,%s", m.MimeType, m.Data)
 }
-func GetBase64sFromForm(c *gin.Context, fieldName string) ([]*Base64Data, error) {
-	mf := c.Request.MultipartForm
-	if mf == nil {
+
+func getMultipartForm(c *gin.Context) (*multipart.Form, error) {
+	if c.Request.MultipartForm == nil {
 		if _, err := c.MultipartForm(); err != nil {
 			return nil, fmt.Errorf("failed to parse image edit form request: %w", err)
 		}
-		mf = c.Request.MultipartForm
+	}
+	return c.Request.MultipartForm, nil
+}
+
+func GetBase64sFromForm(c *gin.Context, fieldName string) ([]*Base64Data, error) {
+	mf, err := getMultipartForm(c)
+	if err != nil {
+		return nil, err
 	}
 	imageFiles, exists := mf.File[fieldName]
 	if !exists || len(imageFiles) == 0 {
 		return nil, errors.New("field " + fieldName + " is not found or empty")
 	}
+	return readFormFilesBase64(imageFiles)
+}
+
+func readFormFilesBase64(files []*multipart.FileHeader) ([]*Base64Data, error) {
 	var imageBase64s []*Base64Data
-	for _, file := range imageFiles {
+	for _, file := range files {
 		image, err := file.Open()
 		if err != nil {
 			return nil, errors.New("failed to open image file")
 		}
-		defer image.Close()
 		imageData, err := io.ReadAll(image)
+		_ = image.Close()
 		if err != nil {
 			return nil, errors.New("failed to read image file")
 		}
-		mimeType := http.DetectContentType(imageData)
-		base64Data := base64.StdEncoding.EncodeToString(imageData)
 		imageBase64s = append(imageBase64s, &Base64Data{
-			MimeType: mimeType,
-			Data:     base64Data,
+			MimeType: http.DetectContentType(imageData),
+			Data:     base64.StdEncoding.EncodeToString(imageData),
 		})
 	}
 	return imageBase64s, nil
 }
+
+// GetImageFormFiles 返回图片编辑、变体表单中上传的图片，依次查找 image、image[] 及 image[0] 等字段，没有上传图片时返回空
+func GetImageFormFiles(c *gin.Context) ([]*multipart.FileHeader, error) {
+	mf, err := getMultipartForm(c)
+	if err != nil {
+		return nil, err
+	}
+	if files := mf.File["image"]; len(files) > 0 {
+		return files, nil
+	}
+	if files := mf.File["image[]"]; len(files) > 0 {
+		return files, nil
+	}
+	var fieldNames []string
+	for fieldName, files := range mf.File {
+		if strings.HasPrefix(fieldName, "image[") && len(files) > 0 {
+			fieldNames = append(fieldNames, fieldName)
+		}
+	}
+	// 按 image[N] 中的序号排序，image[10] 排在 image[2] 之后，无法解析序号的字段排在最后
+	sort.Slice(fieldNames, func(i, j int) bool {
+		indexI, indexJ := imageFieldIndex(fieldNames[i]), imageFieldIndex(fieldNames[j])
+		if indexI != indexJ {
+			return indexI < indexJ
+		}
+		return fieldNames[i] < fieldNames[j]
+	})
+	var imageFiles []*multipart.FileHeader
+	for _, fieldName := range fieldNames {
+		imageFiles = append(imageFiles, mf.File[fieldName]...)
+	}
+	return imageFiles, nil
+}
+
+// imageFieldIndex 解析 image[N] 表单字段的序号
+func imageFieldIndex(fieldName string) int {
+	index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(fieldName, "image["), "]"))
+	if err != nil {
+		return math.MaxInt
+	}
+	return index
+}
+
+// GetImageInputs 返回图片编辑、变体请求的输入图片，供不接受 OpenAI 表单的渠道转换请求：
+// 表单上传的图片转换为 data URL，image 字段及 gpt-image-1 JSON 请求的 images 字段可以是 URL、data URL 或它们的数组
+func GetImageInputs(c *gin.Context, request dto.ImageRequest) ([]string, error) {
+	var images []string
+	if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		imageFiles, err := GetImageFormFiles(c)
+		if err != nil {
+			return nil, err
+		}
+		base64s, err := readFormFilesBase64(imageFiles)
+		if err != nil {
+			return nil, err
+		}
+		for _, base64Data := range base64s {
+			images = append(images, base64Data.String())
+		}
+	}
+	images = append(images, parseImageInputs(request.Image)...)
+	images = append(images, parseImageInputs(request.Extra["images"])...)
+	if len(images) == 0 {
+		return nil, errors.New("image is required")
+	}
+	return images, nil
+}
+
+func parseImageInputs(raw json.RawMessage) []string {
+	var images []string
+	switch common.GetJsonType(raw) {
+	case "string":
+		var image string
+		if err := common.Unmarshal(raw, &image); err == nil && image != "" {
+			images = append(images, image)
+		}
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(raw, &items); err == nil {
+			for _, item := range items {
+				images = append(images, parseImageInputs(item)...)
+			}
+		}
+	case "object":
+		var item struct {
+			ImageUrl string `json:"image_url"`
+		}
+		if err := common.Unmarshal(raw, &item); err == nil && item.ImageUrl != "" {
+			images = append(images, item.ImageUrl)
+		}
+	}
+	return images
+}
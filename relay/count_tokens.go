@@ -0,0 +1,151 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// RelayCountTokens 处理 Claude 的 /v1/messages/count_tokens 及 Gemini 的 models/{model}:countTokens，
+// 渠道原生支持时转发上游，否则在本地估算。计数请求不计费也不记录日志
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		return claudeCountTokens(c)
+	case types.RelayFormatGemini:
+		return geminiCountTokens(c)
+	default:
+		return types.NewErrorWithStatusCode(fmt.Errorf("不支持的 token 计数格式: %s", relayFormat), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+}
+
+func claudeCountTokens(c *gin.Context) *types.NewAPIError {
+	request := &dto.ClaudeRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if request.Model == "" || len(request.Messages) == 0 {
+		return types.NewErrorWithStatusCode(fmt.Errorf("model 和 messages 不能为空"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	info := relaycommon.GenRelayInfoClaude(c, request)
+	info.IsStream = false
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, request); err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	if info.ChannelType == constant.ChannelTypeAnthropic {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		body, err = sjson.SetBytes(body, "model", info.UpstreamModelName)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		}
+		return doCountTokensRequest(c, info, info.ChannelBaseUrl+"/v1/messages/count_tokens", body)
+	}
+
+	tokens, err := service.CountTokenClaudeRequest(*request, info.UpstreamModelName)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeCountTokenFailed, types.ErrOptionWithSkipRetry())
+	}
+	c.JSON(http.StatusOK, gin.H{"input_tokens": tokens})
+	return nil
+}
+
+func geminiCountTokens(c *gin.Context) *types.NewAPIError {
+	request := &dto.GeminiCountTokensRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	chatRequest := request.ToChatRequest()
+	info := relaycommon.GenRelayInfoGemini(c, chatRequest)
+	info.IsStream = false
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, chatRequest); err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	if info.ChannelType == constant.ChannelTypeGemini {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		// generateContentRequest 中的 model 必须与路径中的模型一致
+		if request.GenerateContentRequest != nil {
+			body, err = sjson.SetBytes(body, "generateContentRequest.model", "models/"+info.UpstreamModelName)
+			if err != nil {
+				return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+			}
+		}
+		version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+		url := fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName)
+		return doCountTokensRequest(c, info, url, body)
+	}
+
+	// 本地估算复用请求计费的计数逻辑，系统提示词及工具定义同样计入输入
+	meta := chatRequest.GetTokenCountMeta()
+	texts := []string{meta.CombineText}
+	if chatRequest.SystemInstructions != nil {
+		for _, part := range chatRequest.SystemInstructions.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	if len(chatRequest.Tools) > 0 {
+		texts = append(texts, string(chatRequest.Tools))
+	}
+	meta.CombineText = strings.Join(texts, "\n")
+	tokens, err := service.CountRequestToken(c, meta, info)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeCountTokenFailed, types.ErrOptionWithSkipRetry())
+	}
+	c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+	return nil
+}
+
+// doCountTokensRequest 使用渠道适配器的请求头转发计数请求，并原样返回上游响应
+func doCountTokensRequest(c *gin.Context, info *relaycommon.RelayInfo, url string, body []byte) *types.NewAPIError {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(url, "/"), bytes.NewReader(body))
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err = adaptor.SetupRequestHeader(c, &req.Header, info); err != nil {
+		return types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	resp, err := channel.DoRequest(c, req, info)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return service.RelayErrorHandler(c.Request.Context(), resp, false)
+	}
+	defer resp.Body.Close()
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, resp.Body)
+	return nil
+}
@@ -128,6 +128,18 @@ func WssError(c *gin.Context, ws *websocket.Conn, openaiError types.OpenAIError)
 	_ = WssObject(c, ws, errorObj)
 }
 
+// GeminiError 以 Gemini 原生格式返回错误，响应已开始输出时以 SSE 事件发送
+func GeminiError(c *gin.Context, geminiError types.GeminiError) {
+	body := gin.H{"error": geminiError}
+	if c.Writer.Written() {
+		_ = ObjectData(c, body)
+		return
+	}
+	// 流式请求可能已设置 event-stream 头部但尚未输出，此时仍按普通 JSON 返回
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.JSON(geminiError.Code, body)
+}
+
 func GetResponseID(c *gin.Context) string {
 	logID := c.GetString(common.RequestIdKey)
 	return fmt.Sprintf("chatcmpl-%s", logID)
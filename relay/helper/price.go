@@ -5,6 +5,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -16,7 +17,8 @@ import (
 // https://docs.claude.com/en/docs/build-with-claude/prompt-caching#1-hour-cache-duration
 const claudeCacheCreation1hMultiplier = 6 / 3.75
 
-// HandleGroupRatio checks for "auto_group" in the context and updates the group ratio and relayInfo.UsingGroup if present
+// HandleGroupRatio checks for "auto_group" in the context and updates the group ratio and relayInfo.UsingGroup if present.
+// Per-user / per-token price overrides take precedence over user group special ratios, which take precedence over group ratios.
 func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.GroupRatioInfo {
 	groupRatioInfo := types.GroupRatioInfo{
 		GroupRatio:        1.0, // default ratio
@@ -42,13 +44,49 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// check user / token price override
+	if override := model.GetMatchedPriceOverride(relayInfo.UserId, relayInfo.TokenId, relayInfo.OriginModelName); override != nil {
+		logger.LogDebug(ctx, fmt.Sprintf("price override matched: id=%d, model=%s, type=%s, value=%f", override.Id, override.Model, override.Type, override.Value))
+		groupRatioInfo.PriceOverride = override.ToInfo()
+		if override.Type == types.PriceOverrideTypeRatio {
+			groupRatioInfo.GroupSpecialRatio = override.Value
+			groupRatioInfo.GroupRatio = override.Value
+			groupRatioInfo.HasSpecialRatio = true
+		}
+	}
+
+	// 批处理请求在分组倍率基础上叠加批处理折扣
+	if common.GetBatchRequestId(ctx) != "" {
+		groupRatioInfo.BatchRatio = common.BatchPriceRatio
+		groupRatioInfo.GroupRatio *= common.BatchPriceRatio
+		if groupRatioInfo.HasSpecialRatio {
+			groupRatioInfo.GroupSpecialRatio *= common.BatchPriceRatio
+		}
+	}
+
 	return groupRatioInfo
 }
 
+// applyPriceOverride 固定价格规则直接替换模型价格，并且不再叠加分组倍率（批处理折扣仍然生效）
+func applyPriceOverride(groupRatioInfo *types.GroupRatioInfo, modelPrice float64, usePrice bool) (float64, bool) {
+	override := groupRatioInfo.PriceOverride
+	if override == nil || override.Type != types.PriceOverrideTypePrice {
+		return modelPrice, usePrice
+	}
+	groupRatioInfo.GroupRatio = 1
+	if groupRatioInfo.BatchRatio > 0 {
+		groupRatioInfo.GroupRatio = groupRatioInfo.BatchRatio
+	}
+	groupRatioInfo.GroupSpecialRatio = -1
+	groupRatioInfo.HasSpecialRatio = false
+	return override.Value, true
+}
+
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
 
 	groupRatioInfo := HandleGroupRatio(c, info)
+	modelPrice, usePrice = applyPriceOverride(&groupRatioInfo, modelPrice, usePrice)
 
 	var preConsumedQuota int
 	var modelRatio float64
@@ -150,6 +188,7 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 			modelPrice = defaultPrice
 		}
 	}
+	modelPrice, _ = applyPriceOverride(&groupRatioInfo, modelPrice, true)
 	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	priceData := types.PerCallPriceData{
 		ModelPrice:     modelPrice,
@@ -129,8 +129,9 @@ func GetAndValidOpenAIImageRequest(c *gin.Context, relayMode int) (*dto.ImageReq
 	imageRequest := &dto.ImageRequest{}
 
 	switch relayMode {
-	case relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+			// 表单只在这里解析一次，渠道适配器转换请求时直接读取 c.Request.MultipartForm
 			_, err := c.MultipartForm()
 			if err != nil {
 				return nil, fmt.Errorf("failed to parse image edit form request: %w", err)
@@ -154,6 +155,9 @@ func GetAndValidOpenAIImageRequest(c *gin.Context, relayMode int) (*dto.ImageReq
 			if imageRequest.N == 0 {
 				imageRequest.N = 1
 			}
+			if relayMode == relayconstant.RelayModeImagesVariations && imageRequest.Model == "" {
+				imageRequest.Model = "dall-e-2"
+			}
 
 			hasWatermark := formData.Has("watermark")
 			if hasWatermark {
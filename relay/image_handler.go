@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
@@ -20,6 +21,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const imageVariationPrompt = "Create a variation of this image that keeps its subject, composition and style."
+
 func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.NewAPIError) {
 	info.InitChannelMeta(c)
 
@@ -33,6 +36,11 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		return types.NewError(fmt.Errorf("failed to copy request to ImageRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	// 没有原生变体接口的渠道按编辑处理，使用默认提示词生成变体
+	if info.RelayMode == relayconstant.RelayModeImagesVariations && request.Prompt == "" {
+		request.Prompt = imageVariationPrompt
+	}
+
 	err = helper.ModelMappedHelper(c, info, request)
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
@@ -120,8 +128,8 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	}
 
 	quality := "standard"
-	if request.Quality == "hd" {
-		quality = "hd"
+	if request.Quality != "" {
+		quality = request.Quality
 	}
 
 	var logContent string
@@ -129,6 +137,12 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	if len(request.Size) > 0 {
 		logContent = fmt.Sprintf("大小 %s, 品质 %s, 张数 %d", request.Size, quality, request.N)
 	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeImagesEdits:
+		logContent = strings.TrimPrefix(logContent+", 图片编辑", ", ")
+	case relayconstant.RelayModeImagesVariations:
+		logContent = strings.TrimPrefix(logContent+", 图片变体", ", ")
+	}
 
 	postConsumeQuota(c, info, usage.(*dto.Usage), logContent)
 	return nil
@@ -188,6 +188,12 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 
 	priceData := helper.ModelPriceHelperPerCall(c, info)
 
+	if info.TokenPrepaid {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: service.ErrPrepaidTokenUnsupported.Error(),
+		}
+	}
 	userQuota, err := model.GetUserQuota(info.UserId, false)
 	if err != nil {
 		return &dto.MidjourneyResponse{
@@ -489,6 +495,12 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 
 	priceData := helper.ModelPriceHelperPerCall(c, relayInfo)
 
+	if relayInfo.TokenPrepaid {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: service.ErrPrepaidTokenUnsupported.Error(),
+		}
+	}
 	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
 	if err != nil {
 		return &dto.MidjourneyResponse{
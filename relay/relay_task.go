@@ -19,6 +19,7 @@ import (
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 )
@@ -67,7 +68,13 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	groupRatio := ratio_setting.GetGroupRatio(info.UsingGroup)
 	var ratio float64
 	userGroupRatio, hasUserGroupRatio := ratio_setting.GetGroupGroupRatio(info.UserGroup, info.UsingGroup)
-	if hasUserGroupRatio {
+	if override := model.GetMatchedPriceOverride(info.UserId, info.TokenId, modelName); override != nil {
+		if override.Type == types.PriceOverrideTypePrice {
+			ratio = override.Value
+		} else {
+			ratio = modelPrice * override.Value
+		}
+	} else if hasUserGroupRatio {
 		ratio = modelPrice * userGroupRatio
 	} else {
 		ratio = modelPrice * groupRatio
@@ -83,6 +90,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		}
 	}
 	println(fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, final_ratio: %.4f", modelName, modelPrice, info.UsingGroup, groupRatio, ratio))
+	if info.TokenPrepaid {
+		taskErr = service.TaskErrorWrapperLocal(service.ErrPrepaidTokenUnsupported, "prepaid_token_unsupported", http.StatusForbidden)
+		return
+	}
 	userQuota, err := model.GetUserQuota(info.UserId, false)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -0,0 +1,123 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportsNativeResponses 判断渠道适配器是否原生支持 /v1/responses，其余渠道通过 Chat Completions 桥接
+func supportsNativeResponses(apiType int) bool {
+	adaptor, ok := GetAdaptor(apiType).(channel.NativeResponsesAdaptor)
+	return ok && adaptor.SupportsNativeResponses()
+}
+
+// chatToResponsesBridge 将 Chat Completions 响应转换为 Responses API 响应
+type chatToResponsesBridge struct {
+	responseId string
+	createdAt  int64
+	converter  *service.ResponsesStreamConverter
+}
+
+func newChatToResponsesBridge(model string) *chatToResponsesBridge {
+	responseId := "resp_" + common.GetUUID()
+	createdAt := time.Now().Unix()
+	return &chatToResponsesBridge{
+		responseId: responseId,
+		createdAt:  createdAt,
+		converter:  service.NewResponsesStreamConverter(responseId, model, createdAt),
+	}
+}
+
+func (b *chatToResponsesBridge) encode(events []dto.ResponsesStreamResponse) []byte {
+	var buffer bytes.Buffer
+	for _, event := range events {
+		data, err := common.Marshal(event)
+		if err != nil {
+			common.SysError("failed to marshal responses stream event: " + err.Error())
+			continue
+		}
+		buffer.Write(sseEvent(event.Type, data))
+	}
+	return buffer.Bytes()
+}
+
+func (b *chatToResponsesBridge) ConvertData(data string) []byte {
+	if data == "[DONE]" {
+		return b.encode(b.converter.Finish())
+	}
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+		common.SysError("failed to unmarshal bridged stream chunk: " + err.Error())
+		return nil
+	}
+	return b.encode(b.converter.ConvertChunk(&chunk))
+}
+
+func (b *chatToResponsesBridge) FinishStream(newAPIError *types.NewAPIError) []byte {
+	if newAPIError == nil {
+		return b.encode(b.converter.Finish())
+	}
+	if b.converter.Started() {
+		return b.encode(b.converter.Fail(newAPIError.Error()))
+	}
+	return nil
+}
+
+func (b *chatToResponsesBridge) ConvertBody(body []byte) []byte {
+	var response dto.OpenAITextResponse
+	if err := common.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	data, err := common.Marshal(service.ResponseOpenAI2Responses(&response, b.responseId, b.createdAt))
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// relayViaBridge 临时替换 info 中的请求及转发模式并拦截响应，交给 handler 处理后恢复，
+// 重试时会复用 info，因此必须恢复
+func relayViaBridge(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, relayMode int, relayFormat types.RelayFormat,
+	urlPath string, bridge formatBridge, handler func(*gin.Context, *relaycommon.RelayInfo) *types.NewAPIError) *types.NewAPIError {
+	originRequest, originRelayMode, originRelayFormat, originURLPath := info.Request, info.RelayMode, info.RelayFormat, info.RequestURLPath
+	originWriter := c.Writer
+	writer := newBridgeWriter(originWriter, info.IsStream, bridge)
+	defer func() {
+		c.Writer = originWriter
+		info.Request, info.RelayMode, info.RelayFormat, info.RequestURLPath = originRequest, originRelayMode, originRelayFormat, originURLPath
+	}()
+	info.Request = request
+	info.RelayMode = relayMode
+	info.RelayFormat = relayFormat
+	info.RequestURLPath = urlPath
+	c.Writer = writer
+
+	newAPIError := handler(c, info)
+	writer.finish(newAPIError)
+	return newAPIError
+}
+
+// responsesViaChatCompletions 将 Responses API 请求转换为 Chat Completions 请求交给 TextHelper 处理，
+// 并将响应转换回 Responses API 格式，用于不支持 Responses API 的渠道
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) *types.NewAPIError {
+	openAIRequest, err := service.ResponsesRequestToOpenAIRequest(request)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeConvertRequestFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if openAIRequest.Stream {
+		openAIRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	return relayViaBridge(c, info, openAIRequest, relayconstant.RelayModeChatCompletions, types.RelayFormatOpenAI,
+		"/v1/chat/completions", newChatToResponsesBridge(info.OriginModelName), TextHelper)
+}
@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// responsesRecorder 原样写出响应的同时记录最终的响应对象：
+// 非流式响应即完整响应体，流式响应取 response.completed 等终止事件中的 response
+type responsesRecorder struct {
+	gin.ResponseWriter
+	stream   bool
+	buffer   bytes.Buffer
+	response []byte
+}
+
+func newResponsesRecorder(writer gin.ResponseWriter, stream bool) *responsesRecorder {
+	return &responsesRecorder{ResponseWriter: writer, stream: stream}
+}
+
+func (w *responsesRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesRecorder) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.buffer.Write(data)
+	if !w.stream {
+		return n, err
+	}
+	for {
+		line, readErr := w.buffer.ReadString('\n')
+		if readErr != nil {
+			// 不完整的行放回缓冲区，等待后续数据
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.handleStreamLine(strings.TrimSpace(line))
+	}
+	return n, err
+}
+
+func (w *responsesRecorder) handleStreamLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	switch gjson.Get(data, "type").String() {
+	case "response.completed", "response.incomplete", "response.failed":
+		w.response = []byte(gjson.Get(data, "response").Raw)
+	}
+}
+
+// Response 返回记录到的响应对象，没有有效的响应对象时返回 nil
+func (w *responsesRecorder) Response() []byte {
+	if !w.stream {
+		w.response = w.buffer.Bytes()
+	}
+	if !gjson.ValidBytes(w.response) || gjson.GetBytes(w.response, "object").String() != "response" {
+		return nil
+	}
+	return w.response
+}
@@ -17,6 +17,8 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
+		apiRouter.GET("/status_page", controller.GetStatusPage)
+		apiRouter.POST("/status_page/probe", middleware.AdminAuth(), controller.RunStatusProbes)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
 		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
@@ -78,12 +80,17 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.GET("/topup/info", controller.GetTopUpInfo)
 				selfRoute.GET("/topup/self", controller.GetUserTopUps)
+				selfRoute.GET("/self/ledger", controller.GetSelfQuotaLedgers)
 				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
 				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestEpay)
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.RequestStripePay)
 				selfRoute.POST("/stripe/amount", controller.RequestStripeAmount)
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
+				selfRoute.GET("/subscription/plans", controller.GetEnabledSubscriptionPlans)
+				selfRoute.GET("/subscription/self", controller.GetSelfSubscription)
+				selfRoute.POST("/subscription/subscribe", middleware.CriticalRateLimit(), controller.RequestSubscription)
+				selfRoute.POST("/subscription/cancel", controller.CancelSelfSubscription)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 
@@ -108,6 +115,9 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminRoute.GET("/:id/price_overrides", controller.GetUserPriceOverrides)
+				adminRoute.PUT("/:id/price_overrides", controller.UpdateUserPriceOverrides)
+				adminRoute.GET("/:id/ledger", controller.GetUserQuotaLedgers)
 
 				// Admin 2FA routes
 				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
@@ -135,6 +145,8 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/performance", controller.GetChannelPerformance)
+			channelRoute.GET("/performance/rank", controller.RankChannelPerformance)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
@@ -185,11 +197,41 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
 			redemptionRoute.GET("/:id", controller.GetRedemption)
+			redemptionRoute.GET("/:id/records", controller.GetRedemptionRecords)
 			redemptionRoute.POST("/", controller.AddRedemption)
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		ledgerRoute := apiRouter.Group("/ledger")
+		ledgerRoute.Use(middleware.RootAuth())
+		{
+			ledgerRoute.GET("/check", controller.CheckQuotaLedger)
+		}
+		auditLogRoute := apiRouter.Group("/audit_log")
+		auditLogRoute.Use(middleware.RootAuth())
+		{
+			auditLogRoute.GET("/", controller.GetAuditLogs)
+			auditLogRoute.GET("/export", controller.ExportAuditLogs)
+		}
+		couponRoute := apiRouter.Group("/coupon")
+		couponRoute.Use(middleware.AdminAuth())
+		{
+			couponRoute.GET("/", controller.GetAllCoupons)
+			couponRoute.GET("/:id", controller.GetCoupon)
+			couponRoute.POST("/", controller.AddCoupon)
+			couponRoute.PUT("/", controller.UpdateCoupon)
+			couponRoute.DELETE("/:id", controller.DeleteCoupon)
+		}
+		subscriptionRoute := apiRouter.Group("/subscription")
+		subscriptionRoute.Use(middleware.AdminAuth())
+		{
+			subscriptionRoute.GET("/", controller.GetAllSubscriptions)
+			subscriptionRoute.GET("/plan", controller.GetSubscriptionPlans)
+			subscriptionRoute.POST("/plan", controller.CreateSubscriptionPlan)
+			subscriptionRoute.PUT("/plan", controller.UpdateSubscriptionPlan)
+			subscriptionRoute.DELETE("/plan/:id", controller.DeleteSubscriptionPlan)
+		}
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
@@ -198,10 +240,38 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/capture", middleware.AdminAuth(), controller.GetPayloadCaptures)
+		logRoute.GET("/capture/:request_id", middleware.AdminAuth(), controller.GetPayloadCapture)
+		logRoute.GET("/archive", middleware.AdminAuth(), controller.GetLogArchives)
+		logRoute.POST("/archive", middleware.AdminAuth(), controller.ArchiveLogs)
+		logRoute.POST("/archive/:id/import", middleware.AdminAuth(), controller.ImportLogArchive)
+		logRoute.GET("/archive/:id/logs", middleware.AdminAuth(), controller.GetRestoredLogs)
+		logRoute.DELETE("/archive/:id/import", middleware.AdminAuth(), controller.DeleteRestoredLogs)
+
+		alertRuleRoute := apiRouter.Group("/alert_rule")
+		alertRuleRoute.Use(middleware.AdminAuth())
+		{
+			alertRuleRoute.GET("/", controller.GetAllAlertRules)
+			alertRuleRoute.POST("/", controller.AddAlertRule)
+			alertRuleRoute.PUT("/", controller.UpdateAlertRule)
+			alertRuleRoute.DELETE("/:id", controller.DeleteAlertRule)
+			alertRuleRoute.GET("/events", controller.GetAlertEvents)
+		}
+
+		captureRuleRoute := apiRouter.Group("/payload_capture_rule")
+		captureRuleRoute.Use(middleware.AdminAuth())
+		{
+			captureRuleRoute.GET("/", controller.GetAllPayloadCaptureRules)
+			captureRuleRoute.POST("/", controller.AddPayloadCaptureRule)
+			captureRuleRoute.PUT("/", controller.UpdatePayloadCaptureRule)
+			captureRuleRoute.DELETE("/:id", controller.DeletePayloadCaptureRule)
+		}
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/analytics", middleware.AdminAuth(), controller.GetUsageAnalytics)
+		dataRoute.GET("/self/analytics", middleware.UserAuth(), controller.GetSelfUsageAnalytics)
 
 		logRoute.Use(middleware.CORS())
 		{
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+)
+
+func AutomaticallyEvaluateAlertRules(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		EvaluateAlertRules()
+	}
+}
+
+// EvaluateAlertRules 评估所有启用的告警规则，对新触发、持续及恢复的告警发送通知
+func EvaluateAlertRules() {
+	rules, err := model.GetEnabledAlertRules()
+	if err != nil {
+		common.SysError("failed to get alert rules: " + err.Error())
+		return
+	}
+	// 先写入本节点尚未落库的请求计数
+	model.SaveAlertRequestStatCache()
+	for _, rule := range rules {
+		firing, err := evaluateAlertRule(rule)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to evaluate alert rule #%d: %s", rule.Id, err.Error()))
+			continue
+		}
+		transitions, err := model.ApplyAlertObservations(rule, firing)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update alert events of rule #%d: %s", rule.Id, err.Error()))
+		}
+		for _, transition := range transitions {
+			notifyAlert(rule, transition)
+		}
+	}
+}
+
+func evaluateAlertRule(rule *model.AlertRule) (map[string]*model.AlertEvent, error) {
+	now := common.GetTimestamp()
+	since := now - int64(rule.WindowMinutes)*60
+	firing := make(map[string]*model.AlertEvent)
+	fire := func(subject string, value float64, message string) {
+		firing[subject] = &model.AlertEvent{Value: value, Message: message}
+	}
+
+	switch rule.Type {
+	case model.AlertTypeChannelErrorRate, model.AlertTypeModelErrorRate:
+		column, name := "channel_id", "渠道"
+		if rule.Type == model.AlertTypeModelErrorRate {
+			column, name = "model_name", "模型"
+		}
+		stats, err := model.GetAlertRequestStats(column, since, rule.Target)
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			total := stat.Success + stat.Failure
+			if total == 0 || total < int64(rule.MinCount) {
+				continue
+			}
+			rate := float64(stat.Failure) * 100 / float64(total)
+			if rate >= rule.Threshold {
+				fire(fmt.Sprintf("%s:%s", column, stat.Key), rate, fmt.Sprintf("%s %s 最近 %d 分钟错误率 %.1f%%（%d/%d），阈值 %.1f%%",
+					name, stat.Key, rule.WindowMinutes, rate, stat.Failure, total, rule.Threshold))
+			}
+		}
+	case model.AlertTypeModelNoSuccess:
+		stats, err := model.GetAlertRequestStats("model_name", since, rule.Target)
+		if err != nil {
+			return nil, err
+		}
+		var success, failure int64
+		for _, stat := range stats {
+			success += stat.Success
+			failure += stat.Failure
+		}
+		if success == 0 {
+			fire("model_name:"+rule.Target, float64(failure), fmt.Sprintf("模型 %s 最近 %d 分钟没有成功请求，失败 %d 次",
+				rule.Target, rule.WindowMinutes, failure))
+		}
+	case model.AlertTypeChannelBalance:
+		channelId, _ := strconv.Atoi(rule.Target)
+		channels, err := model.GetAlertChannelBalances(channelId)
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range channels {
+			if channel.Balance < rule.Threshold {
+				fire(fmt.Sprintf("channel_id:%d", channel.Id), channel.Balance, fmt.Sprintf("渠道「%s」（#%d）余额 $%.2f，低于阈值 $%.2f",
+					channel.Name, channel.Id, channel.Balance, rule.Threshold))
+			}
+		}
+	case model.AlertTypeUserSpendSpike:
+		userId, _ := strconv.Atoi(rule.Target)
+		window := int64(rule.WindowMinutes) * 60
+		current, err := model.GetAlertUserSpend(since, now, userId)
+		if err != nil {
+			return nil, err
+		}
+		// 基线为前 24 小时内平均每个时间窗口的消费
+		history, err := model.GetAlertUserSpend(since-86400, since, userId)
+		if err != nil {
+			return nil, err
+		}
+		baselines := make(map[int]float64, len(history))
+		for _, stat := range history {
+			baselines[stat.UserId] = float64(stat.Quota) * float64(window) / 86400
+		}
+		for _, stat := range current {
+			if stat.Quota < int64(rule.MinCount) {
+				continue
+			}
+			baseline := baselines[stat.UserId]
+			if baseline == 0 && rule.MinCount == 0 {
+				continue
+			}
+			if baseline > 0 && float64(stat.Quota) < baseline*rule.Threshold {
+				continue
+			}
+			ratio := 0.0
+			if baseline > 0 {
+				ratio = float64(stat.Quota) / baseline
+			}
+			fire(fmt.Sprintf("user_id:%d", stat.UserId), ratio, fmt.Sprintf("用户 #%d 最近 %d 分钟消费 %s，为基线的 %.1f 倍（基线 %s）",
+				stat.UserId, rule.WindowMinutes, logger.FormatQuota(int(stat.Quota)), ratio, logger.FormatQuota(int(baseline))))
+		}
+	case model.AlertTypeTaskBacklog:
+		stats, err := model.CountUnfinishedTasksByPlatform()
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			if rule.Target != "" && stat.Platform != rule.Target {
+				continue
+			}
+			if float64(stat.Count) >= rule.Threshold {
+				fire("platform:"+stat.Platform, float64(stat.Count), fmt.Sprintf("平台 %s 未完成任务 %d 个，阈值 %.0f",
+					stat.Platform, stat.Count, rule.Threshold))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown alert type: %s", rule.Type)
+	}
+	return firing, nil
+}
+
+// notifyAlert 按接收人的通知设置（邮件、Webhook、Bark、Gotify）发送告警
+func notifyAlert(rule *model.AlertRule, transition *model.AlertTransition) {
+	var user *model.User
+	if rule.NotifyUserId != 0 {
+		var err error
+		if user, err = model.GetUserById(rule.NotifyUserId, true); err != nil {
+			common.SysError(fmt.Sprintf("failed to get alert receiver #%d: %s", rule.NotifyUserId, err.Error()))
+			return
+		}
+	} else {
+		user = model.GetRootUser()
+	}
+	if user == nil {
+		return
+	}
+	title := fmt.Sprintf("告警触发：%s", rule.Name)
+	content := transition.Event.Message
+	switch {
+	case transition.Resolved:
+		title = fmt.Sprintf("告警恢复：%s", rule.Name)
+		content = fmt.Sprintf("%s 已恢复，持续 %s。最后一次告警：%s", transition.Event.Subject,
+			time.Duration(transition.Event.ResolvedAt-transition.Event.FiredAt)*time.Second, transition.Event.Message)
+	case transition.Repeat:
+		title = fmt.Sprintf("告警持续：%s", rule.Name)
+	}
+	base := user.ToBaseUser()
+	notifyType := fmt.Sprintf("%s_%d_%s", dto.NotifyTypeAlert, rule.Id, transition.Event.Subject)
+	if err := NotifyUser(base.Id, base.Email, base.GetSetting(), dto.NewNotify(notifyType, title, content, nil)); err != nil {
+		common.SysError(fmt.Sprintf("failed to send alert notification: %s", err.Error()))
+	}
+}
@@ -0,0 +1,591 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+const (
+	BatchCompletionWindow = "24h"
+
+	batchMaxRequests         = 50000
+	batchMaxErrors           = 100
+	batchStatusCheckInterval = 2 * time.Second
+	batchPollInterval        = 5 * time.Second
+	batchResultPageSize      = 200
+	batchRateLimitRetries    = 3
+	batchExpiredCode         = "batch_expired"
+)
+
+// batchEndpoints 批处理支持的接口
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+var ErrBatchInsufficientQuota = errors.New("用户额度不足以预留批处理所需额度")
+
+func IsBatchEndpoint(endpoint string) bool {
+	return batchEndpoints[endpoint]
+}
+
+var batchRelayHandler http.Handler
+
+// SetBatchRelayHandler 设置执行批处理请求的 HTTP 处理器，
+// 这些请求都在进程内经过完整的鉴权、限流、渠道选择及计费流程
+func SetBatchRelayHandler(handler http.Handler) {
+	batchRelayHandler = handler
+}
+
+// batchRequest 输入文件中通过校验的一行请求
+type batchRequest struct {
+	line  int
+	input dto.BatchInputLine
+	model string
+}
+
+func newBatchError(line int, code string, message string, param string) *dto.OpenAIBatchError {
+	batchError := &dto.OpenAIBatchError{Code: code, Message: message, Line: &line}
+	if param != "" {
+		batchError.Param = &param
+	}
+	return batchError
+}
+
+// validateBatchLine 校验输入文件中的一行，customIds 用于检查 custom_id 是否重复
+func validateBatchLine(line int, data []byte, endpoint string, customIds map[string]bool) (*batchRequest, *dto.OpenAIBatchError) {
+	request := &batchRequest{line: line}
+	if err := common.Unmarshal(data, &request.input); err != nil {
+		return nil, newBatchError(line, "invalid_json_line", "This line is not parseable as valid JSON.", "")
+	}
+	input := &request.input
+	if input.CustomId == "" {
+		return nil, newBatchError(line, "missing_required_parameter", "Missing required parameter: 'custom_id'.", "custom_id")
+	}
+	if customIds[input.CustomId] {
+		return nil, newBatchError(line, "duplicate_custom_id", fmt.Sprintf("The custom_id '%s' is duplicated.", input.CustomId), "custom_id")
+	}
+	customIds[input.CustomId] = true
+	if input.Method != http.MethodPost {
+		return nil, newBatchError(line, "invalid_method", "Only the POST method is supported.", "method")
+	}
+	if input.Url != endpoint {
+		return nil, newBatchError(line, "invalid_url", fmt.Sprintf("The url '%s' does not match the batch endpoint '%s'.", input.Url, endpoint), "url")
+	}
+	var body struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if len(input.Body) == 0 || common.Unmarshal(input.Body, &body) != nil {
+		return nil, newBatchError(line, "invalid_request", "The body must be a JSON object.", "body")
+	}
+	if body.Model == "" {
+		return nil, newBatchError(line, "missing_required_parameter", "Missing required parameter: 'body.model'.", "body.model")
+	}
+	if body.Stream {
+		return nil, newBatchError(line, "invalid_request", "Streaming is not supported in batch requests.", "body.stream")
+	}
+	request.model = body.Model
+	return request, nil
+}
+
+// readBatchRequests 逐行读取并校验输入文件，跳过空行，行号从 1 开始；fn 返回 false 时停止读取
+func readBatchRequests(reader io.Reader, endpoint string, fn func(request *batchRequest, batchError *dto.OpenAIBatchError) bool) error {
+	bufReader := bufio.NewReader(reader)
+	customIds := make(map[string]bool)
+	line := 0
+	for {
+		data, err := bufReader.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+			data = bytes.TrimSpace(data)
+			if len(data) > 0 && !fn(validateBatchLine(line, data, endpoint, customIds)) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// EstimateBatchRequestQuota 按预扣费的方式估算单个批处理请求需要预留的额度（已计入批处理折扣）
+func EstimateBatchRequestQuota(modelName string, group string, body []byte) int {
+	return estimateRequestQuota(modelName, ratio_setting.GetGroupRatio(group)*common.BatchPriceRatio, body)
+}
+
+// EstimateRequestQuota 按预扣费的方式估算单个请求需要预留的额度
+func EstimateRequestQuota(modelName string, group string, body []byte) int {
+	return estimateRequestQuota(modelName, ratio_setting.GetGroupRatio(group), body)
+}
+
+func estimateRequestQuota(modelName string, groupRatio float64, body []byte) int {
+	if modelPrice, ok := ratio_setting.GetModelPrice(modelName, false); ok {
+		return int(modelPrice * common.QuotaPerUnit * groupRatio)
+	}
+	var request struct {
+		MaxTokens           int `json:"max_tokens"`
+		MaxCompletionTokens int `json:"max_completion_tokens"`
+		MaxOutputTokens     int `json:"max_output_tokens"`
+	}
+	_ = common.Unmarshal(body, &request)
+	maxTokens := common.Max(request.MaxTokens, common.Max(request.MaxCompletionTokens, request.MaxOutputTokens))
+	modelRatio, _, _ := ratio_setting.GetModelRatio(modelName)
+	tokens := common.Max(CountTextToken(string(body), modelName), common.PreConsumedQuota) + maxTokens
+	return int(float64(tokens) * modelRatio * groupRatio)
+}
+
+// CreateBatch 校验输入文件并创建批处理。校验失败时创建状态为 failed 的批处理并返回，
+// 校验通过时按估算结果预留用户额度，额度不足时返回 ErrBatchInsufficientQuota
+func CreateBatch(ctx context.Context, userId int, tokenId int, group string, inputFile *model.File, request *dto.OpenAIBatchRequest) (*model.Batch, error) {
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetUUID(),
+		UserId:           userId,
+		TokenId:          tokenId,
+		UsingGroup:       group,
+		Endpoint:         request.Endpoint,
+		InputFileId:      inputFile.FileId,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*3600,
+	}
+	if len(request.Metadata) > 0 {
+		metadata, err := common.Marshal(request.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		batch.Metadata = string(metadata)
+	}
+
+	reader, err := OpenFile(ctx, inputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var batchErrors []*dto.OpenAIBatchError
+	reservedQuota := 0
+	err = readBatchRequests(reader, request.Endpoint, func(request *batchRequest, batchError *dto.OpenAIBatchError) bool {
+		if batchError != nil {
+			batchErrors = append(batchErrors, batchError)
+			return len(batchErrors) < batchMaxErrors
+		}
+		batch.TotalRequests++
+		if batch.TotalRequests > batchMaxRequests {
+			batchErrors = append(batchErrors, newBatchError(request.line, "too_many_requests",
+				fmt.Sprintf("The batch input file contains more than %d requests.", batchMaxRequests), ""))
+			return false
+		}
+		reservedQuota += EstimateBatchRequestQuota(request.model, group, request.input.Body)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(batchErrors) == 0 && batch.TotalRequests == 0 {
+		batchErrors = append(batchErrors, &dto.OpenAIBatchError{Code: "empty_file", Message: "The batch input file is empty."})
+	}
+	if len(batchErrors) > 0 {
+		data, err := common.Marshal(&dto.OpenAIBatchErrors{Object: "list", Data: batchErrors})
+		if err != nil {
+			return nil, err
+		}
+		batch.Errors = string(data)
+		batch.TotalRequests = 0
+		batch.Status = model.BatchStatusFailed
+		batch.FailedAt = now
+		return batch, batch.Insert()
+	}
+
+	userQuota, err := model.GetUserQuota(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	if userQuota < reservedQuota {
+		return nil, ErrBatchInsufficientQuota
+	}
+	if err = model.DecreaseUserQuota(userId, reservedQuota, model.LedgerReasonBatchJob, batch.BatchId); err != nil {
+		return nil, err
+	}
+	batch.ReservedQuota = reservedQuota
+	batch.Status = model.BatchStatusInProgress
+	batch.InProgressAt = now
+	if err = batch.Insert(); err != nil {
+		_ = model.IncreaseUserQuota(userId, reservedQuota, true, model.LedgerReasonBatchJob, batch.BatchId)
+		return nil, err
+	}
+	return batch, nil
+}
+
+// CancelBatch 将未结束的批处理标记为 cancelling，由后台任务停止执行并生成结果文件
+func CancelBatch(batch *model.Batch) (bool, error) {
+	now := common.GetTimestamp()
+	ok, err := model.TransitBatchStatus(batch.BatchId, []string{model.BatchStatusValidating, model.BatchStatusInProgress},
+		model.BatchStatusCancelling, map[string]interface{}{"cancelling_at": now})
+	if ok {
+		batch.Status = model.BatchStatusCancelling
+		batch.CancellingAt = now
+	}
+	return ok, err
+}
+
+// executeBatchRequest 在进程内执行一行请求，遇到限流时稍后重试
+func executeBatchRequest(batch *model.Batch, tokenKey string, request *batchRequest) *model.BatchItem {
+	item := &model.BatchItem{BatchId: batch.BatchId, Line: request.line, CustomId: request.input.CustomId}
+	for attempt := 0; ; attempt++ {
+		ctx := common.WithBatchRequest(context.Background(), batch.BatchId)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, request.input.Url, bytes.NewReader(request.input.Body))
+		if err != nil {
+			item.ErrorCode, item.ErrorMessage = "invalid_request", err.Error()
+			return item
+		}
+		req.RemoteAddr = "127.0.0.1:0"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+		recorder := httptest.NewRecorder()
+		batchRelayHandler.ServeHTTP(recorder, req)
+		if recorder.Code == http.StatusTooManyRequests && attempt < batchRateLimitRetries {
+			time.Sleep(time.Duration(attempt+1) * 10 * time.Second)
+			continue
+		}
+		item.StatusCode = recorder.Code
+		item.RequestId = recorder.Header().Get(common.RequestIdKey)
+		item.Body = recorder.Body.String()
+		return item
+	}
+}
+
+// executeBatch 执行批处理中尚未执行的请求，遇到取消时停止，超过完成时限时将剩余请求记为过期
+func executeBatch(batch *model.Batch) error {
+	if batchRelayHandler == nil {
+		return errors.New("batch relay handler is not set")
+	}
+	doneLines, err := model.GetBatchItemLines(batch.BatchId)
+	if err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(doneLines))
+	for _, line := range doneLines {
+		done[line] = true
+	}
+	tokenKey := ""
+	if token, err := model.GetTokenById(batch.TokenId); err == nil {
+		tokenKey = token.Key
+	}
+	inputFile, err := model.GetUserFile(batch.UserId, 0, batch.InputFileId)
+	if err != nil {
+		return err
+	}
+	reader, err := OpenFile(context.Background(), inputFile)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var wg sync.WaitGroup
+	sem := getBatchSemaphore()
+	lastCheck := time.Now()
+	stopped := false
+	err = readBatchRequests(reader, batch.Endpoint, func(request *batchRequest, batchError *dto.OpenAIBatchError) bool {
+		if request == nil || done[request.line] {
+			return true
+		}
+		if !stopped && time.Since(lastCheck) > batchStatusCheckInterval {
+			lastCheck = time.Now()
+			if status, err := model.GetBatchStatus(batch.BatchId); err == nil && status == model.BatchStatusCancelling {
+				stopped = true
+			}
+		}
+		if stopped {
+			return false
+		}
+		if common.GetTimestamp() > batch.ExpiresAt {
+			item := &model.BatchItem{
+				BatchId:      batch.BatchId,
+				Line:         request.line,
+				CustomId:     request.input.CustomId,
+				ErrorCode:    batchExpiredCode,
+				ErrorMessage: "This request could not be executed before the completion window expired.",
+			}
+			if err := model.RecordBatchItem(item); err != nil {
+				common.SysError(fmt.Sprintf("failed to record batch %s item: %s", batch.BatchId, err.Error()))
+			}
+			return true
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(request *batchRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			item := executeBatchRequest(batch, tokenKey, request)
+			if err := model.RecordBatchItem(item); err != nil {
+				common.SysError(fmt.Sprintf("failed to record batch %s item: %s", batch.BatchId, err.Error()))
+			}
+		}(request)
+		return true
+	})
+	wg.Wait()
+	return err
+}
+
+var (
+	batchSemaphore     chan struct{}
+	batchSemaphoreOnce sync.Once
+	runningBatches     sync.Map
+)
+
+func getBatchSemaphore() chan struct{} {
+	batchSemaphoreOnce.Do(func() {
+		batchSemaphore = make(chan struct{}, common.Max(common.BatchConcurrency, 1))
+	})
+	return batchSemaphore
+}
+
+// batchResultWriter 将执行结果写入临时文件，结束时保存为 batch_output 文件，没有内容时不创建文件
+type batchResultWriter struct {
+	batch  *model.Batch
+	suffix string
+	tmp    *os.File
+	writer *bufio.Writer
+}
+
+func (w *batchResultWriter) write(line []byte) error {
+	if w.tmp == nil {
+		tmp, err := os.CreateTemp("", w.batch.BatchId+"-*.jsonl")
+		if err != nil {
+			return err
+		}
+		w.tmp = tmp
+		w.writer = bufio.NewWriter(tmp)
+	}
+	if _, err := w.writer.Write(line); err != nil {
+		return err
+	}
+	return w.writer.WriteByte('\n')
+}
+
+func (w *batchResultWriter) save() (string, error) {
+	if w.tmp == nil {
+		return "", nil
+	}
+	if err := w.writer.Flush(); err != nil {
+		return "", err
+	}
+	size, err := w.tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	file, err := SaveFile(context.Background(), w.batch.UserId, w.batch.TokenId, model.FilePurposeBatchOutput,
+		fmt.Sprintf("%s_%s.jsonl", w.batch.BatchId, w.suffix), w.tmp, size, 0)
+	if err != nil {
+		return "", err
+	}
+	return file.FileId, nil
+}
+
+func (w *batchResultWriter) close() {
+	if w.tmp != nil {
+		_ = w.tmp.Close()
+		_ = os.Remove(w.tmp.Name())
+	}
+}
+
+func batchItemToOutputLine(item *model.BatchItem) ([]byte, error) {
+	line := &dto.BatchOutputLine{Id: fmt.Sprintf("batch_req_%d", item.Id), CustomId: item.CustomId}
+	if item.StatusCode > 0 {
+		body := []byte(item.Body)
+		if !json.Valid(body) {
+			body, _ = common.Marshal(item.Body)
+		}
+		line.Response = &dto.BatchOutputResponse{StatusCode: item.StatusCode, RequestId: item.RequestId, Body: body}
+	}
+	if item.ErrorCode != "" {
+		line.Error = &dto.BatchOutputError{Code: item.ErrorCode, Message: item.ErrorMessage}
+	}
+	return common.Marshal(line)
+}
+
+// finalizeBatch 生成结果文件及错误文件，退还剩余的预留额度，并将批处理切换到最终状态
+func finalizeBatch(batch *model.Batch) error {
+	status, err := model.GetBatchStatus(batch.BatchId)
+	if err != nil {
+		return err
+	}
+	if status == model.BatchStatusInProgress {
+		if _, err = model.TransitBatchStatus(batch.BatchId, []string{model.BatchStatusInProgress}, model.BatchStatusFinalizing,
+			map[string]interface{}{"finalizing_at": common.GetTimestamp()}); err != nil {
+			return err
+		}
+	}
+
+	outputWriter := &batchResultWriter{batch: batch, suffix: "output"}
+	defer outputWriter.close()
+	errorWriter := &batchResultWriter{batch: batch, suffix: "error"}
+	defer errorWriter.close()
+	expired := false
+	afterLine := 0
+	for {
+		items, err := model.GetBatchItems(batch.BatchId, afterLine, batchResultPageSize)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			data, err := batchItemToOutputLine(item)
+			if err != nil {
+				return err
+			}
+			writer := errorWriter
+			if item.Succeeded() {
+				writer = outputWriter
+			}
+			if err = writer.write(data); err != nil {
+				return err
+			}
+			expired = expired || item.ErrorCode == batchExpiredCode
+			afterLine = item.Line
+		}
+		if len(items) < batchResultPageSize {
+			break
+		}
+	}
+	outputFileId, err := outputWriter.save()
+	if err != nil {
+		return err
+	}
+	errorFileId, err := errorWriter.save()
+	if err != nil {
+		return err
+	}
+
+	from := []string{model.BatchStatusFinalizing}
+	final, timeField := model.BatchStatusCompleted, "completed_at"
+	switch {
+	case status == model.BatchStatusCancelling:
+		from = []string{model.BatchStatusCancelling}
+		final, timeField = model.BatchStatusCancelled, "cancelled_at"
+	case expired:
+		final, timeField = model.BatchStatusExpired, "expired_at"
+	}
+	released, ok, err := model.FinishBatch(batch.BatchId, from, final, map[string]interface{}{
+		timeField:        common.GetTimestamp(),
+		"output_file_id": outputFileId,
+		"error_file_id":  errorFileId,
+	})
+	if err != nil {
+		return err
+	}
+	if ok && released > 0 {
+		if err = model.IncreaseUserQuota(batch.UserId, released, true, model.LedgerReasonBatchJob, batch.BatchId); err != nil {
+			common.SysError(fmt.Sprintf("failed to return batch %s reserved quota: %s", batch.BatchId, err.Error()))
+		}
+	}
+	return model.DeleteBatchItems(batch.BatchId)
+}
+
+// ProcessBatch 执行并结束一个批处理，出错时保留当前进度，等待下一轮继续处理
+func ProcessBatch(batch *model.Batch) {
+	if batch.Status == model.BatchStatusInProgress {
+		if err := executeBatch(batch); err != nil {
+			common.SysError(fmt.Sprintf("failed to execute batch %s: %s", batch.BatchId, err.Error()))
+			return
+		}
+	}
+	if err := finalizeBatch(batch); err != nil {
+		common.SysError(fmt.Sprintf("failed to finalize batch %s: %s", batch.BatchId, err.Error()))
+	}
+}
+
+// AutomaticallyProcessBatches 在主节点上持续处理未完成的批处理，重启后从已记录的进度继续执行
+func AutomaticallyProcessBatches() {
+	for {
+		batches, err := model.GetUnfinishedBatches()
+		if err != nil {
+			common.SysError("failed to get unfinished batches: " + err.Error())
+		}
+		for _, batch := range batches {
+			if _, running := runningBatches.LoadOrStore(batch.BatchId, true); running {
+				continue
+			}
+			go func(batch *model.Batch) {
+				defer runningBatches.Delete(batch.BatchId)
+				ProcessBatch(batch)
+			}(batch)
+		}
+		time.Sleep(batchPollInterval)
+	}
+}
+
+// BatchToOpenAI 转换为 OpenAI SDK 兼容的批处理对象
+func BatchToOpenAI(batch *model.Batch) *dto.OpenAIBatch {
+	optional := func(value int64) *int64 {
+		if value == 0 {
+			return nil
+		}
+		return &value
+	}
+	optionalId := func(id string) *string {
+		if id == "" {
+			return nil
+		}
+		return &id
+	}
+	object := &dto.OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalId(batch.OutputFileId),
+		ErrorFileId:      optionalId(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optional(batch.InProgressAt),
+		ExpiresAt:        optional(batch.ExpiresAt),
+		FinalizingAt:     optional(batch.FinalizingAt),
+		CompletedAt:      optional(batch.CompletedAt),
+		FailedAt:         optional(batch.FailedAt),
+		ExpiredAt:        optional(batch.ExpiredAt),
+		CancellingAt:     optional(batch.CancellingAt),
+		CancelledAt:      optional(batch.CancelledAt),
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     batch.TotalRequests,
+			Completed: batch.CompletedRequests,
+			Failed:    batch.FailedRequests,
+		},
+		Metadata: map[string]string{},
+	}
+	if batch.Errors != "" {
+		object.Errors = &dto.OpenAIBatchErrors{}
+		_ = common.UnmarshalJsonStr(batch.Errors, object.Errors)
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &object.Metadata)
+	}
+	return object
+}
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// claudeThinkingEffort 按 Claude thinking 的预算 token 数估算 Responses API 的推理力度
+func claudeThinkingEffort(budgetTokens int) string {
+	switch {
+	case budgetTokens <= 0:
+		return "medium"
+	case budgetTokens < 4096:
+		return "low"
+	case budgetTokens < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+func claudeMediaSourceURL(source *dto.ClaudeMessageSource) string {
+	if source == nil {
+		return ""
+	}
+	if source.Type == "url" {
+		return source.Url
+	}
+	return fmt.Sprintf("data:%s;base64,%s", source.MediaType, common.Interface2String(source.Data))
+}
+
+// claudeToolResultOutput 将 tool_result 的内容转换为 function_call_output 的文本
+func claudeToolResultOutput(block dto.ClaudeMediaMessage) string {
+	if block.Content == nil || block.IsStringContent() {
+		return block.GetStringContent()
+	}
+	var sb strings.Builder
+	for _, content := range block.ParseMediaContent() {
+		if content.Type == dto.ContentTypeText {
+			sb.WriteString(content.GetText())
+		}
+	}
+	return sb.String()
+}
+
+// ClaudeToResponsesRequest 将 Claude Messages 请求转换为 Responses API 请求，
+// 用于只能通过 Responses API 调用的上游模型
+func ClaudeToResponsesRequest(claudeRequest *dto.ClaudeRequest) (*dto.OpenAIResponsesRequest, error) {
+	request := &dto.OpenAIResponsesRequest{
+		Model:           claudeRequest.Model,
+		Stream:          claudeRequest.Stream,
+		MaxOutputTokens: claudeRequest.MaxTokens,
+		TopP:            claudeRequest.TopP,
+		Temperature:     claudeRequest.Temperature,
+	}
+	if claudeRequest.Thinking != nil && claudeRequest.Thinking.Type == "enabled" {
+		request.Reasoning = &dto.Reasoning{
+			Effort:  claudeThinkingEffort(claudeRequest.Thinking.GetBudgetTokens()),
+			Summary: "auto",
+		}
+	}
+
+	// system -> instructions
+	if claudeRequest.System != nil {
+		instructions := claudeRequest.GetStringSystem()
+		if !claudeRequest.IsStringSystem() {
+			var texts []string
+			for _, system := range claudeRequest.ParseSystem() {
+				if system.GetText() != "" {
+					texts = append(texts, system.GetText())
+				}
+			}
+			instructions = strings.Join(texts, "\n")
+		}
+		if instructions != "" {
+			data, err := common.Marshal(instructions)
+			if err != nil {
+				return nil, err
+			}
+			request.Instructions = data
+		}
+	}
+
+	input := make([]map[string]any, 0, len(claudeRequest.Messages))
+	for _, message := range claudeRequest.Messages {
+		if message.IsStringContent() {
+			input = append(input, map[string]any{"role": message.Role, "content": message.GetStringContent()})
+			continue
+		}
+		blocks, err := message.ParseContent()
+		if err != nil {
+			return nil, err
+		}
+		textType := "input_text"
+		if message.Role == "assistant" {
+			textType = "output_text"
+		}
+		parts := make([]map[string]any, 0, len(blocks))
+		flushParts := func() {
+			if len(parts) == 0 {
+				return
+			}
+			input = append(input, map[string]any{"role": message.Role, "content": parts})
+			parts = make([]map[string]any, 0)
+		}
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				parts = append(parts, map[string]any{"type": textType, "text": block.GetText()})
+			case "image":
+				parts = append(parts, map[string]any{"type": "input_image", "image_url": claudeMediaSourceURL(block.Source)})
+			case "document":
+				if block.Source == nil || block.Source.Type != "base64" {
+					continue
+				}
+				parts = append(parts, map[string]any{
+					"type":      "input_file",
+					"filename":  "document.pdf",
+					"file_data": claudeMediaSourceURL(block.Source),
+				})
+			case "tool_use":
+				flushParts()
+				input = append(input, map[string]any{
+					"type":      "function_call",
+					"call_id":   block.Id,
+					"name":      block.Name,
+					"arguments": toJSONString(block.Input),
+				})
+			case "tool_result":
+				flushParts()
+				input = append(input, map[string]any{
+					"type":    "function_call_output",
+					"call_id": block.ToolUseId,
+					"output":  claudeToolResultOutput(block),
+				})
+			default:
+				// thinking、redacted_thinking 等内容由上游重新推理，不回传
+				continue
+			}
+		}
+		flushParts()
+	}
+	inputData, err := common.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	request.Input = inputData
+
+	// 只转换普通函数工具，web_search 等服务端工具无法在 Responses API 中等价执行
+	rawTools, _ := common.Any2Type[[]map[string]any](claudeRequest.Tools)
+	responsesTools := make([]map[string]any, 0, len(rawTools))
+	for _, rawTool := range rawTools {
+		if toolType := common.Interface2String(rawTool["type"]); toolType != "" && toolType != "custom" {
+			continue
+		}
+		tool, err := common.Any2Type[dto.Tool](rawTool)
+		if err != nil {
+			return nil, err
+		}
+		responsesTools = append(responsesTools, map[string]any{
+			"type":        "function",
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  tool.InputSchema,
+		})
+	}
+	if len(responsesTools) > 0 {
+		if request.Tools, err = common.Marshal(responsesTools); err != nil {
+			return nil, err
+		}
+		if claudeRequest.ToolChoice != nil {
+			toolChoice, _ := common.Any2Type[dto.ClaudeToolChoice](claudeRequest.ToolChoice)
+			var choice any
+			switch toolChoice.Type {
+			case "auto", "none":
+				choice = toolChoice.Type
+			case "any":
+				choice = "required"
+			case "tool":
+				choice = map[string]any{"type": "function", "name": toolChoice.Name}
+			}
+			if choice != nil {
+				request.ToolChoice, _ = common.Marshal(choice)
+			}
+			if toolChoice.DisableParallelToolUse {
+				request.ParallelToolCalls, _ = common.Marshal(false)
+			}
+		}
+	}
+	return request, nil
+}
+
+func claudeStopReasonFromResponses(response *dto.OpenAIResponsesResponse, hasToolUse bool) string {
+	if response != nil && response.Status == "incomplete" {
+		return "max_tokens"
+	}
+	if hasToolUse {
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+func claudeUsageFromResponses(usage *dto.Usage) *dto.ClaudeUsage {
+	claudeUsage := &dto.ClaudeUsage{}
+	if usage == nil {
+		return claudeUsage
+	}
+	claudeUsage.InputTokens = usage.InputTokens
+	claudeUsage.OutputTokens = usage.OutputTokens
+	if usage.InputTokensDetails != nil {
+		claudeUsage.CacheReadInputTokens = usage.InputTokensDetails.CachedTokens
+		claudeUsage.InputTokens -= usage.InputTokensDetails.CachedTokens
+	}
+	return claudeUsage
+}
+
+func claudeToolInput(arguments string) any {
+	var input map[string]any
+	if err := common.UnmarshalJsonStr(arguments, &input); err == nil && input != nil {
+		return input
+	}
+	return map[string]any{}
+}
+
+// reasoningText 返回推理条目的摘要文本，没有摘要时使用推理原文
+func reasoningText(output dto.ResponsesOutput) string {
+	var sb strings.Builder
+	for _, summary := range output.Summary {
+		sb.WriteString(summary.Text)
+	}
+	if sb.Len() == 0 {
+		for _, content := range output.Content {
+			sb.WriteString(content.Text)
+		}
+	}
+	return sb.String()
+}
+
+// ResponsesResponse2Claude 将非流式 Responses API 响应转换为 Claude Messages 响应
+func ResponsesResponse2Claude(response *dto.OpenAIResponsesResponse) *dto.ClaudeResponse {
+	contents := make([]dto.ClaudeMediaMessage, 0, len(response.Output))
+	hasToolUse := false
+	for _, output := range response.Output {
+		switch output.Type {
+		case dto.ResponsesOutputTypeReasoning:
+			if text := reasoningText(output); text != "" {
+				contents = append(contents, dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer(text)})
+			}
+		case dto.ResponsesOutputTypeMessage:
+			for _, content := range output.Content {
+				if content.Type == "output_text" {
+					block := dto.ClaudeMediaMessage{Type: "text"}
+					block.SetText(content.Text)
+					contents = append(contents, block)
+				}
+			}
+		case dto.ResponsesOutputTypeFunctionCall:
+			hasToolUse = true
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:  "tool_use",
+				Id:    output.CallId,
+				Name:  output.Name,
+				Input: claudeToolInput(output.Arguments),
+			})
+		}
+	}
+	return &dto.ClaudeResponse{
+		Id:         response.ID,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      response.Model,
+		Content:    contents,
+		StopReason: claudeStopReasonFromResponses(response, hasToolUse),
+		Usage:      claudeUsageFromResponses(response.Usage),
+	}
+}
+
+// ClaudeResponsesStreamConverter 将 Responses API 流式事件转换为 Claude Messages 流式事件，
+// 每个 output item 对应一个 content block
+type ClaudeResponsesStreamConverter struct {
+	Model string
+
+	started    bool
+	finished   bool
+	nextIndex  int
+	openBlocks map[int]int // output_index -> content block index
+	hasToolUse bool
+}
+
+func NewClaudeResponsesStreamConverter(model string) *ClaudeResponsesStreamConverter {
+	return &ClaudeResponsesStreamConverter{Model: model, openBlocks: make(map[int]int)}
+}
+
+func (s *ClaudeResponsesStreamConverter) Started() bool {
+	return s.started
+}
+
+func (s *ClaudeResponsesStreamConverter) start(id string, model string) *dto.ClaudeResponse {
+	s.started = true
+	if model == "" {
+		model = s.Model
+	}
+	message := &dto.ClaudeMediaMessage{
+		Id:    id,
+		Type:  "message",
+		Role:  "assistant",
+		Model: model,
+		Usage: &dto.ClaudeUsage{},
+	}
+	message.SetContent(make([]any, 0))
+	return &dto.ClaudeResponse{Type: "message_start", Message: message}
+}
+
+func (s *ClaudeResponsesStreamConverter) blockIndex(event *dto.ResponsesStreamResponse) (int, bool) {
+	if event.OutputIndex == nil {
+		return 0, false
+	}
+	index, ok := s.openBlocks[*event.OutputIndex]
+	return index, ok
+}
+
+func (s *ClaudeResponsesStreamConverter) delta(event *dto.ResponsesStreamResponse, delta *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	index, ok := s.blockIndex(event)
+	if !ok {
+		return nil
+	}
+	return []*dto.ClaudeResponse{{Type: "content_block_delta", Index: common.GetPointer(index), Delta: delta}}
+}
+
+// ConvertEvent 转换一个 Responses API 流式事件，返回需要发送的 Claude 事件
+func (s *ClaudeResponsesStreamConverter) ConvertEvent(event *dto.ResponsesStreamResponse) []*dto.ClaudeResponse {
+	var responses []*dto.ClaudeResponse
+	if !s.started {
+		id, model := "", ""
+		if event.Response != nil {
+			id, model = event.Response.ID, event.Response.Model
+		}
+		responses = append(responses, s.start(id, model))
+	}
+	switch event.Type {
+	case dto.ResponsesStreamTypeOutputItemAdded:
+		if event.Item == nil || event.OutputIndex == nil {
+			break
+		}
+		block := &dto.ClaudeMediaMessage{}
+		switch event.Item.Type {
+		case dto.ResponsesOutputTypeMessage:
+			block.Type = "text"
+			block.SetText("")
+		case dto.ResponsesOutputTypeReasoning:
+			block.Type = "thinking"
+			block.Thinking = common.GetPointer("")
+		case dto.ResponsesOutputTypeFunctionCall:
+			s.hasToolUse = true
+			block.Type = "tool_use"
+			block.Id = event.Item.CallId
+			block.Name = event.Item.Name
+			block.Input = map[string]any{}
+		default:
+			return responses
+		}
+		index := s.nextIndex
+		s.nextIndex++
+		s.openBlocks[*event.OutputIndex] = index
+		responses = append(responses, &dto.ClaudeResponse{Type: "content_block_start", Index: common.GetPointer(index), ContentBlock: block})
+	case dto.ResponsesStreamTypeOutputTextDelta:
+		responses = append(responses, s.delta(event, &dto.ClaudeMediaMessage{Type: "text_delta", Text: common.GetPointer(event.Delta)})...)
+	case dto.ResponsesStreamTypeSummaryTextDelta, "response.reasoning_text.delta":
+		responses = append(responses, s.delta(event, &dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: common.GetPointer(event.Delta)})...)
+	case dto.ResponsesStreamTypeArgumentsDelta:
+		responses = append(responses, s.delta(event, &dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: common.GetPointer(event.Delta)})...)
+	case dto.ResponsesStreamTypeOutputItemDone:
+		if index, ok := s.blockIndex(event); ok {
+			delete(s.openBlocks, *event.OutputIndex)
+			responses = append(responses, &dto.ClaudeResponse{Type: "content_block_stop", Index: common.GetPointer(index)})
+		}
+	case dto.ResponsesStreamTypeCompleted, dto.ResponsesStreamTypeIncomplete:
+		responses = append(responses, s.finish(event.Response)...)
+	case dto.ResponsesStreamTypeFailed:
+		s.finished = true
+		message := "upstream response failed"
+		if event.Response != nil {
+			if oaiError := event.Response.GetOpenAIError(); oaiError != nil && oaiError.Message != "" {
+				message = oaiError.Message
+			}
+		}
+		responses = append(responses, &dto.ClaudeResponse{Type: "error", Error: map[string]string{"type": "api_error", "message": message}})
+	}
+	return responses
+}
+
+func (s *ClaudeResponsesStreamConverter) finish(response *dto.OpenAIResponsesResponse) []*dto.ClaudeResponse {
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	var responses []*dto.ClaudeResponse
+	indexes := make([]int, 0, len(s.openBlocks))
+	for _, index := range s.openBlocks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		responses = append(responses, &dto.ClaudeResponse{Type: "content_block_stop", Index: common.GetPointer(index)})
+	}
+	s.openBlocks = make(map[int]int)
+	var usage *dto.Usage
+	if response != nil {
+		usage = response.Usage
+	}
+	responses = append(responses, &dto.ClaudeResponse{
+		Type:  "message_delta",
+		Usage: claudeUsageFromResponses(usage),
+		Delta: &dto.ClaudeMediaMessage{StopReason: common.GetPointer(claudeStopReasonFromResponses(response, s.hasToolUse))},
+	})
+	return append(responses, &dto.ClaudeResponse{Type: "message_stop"})
+}
+
+// Finish 在上游未发送 response.completed 时补发结束事件
+func (s *ClaudeResponsesStreamConverter) Finish() []*dto.ClaudeResponse {
+	if !s.started {
+		return nil
+	}
+	return s.finish(nil)
+}
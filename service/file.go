@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// fileInlineMaxBytes 请求中通过 file_id 引用并内联为 base64 的单个文件大小上限
+const fileInlineMaxBytes = 50 << 20
+
+var ErrFileStorageQuotaExceeded = errors.New("文件存储空间不足")
+
+// GetFileStore 返回 /v1/files 及批处理结果文件的存储，与日志归档共用 ObjectStore 的实现：
+// 配置了 FILE_S3_BUCKET 时使用对象存储，否则写入 FILE_STORAGE_DIR 指定的本地目录
+func GetFileStore(storage string) (ObjectStore, error) {
+	if storage == "" {
+		storage = ObjectStorageLocal
+		if os.Getenv("FILE_S3_BUCKET") != "" {
+			storage = ObjectStorageS3
+		}
+	}
+	switch storage {
+	case ObjectStorageLocal:
+		dir, err := filepath.Abs(common.GetEnvOrDefaultString("FILE_STORAGE_DIR", "./files"))
+		if err != nil {
+			return nil, err
+		}
+		return &localObjectStore{dir: dir}, nil
+	case ObjectStorageS3:
+		store, err := newS3ObjectStore("FILE", "application/octet-stream")
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown file storage: %s", storage)
+}
+
+// CheckFileStorageQuota 检查用户再写入 size 字节后是否超过存储空间上限
+func CheckFileStorageQuota(userId int, size int64) error {
+	if common.FileUserStorageLimitMB <= 0 {
+		return nil
+	}
+	used, err := model.GetUserFileBytes(userId)
+	if err != nil {
+		return err
+	}
+	if used+size > int64(common.FileUserStorageLimitMB)<<20 {
+		return ErrFileStorageQuotaExceeded
+	}
+	return nil
+}
+
+// SaveFile 将文件内容写入存储并保存文件记录，expiresAfter 为文件保留秒数，0 表示使用默认保留天数
+func SaveFile(ctx context.Context, userId int, tokenId int, purpose string, filename string, body io.ReadSeeker, size int64, expiresAfter int64) (*model.File, error) {
+	store, err := GetFileStore("")
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		FileId:    "file-" + common.GetUUID(),
+		UserId:    userId,
+		TokenId:   tokenId,
+		Purpose:   purpose,
+		Filename:  filename,
+		Bytes:     size,
+		Storage:   store.Name(),
+		CreatedAt: common.GetTimestamp(),
+	}
+	if expiresAfter == 0 && common.FileRetentionDays > 0 {
+		expiresAfter = int64(common.FileRetentionDays) * 86400
+	}
+	if expiresAfter > 0 {
+		file.ExpiresAt = file.CreatedAt + expiresAfter
+	}
+	file.ObjectKey = fmt.Sprintf("files/%d/%s", userId, file.FileId)
+	if err = store.Put(ctx, file.ObjectKey, body, size); err != nil {
+		return nil, err
+	}
+	if err = file.Insert(); err != nil {
+		_ = store.Delete(ctx, file.ObjectKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+func OpenFile(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	store, err := GetFileStore(file.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(ctx, file.ObjectKey)
+}
+
+// DeleteFile 删除文件内容及文件记录，内容已不存在时仍删除记录
+func DeleteFile(ctx context.Context, file *model.File) error {
+	store, err := GetFileStore(file.Storage)
+	if err != nil {
+		return err
+	}
+	if err = store.Delete(ctx, file.ObjectKey); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return model.DeleteFile(file)
+}
+
+func FileToOpenAI(file *model.File) *dto.OpenAIFile {
+	object := &dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+	if file.ExpiresAt > 0 {
+		object.ExpiresAt = &file.ExpiresAt
+	}
+	return object
+}
+
+// GetRequestFileScope 返回当前请求可访问的文件范围，开启 FILE_TOKEN_SCOPED 时限定为当前令牌
+func GetRequestFileScope(c *gin.Context) (userId int, tokenId int) {
+	if common.FileTokenScoped {
+		return c.GetInt("id"), c.GetInt("token_id")
+	}
+	return c.GetInt("id"), 0
+}
+
+// readFileDataURL 读取文件内容并编码为 data URL
+func readFileDataURL(ctx context.Context, file *model.File) (string, error) {
+	if file.Bytes > fileInlineMaxBytes {
+		return "", fmt.Errorf("file %s is too large to be inlined (%d bytes)", file.FileId, file.Bytes)
+	}
+	reader, err := OpenFile(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, fileInlineMaxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(file.Filename)))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if idx := strings.Index(mimeType, ";"); idx > 0 {
+		mimeType = mimeType[:idx]
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// requestFileReference 请求体中带有 file_id 的对象
+type requestFileReference struct {
+	path    string
+	fileId  string
+	isImage bool
+}
+
+func joinJSONPath(path string, key string) string {
+	if path == "" {
+		return gjson.Escape(key)
+	}
+	return path + "." + gjson.Escape(key)
+}
+
+// findFileReferences 递归查找带有本站格式 file_id 的对象，记录其 JSON 路径
+func findFileReferences(value gjson.Result, path string, refs *[]requestFileReference) {
+	if !value.IsObject() && !value.IsArray() {
+		return
+	}
+	if value.IsObject() {
+		if fileId := value.Get("file_id"); fileId.Type == gjson.String && strings.HasPrefix(fileId.Str, "file-") {
+			*refs = append(*refs, requestFileReference{path: path, fileId: fileId.Str, isImage: value.Get("type").Str == "input_image"})
+		}
+	}
+	value.ForEach(func(key, item gjson.Result) bool {
+		findFileReferences(item, joinJSONPath(path, key.String()), refs)
+		return true
+	})
+}
+
+// InlineRequestFiles 将请求体中引用本站文件的 file_id 替换为文件内容，上游渠道无法识别本站的文件 id：
+// input_image 条目替换为 image_url，其余（Chat 的 file 对象、Responses 的 input_file 条目）替换为 file_data 及 filename。
+// 只修改匹配的对象，请求体的其余部分保持原样；不属于本站的 file_id 保持不变，交由上游处理
+func InlineRequestFiles(c *gin.Context) error {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(body), `"file_id"`) || !strings.HasPrefix(c.GetHeader("Content-Type"), "application/json") {
+		return nil
+	}
+	if !gjson.ValidBytes(body) {
+		return nil
+	}
+	var refs []requestFileReference
+	findFileReferences(gjson.ParseBytes(body), "", &refs)
+	userId, tokenId := GetRequestFileScope(c)
+	changed := false
+	for _, ref := range refs {
+		file, err := model.GetUserFile(userId, tokenId, ref.fileId)
+		if err != nil {
+			continue
+		}
+		dataURL, err := readFileDataURL(c.Request.Context(), file)
+		if err != nil {
+			return err
+		}
+		if body, err = sjson.DeleteBytes(body, joinJSONPath(ref.path, "file_id")); err != nil {
+			return err
+		}
+		if ref.isImage {
+			body, err = sjson.SetBytes(body, joinJSONPath(ref.path, "image_url"), dataURL)
+		} else if body, err = sjson.SetBytes(body, joinJSONPath(ref.path, "file_data"), dataURL); err == nil {
+			body, err = sjson.SetBytes(body, joinJSONPath(ref.path, "filename"), file.Filename)
+		}
+		if err != nil {
+			return err
+		}
+		changed = true
+	}
+	if changed {
+		c.Set(common.KeyRequestBody, body)
+	}
+	return nil
+}
+
+// CleanExpiredFiles 删除已过期的文件，未结束批处理的输入文件等批处理结束后再删除
+func CleanExpiredFiles() (int, error) {
+	files, err := model.GetExpiredFiles(common.GetTimestamp(), 1000)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, file := range files {
+		if used, err := model.IsFileUsedByUnfinishedBatch(file.FileId); err != nil || used {
+			continue
+		}
+		if err = DeleteFile(context.Background(), file); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete expired file %s: %s", file.FileId, err.Error()))
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func AutomaticallyCleanExpiredFiles(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		deleted, err := CleanExpiredFiles()
+		if err != nil {
+			common.SysError("failed to clean expired files: " + err.Error())
+			continue
+		}
+		if deleted > 0 {
+			common.SysLog(fmt.Sprintf("deleted %d expired files", deleted))
+		}
+	}
+}
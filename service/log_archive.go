@@ -0,0 +1,281 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const logArchiveBatchSize = 1000
+
+var logArchiveLock sync.Mutex
+
+// GetLogArchiveStore 根据环境变量返回归档存储，配置了 LOG_ARCHIVE_S3_BUCKET 时使用对象存储，否则写入本地目录
+func GetLogArchiveStore(storage string) (ObjectStore, error) {
+	bucket := os.Getenv("LOG_ARCHIVE_S3_BUCKET")
+	if storage == "" {
+		storage = ObjectStorageLocal
+		if bucket != "" {
+			storage = ObjectStorageS3
+		}
+	}
+	switch storage {
+	case ObjectStorageLocal:
+		dir, err := filepath.Abs(common.GetEnvOrDefaultString("LOG_ARCHIVE_DIR", "./archives"))
+		if err != nil {
+			return nil, err
+		}
+		return &localObjectStore{dir: dir}, nil
+	case ObjectStorageS3:
+		store, err := newS3ObjectStore("LOG_ARCHIVE", "application/gzip")
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown log archive storage: %s", storage)
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// ArchiveLogs 将 cutoff 所在日之前的日志按天导出为 gzip 压缩的 JSONL 文件，校验成功后再从 logs 表删除
+func ArchiveLogs(ctx context.Context, cutoff int64) ([]*model.LogArchive, error) {
+	if !logArchiveLock.TryLock() {
+		return nil, errors.New("日志归档任务正在运行")
+	}
+	defer logArchiveLock.Unlock()
+
+	store, err := GetLogArchiveStore("")
+	if err != nil {
+		return nil, err
+	}
+	// 只归档完整的自然日，保证每个分区只对应一天
+	dayCutoff := startOfDay(time.Unix(cutoff, 0))
+	oldest, err := model.GetOldestLogTimestamp(dayCutoff.Unix())
+	if err != nil || oldest == 0 {
+		return nil, err
+	}
+	archives := make([]*model.LogArchive, 0)
+	for day := startOfDay(time.Unix(oldest, 0)); day.Before(dayCutoff); day = day.AddDate(0, 0, 1) {
+		archive, err := archiveLogDay(ctx, store, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return archives, fmt.Errorf("归档 %s 的日志失败: %w", day.Format("2006-01-02"), err)
+		}
+		if archive != nil {
+			archives = append(archives, archive)
+		}
+	}
+	return archives, nil
+}
+
+func archiveLogDay(ctx context.Context, store ObjectStore, dayStart time.Time, dayEnd time.Time) (*model.LogArchive, error) {
+	startTime, endTime := dayStart.Unix(), dayEnd.Unix()
+	maxId, err := model.GetMaxLogId(startTime, endTime)
+	if err != nil || maxId == 0 {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "log-archive-*.jsonl.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	day := dayStart.Format("2006-01-02")
+	archive := &model.LogArchive{
+		Day:       day,
+		Storage:   store.Name(),
+		StartTime: startTime,
+		EndTime:   endTime,
+	}
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, hash))
+	err = model.IterateLogs(ctx, startTime, endTime, maxId, logArchiveBatchSize, func(logs []*model.Log) error {
+		for _, log := range logs {
+			line, err := common.Marshal(log)
+			if err != nil {
+				return err
+			}
+			if _, err = gz.Write(append(line, '\n')); err != nil {
+				return err
+			}
+			if archive.MinId == 0 {
+				archive.MinId = log.Id
+			}
+			archive.MaxId = log.Id
+			archive.RowCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = gz.Close(); err != nil {
+		return nil, err
+	}
+	if archive.RowCount == 0 {
+		return nil, nil
+	}
+	archive.Checksum = hex.EncodeToString(hash.Sum(nil))
+	if archive.SizeBytes, err = tmp.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	archive.ObjectKey = fmt.Sprintf("logs/dt=%s/logs-%d-%d.jsonl.gz", day, archive.MinId, archive.MaxId)
+	if err = store.Put(ctx, archive.ObjectKey, tmp, archive.SizeBytes); err != nil {
+		return nil, err
+	}
+	if err = verifyLogArchive(ctx, store, archive); err != nil {
+		_ = store.Delete(ctx, archive.ObjectKey)
+		return nil, err
+	}
+	if err = archive.Insert(); err != nil {
+		return nil, err
+	}
+	deleted, err := model.DeleteArchivedLogs(ctx, startTime, endTime, archive.MaxId, logArchiveBatchSize)
+	if err != nil {
+		return archive, err
+	}
+	common.SysLog(fmt.Sprintf("archived %d logs of %s to %s:%s, deleted %d", archive.RowCount, day, store.Name(), archive.ObjectKey, deleted))
+	return archive, nil
+}
+
+// verifyLogArchive 读回归档文件，校验压缩文件 sha256 与日志条数
+func verifyLogArchive(ctx context.Context, store ObjectStore, archive *model.LogArchive) error {
+	reader, err := store.Open(ctx, archive.ObjectKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	gz, err := gzip.NewReader(io.TeeReader(reader, hash))
+	if err != nil {
+		return err
+	}
+	var rows int64
+	err = readLogArchiveLines(gz, func(line []byte) error {
+		rows++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 读完 gzip 尾部之后可能仍有未读取的字节，全部计入校验和
+	if _, err = io.Copy(io.Discard, io.TeeReader(reader, hash)); err != nil {
+		return err
+	}
+	if rows != archive.RowCount {
+		return fmt.Errorf("归档校验失败：期望 %d 条日志，实际 %d 条", archive.RowCount, rows)
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != archive.Checksum {
+		return fmt.Errorf("归档校验失败：校验和不一致 %s != %s", checksum, archive.Checksum)
+	}
+	return nil
+}
+
+func readLogArchiveLines(reader io.Reader, fn func(line []byte) error) error {
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if fnErr := fn(line); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportLogArchive 将归档重新导入 restored_logs 表供排查使用，返回导入条数
+func ImportLogArchive(ctx context.Context, archiveId int) (int64, error) {
+	archive, err := model.GetLogArchiveById(archiveId)
+	if err != nil {
+		return 0, err
+	}
+	store, err := GetLogArchiveStore(archive.Storage)
+	if err != nil {
+		return 0, err
+	}
+	reader, err := store.Open(ctx, archive.ObjectKey)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	var imported int64
+	batch := make([]*model.Log, 0, logArchiveBatchSize)
+	flush := func() error {
+		if err := model.RestoreLogs(archive.Id, batch, imported == 0); err != nil {
+			return err
+		}
+		imported += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	err = readLogArchiveLines(gz, func(line []byte) error {
+		log := &model.Log{}
+		if err := common.Unmarshal(line, log); err != nil {
+			return err
+		}
+		batch = append(batch, log)
+		if len(batch) >= logArchiveBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return imported, err
+	}
+	return imported, model.MarkLogArchiveRestored(archive.Id, common.GetTimestamp())
+}
+
+func AutomaticallyArchiveLogs(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		if !common.LogArchiveEnabled {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -common.LogArchiveRetentionDays).Unix()
+		archives, err := ArchiveLogs(context.Background(), cutoff)
+		if err != nil {
+			common.SysError("failed to archive logs: " + err.Error())
+			continue
+		}
+		if len(archives) > 0 {
+			common.SysLog(fmt.Sprintf("archived logs into %d files", len(archives)))
+		}
+	}
+}
@@ -49,6 +49,13 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if priceOverride := relayInfo.PriceData.GroupRatioInfo.PriceOverride; priceOverride != nil {
+		other["price_override"] = priceOverride
+	}
+	if batchRatio := relayInfo.PriceData.GroupRatioInfo.BatchRatio; batchRatio > 0 {
+		other["batch_id"] = common.GetBatchRequestId(ctx)
+		other["batch_ratio"] = batchRatio
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
@@ -68,6 +75,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["local_count_tokens"] = isLocalCountTokens
 	}
 
+	if IsPayloadCaptured(ctx) {
+		adminInfo["payload_capture_request_id"] = ctx.GetString(common.RequestIdKey)
+	}
+
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
 	return other
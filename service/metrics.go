@@ -0,0 +1,84 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/metrics"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// stateCollector 在抓取时读取渠道状态、任务队列和 Redis 连接池等状态类指标
+type stateCollector struct {
+	channelStatus  *prometheus.Desc
+	taskQueueDepth *prometheus.Desc
+	redisPool      *prometheus.Desc
+	redisPoolEvent *prometheus.Desc
+}
+
+func newStateCollector() *stateCollector {
+	return &stateCollector{
+		channelStatus: prometheus.NewDesc("newapi_channel_status",
+			"Channel status (1: enabled, 2: manually disabled, 3: auto disabled).",
+			[]string{"channel_id", "channel_type"}, nil),
+		taskQueueDepth: prometheus.NewDesc("newapi_task_queue_depth",
+			"Number of unfinished async tasks by platform.",
+			[]string{"platform"}, nil),
+		redisPool: prometheus.NewDesc("newapi_redis_pool_connections",
+			"Redis connection pool stats.",
+			[]string{"state"}, nil),
+		redisPoolEvent: prometheus.NewDesc("newapi_redis_pool_events_total",
+			"Redis connection pool hits, misses and timeouts.",
+			[]string{"event"}, nil),
+	}
+}
+
+func (s *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.channelStatus
+	ch <- s.taskQueueDepth
+	ch <- s.redisPool
+	ch <- s.redisPoolEvent
+}
+
+func (s *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	if channels, err := model.GetChannelStatusStats(); err == nil {
+		for _, channel := range channels {
+			ch <- prometheus.MustNewConstMetric(s.channelStatus, prometheus.GaugeValue, float64(channel.Status),
+				strconv.Itoa(channel.Id), strconv.Itoa(channel.Type))
+		}
+	} else {
+		common.SysError("failed to collect channel metrics: " + err.Error())
+	}
+	if tasks, err := model.CountUnfinishedTasksByPlatform(); err == nil {
+		for _, task := range tasks {
+			ch <- prometheus.MustNewConstMetric(s.taskQueueDepth, prometheus.GaugeValue, float64(task.Count), task.Platform)
+		}
+	} else {
+		common.SysError("failed to collect task metrics: " + err.Error())
+	}
+	if common.RedisEnabled && common.RDB != nil {
+		stats := common.RDB.PoolStats()
+		ch <- prometheus.MustNewConstMetric(s.redisPool, prometheus.GaugeValue, float64(stats.TotalConns), "total")
+		ch <- prometheus.MustNewConstMetric(s.redisPool, prometheus.GaugeValue, float64(stats.IdleConns), "idle")
+		ch <- prometheus.MustNewConstMetric(s.redisPool, prometheus.GaugeValue, float64(stats.StaleConns), "stale")
+		ch <- prometheus.MustNewConstMetric(s.redisPoolEvent, prometheus.CounterValue, float64(stats.Hits), "hits")
+		ch <- prometheus.MustNewConstMetric(s.redisPoolEvent, prometheus.CounterValue, float64(stats.Misses), "misses")
+		ch <- prometheus.MustNewConstMetric(s.redisPoolEvent, prometheus.CounterValue, float64(stats.Timeouts), "timeouts")
+	}
+}
+
+// InitMetrics 注册需要访问数据库和 Redis 的监控指标，需在数据库与 Redis 初始化之后调用
+func InitMetrics() {
+	metrics.MustRegister(newStateCollector())
+	if sqlDB, err := model.DB.DB(); err == nil {
+		metrics.MustRegister(collectors.NewDBStatsCollector(sqlDB, "main"))
+	}
+	if model.LOG_DB != model.DB {
+		if sqlDB, err := model.LOG_DB.DB(); err == nil {
+			metrics.MustRegister(collectors.NewDBStatsCollector(sqlDB, "log"))
+		}
+	}
+}
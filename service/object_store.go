@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	ObjectStorageLocal = "local"
+	ObjectStorageS3    = "s3"
+)
+
+// ObjectStore 日志归档及 /v1/files 文件共用的存储后端
+type ObjectStore interface {
+	Name() string
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type localObjectStore struct {
+	dir string
+}
+
+func (s *localObjectStore) Name() string {
+	return ObjectStorageLocal
+}
+
+func (s *localObjectStore) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid object key: %s", key)
+	}
+	return path, nil
+}
+
+func (s *localObjectStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免留下不完整的文件
+	tmp := path + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, body); err != nil {
+		_ = fd.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *localObjectStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *localObjectStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// s3ObjectStore S3 兼容对象存储，可配合 MinIO 等使用
+type s3ObjectStore struct {
+	client      *s3.Client
+	bucket      string
+	contentType string
+}
+
+func (s *s3ObjectStore) Name() string {
+	return ObjectStorageS3
+}
+
+func (s *s3ObjectStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(s.contentType),
+	})
+	return err
+}
+
+func (s *s3ObjectStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (s *s3ObjectStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// newS3ObjectStore 根据 <prefix>_S3_BUCKET、<prefix>_S3_ENDPOINT 等环境变量创建对象存储
+func newS3ObjectStore(prefix string, contentType string) (*s3ObjectStore, error) {
+	bucket := os.Getenv(prefix + "_S3_BUCKET")
+	if bucket == "" {
+		return nil, errors.New(prefix + "_S3_BUCKET 未配置")
+	}
+	options := s3.Options{
+		Region: common.GetEnvOrDefaultString(prefix+"_S3_REGION", "us-east-1"),
+		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+			os.Getenv(prefix+"_S3_ACCESS_KEY"), os.Getenv(prefix+"_S3_SECRET_KEY"), "")),
+	}
+	if endpoint := os.Getenv(prefix + "_S3_ENDPOINT"); endpoint != "" {
+		options.BaseEndpoint = aws.String(endpoint)
+		options.UsePathStyle = true
+	}
+	return &s3ObjectStore{client: s3.New(options), bucket: bucket, contentType: contentType}, nil
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	payloadCaptureFieldMaxBytes    = 60 * 1024  // 单个字段保存的最大长度，兼容 MySQL text 类型
+	payloadCaptureResponseMaxBytes = 256 * 1024 // 采集上游响应时缓存的最大长度，拼接流式响应后再截断
+)
+
+// 需要脱敏的字段名（小写）
+var payloadCaptureSecretKeys = map[string]bool{
+	"api_key":       true,
+	"apikey":        true,
+	"key":           true,
+	"access_token":  true,
+	"refresh_token": true,
+	"secret":        true,
+	"secret_key":    true,
+	"client_secret": true,
+	"password":      true,
+	"authorization": true,
+	"x-api-key":     true,
+}
+
+var payloadCaptureSecretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`sk-[A-Za-z0-9_\-]{8,}`), "sk-***"},
+	{regexp.MustCompile(`AIza[0-9A-Za-z_\-]{20,}`), "AIza***"},
+	{regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._\-]+`), "Bearer ***"},
+}
+
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	remain := b.limit - b.buf.Len()
+	if remain < len(p) {
+		b.truncated = true
+		if remain > 0 {
+			b.buf.Write(p[:remain])
+		}
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) snapshot() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...), b.truncated
+}
+
+type captureReadCloser struct {
+	io.ReadCloser
+	buffer *cappedBuffer
+}
+
+func (r *captureReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		_, _ = r.buffer.Write(p[:n])
+	}
+	return n, err
+}
+
+type payloadCaptureAttempt struct {
+	channelId  int
+	url        string
+	request    []byte
+	statusCode int
+	isStream   bool
+	response   *cappedBuffer
+}
+
+// PayloadCaptureSession 单个请求的内容采集，命中采集规则后写入上下文
+type PayloadCaptureSession struct {
+	mu       sync.Mutex
+	rule     *model.PayloadCaptureRule
+	inbound  []byte
+	attempts []*payloadCaptureAttempt
+}
+
+func getPayloadCaptureSession(c *gin.Context) *PayloadCaptureSession {
+	session, ok := common.GetContextKeyType[*PayloadCaptureSession](c, constant.ContextKeyPayloadCapture)
+	if !ok {
+		return nil
+	}
+	return session
+}
+
+func (s *PayloadCaptureSession) currentAttempt() *payloadCaptureAttempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.attempts) == 0 {
+		return nil
+	}
+	return s.attempts[len(s.attempts)-1]
+}
+
+// IsPayloadCaptured 当前请求是否正在采集内容
+func IsPayloadCaptured(c *gin.Context) bool {
+	return getPayloadCaptureSession(c) != nil
+}
+
+// StartPayloadCaptureAttempt 在每次选定渠道后调用，首次命中采集规则时开始采集
+func StartPayloadCaptureAttempt(c *gin.Context) {
+	channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+	session := getPayloadCaptureSession(c)
+	if session == nil {
+		rule := selectPayloadCaptureRule(c, channelId)
+		if rule == nil {
+			return
+		}
+		inbound, _ := common.GetRequestBody(c)
+		session = &PayloadCaptureSession{
+			rule:    rule,
+			inbound: append([]byte(nil), inbound...),
+		}
+		common.SetContextKey(c, constant.ContextKeyPayloadCapture, session)
+	}
+	session.mu.Lock()
+	session.attempts = append(session.attempts, &payloadCaptureAttempt{
+		channelId: channelId,
+		response:  &cappedBuffer{limit: payloadCaptureResponseMaxBytes},
+	})
+	session.mu.Unlock()
+}
+
+func selectPayloadCaptureRule(c *gin.Context, channelId int) *model.PayloadCaptureRule {
+	rules := model.MatchPayloadCaptureRules(
+		common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		channelId,
+		common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+	)
+	for _, rule := range rules {
+		if rand.Float64() >= rule.SampleRate {
+			continue
+		}
+		ok, err := model.TakePayloadCaptureQuota(rule.Id)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to take payload capture quota of rule %d: %s", rule.Id, err.Error()))
+			continue
+		}
+		if ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// CapturePayloadUpstreamRequest 记录发往上游的请求，返回可继续使用的请求体
+func CapturePayloadUpstreamRequest(c *gin.Context, fullRequestURL string, body io.Reader) io.Reader {
+	session := getPayloadCaptureSession(c)
+	if session == nil {
+		return body
+	}
+	attempt := session.currentAttempt()
+	if attempt == nil {
+		return body
+	}
+	attempt.url = fullRequestURL
+	if body == nil {
+		return body
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return io.MultiReader(bytes.NewReader(data), body)
+	}
+	attempt.request = data
+	return bytes.NewReader(data)
+}
+
+// CapturePayloadUpstreamResponse 记录上游响应状态码，并在读取响应体时同步缓存内容
+func CapturePayloadUpstreamResponse(c *gin.Context, resp *http.Response) {
+	session := getPayloadCaptureSession(c)
+	if session == nil || resp == nil {
+		return
+	}
+	attempt := session.currentAttempt()
+	if attempt == nil {
+		return
+	}
+	attempt.statusCode = resp.StatusCode
+	attempt.isStream = strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if resp.Body != nil {
+		resp.Body = &captureReadCloser{ReadCloser: resp.Body, buffer: attempt.response}
+	}
+}
+
+// FinishPayloadCapture 请求结束后脱敏并异步保存采集内容
+func FinishPayloadCapture(c *gin.Context) {
+	session := getPayloadCaptureSession(c)
+	if session == nil {
+		return
+	}
+	requestId := c.GetString(common.RequestIdKey)
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	session.mu.Lock()
+	attempts := session.attempts
+	session.mu.Unlock()
+
+	gopool.Go(func() {
+		now := common.GetTimestamp()
+		expiresAt := now + int64(session.rule.RetentionHours)*3600
+		captures := make([]*model.PayloadCapture, 0, len(attempts))
+		for i, attempt := range attempts {
+			response, truncated := attempt.response.snapshot()
+			capture := &model.PayloadCapture{
+				RequestId:   requestId,
+				RuleId:      session.rule.Id,
+				Attempt:     i,
+				UserId:      userId,
+				TokenId:     tokenId,
+				ChannelId:   attempt.channelId,
+				ModelName:   modelName,
+				UpstreamUrl: truncatePayload(maskPayloadURL(attempt.url), 512, &truncated),
+				StatusCode:  attempt.statusCode,
+				CreatedTime: now,
+				ExpiresAt:   expiresAt,
+			}
+			if i == 0 {
+				capture.InboundRequest = truncatePayload(maskPayload(session.inbound), payloadCaptureFieldMaxBytes, &truncated)
+			}
+			capture.UpstreamRequest = truncatePayload(maskPayload(attempt.request), payloadCaptureFieldMaxBytes, &truncated)
+			capture.UpstreamResponse = truncatePayload(maskPayload(response), payloadCaptureFieldMaxBytes, &truncated)
+			if attempt.isStream {
+				reassembled := ReassembleStreamResponse(response)
+				capture.ReassembledResponse = truncatePayload(maskPayloadText(reassembled), payloadCaptureFieldMaxBytes, &truncated)
+			}
+			capture.Truncated = truncated
+			captures = append(captures, capture)
+		}
+		if err := model.SavePayloadCaptures(captures); err != nil {
+			common.SysError("failed to save payload captures: " + err.Error())
+		}
+	})
+}
+
+// ReassembleStreamResponse 将 SSE 流式响应中的增量内容拼接为完整文本
+// 支持 OpenAI Chat Completions / Responses、Claude Messages 与 Gemini 格式
+func ReassembleStreamResponse(data []byte) string {
+	var reasoning, content strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || payload == "[DONE]" || !gjson.Valid(payload) {
+			continue
+		}
+		chunk := gjson.Parse(payload)
+		// OpenAI Chat Completions
+		chunk.Get("choices.#.delta").ForEach(func(_, delta gjson.Result) bool {
+			reasoning.WriteString(delta.Get("reasoning_content").String())
+			content.WriteString(delta.Get("content").String())
+			return true
+		})
+		switch chunk.Get("type").String() {
+		// OpenAI Responses
+		case "response.output_text.delta":
+			content.WriteString(chunk.Get("delta").String())
+		case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+			reasoning.WriteString(chunk.Get("delta").String())
+		// Claude Messages
+		case "content_block_delta":
+			delta := chunk.Get("delta")
+			reasoning.WriteString(delta.Get("thinking").String())
+			content.WriteString(delta.Get("text").String())
+			content.WriteString(delta.Get("partial_json").String())
+		}
+		// Gemini
+		chunk.Get("candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+			if part.Get("thought").Bool() {
+				reasoning.WriteString(part.Get("text").String())
+			} else {
+				content.WriteString(part.Get("text").String())
+			}
+			return true
+		})
+	}
+	if reasoning.Len() == 0 {
+		return content.String()
+	}
+	return "[reasoning]\n" + reasoning.String() + "\n\n[content]\n" + content.String()
+}
+
+// maskPayload 脱敏请求或响应内容，JSON 按字段名脱敏，其余按常见密钥格式脱敏
+func maskPayload(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	var value interface{}
+	if err := common.Unmarshal(data, &value); err == nil {
+		if masked, err := common.Marshal(maskPayloadValue(value)); err == nil {
+			return maskPayloadText(string(masked))
+		}
+	}
+	return maskPayloadText(string(data))
+}
+
+func maskPayloadValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if payloadCaptureSecretKeys[strings.ToLower(key)] {
+				if _, ok := item.(string); ok {
+					v[key] = "***"
+					continue
+				}
+			}
+			v[key] = maskPayloadValue(item)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = maskPayloadValue(v[i])
+		}
+		return v
+	}
+	return value
+}
+
+func maskPayloadText(text string) string {
+	for _, p := range payloadCaptureSecretPatterns {
+		text = p.pattern.ReplaceAllString(text, p.replacement)
+	}
+	return text
+}
+
+func maskPayloadURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	for key := range query {
+		if payloadCaptureSecretKeys[strings.ToLower(key)] {
+			query.Set(key, "***")
+		}
+	}
+	u.RawQuery = query.Encode()
+	return maskPayloadText(u.String())
+}
+
+func truncatePayload(text string, maxBytes int, truncated *bool) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	*truncated = true
+	return strings.ToValidUTF8(text[:maxBytes], "")
+}
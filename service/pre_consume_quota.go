@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -14,6 +15,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ErrPrepaidTokenUnsupported 异步任务失败后退还到用户额度，兑换码发放的令牌只能用于实时请求
+var ErrPrepaidTokenUnsupported = errors.New("兑换码发放的令牌仅支持实时请求")
+
 func ReturnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
 	if relayInfo.FinalPreConsumedQuota != 0 {
 		logger.LogInfo(c, fmt.Sprintf("用户 %d 请求失败, 返还预扣费额度 %s", relayInfo.UserId, logger.FormatQuota(relayInfo.FinalPreConsumedQuota)))
@@ -31,10 +35,24 @@ func ReturnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
 // PreConsumeQuota checks if the user has enough quota to pre-consume.
 // It returns the pre-consumed quota if successful, or an error if not.
 func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	// 状态探测请求不计费
+	if model.IsStatusProbeUser(relayInfo.UserId) {
+		relayInfo.FinalPreConsumedQuota = 0
+		return nil
+	}
+	if relayInfo.TokenPrepaid {
+		return preConsumePrepaidTokenQuota(c, preConsumedQuota, relayInfo)
+	}
 	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
 	}
+	// 批处理及后台响应请求可使用提交时预留的额度
+	reservedQuota, err := getReservedQuota(relayInfo)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	userQuota += reservedQuota
 	if userQuota <= 0 {
 		return types.NewErrorWithStatusCode(fmt.Errorf("用户额度不足, 剩余额度: %s", logger.FormatQuota(userQuota)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 	}
@@ -68,7 +86,7 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 		}
-		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+		err = decreaseRequestUserQuota(relayInfo, preConsumedQuota)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 		}
@@ -77,3 +95,19 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	relayInfo.FinalPreConsumedQuota = preConsumedQuota
 	return nil
 }
+
+// preConsumePrepaidTokenQuota 兑换码发放的令牌只使用令牌自身的额度，不检查及扣减用户额度，也不使用免预扣的信任策略
+func preConsumePrepaidTokenQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	tokenQuota := c.GetInt("token_quota")
+	if tokenQuota <= 0 {
+		return types.NewErrorWithStatusCode(fmt.Errorf("令牌额度不足, 剩余额度: %s", logger.FormatQuota(tokenQuota)), types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	if preConsumedQuota > 0 {
+		if err := PreConsumeTokenQuota(relayInfo, preConsumedQuota); err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		logger.LogInfo(c, fmt.Sprintf("用户 %d 令牌 %d 预扣费 %s", relayInfo.UserId, relayInfo.TokenId, logger.FormatQuota(preConsumedQuota)))
+	}
+	relayInfo.FinalPreConsumedQuota = preConsumedQuota
+	return nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// getReservedQuota 返回请求所属批处理或后台响应剩余的预留额度，其他请求返回 0
+func getReservedQuota(relayInfo *relaycommon.RelayInfo) (int, error) {
+	switch {
+	case relayInfo.BatchId != "":
+		return model.GetBatchReservedQuota(relayInfo.BatchId)
+	case relayInfo.BackgroundResponseId != "":
+		return model.GetStoredResponseReservedQuota(relayInfo.BackgroundResponseId)
+	}
+	return 0, nil
+}
+
+// decreaseRequestUserQuota 扣减请求的用户侧费用，批处理及后台响应请求优先从预留额度中扣减，不足部分再扣减用户额度
+func decreaseRequestUserQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	var taken int
+	var err error
+	switch {
+	case relayInfo.BatchId != "":
+		taken, err = model.TakeBatchReservedQuota(relayInfo.BatchId, quota)
+	case relayInfo.BackgroundResponseId != "":
+		taken, err = model.TakeStoredResponseReservedQuota(relayInfo.BackgroundResponseId, quota)
+	}
+	if err != nil {
+		return err
+	}
+	if quota -= taken; quota <= 0 {
+		return nil
+	}
+	return model.DecreaseUserQuota(relayInfo.UserId, quota, model.LedgerReasonConsume, relayInfo.RequestId)
+}
+
+// increaseRequestUserQuota 退还请求的用户侧费用，批处理或后台响应未结束时退回预留额度，由结束时统一退还
+func increaseRequestUserQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	var returned bool
+	var err error
+	switch {
+	case relayInfo.BatchId != "":
+		returned, err = model.ReturnBatchReservedQuota(relayInfo.BatchId, quota)
+	case relayInfo.BackgroundResponseId != "":
+		returned, err = model.ReturnStoredResponseReservedQuota(relayInfo.BackgroundResponseId, quota)
+	}
+	if err != nil || returned {
+		return err
+	}
+	return model.IncreaseUserQuota(relayInfo.UserId, quota, false, model.LedgerReasonRefund, relayInfo.RequestId)
+}
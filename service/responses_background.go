@@ -0,0 +1,421 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	backgroundResponsePollInterval   = 2 * time.Second
+	backgroundResponseStatusInterval = 2 * time.Second
+)
+
+var (
+	ErrResponseInsufficientQuota = errors.New("用户额度不足以预留后台响应所需额度")
+	ErrResponseStoreDisabled     = errors.New("未启用响应存储，不支持后台响应")
+)
+
+// backgroundResponseFields 排队中的响应对象从请求中带出的字段
+var backgroundResponseFields = []string{"instructions", "metadata", "max_output_tokens", "reasoning", "text", "tools",
+	"tool_choice", "temperature", "top_p", "parallel_tool_calls", "truncation", "user"}
+
+// IsBackgroundResponsesRequest 判断 /v1/responses 请求是否指定了 background: true
+func IsBackgroundResponsesRequest(c *gin.Context) bool {
+	body, err := common.GetRequestBody(c)
+	return err == nil && gjson.GetBytes(body, "background").Bool()
+}
+
+// newBackgroundResponseObject 生成尚未得到上游结果时的响应对象
+func newBackgroundResponseObject(response *model.StoredResponse, request []byte, status string) ([]byte, error) {
+	object := map[string]any{
+		"id":                   response.ResponseId,
+		"object":               "response",
+		"created_at":           response.CreatedAt,
+		"status":               status,
+		"background":           true,
+		"model":                response.Model,
+		"output":               []any{},
+		"error":                nil,
+		"incomplete_details":   nil,
+		"previous_response_id": nil,
+		"store":                true,
+		"usage":                nil,
+	}
+	for _, field := range backgroundResponseFields {
+		if value := gjson.GetBytes(request, field); value.Exists() {
+			object[field] = json.RawMessage(value.Raw)
+		}
+	}
+	if previousId := gjson.GetBytes(response.Response, "previous_response_id").String(); previousId != "" {
+		object["previous_response_id"] = previousId
+	}
+	return common.Marshal(object)
+}
+
+// CreateBackgroundResponse 保存后台响应并按估算结果预留用户额度，未启用响应存储时返回 ErrResponseStoreDisabled，
+// 额度不足时返回 ErrResponseInsufficientQuota。
+// 调用前请求体中引用本站响应的 previous_response_id 应已展开
+func CreateBackgroundResponse(c *gin.Context) (*model.StoredResponse, error) {
+	if !common.ResponsesStoreEnabled {
+		return nil, ErrResponseStoreDisabled
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenPrepaid) {
+		return nil, ErrPrepaidTokenUnsupported
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = sjson.DeleteBytes(body, "background"); err != nil {
+		return nil, err
+	}
+	var request struct {
+		Model  string          `json:"model"`
+		Input  json.RawMessage `json:"input"`
+		Stream bool            `json:"stream"`
+	}
+	if err = common.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	items, err := storedInputItems(request.Input)
+	if err != nil {
+		return nil, err
+	}
+	response := &model.StoredResponse{
+		ResponseId: "resp_" + common.GetUUID(),
+		UserId:     c.GetInt("id"),
+		TokenId:    c.GetInt("token_id"),
+		Model:      request.Model,
+		Status:     model.ResponseStatusQueued,
+		Input:      items,
+		Background: true,
+		Stream:     request.Stream,
+		Request:    body,
+		UsingGroup: common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		ClientIp:   c.ClientIP(),
+		CreatedAt:  common.GetTimestamp(),
+	}
+	if previousId := common.GetContextKeyString(c, constant.ContextKeyPreviousResponseId); previousId != "" {
+		response.Response, _ = sjson.SetBytes(nil, "previous_response_id", previousId)
+	}
+	if response.Response, err = newBackgroundResponseObject(response, body, model.ResponseStatusQueued); err != nil {
+		return nil, err
+	}
+	if common.ResponsesRetentionDays > 0 {
+		response.ExpiresAt = response.CreatedAt + int64(common.ResponsesRetentionDays)*86400
+	}
+
+	reservedQuota := EstimateRequestQuota(request.Model, response.UsingGroup, body)
+	userQuota, err := model.GetUserQuota(response.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	if userQuota < reservedQuota {
+		return nil, ErrResponseInsufficientQuota
+	}
+	if err = model.DecreaseUserQuota(response.UserId, reservedQuota, model.LedgerReasonBackground, response.ResponseId); err != nil {
+		return nil, err
+	}
+	response.ReservedQuota = reservedQuota
+	if err = response.Insert(); err != nil {
+		_ = model.IncreaseUserQuota(response.UserId, reservedQuota, true, model.LedgerReasonBackground, response.ResponseId)
+		return nil, err
+	}
+	if common.IsMasterNode {
+		startBackgroundResponse(response)
+	}
+	return response, nil
+}
+
+// finishBackgroundResponse 将后台响应切换到最终状态，并将剩余的预留额度退还给用户
+func finishBackgroundResponse(response *model.StoredResponse, from []string, status string, object []byte) (bool, error) {
+	released, ok, err := model.FinishStoredResponse(response.ResponseId, from, status, map[string]interface{}{"response": object})
+	if !ok || err != nil {
+		return ok, err
+	}
+	response.Status, response.Response, response.ReservedQuota = status, object, 0
+	if released > 0 {
+		if err = model.IncreaseUserQuota(response.UserId, released, true, model.LedgerReasonBackground, response.ResponseId); err != nil {
+			common.SysError(fmt.Sprintf("failed to return response %s reserved quota: %s", response.ResponseId, err.Error()))
+		}
+	}
+	return true, nil
+}
+
+// CancelBackgroundResponse 取消未结束的后台响应并退还剩余的预留额度，执行中的响应由执行方感知后中断上游请求
+func CancelBackgroundResponse(response *model.StoredResponse) (bool, error) {
+	object, err := sjson.SetBytes(response.Response, "status", model.ResponseStatusCancelled)
+	if err != nil {
+		return false, err
+	}
+	return finishBackgroundResponse(response, []string{model.ResponseStatusQueued, model.ResponseStatusInProgress},
+		model.ResponseStatusCancelled, object)
+}
+
+// backgroundResponseWriter 接收进程内执行的响应：流式响应逐条保存事件，并将上游的响应 id 替换为本站的后台响应 id
+type backgroundResponseWriter struct {
+	header     http.Header
+	status     int
+	response   *model.StoredResponse
+	buffer     bytes.Buffer
+	sequence   int
+	final      []byte
+	errorEvent string
+}
+
+func newBackgroundResponseWriter(response *model.StoredResponse) *backgroundResponseWriter {
+	return &backgroundResponseWriter{header: make(http.Header), response: response}
+}
+
+func (w *backgroundResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *backgroundResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *backgroundResponseWriter) Flush() {}
+
+func (w *backgroundResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	w.buffer.Write(data)
+	if !w.response.Stream || w.status != http.StatusOK {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区，等待后续数据
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.handleStreamLine(strings.TrimSpace(line))
+	}
+	return len(data), nil
+}
+
+func (w *backgroundResponseWriter) handleStreamLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		// 流式响应开始后出现的错误以 JSON 写出
+		if strings.HasPrefix(line, "{") {
+			w.errorEvent = gjson.Get(line, "error.message").String()
+		}
+		return
+	}
+	data := []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+	eventType := gjson.GetBytes(data, "type").String()
+	if eventType == "" {
+		return
+	}
+	if gjson.GetBytes(data, "response").IsObject() {
+		data = w.rewriteObject(data, "response.")
+	}
+	switch eventType {
+	case "response.completed", "response.incomplete", "response.failed":
+		w.final = []byte(gjson.GetBytes(data, "response").Raw)
+	case "error":
+		w.errorEvent = gjson.GetBytes(data, "message").String()
+	}
+	w.saveEvent(eventType, data)
+}
+
+func (w *backgroundResponseWriter) saveEvent(eventType string, data []byte) {
+	data, _ = sjson.SetBytes(data, "sequence_number", w.sequence)
+	event := &model.ResponseEvent{ResponseId: w.response.ResponseId, SequenceNumber: w.sequence, Type: eventType, Data: data}
+	if err := model.InsertResponseEvent(event); err != nil {
+		common.SysError(fmt.Sprintf("failed to save response %s event: %s", w.response.ResponseId, err.Error()))
+	}
+	w.sequence++
+}
+
+// rewriteObject 将响应对象中的上游信息替换为后台响应的信息
+func (w *backgroundResponseWriter) rewriteObject(data []byte, prefix string) []byte {
+	data, _ = sjson.SetBytes(data, prefix+"id", w.response.ResponseId)
+	data, _ = sjson.SetBytes(data, prefix+"background", true)
+	data, _ = sjson.SetBytes(data, prefix+"created_at", w.response.CreatedAt)
+	if previousId := gjson.GetBytes(w.response.Response, "previous_response_id").String(); previousId != "" {
+		data, _ = sjson.SetBytes(data, prefix+"previous_response_id", previousId)
+	}
+	return data
+}
+
+// result 返回最终的响应对象，上游失败或流式响应中断时生成 failed 状态的响应对象
+func (w *backgroundResponseWriter) result() []byte {
+	if w.response.Stream && w.final != nil {
+		return w.final
+	}
+	body := w.buffer.Bytes()
+	if !w.response.Stream && w.status == http.StatusOK && gjson.GetBytes(body, "object").String() == "response" {
+		return w.rewriteObject(body, "")
+	}
+	code, message := "server_error", w.errorEvent
+	if errorMessage := gjson.GetBytes(body, "error.message"); errorMessage.Exists() {
+		message = errorMessage.String()
+		if errorCode := gjson.GetBytes(body, "error.code").String(); errorCode != "" {
+			code = errorCode
+		}
+	}
+	if message == "" {
+		message = "The response was interrupted before it completed."
+	}
+	object, _ := sjson.SetBytes(w.response.Response, "status", model.ResponseStatusFailed)
+	object, _ = sjson.SetBytes(object, "error", map[string]string{"code": code, "message": message})
+	if w.response.Stream {
+		event, _ := sjson.SetRawBytes([]byte(`{"type":"response.failed"}`), "response", object)
+		w.saveEvent("response.failed", event)
+	}
+	return object
+}
+
+var backgroundResponseRelay func(c *gin.Context, response *model.StoredResponse)
+
+// SetBackgroundResponseRelay 设置执行后台响应的转发函数。后台响应提交时已通过鉴权及限流，
+// 执行时按保存的令牌、分组及客户端 IP 重建上下文后直接转发，不再经过路由中间件
+func SetBackgroundResponseRelay(relay func(c *gin.Context, response *model.StoredResponse)) {
+	backgroundResponseRelay = relay
+}
+
+// executeBackgroundResponse 在进程内执行排队中的后台响应，响应被取消时中断请求
+func executeBackgroundResponse(response *model.StoredResponse) error {
+	if backgroundResponseRelay == nil {
+		return errors.New("background response relay is not set")
+	}
+	object, err := sjson.SetBytes(response.Response, "status", model.ResponseStatusInProgress)
+	if err != nil {
+		return err
+	}
+	ok, err := model.TransitStoredResponseStatus(response.ResponseId, []string{model.ResponseStatusQueued},
+		model.ResponseStatusInProgress, map[string]interface{}{"response": object})
+	if err != nil || !ok {
+		return err
+	}
+	response.Status, response.Response = model.ResponseStatusInProgress, object
+
+	ctx, cancel := context.WithCancel(common.WithBackgroundResponse(context.Background(), response.ResponseId))
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(backgroundResponseStatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if status, err := model.GetStoredResponseStatus(response.ResponseId); err == nil && status == model.ResponseStatusCancelled {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/responses", bytes.NewReader(response.Request))
+	if err != nil {
+		return err
+	}
+	req.RemoteAddr = net.JoinHostPort(response.ClientIp, "0")
+	req.Header.Set("Content-Type", "application/json")
+	writer := newBackgroundResponseWriter(response)
+	c, _ := gin.CreateTestContext(writer)
+	c.Request = req
+	backgroundResponseRelay(c, response)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	object = writer.result()
+	status := gjson.GetBytes(object, "status").String()
+	if status == "" {
+		status = model.ResponseStatusCompleted
+	}
+	_, err = finishBackgroundResponse(response, []string{model.ResponseStatusInProgress}, status, object)
+	return err
+}
+
+// FailInterruptedBackgroundResponses 将重启前执行到一半的后台响应标记为失败并退还剩余的预留额度。
+// 上游可能已经收到并计费，重新执行会重复扣费，因此不再重新执行
+func FailInterruptedBackgroundResponses() {
+	responses, err := model.GetBackgroundResponsesByStatus(model.ResponseStatusInProgress)
+	if err != nil {
+		common.SysError("failed to get interrupted background responses: " + err.Error())
+		return
+	}
+	for _, response := range responses {
+		writer := newBackgroundResponseWriter(response)
+		if response.Stream {
+			sequence, err := model.GetLastResponseEventSequence(response.ResponseId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to get response %s events: %s", response.ResponseId, err.Error()))
+				continue
+			}
+			writer.sequence = sequence + 1
+		}
+		writer.errorEvent = "The response was interrupted by a server restart."
+		if _, err = finishBackgroundResponse(response, []string{model.ResponseStatusInProgress}, model.ResponseStatusFailed, writer.result()); err != nil {
+			common.SysError(fmt.Sprintf("failed to fail interrupted response %s: %s", response.ResponseId, err.Error()))
+		}
+	}
+}
+
+var (
+	backgroundResponseSemaphore     chan struct{}
+	backgroundResponseSemaphoreOnce sync.Once
+	runningBackgroundResponses      sync.Map
+)
+
+func getBackgroundResponseSemaphore() chan struct{} {
+	backgroundResponseSemaphoreOnce.Do(func() {
+		backgroundResponseSemaphore = make(chan struct{}, common.Max(common.ResponsesBackgroundConcurrency, 1))
+	})
+	return backgroundResponseSemaphore
+}
+
+// startBackgroundResponse 在后台执行响应，同一响应同时只会执行一次
+func startBackgroundResponse(response *model.StoredResponse) {
+	if _, running := runningBackgroundResponses.LoadOrStore(response.ResponseId, true); running {
+		return
+	}
+	go func() {
+		defer runningBackgroundResponses.Delete(response.ResponseId)
+		sem := getBackgroundResponseSemaphore()
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		if err := executeBackgroundResponse(response); err != nil {
+			common.SysError(fmt.Sprintf("failed to execute background response %s: %s", response.ResponseId, err.Error()))
+		}
+	}()
+}
+
+// AutomaticallyProcessBackgroundResponses 在主节点上持续执行排队中的后台响应，启动时先结束重启前中断的响应
+func AutomaticallyProcessBackgroundResponses() {
+	FailInterruptedBackgroundResponses()
+	for {
+		responses, err := model.GetBackgroundResponsesByStatus(model.ResponseStatusQueued)
+		if err != nil {
+			common.SysError("failed to get unfinished background responses: " + err.Error())
+		}
+		for _, response := range responses {
+			startBackgroundResponse(response)
+		}
+		time.Sleep(backgroundResponsePollInterval)
+	}
+}
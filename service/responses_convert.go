@@ -0,0 +1,634 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// responsesInputItem Responses API input 数组中的单个条目，兼容消息、函数调用及函数调用结果
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageUrl string `json:"image_url"`
+	Detail   string `json:"detail"`
+	FileId   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	Filename string `json:"filename"`
+	FileUrl  string `json:"file_url"`
+}
+
+type responsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"`
+}
+
+type responsesTextFormat struct {
+	Format *struct {
+		Type        string          `json:"type"`
+		Name        string          `json:"name,omitempty"`
+		Description string          `json:"description,omitempty"`
+		Schema      json.RawMessage `json:"schema,omitempty"`
+		Strict      *bool           `json:"strict,omitempty"`
+	} `json:"format"`
+}
+
+// ResponsesRequestToOpenAIRequest 将 Responses API 请求转换为 Chat Completions 请求，
+// 用于不支持 Responses API 的渠道
+func ResponsesRequestToOpenAIRequest(request *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Model:       request.Model,
+		Stream:      request.Stream,
+		MaxTokens:   request.MaxOutputTokens,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		User:        request.User,
+	}
+	if request.Reasoning != nil {
+		openAIRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+	if len(request.ParallelToolCalls) > 0 {
+		var parallelToolCalls bool
+		if err := common.Unmarshal(request.ParallelToolCalls, &parallelToolCalls); err == nil {
+			openAIRequest.ParallelTooCalls = &parallelToolCalls
+		}
+	}
+
+	if len(request.Instructions) > 0 {
+		var instructions string
+		if err := common.Unmarshal(request.Instructions, &instructions); err != nil {
+			return nil, fmt.Errorf("invalid instructions: %w", err)
+		}
+		if instructions != "" {
+			openAIRequest.Messages = append(openAIRequest.Messages, dto.Message{Role: "system", Content: instructions})
+		}
+	}
+	messages, err := responsesInputToMessages(request.Input)
+	if err != nil {
+		return nil, err
+	}
+	openAIRequest.Messages = append(openAIRequest.Messages, messages...)
+
+	if len(request.Tools) > 0 {
+		var tools []responsesTool
+		if err = common.Unmarshal(request.Tools, &tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+		for _, tool := range tools {
+			// 内置工具（web_search、file_search 等）只有原生 Responses API 才能执行，直接忽略
+			if tool.Type != "function" {
+				continue
+			}
+			openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+	}
+	if len(request.ToolChoice) > 0 && len(openAIRequest.Tools) > 0 {
+		openAIRequest.ToolChoice = responsesToolChoiceToOpenAI(request.ToolChoice)
+	}
+
+	if len(request.Text) > 0 {
+		var text responsesTextFormat
+		if err = common.Unmarshal(request.Text, &text); err == nil && text.Format != nil {
+			switch text.Format.Type {
+			case "json_object":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+			case "json_schema":
+				jsonSchema, _ := common.Marshal(map[string]any{
+					"name":        text.Format.Name,
+					"description": text.Format.Description,
+					"schema":      text.Format.Schema,
+					"strict":      text.Format.Strict,
+				})
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_schema", JsonSchema: jsonSchema}
+			}
+		}
+	}
+	return openAIRequest, nil
+}
+
+func responsesToolChoiceToOpenAI(raw json.RawMessage) any {
+	if common.GetJsonType(raw) == "string" {
+		var toolChoice string
+		_ = common.Unmarshal(raw, &toolChoice)
+		return toolChoice
+	}
+	var toolChoice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := common.Unmarshal(raw, &toolChoice); err != nil || toolChoice.Type != "function" {
+		return nil
+	}
+	return map[string]any{
+		"type":     "function",
+		"function": map[string]string{"name": toolChoice.Name},
+	}
+}
+
+func responsesInputToMessages(input json.RawMessage) ([]dto.Message, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+	if common.GetJsonType(input) == "string" {
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		return []dto.Message{{Role: "user", Content: text}}, nil
+	}
+	var items []responsesInputItem
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	messages := make([]dto.Message, 0, len(items))
+	var toolCalls []dto.ToolCallRequest
+	flushToolCalls := func() {
+		if len(toolCalls) == 0 {
+			return
+		}
+		// 连续的 function_call 合并为同一条 assistant 消息
+		message := dto.Message{Role: "assistant"}
+		message.SetNullContent()
+		message.SetToolCalls(toolCalls)
+		messages = append(messages, message)
+		toolCalls = nil
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "function_call":
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			})
+			continue
+		case "function_call_output":
+			flushToolCalls()
+			messages = append(messages, dto.Message{
+				Role:       "tool",
+				Content:    responsesOutputText(item.Output),
+				ToolCallId: item.CallId,
+			})
+		case "", "message":
+			flushToolCalls()
+			message, err := responsesMessageToOpenAI(item)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		default:
+			// reasoning、item_reference 及内置工具调用等条目无法在 Chat Completions 中表示
+			continue
+		}
+	}
+	flushToolCalls()
+	return messages, nil
+}
+
+func responsesOutputText(output json.RawMessage) string {
+	if len(output) == 0 {
+		return ""
+	}
+	if common.GetJsonType(output) == "string" {
+		var text string
+		_ = common.Unmarshal(output, &text)
+		return text
+	}
+	var contents []responsesInputContent
+	if err := common.Unmarshal(output, &contents); err != nil {
+		return string(output)
+	}
+	var sb strings.Builder
+	for _, content := range contents {
+		sb.WriteString(content.Text)
+	}
+	return sb.String()
+}
+
+func responsesMessageToOpenAI(item responsesInputItem) (dto.Message, error) {
+	role := item.Role
+	if role == "developer" {
+		role = "system"
+	}
+	message := dto.Message{Role: role}
+	if len(item.Content) == 0 || common.GetJsonType(item.Content) == "string" {
+		var text string
+		_ = common.Unmarshal(item.Content, &text)
+		message.SetStringContent(text)
+		return message, nil
+	}
+	var contents []responsesInputContent
+	if err := common.Unmarshal(item.Content, &contents); err != nil {
+		return message, fmt.Errorf("invalid message content: %w", err)
+	}
+	// assistant 历史消息只包含文本，直接拼接
+	if role == "assistant" {
+		var sb strings.Builder
+		for _, content := range contents {
+			sb.WriteString(content.Text)
+			sb.WriteString(content.Refusal)
+		}
+		message.SetStringContent(sb.String())
+		return message, nil
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(contents))
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text":
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Text})
+		case "input_image":
+			if content.ImageUrl == "" {
+				return message, errors.New("input_image without image_url is not supported by this channel")
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: content.ImageUrl, Detail: content.Detail},
+			})
+		case "input_file":
+			if content.FileData == "" && content.FileId == "" {
+				return message, errors.New("input_file without file_data or file_id is not supported by this channel")
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{FileName: content.Filename, FileData: content.FileData, FileId: content.FileId},
+			})
+		}
+	}
+	message.SetMediaContent(mediaContents)
+	return message, nil
+}
+
+// responsesUsageFromOpenAI 在 Chat Completions 用量的基础上补充 Responses API 的用量字段
+func responsesUsageFromOpenAI(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	responsesUsage := *usage
+	responsesUsage.InputTokens = usage.PromptTokens
+	responsesUsage.OutputTokens = usage.CompletionTokens
+	if responsesUsage.TotalTokens == 0 {
+		responsesUsage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	responsesUsage.InputTokensDetails = &dto.InputTokenDetails{CachedTokens: usage.PromptTokensDetails.CachedTokens}
+	return &responsesUsage
+}
+
+func newResponsesResponse(id string, model string, createdAt int64, status string) *dto.OpenAIResponsesResponse {
+	return &dto.OpenAIResponsesResponse{
+		ID:                id,
+		Object:            "response",
+		CreatedAt:         int(createdAt),
+		Status:            status,
+		Model:             model,
+		Output:            make([]dto.ResponsesOutput, 0),
+		ParallelToolCalls: true,
+		ToolChoice:        "auto",
+		Tools:             make([]map[string]any, 0),
+	}
+}
+
+func responsesStatusFromFinishReason(finishReason string) string {
+	if finishReason == "length" {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+// ResponseOpenAI2Responses 将非流式 Chat Completions 响应转换为 Responses API 响应
+func ResponseOpenAI2Responses(response *dto.OpenAITextResponse, id string, createdAt int64) *dto.OpenAIResponsesResponse {
+	finishReason := ""
+	if len(response.Choices) > 0 {
+		finishReason = response.Choices[0].FinishReason
+	}
+	responsesResponse := newResponsesResponse(id, response.Model, createdAt, responsesStatusFromFinishReason(finishReason))
+	responsesResponse.Usage = responsesUsageFromOpenAI(&response.Usage)
+	if len(response.Choices) == 0 {
+		return responsesResponse
+	}
+	message := response.Choices[0].Message
+	reasoning := message.ReasoningContent
+	if reasoning == "" {
+		reasoning = message.Reasoning
+	}
+	if reasoning != "" {
+		responsesResponse.Output = append(responsesResponse.Output, dto.ResponsesOutput{
+			Type:    dto.ResponsesOutputTypeReasoning,
+			ID:      "rs_" + common.GetUUID(),
+			Status:  "completed",
+			Summary: []dto.ResponsesOutputContent{{Type: "summary_text", Text: reasoning}},
+		})
+	}
+	if text := message.StringContent(); text != "" {
+		responsesResponse.Output = append(responsesResponse.Output, dto.ResponsesOutput{
+			Type:    dto.ResponsesOutputTypeMessage,
+			ID:      "msg_" + common.GetUUID(),
+			Status:  "completed",
+			Role:    "assistant",
+			Content: []dto.ResponsesOutputContent{{Type: "output_text", Text: text, Annotations: []interface{}{}}},
+		})
+	}
+	for _, toolCall := range message.ParseToolCalls() {
+		responsesResponse.Output = append(responsesResponse.Output, dto.ResponsesOutput{
+			Type:      dto.ResponsesOutputTypeFunctionCall,
+			ID:        "fc_" + common.GetUUID(),
+			Status:    "completed",
+			CallId:    toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
+	}
+	return responsesResponse
+}
+
+type responsesStreamItem struct {
+	outputIndex int
+	item        dto.ResponsesOutput
+	text        strings.Builder
+	done        bool
+}
+
+// ResponsesStreamConverter 将 Chat Completions 流式分片转换为 Responses API 流式事件，
+// 文本、推理及函数调用分别对应独立的 output item
+type ResponsesStreamConverter struct {
+	ResponseId string
+	Model      string
+	CreatedAt  int64
+
+	sequence     int
+	started      bool
+	finished     bool
+	items        []*responsesStreamItem
+	message      *responsesStreamItem
+	reasoning    *responsesStreamItem
+	toolCalls    map[int]*responsesStreamItem
+	usage        *dto.Usage
+	finishReason string
+}
+
+func NewResponsesStreamConverter(responseId string, model string, createdAt int64) *ResponsesStreamConverter {
+	return &ResponsesStreamConverter{
+		ResponseId: responseId,
+		Model:      model,
+		CreatedAt:  createdAt,
+		toolCalls:  make(map[int]*responsesStreamItem),
+	}
+}
+
+func (s *ResponsesStreamConverter) Started() bool {
+	return s.started
+}
+
+func (s *ResponsesStreamConverter) Finished() bool {
+	return s.finished
+}
+
+func (s *ResponsesStreamConverter) event(eventType string) dto.ResponsesStreamResponse {
+	event := dto.ResponsesStreamResponse{Type: eventType, SequenceNumber: s.sequence}
+	s.sequence++
+	return event
+}
+
+func (s *ResponsesStreamConverter) itemEvent(eventType string, item *responsesStreamItem) dto.ResponsesStreamResponse {
+	event := s.event(eventType)
+	event.ItemID = item.item.ID
+	event.OutputIndex = common.GetPointer(item.outputIndex)
+	return event
+}
+
+func (s *ResponsesStreamConverter) start() []dto.ResponsesStreamResponse {
+	s.started = true
+	created := s.event(dto.ResponsesStreamTypeCreated)
+	created.Response = newResponsesResponse(s.ResponseId, s.Model, s.CreatedAt, "in_progress")
+	inProgress := s.event(dto.ResponsesStreamTypeInProgress)
+	inProgress.Response = created.Response
+	return []dto.ResponsesStreamResponse{created, inProgress}
+}
+
+func (s *ResponsesStreamConverter) addItem(item dto.ResponsesOutput) (*responsesStreamItem, dto.ResponsesStreamResponse) {
+	streamItem := &responsesStreamItem{outputIndex: len(s.items), item: item}
+	s.items = append(s.items, streamItem)
+	event := s.itemEvent(dto.ResponsesStreamTypeOutputItemAdded, streamItem)
+	added := streamItem.item
+	event.Item = &added
+	return streamItem, event
+}
+
+func (s *ResponsesStreamConverter) closeItem(item *responsesStreamItem) []dto.ResponsesStreamResponse {
+	if item == nil || item.done {
+		return nil
+	}
+	item.done = true
+	item.item.Status = "completed"
+	events := make([]dto.ResponsesStreamResponse, 0, 4)
+	text := item.text.String()
+	switch item.item.Type {
+	case dto.ResponsesOutputTypeMessage:
+		part := dto.ResponsesOutputContent{Type: "output_text", Text: text, Annotations: []interface{}{}}
+		item.item.Content = []dto.ResponsesOutputContent{part}
+		event := s.itemEvent(dto.ResponsesStreamTypeOutputTextDone, item)
+		event.ContentIndex = common.GetPointer(0)
+		event.Text = text
+		events = append(events, event)
+		event = s.itemEvent(dto.ResponsesStreamTypeContentPartDone, item)
+		event.ContentIndex = common.GetPointer(0)
+		event.Part = &part
+		events = append(events, event)
+	case dto.ResponsesOutputTypeReasoning:
+		part := dto.ResponsesOutputContent{Type: "summary_text", Text: text}
+		item.item.Summary = []dto.ResponsesOutputContent{part}
+		event := s.itemEvent(dto.ResponsesStreamTypeSummaryTextDone, item)
+		event.SummaryIndex = common.GetPointer(0)
+		event.Text = text
+		events = append(events, event)
+		event = s.itemEvent(dto.ResponsesStreamTypeSummaryPartDone, item)
+		event.SummaryIndex = common.GetPointer(0)
+		event.Part = &part
+		events = append(events, event)
+	case dto.ResponsesOutputTypeFunctionCall:
+		item.item.Arguments = text
+		event := s.itemEvent(dto.ResponsesStreamTypeArgumentsDone, item)
+		event.Arguments = text
+		events = append(events, event)
+	}
+	event := s.itemEvent(dto.ResponsesStreamTypeOutputItemDone, item)
+	done := item.item
+	event.Item = &done
+	return append(events, event)
+}
+
+// ConvertChunk 转换一个 Chat Completions 流式分片，返回需要发送的 Responses API 事件
+func (s *ResponsesStreamConverter) ConvertChunk(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	var events []dto.ResponsesStreamResponse
+	if chunk.Model != "" {
+		s.Model = chunk.Model
+	}
+	if !s.started {
+		events = append(events, s.start()...)
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return events
+	}
+	choice := chunk.Choices[0]
+	delta := choice.Delta
+
+	if reasoning := delta.GetReasoningContent(); reasoning != "" {
+		if s.reasoning == nil || s.reasoning.done {
+			events = append(events, s.closeItem(s.message)...)
+			var event dto.ResponsesStreamResponse
+			s.reasoning, event = s.addItem(dto.ResponsesOutput{
+				Type:    dto.ResponsesOutputTypeReasoning,
+				ID:      "rs_" + common.GetUUID(),
+				Status:  "in_progress",
+				Summary: make([]dto.ResponsesOutputContent, 0),
+			})
+			events = append(events, event)
+			event = s.itemEvent(dto.ResponsesStreamTypeSummaryPartAdded, s.reasoning)
+			event.SummaryIndex = common.GetPointer(0)
+			event.Part = &dto.ResponsesOutputContent{Type: "summary_text"}
+			events = append(events, event)
+		}
+		s.reasoning.text.WriteString(reasoning)
+		event := s.itemEvent(dto.ResponsesStreamTypeSummaryTextDelta, s.reasoning)
+		event.SummaryIndex = common.GetPointer(0)
+		event.Delta = reasoning
+		events = append(events, event)
+	}
+
+	if content := delta.GetContentString(); content != "" {
+		if s.message == nil || s.message.done {
+			events = append(events, s.closeItem(s.reasoning)...)
+			var event dto.ResponsesStreamResponse
+			s.message, event = s.addItem(dto.ResponsesOutput{
+				Type:    dto.ResponsesOutputTypeMessage,
+				ID:      "msg_" + common.GetUUID(),
+				Status:  "in_progress",
+				Role:    "assistant",
+				Content: make([]dto.ResponsesOutputContent, 0),
+			})
+			events = append(events, event)
+			event = s.itemEvent(dto.ResponsesStreamTypeContentPartAdded, s.message)
+			event.ContentIndex = common.GetPointer(0)
+			event.Part = &dto.ResponsesOutputContent{Type: "output_text", Annotations: []interface{}{}}
+			events = append(events, event)
+		}
+		s.message.text.WriteString(content)
+		event := s.itemEvent(dto.ResponsesStreamTypeOutputTextDelta, s.message)
+		event.ContentIndex = common.GetPointer(0)
+		event.Delta = content
+		events = append(events, event)
+	}
+
+	for i, toolCall := range delta.ToolCalls {
+		index := i
+		if toolCall.Index != nil {
+			index = *toolCall.Index
+		}
+		item, ok := s.toolCalls[index]
+		if !ok {
+			events = append(events, s.closeItem(s.reasoning)...)
+			events = append(events, s.closeItem(s.message)...)
+			var event dto.ResponsesStreamResponse
+			item, event = s.addItem(dto.ResponsesOutput{
+				Type:   dto.ResponsesOutputTypeFunctionCall,
+				ID:     "fc_" + common.GetUUID(),
+				Status: "in_progress",
+				CallId: toolCall.ID,
+				Name:   toolCall.Function.Name,
+			})
+			s.toolCalls[index] = item
+			events = append(events, event)
+		}
+		if toolCall.Function.Arguments != "" {
+			item.text.WriteString(toolCall.Function.Arguments)
+			event := s.itemEvent(dto.ResponsesStreamTypeArgumentsDelta, item)
+			event.Delta = toolCall.Function.Arguments
+			events = append(events, event)
+		}
+	}
+
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.finishReason = *choice.FinishReason
+	}
+	return events
+}
+
+// Finish 结束所有未完成的 output item，并返回 response.completed（或 response.incomplete）事件
+func (s *ResponsesStreamConverter) Finish() []dto.ResponsesStreamResponse {
+	if s.finished {
+		return nil
+	}
+	var events []dto.ResponsesStreamResponse
+	if !s.started {
+		events = append(events, s.start()...)
+	}
+	s.finished = true
+	toolIndexes := make([]int, 0, len(s.toolCalls))
+	for index := range s.toolCalls {
+		toolIndexes = append(toolIndexes, index)
+	}
+	sort.Ints(toolIndexes)
+	events = append(events, s.closeItem(s.reasoning)...)
+	events = append(events, s.closeItem(s.message)...)
+	for _, index := range toolIndexes {
+		events = append(events, s.closeItem(s.toolCalls[index])...)
+	}
+
+	status := responsesStatusFromFinishReason(s.finishReason)
+	response := newResponsesResponse(s.ResponseId, s.Model, s.CreatedAt, status)
+	for _, item := range s.items {
+		response.Output = append(response.Output, item.item)
+	}
+	response.Usage = responsesUsageFromOpenAI(s.usage)
+	eventType := dto.ResponsesStreamTypeCompleted
+	if status == "incomplete" {
+		eventType = dto.ResponsesStreamTypeIncomplete
+	}
+	event := s.event(eventType)
+	event.Response = response
+	return append(events, event)
+}
+
+// Fail 在上游出错时结束流，返回 response.failed 事件
+func (s *ResponsesStreamConverter) Fail(message string) []dto.ResponsesStreamResponse {
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	response := newResponsesResponse(s.ResponseId, s.Model, s.CreatedAt, "failed")
+	response.Error = map[string]string{"code": "server_error", "message": message}
+	event := s.event(dto.ResponsesStreamTypeFailed)
+	event.Response = response
+	return []dto.ResponsesStreamResponse{event}
+}
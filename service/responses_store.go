@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gorm.io/gorm"
+)
+
+// responsesInputItems 将 Responses API 的 input 统一为条目数组，字符串输入转换为一条用户消息
+func responsesInputItems(input json.RawMessage) ([]json.RawMessage, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+	if common.GetJsonType(input) == "string" {
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": []map[string]any{{"type": "input_text", "text": text}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// resendableItems 返回可以再次发送给上游的条目：其他上游账号不认识本站或原上游生成的条目 id，因此去掉 id；
+// 没有 encrypted_content 的 reasoning 条目只能由原上游按 id 引用，直接丢弃
+func resendableItems(items []json.RawMessage) []json.RawMessage {
+	result := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		switch gjson.GetBytes(item, "type").String() {
+		case "item_reference":
+			result = append(result, item)
+			continue
+		case "reasoning":
+			if !gjson.GetBytes(item, "encrypted_content").Exists() {
+				continue
+			}
+		}
+		if stripped, err := sjson.DeleteBytes(item, "id"); err == nil {
+			item = stripped
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// ExpandPreviousResponse 当 previous_response_id 指向本站保存的响应时，将该响应的输入及输出条目展开到
+// 请求的 input 之前并移除 previous_response_id，使多轮对话可以跨渠道、跨上游进行。
+// 不是本站保存的响应时保持原样，交给上游处理
+func ExpandPreviousResponse(c *gin.Context) error {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	previousId := gjson.GetBytes(body, "previous_response_id").String()
+	if previousId == "" {
+		return nil
+	}
+	stored, err := model.GetUserStoredResponse(c.GetInt("id"), previousId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	var history []json.RawMessage
+	if err = common.Unmarshal(stored.Input, &history); err != nil {
+		return err
+	}
+	if output := gjson.GetBytes(stored.Response, "output"); output.IsArray() {
+		for _, item := range output.Array() {
+			history = append(history, json.RawMessage(item.Raw))
+		}
+	}
+	input, err := responsesInputItems(json.RawMessage(gjson.GetBytes(body, "input").Raw))
+	if err != nil {
+		return err
+	}
+	items, err := common.Marshal(append(resendableItems(history), input...))
+	if err != nil {
+		return err
+	}
+	if body, err = sjson.SetRawBytes(body, "input", items); err != nil {
+		return err
+	}
+	if body, err = sjson.DeleteBytes(body, "previous_response_id"); err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, body)
+	common.SetContextKey(c, constant.ContextKeyPreviousResponseId, previousId)
+	return nil
+}
+
+// ShouldStoreResponse 判断是否保存本次 /v1/responses 请求的响应，其他格式经 Responses API 转发的请求不保存
+func ShouldStoreResponse(c *gin.Context, request *dto.OpenAIResponsesRequest) bool {
+	if !common.ResponsesStoreEnabled || string(request.Store) == "false" {
+		return false
+	}
+	// 后台响应由执行方保存最终结果
+	if common.GetBackgroundResponseId(c) != "" {
+		return false
+	}
+	return common.GetContextKeyString(c, constant.ContextKeyRelayFormat) == string(types.RelayFormatOpenAIResponses)
+}
+
+// storedInputItems 返回需要保存的输入条目，缺少 id 的条目补充 id 以便分页查询
+func storedInputItems(input json.RawMessage) ([]byte, error) {
+	items, err := responsesInputItems(input)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		if gjson.GetBytes(item, "id").Exists() {
+			continue
+		}
+		prefix := "item_"
+		if itemType := gjson.GetBytes(item, "type").String(); itemType == "" || itemType == "message" {
+			prefix = "msg_"
+		}
+		if items[i], err = sjson.SetBytes(item, "id", prefix+common.GetUUID()); err != nil {
+			return nil, err
+		}
+	}
+	return common.Marshal(items)
+}
+
+// StoreResponse 保存响应对象及发送给上游的完整输入条目
+func StoreResponse(c *gin.Context, request *dto.OpenAIResponsesRequest, response []byte) error {
+	responseId := gjson.GetBytes(response, "id").String()
+	if responseId == "" {
+		return errors.New("响应中缺少 id")
+	}
+	input, err := storedInputItems(request.Input)
+	if err != nil {
+		return err
+	}
+	if previousId := common.GetContextKeyString(c, constant.ContextKeyPreviousResponseId); previousId != "" {
+		if response, err = sjson.SetBytes(response, "previous_response_id", previousId); err != nil {
+			return err
+		}
+	}
+	stored := &model.StoredResponse{
+		ResponseId: responseId,
+		UserId:     c.GetInt("id"),
+		TokenId:    c.GetInt("token_id"),
+		Model:      gjson.GetBytes(response, "model").String(),
+		Status:     gjson.GetBytes(response, "status").String(),
+		Input:      input,
+		Response:   response,
+	}
+	if common.ResponsesRetentionDays > 0 {
+		stored.ExpiresAt = common.GetTimestamp() + int64(common.ResponsesRetentionDays)*86400
+	}
+	return stored.Insert()
+}
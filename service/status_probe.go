@@ -0,0 +1,353 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const (
+	statusProbeConcurrency = 4
+	statusProbeTimeout     = 60 * time.Second
+	statusPageCacheTTL     = 60 * time.Second
+	statusPageDays         = 30
+)
+
+// StatusProbeTarget 探测对象，即某个分组下的某个模型
+type StatusProbeTarget struct {
+	ModelName string
+	Group     string
+}
+
+// getStatusProbeTargets 返回需要探测的模型。STATUS_PROBE_MODELS 为逗号分隔的 模型 或 模型@分组，
+// 未配置时探测 STATUS_PROBE_GROUPS（默认 default）中所有支持对话接口的已启用模型
+func getStatusProbeTargets() []StatusProbeTarget {
+	targets := make([]StatusProbeTarget, 0)
+	if models := strings.TrimSpace(os.Getenv("STATUS_PROBE_MODELS")); models != "" {
+		for _, item := range strings.Split(models, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			target := StatusProbeTarget{ModelName: item, Group: "default"}
+			if idx := strings.LastIndex(item, "@"); idx > 0 {
+				target.ModelName, target.Group = item[:idx], item[idx+1:]
+			}
+			targets = append(targets, target)
+		}
+		return targets
+	}
+	groups := strings.Split(common.GetEnvOrDefaultString("STATUS_PROBE_GROUPS", "default"), ",")
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		for _, modelName := range model.GetGroupEnabledModels(group) {
+			if isChatProbeModel(modelName) {
+				targets = append(targets, StatusProbeTarget{ModelName: modelName, Group: group})
+			}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].ModelName != targets[j].ModelName {
+			return targets[i].ModelName < targets[j].ModelName
+		}
+		return targets[i].Group < targets[j].Group
+	})
+	return targets
+}
+
+// isChatProbeModel 只探测可以通过对话接口调用的模型，跳过向量、绘图、重排序及视频模型
+func isChatProbeModel(modelName string) bool {
+	endpointTypes := model.GetModelSupportEndpointTypes(modelName)
+	if len(endpointTypes) == 0 {
+		return true
+	}
+	for _, endpointType := range endpointTypes {
+		switch endpointType {
+		case constant.EndpointTypeOpenAI, constant.EndpointTypeAnthropic, constant.EndpointTypeGemini:
+			return true
+		}
+	}
+	return false
+}
+
+func getStatusProbeBaseURL() string {
+	if baseURL := os.Getenv("STATUS_PROBE_BASE_URL"); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = strconv.Itoa(*common.Port)
+	}
+	return "http://127.0.0.1:" + port
+}
+
+func truncateProbeError(message string) string {
+	runes := []rune(message)
+	if len(runes) > 500 {
+		return string(runes[:500])
+	}
+	return message
+}
+
+// probeStatusTarget 使用系统令牌经由正常的转发流程发起一次最小的对话请求
+func probeStatusTarget(client *http.Client, baseURL string, token *model.Token, target StatusProbeTarget) *model.StatusProbe {
+	probe := &model.StatusProbe{
+		ModelName:  target.ModelName,
+		UsingGroup: target.Group,
+		CreatedAt:  common.GetTimestamp(),
+	}
+	body, _ := common.Marshal(map[string]any{
+		"model":      target.ModelName,
+		"messages":   []map[string]string{{"role": "user", "content": "hi"}},
+		"max_tokens": 1,
+		"stream":     false,
+	})
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		probe.ErrorMessage = err.Error()
+		return probe
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	probe.LatencyMs = int(time.Since(startTime).Milliseconds())
+	if err != nil {
+		probe.ErrorMessage = truncateProbeError(err.Error())
+		return probe
+	}
+	defer resp.Body.Close()
+	probe.StatusCode = resp.StatusCode
+	probe.Success = resp.StatusCode == http.StatusOK
+	if !probe.Success {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		probe.ErrorMessage = truncateProbeError(fmt.Sprintf("status code %d: %s", resp.StatusCode, string(respBody)))
+	} else {
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+	return probe
+}
+
+// RunStatusProbes 对所有探测对象发起一轮探测并保存结果
+func RunStatusProbes() {
+	targets := getStatusProbeTargets()
+	if len(targets) == 0 {
+		return
+	}
+	baseURL := getStatusProbeBaseURL()
+	client := &http.Client{Timeout: statusProbeTimeout}
+	tokens := make(map[string]*model.Token)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, statusProbeConcurrency)
+	for _, target := range targets {
+		token, ok := tokens[target.Group]
+		if !ok {
+			var err error
+			token, err = model.GetOrCreateStatusProbeToken(target.Group)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to get status probe token for group %s: %s", target.Group, err.Error()))
+				continue
+			}
+			tokens[target.Group] = token
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target StatusProbeTarget, token *model.Token) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			probe := probeStatusTarget(client, baseURL, token, target)
+			if err := model.RecordStatusProbe(probe); err != nil {
+				common.SysError("failed to record status probe: " + err.Error())
+			}
+		}(target, token)
+	}
+	wg.Wait()
+}
+
+func AutomaticallyRunStatusProbes() {
+	for {
+		interval := common.StatusProbeIntervalMinutes
+		if interval <= 0 {
+			interval = 5
+		}
+		time.Sleep(time.Duration(interval) * time.Minute)
+		if !common.StatusProbeEnabled {
+			continue
+		}
+		RunStatusProbes()
+		cutoff := time.Now().AddDate(0, 0, -common.StatusProbeRetentionDays).Unix()
+		if _, err := model.DeleteStatusProbesBefore(cutoff); err != nil {
+			common.SysError("failed to clean status probes: " + err.Error())
+		}
+	}
+}
+
+// StatusPageDay 某个自然日（UTC）的探测汇总
+type StatusPageDay struct {
+	Day     string   `json:"day"`
+	Total   int64    `json:"total"`
+	Success int64    `json:"success"`
+	Uptime  *float64 `json:"uptime"` // 百分比，没有探测数据时为 null
+}
+
+// StatusPageModel 状态页中某个模型及分组的可用性
+type StatusPageModel struct {
+	ModelName       string                `json:"model_name"`
+	Group           string                `json:"group"`
+	Status          string                `json:"status"` // up / down
+	LastCheckedAt   int64                 `json:"last_checked_at"`
+	LastLatencyMs   int                   `json:"last_latency_ms"`
+	Uptime24h       *float64              `json:"uptime_24h"`
+	Uptime7d        *float64              `json:"uptime_7d"`
+	Uptime30d       *float64              `json:"uptime_30d"`
+	AvgLatencyMs24h int64                 `json:"avg_latency_ms_24h"`
+	Days            []*StatusPageDay      `json:"days"`
+	Incidents       []*StatusPageIncident `json:"incidents"`
+}
+
+// StatusPageIncident 公开状态页中的故障区间，只给出错误类别，不包含上游返回的原始错误信息
+type StatusPageIncident struct {
+	StartedAt  int64  `json:"started_at"`
+	ResolvedAt int64  `json:"resolved_at"` // 0 表示故障仍在持续
+	Failures   int    `json:"failures"`
+	ErrorType  string `json:"error_type"`
+}
+
+type StatusPage struct {
+	Enabled   bool               `json:"enabled"`
+	UpdatedAt int64              `json:"updated_at"`
+	Models    []*StatusPageModel `json:"models"`
+}
+
+var (
+	statusPageCache     *StatusPage
+	statusPageCacheTime time.Time
+	statusPageCacheLock sync.Mutex
+)
+
+func uptimePercent(success int64, total int64) *float64 {
+	if total == 0 {
+		return nil
+	}
+	uptime := float64(success) * 100 / float64(total)
+	uptime = float64(int64(uptime*100+0.5)) / 100
+	return &uptime
+}
+
+// GetStatusPage 返回公开状态页数据，结果缓存一分钟
+func GetStatusPage() (*StatusPage, error) {
+	statusPageCacheLock.Lock()
+	defer statusPageCacheLock.Unlock()
+	if statusPageCache != nil && time.Since(statusPageCacheTime) < statusPageCacheTTL {
+		return statusPageCache, nil
+	}
+	page, err := buildStatusPage(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	statusPageCache = page
+	statusPageCacheTime = time.Now()
+	return page, nil
+}
+
+func buildStatusPage(now time.Time) (*StatusPage, error) {
+	latest, err := model.GetLatestStatusProbes()
+	if err != nil {
+		return nil, err
+	}
+	todayStart := now.Unix() - now.Unix()%86400
+	daysStart := todayStart - (statusPageDays-1)*86400
+	dailyStats, err := model.GetStatusProbeStats(daysStart, true)
+	if err != nil {
+		return nil, err
+	}
+	recentStats, err := model.GetStatusProbeStats(now.Unix()-86400, false)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := model.GetStatusIncidents(daysStart)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &StatusPage{Enabled: common.StatusProbeEnabled, UpdatedAt: now.Unix(), Models: make([]*StatusPageModel, 0, len(latest))}
+	models := make(map[string]*StatusPageModel, len(latest))
+	for _, probe := range latest {
+		item := &StatusPageModel{
+			ModelName:     probe.ModelName,
+			Group:         probe.UsingGroup,
+			Status:        "down",
+			LastCheckedAt: probe.CreatedAt,
+			LastLatencyMs: probe.LatencyMs,
+			Days:          make([]*StatusPageDay, statusPageDays),
+			Incidents:     make([]*StatusPageIncident, 0),
+		}
+		if probe.Success {
+			item.Status = "up"
+		}
+		for i := range item.Days {
+			item.Days[i] = &StatusPageDay{Day: time.Unix(daysStart+int64(i)*86400, 0).UTC().Format("2006-01-02")}
+		}
+		models[probe.ModelName+"@"+probe.UsingGroup] = item
+		page.Models = append(page.Models, item)
+	}
+
+	var total30d, success30d, total7d, success7d = map[string]int64{}, map[string]int64{}, map[string]int64{}, map[string]int64{}
+	for _, stat := range dailyStats {
+		key := stat.ModelName + "@" + stat.UsingGroup
+		item, ok := models[key]
+		if !ok {
+			continue
+		}
+		if idx := (stat.Day - daysStart) / 86400; idx >= 0 && idx < statusPageDays {
+			day := item.Days[idx]
+			day.Total, day.Success = stat.Total, stat.Success
+			day.Uptime = uptimePercent(stat.Success, stat.Total)
+		}
+		total30d[key] += stat.Total
+		success30d[key] += stat.Success
+		if stat.Day >= todayStart-6*86400 {
+			total7d[key] += stat.Total
+			success7d[key] += stat.Success
+		}
+	}
+	for key, item := range models {
+		item.Uptime30d = uptimePercent(success30d[key], total30d[key])
+		item.Uptime7d = uptimePercent(success7d[key], total7d[key])
+	}
+	for _, stat := range recentStats {
+		if item, ok := models[stat.ModelName+"@"+stat.UsingGroup]; ok {
+			item.Uptime24h = uptimePercent(stat.Success, stat.Total)
+			if stat.Total > 0 {
+				item.AvgLatencyMs24h = stat.LatencyTotal / stat.Total
+			}
+		}
+	}
+	for _, incident := range incidents {
+		if item, ok := models[incident.ModelName+"@"+incident.UsingGroup]; ok {
+			item.Incidents = append(item.Incidents, &StatusPageIncident{
+				StartedAt:  incident.StartedAt,
+				ResolvedAt: incident.ResolvedAt,
+				Failures:   incident.Failures,
+				ErrorType:  incident.ErrorType,
+			})
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConsumeSubscriptionAllowance 检查并占用订阅套餐中的模型请求次数
+// 成功时返回匹配到的规则，请求失败后需通过 ReturnSubscriptionAllowance 归还
+func ConsumeSubscriptionAllowance(c *gin.Context, relayInfo *relaycommon.RelayInfo) (string, *types.NewAPIError) {
+	pattern, exceeded, err := model.ConsumeSubscriptionAllowance(relayInfo.UserId, relayInfo.OriginModelName)
+	if err != nil {
+		return "", types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if exceeded {
+		return "", types.NewErrorWithStatusCode(fmt.Errorf("订阅套餐中模型 %s 的本周期请求次数已用完", relayInfo.OriginModelName), types.ErrorCodeSubscriptionAllowanceExceeded, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	if pattern != "" {
+		logger.LogDebug(c, fmt.Sprintf("subscription allowance consumed: user=%d, rule=%s", relayInfo.UserId, pattern))
+	}
+	return pattern, nil
+}
+
+func ReturnSubscriptionAllowance(c *gin.Context, relayInfo *relaycommon.RelayInfo, pattern string) {
+	if pattern == "" {
+		return
+	}
+	logger.LogInfo(c, fmt.Sprintf("用户 %d 请求失败, 返还订阅模型请求次数 %s", relayInfo.UserId, pattern))
+	model.ReturnSubscriptionAllowance(relayInfo.UserId, pattern)
+}
@@ -9,6 +9,8 @@ import (
 type GlobalSettings struct {
 	PassThroughRequestEnabled bool     `json:"pass_through_request_enabled"`
 	ThinkingModelBlacklist    []string `json:"thinking_model_blacklist"`
+	// 只能通过 Responses API 调用的模型，Claude Messages 请求会转换为 Responses API 请求转发
+	ResponsesOnlyModels []string `json:"responses_only_models"`
 }
 
 // 默认配置
@@ -18,6 +20,7 @@ var defaultOpenaiSettings = GlobalSettings{
 		"moonshotai/kimi-k2-thinking",
 		"kimi-k2-thinking",
 	},
+	ResponsesOnlyModels: []string{},
 }
 
 // 全局实例
@@ -46,3 +49,18 @@ func ShouldPreserveThinkingSuffix(modelName string) bool {
 	}
 	return false
 }
+
+// IsResponsesOnlyModel 判断模型是否配置为只能通过 Responses API 调用
+func IsResponsesOnlyModel(modelName string) bool {
+	target := strings.TrimSpace(modelName)
+	if target == "" {
+		return false
+	}
+
+	for _, entry := range globalSettings.ResponsesOnlyModels {
+		if strings.TrimSpace(entry) == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package ratio_setting
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// defaultImagePriceRatio 按次计费的图片模型按尺寸、品质调整价格的倍率，键为模型名称（支持以 * 结尾的前缀匹配，也作为同名前缀模型的倍率），
+// 值的键为尺寸（如 1024x1792）、品质（如 hd）或 尺寸@品质 的组合，组合存在时不再叠加单独的尺寸、品质倍率
+var defaultImagePriceRatio = map[string]map[string]float64{
+	"dall-e": {
+		"256x256": 0.4,
+		"512x512": 0.45,
+	},
+	"dall-e-2": {
+		"256x256": 0.4,
+		"512x512": 0.45,
+	},
+	"dall-e-3": {
+		"1024x1792":    2,
+		"1792x1024":    2,
+		"hd":           2,
+		"1024x1792@hd": 3,
+		"1792x1024@hd": 3,
+	},
+}
+
+var imagePriceRatioMap map[string]map[string]float64
+var imagePriceRatioMapMutex sync.RWMutex
+
+func GetDefaultImagePriceRatioMap() map[string]map[string]float64 {
+	return defaultImagePriceRatio
+}
+
+func ImagePriceRatio2JSONString() string {
+	imagePriceRatioMapMutex.RLock()
+	defer imagePriceRatioMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(imagePriceRatioMap)
+	if err != nil {
+		common.SysError("error marshalling image price ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateImagePriceRatioByJSONString(jsonStr string) error {
+	ratioMap := make(map[string]map[string]float64)
+	if err := common.Unmarshal([]byte(jsonStr), &ratioMap); err != nil {
+		return err
+	}
+	imagePriceRatioMapMutex.Lock()
+	defer imagePriceRatioMapMutex.Unlock()
+	imagePriceRatioMap = ratioMap
+	return nil
+}
+
+// getModelImagePriceRatio 返回模型的尺寸、品质倍率设置，精确匹配优先，其次匹配最长的 * 前缀，
+// 都未匹配时按模型名称以设置中的模型名称开头匹配（如 dall-e-3-custom 使用 dall-e-3 的倍率）
+func getModelImagePriceRatio(model string) map[string]float64 {
+	if ratios, ok := imagePriceRatioMap[model]; ok {
+		return ratios
+	}
+	var matched, fallback map[string]float64
+	matchedLen, fallbackLen := -1, -1
+	for name, ratios := range imagePriceRatioMap {
+		prefix, ok := strings.CutSuffix(name, "*")
+		if !strings.HasPrefix(model, prefix) {
+			continue
+		}
+		if ok && len(prefix) > matchedLen {
+			matched, matchedLen = ratios, len(prefix)
+		} else if !ok && len(prefix) > fallbackLen {
+			fallback, fallbackLen = ratios, len(prefix)
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	return fallback
+}
+
+// GetImagePriceRatio 返回图片模型按尺寸、品质计算的价格倍率，未配置时为 1
+func GetImagePriceRatio(model string, size string, quality string) float64 {
+	imagePriceRatioMapMutex.RLock()
+	defer imagePriceRatioMapMutex.RUnlock()
+	ratios := getModelImagePriceRatio(model)
+	if ratios == nil {
+		return 1
+	}
+	if ratio, ok := ratios[size+"@"+quality]; ok && size != "" && quality != "" {
+		return ratio
+	}
+	ratio := 1.0
+	if sizeRatio, ok := ratios[size]; ok && size != "" {
+		ratio *= sizeRatio
+	}
+	if qualityRatio, ok := ratios[quality]; ok && quality != "" {
+		ratio *= qualityRatio
+	}
+	return ratio
+}
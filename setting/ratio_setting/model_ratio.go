@@ -357,6 +357,11 @@ func InitRatioSettings() {
 	imageRatioMap = defaultImageRatio
 	imageRatioMapMutex.Unlock()
 
+	// initialize imagePriceRatioMap
+	imagePriceRatioMapMutex.Lock()
+	imagePriceRatioMap = defaultImagePriceRatio
+	imagePriceRatioMapMutex.Unlock()
+
 	// initialize audioRatioMap
 	audioRatioMapMutex.Lock()
 	audioRatioMap = defaultAudioRatio
@@ -0,0 +1,45 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// TestGeminiErrorEnvelope 测试 Gemini 路由的鉴权失败及流式中途错误使用 Gemini 原生错误格式
+func TestGeminiErrorEnvelope(t *testing.T) {
+	r := setupTestRouter()
+	r.Use(middleware.TokenAuth())
+	r.POST("/v1beta/models/*path", func(c *gin.Context) {})
+	r.POST("/v1/chat/completions", func(c *gin.Context) {})
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-test:generateContent", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusUnauthorized || gjson.Get(body, "error.code").Int() != http.StatusUnauthorized ||
+		gjson.Get(body, "error.status").String() != "UNAUTHENTICATED" || gjson.Get(body, "error.message").String() == "" {
+		t.Errorf("Gemini 路由鉴权失败响应错误: %d %s", recorder.Code, body)
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if gjson.Get(recorder.Body.String(), "error.type").String() != "new_api_error" {
+		t.Errorf("OpenAI 路由应保持原有错误格式: %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	_ = helper.StringData(c, `{"candidates":[]}`)
+	helper.GeminiError(c, types.NewGeminiError(http.StatusTooManyRequests, "slow down"))
+	if !strings.Contains(recorder.Body.String(), `data: {"error":{"code":429,"message":"slow down","status":"RESOURCE_EXHAUSTED"}}`) {
+		t.Errorf("流式中途错误应以 SSE 事件发送: %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,91 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.ReleaseMode)
+}
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	writer, errorWriter := gin.DefaultWriter, gin.DefaultErrorWriter
+	gin.DefaultWriter, gin.DefaultErrorWriter = buf, buf
+	t.Cleanup(func() {
+		gin.DefaultWriter, gin.DefaultErrorWriter = writer, errorWriter
+		common.LogJSONEnabled = false
+		_ = common.SetLogLevels("info", "")
+	})
+	return buf
+}
+
+// TestJSONLogFields 测试 JSON 日志携带请求关联字段
+func TestJSONLogFields(t *testing.T) {
+	buf := captureLogs(t)
+	common.LogJSONEnabled = true
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(common.RequestIdKey, "req-1")
+	common.SetContextKey(c, constant.ContextKeyUserId, 7)
+	common.SetContextKey(c, constant.ContextKeyTokenId, 8)
+	common.SetContextKey(c, constant.ContextKeyChannelId, 9)
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "gpt-4o")
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, "openai")
+	logger.LogError(c, "上游返回错误")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("日志不是合法 JSON: %v, %s", err, buf.String())
+	}
+	expected := map[string]any{
+		"level": "error", "request_id": "req-1", "user_id": 7.0, "token_id": 8.0, "channel_id": 9.0,
+		"model": "gpt-4o", "relay_format": "openai", "msg": "上游返回错误",
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("字段 %s 期望 %v，实际 %v", key, value, line[key])
+		}
+	}
+	if _, ok := line["time"]; !ok {
+		t.Errorf("缺少 time 字段")
+	}
+}
+
+// TestPackageLogLevel 测试按包设置的日志级别
+func TestPackageLogLevel(t *testing.T) {
+	buf := captureLogs(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	if err := common.SetLogLevels("info", "test/logger=error"); err != nil {
+		t.Fatalf("设置日志级别失败: %v", err)
+	}
+	logger.LogInfo(c, "info message")
+	logger.LogWarn(c, "warn message")
+	common.SysLog("sys message")
+	if buf.Len() != 0 {
+		t.Errorf("期望低于 error 级别的日志被过滤，实际输出 %s", buf.String())
+	}
+
+	if err := common.SetLogLevels("error", "test=debug"); err != nil {
+		t.Fatalf("设置日志级别失败: %v", err)
+	}
+	logger.LogDebug(c, "debug %d", 1)
+	if !strings.Contains(buf.String(), "debug 1") {
+		t.Errorf("期望按包开启 debug 日志，实际输出 %s", buf.String())
+	}
+
+	if err := common.SetLogLevels("verbose", ""); err == nil {
+		t.Errorf("期望未知日志级别返回错误")
+	}
+}
@@ -0,0 +1,41 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/metrics"
+)
+
+// TestRelayMetricsExport 测试中转指标按渠道、模型等标签导出
+func TestRelayMetricsExport(t *testing.T) {
+	labels := metrics.RelayLabels{ChannelId: 7, ChannelType: 1, Model: "gpt-4o", Group: "default", RelayFormat: "openai"}
+	metrics.RecordRelayRequest(labels, 429, "channel_response_time_exceeded", 2*time.Second, 300*time.Millisecond)
+	metrics.RecordRetry(labels)
+	metrics.RecordConsume(labels, 100, 50, 1200)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	output := string(body)
+
+	labelStr := `channel_id="7",channel_type="1",group="default",model="gpt-4o",relay_format="openai"`
+	expected := []string{
+		`newapi_relay_requests_total{` + labelStr + `,status_code="429"} 1`,
+		`newapi_relay_errors_total{channel_id="7",channel_type="1",error_code="channel_response_time_exceeded",group="default",model="gpt-4o",relay_format="openai",status_code="429"} 1`,
+		`newapi_relay_retries_total{` + labelStr + `} 1`,
+		`newapi_relay_request_duration_seconds_count{` + labelStr + `} 1`,
+		`newapi_relay_time_to_first_token_seconds_count{` + labelStr + `} 1`,
+		`newapi_relay_prompt_tokens_total{` + labelStr + `} 100`,
+		`newapi_relay_completion_tokens_total{` + labelStr + `} 50`,
+		`newapi_relay_quota_consumed_total{` + labelStr + `} 1200`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("metrics output missing %q", line)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// TestAlertFireAndResolve 测试告警触发去重及恢复
+func TestAlertFireAndResolve(t *testing.T) {
+	setupTestDB(t)
+	if err := model.DB.Create(&model.User{Id: 1, Username: "root", Role: common.RoleRootUser, AffCode: "root"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	rule := &model.AlertRule{Name: "渠道错误率", Type: model.AlertTypeChannelErrorRate, Threshold: 50, WindowMinutes: 5, MinCount: 2}
+	if err := rule.Validate(); err != nil {
+		t.Fatalf("规则校验失败: %v", err)
+	}
+	if err := rule.Insert(); err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+	// 请求计数不依赖错误日志，默认配置下同样可以触发
+	attempts := []struct {
+		channelId int
+		failed    bool
+	}{{1, false}, {1, true}, {1, true}, {2, false}, {2, true}, {2, false}}
+	for _, attempt := range attempts {
+		model.RecordAlertRequest(attempt.channelId, "gpt-4o", attempt.failed)
+	}
+
+	service.EvaluateAlertRules()
+	service.EvaluateAlertRules()
+	events, total, err := model.GetAlertEvents(rule.Id, model.AlertEventStatusFiring, &common.PageInfo{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("查询告警事件失败: %v", err)
+	}
+	if total != 1 || events[0].Subject != "channel_id:1" {
+		t.Fatalf("期望渠道 1 只有一个告警事件，实际 %d 个: %+v", total, events)
+	}
+
+	// 请求计数移出时间窗口后告警恢复
+	model.DB.Model(&model.AlertRequestStat{}).Where("1 = 1").Update("bucket_time", common.GetTimestamp()-3600)
+	service.EvaluateAlertRules()
+	_, total, _ = model.GetAlertEvents(rule.Id, model.AlertEventStatusResolved, &common.PageInfo{Page: 1, PageSize: 10})
+	if total != 1 {
+		t.Errorf("期望告警恢复，实际已恢复事件 %d 个", total)
+	}
+}
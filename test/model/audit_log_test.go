@@ -0,0 +1,82 @@
+package model_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuditLogDiffAndAppendOnly 测试审计日志的变更比较、敏感字段掩码及只追加约束
+func TestAuditLogDiffAndAppendOnly(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("PUT", "/api/channel/", nil)
+	c.Set("id", 1)
+	c.Set("username", "root")
+	c.Set("role", common.RoleRootUser)
+
+	before := &model.Channel{Id: 7, Name: "old", Key: "sk-old", Priority: common.GetPointer[int64](0)}
+	after := &model.Channel{Id: 7, Name: "new", Key: "sk-new", Priority: common.GetPointer[int64](0),
+		HeaderOverride: common.GetPointer(`{"Authorization":"Bearer sk-header"}`)}
+	model.RecordAuditLog(c, model.AuditActionChannelUpdate, model.AuditTargetChannel, 7, before, after)
+	model.RecordOptionAuditLog(c, "GitHubClientSecret", "", "secret-value")
+	model.RecordOptionAuditLog(c, "discord.client_secret", "", "dotted-secret-value")
+
+	logs, total, err := model.GetAuditLogs(&model.AuditLogQuery{TargetType: model.AuditTargetChannel, TargetId: "7"}, &common.PageInfo{Page: 1, PageSize: 10})
+	if err != nil || total != 1 {
+		t.Fatalf("查询审计日志失败: %v, total=%d", err, total)
+	}
+	log := logs[0]
+	if log.ActorName != "root" || log.Action != model.AuditActionChannelUpdate {
+		t.Errorf("审计日志操作人或操作类型错误: %+v", log)
+	}
+	var diff map[string]*model.AuditChange
+	if err = common.Unmarshal([]byte(log.Diff), &diff); err != nil {
+		t.Fatalf("解析变更失败: %v", err)
+	}
+	if len(diff) != 3 || diff["name"] == nil || diff["key"] == nil || diff["header_override"] == nil {
+		t.Fatalf("期望只记录 name、key 与 header_override 的变更，实际 %s", log.Diff)
+	}
+	if strings.Contains(log.Diff, "sk-") {
+		t.Errorf("渠道密钥或请求头覆盖未掩码: %s", log.Diff)
+	}
+
+	logs, _, _ = model.GetAuditLogs(&model.AuditLogQuery{Action: model.AuditActionOptionUpdate}, &common.PageInfo{Page: 1, PageSize: 10})
+	if len(logs) != 2 {
+		t.Fatalf("期望 2 条设置审计日志，实际 %d 条", len(logs))
+	}
+	for _, optionLog := range logs {
+		if strings.Contains(optionLog.Diff, "secret-value") {
+			t.Errorf("密钥类设置未掩码: %+v", optionLog)
+		}
+	}
+
+	if err = model.LOG_DB.Model(log).Update("action", "tampered").Error; err == nil {
+		t.Error("审计日志不应允许修改")
+	}
+	if err = model.LOG_DB.Delete(log).Error; err == nil {
+		t.Error("审计日志不应允许删除")
+	}
+}
+
+// TestIsSensitiveOptionKey 测试驼峰及点分隔的密钥类设置项均被识别
+func TestIsSensitiveOptionKey(t *testing.T) {
+	sensitive := []string{"GitHubClientSecret", "SMTPToken", "discord.client_secret", "oidc.client_secret", "oidc.api_key", "a.b.Token"}
+	for _, key := range sensitive {
+		if !model.IsSensitiveOptionKey(key) {
+			t.Errorf("%s 应视为敏感设置", key)
+		}
+	}
+	plain := []string{"SystemName", "discord.enabled", "oidc.client_id", "oidc.well_known"}
+	for _, key := range plain {
+		if model.IsSensitiveOptionKey(key) {
+			t.Errorf("%s 不应视为敏感设置", key)
+		}
+	}
+}
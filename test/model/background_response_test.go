@@ -0,0 +1,172 @@
+package model_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newBackgroundRequestContext(body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewBufferString(body))
+	c.Set("id", 1)
+	c.Set("token_id", 1)
+	return c
+}
+
+// TestBackgroundResponseLifecycle 测试后台响应的额度预留、进程内执行、事件保存及取消
+func TestBackgroundResponseLifecycle(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+	const userQuota = 10000000
+	const requestCost = 100
+	if err := model.DB.Create(&model.User{Id: 1, Username: "background", AffCode: "bg1", Group: "default", Quota: userQuota}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "background", Name: "t", RemainQuota: userQuota}).Error; err != nil {
+		t.Fatalf("创建令牌失败: %v", err)
+	}
+
+	service.SetBackgroundResponseRelay(func(c *gin.Context, response *model.StoredResponse) {
+		body, _ := common.GetRequestBody(c)
+		if common.GetBackgroundResponseId(c) != response.ResponseId || response.TokenId != 1 || c.ClientIP() != "192.0.2.1" ||
+			gjson.GetBytes(body, "background").Exists() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "not a background request"}})
+			return
+		}
+		// 模拟结算：费用从后台响应的预留额度中扣减
+		relayInfo := &relaycommon.RelayInfo{UserId: 1, TokenId: 1, TokenKey: "background", BackgroundResponseId: common.GetBackgroundResponseId(c)}
+		if err := service.PostConsumeQuota(relayInfo, requestCost, 0, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.Header("Content-Type", "text/event-stream")
+		_, _ = c.Writer.Write([]byte("event: response.created\ndata: {\"type\":\"response.created\",\"sequence_number\":0,\"response\":{\"id\":\"resp_up\",\"status\":\"in_progress\"}}\n\n"))
+		_, _ = c.Writer.Write([]byte("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"sequence_number\":1,\"delta\":\"hi\"}\n\nevent: response.completed\ndata: {\"type\":\"response.completed\","))
+		_, _ = c.Writer.Write([]byte("\"sequence_number\":2,\"response\":{\"id\":\"resp_up\",\"status\":\"completed\",\"output\":[{\"type\":\"message\",\"content\":[{\"type\":\"output_text\",\"text\":\"hi\"}]}]}}\n\n"))
+	})
+
+	if _, err := service.CreateBackgroundResponse(newBackgroundRequestContext(`{"model":"gpt-4o","input":"hi","background":true}`)); !errors.Is(err, service.ErrResponseStoreDisabled) {
+		t.Fatalf("未启用响应存储时应拒绝后台响应: %v", err)
+	}
+	common.ResponsesStoreEnabled = true
+	defer func() { common.ResponsesStoreEnabled = false }()
+
+	// 非主节点只排队不执行，取消后退还预留额度
+	common.IsMasterNode = false
+	queued, err := service.CreateBackgroundResponse(newBackgroundRequestContext(`{"model":"gpt-4o","input":"hi","background":true}`))
+	if err != nil {
+		t.Fatalf("创建后台响应失败: %v", err)
+	}
+	if queued.Status != model.ResponseStatusQueued || queued.ReservedQuota <= 0 || gjson.GetBytes(queued.Response, "status").String() != "queued" {
+		t.Fatalf("排队中的后台响应错误: %s %d %s", queued.Status, queued.ReservedQuota, queued.Response)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota-queued.ReservedQuota {
+		t.Fatalf("提交后应预留额度: %d", quota)
+	}
+	if ok, err := service.CancelBackgroundResponse(queued); !ok || err != nil {
+		t.Fatalf("取消后台响应失败: %v %v", ok, err)
+	}
+	if ok, _ := service.CancelBackgroundResponse(queued); ok {
+		t.Errorf("已取消的响应不应重复取消")
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota {
+		t.Errorf("取消后应退还预留额度: %d", quota)
+	}
+
+	common.IsMasterNode = true
+	defer func() { common.IsMasterNode = false }()
+	response, err := service.CreateBackgroundResponse(newBackgroundRequestContext(`{"model":"gpt-4o","input":"hi","stream":true,"background":true}`))
+	if err != nil {
+		t.Fatalf("创建后台响应失败: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, _ := model.GetStoredResponseStatus(response.ResponseId)
+		if model.IsResponseFinished(status) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("后台响应未在限定时间内结束: %s", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	stored, err := model.GetUserStoredResponse(1, response.ResponseId)
+	if err != nil || stored.Status != model.ResponseStatusCompleted {
+		t.Fatalf("后台响应应已完成: %+v %v", stored, err)
+	}
+	if gjson.GetBytes(stored.Response, "id").String() != response.ResponseId || !gjson.GetBytes(stored.Response, "background").Bool() {
+		t.Errorf("最终响应对象应使用后台响应 id: %s", stored.Response)
+	}
+	if stored.ReservedQuota != 0 {
+		t.Errorf("执行后应释放预留额度: %d", stored.ReservedQuota)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota-requestCost {
+		t.Errorf("执行后应只扣除实际费用并退还剩余预留额度: %d", quota)
+	}
+
+	events, err := model.GetResponseEvents(response.ResponseId, 0, 100)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("starting_after 之后应有 2 个事件: %d %v", len(events), err)
+	}
+	if events[0].Type != "response.output_text.delta" || events[1].SequenceNumber != 2 {
+		t.Errorf("事件顺序错误: %s %d", events[0].Type, events[1].SequenceNumber)
+	}
+	if gjson.GetBytes(events[1].Data, "response.id").String() != response.ResponseId {
+		t.Errorf("事件中的响应 id 应被替换: %s", events[1].Data)
+	}
+}
+
+// TestInterruptedBackgroundResponse 测试重启前执行到一半的后台响应被标记为失败并退还预留额度，而不是重新执行
+func TestInterruptedBackgroundResponse(t *testing.T) {
+	setupTestDB(t)
+	const userQuota = 10000
+	const reservedQuota = 3000
+	if err := model.DB.Create(&model.User{Id: 1, Username: "interrupted", AffCode: "ir1", Group: "default", Quota: userQuota}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	response := &model.StoredResponse{ResponseId: "resp_interrupted", UserId: 1, TokenId: 1, Model: "gpt-4o",
+		Status: model.ResponseStatusInProgress, Response: []byte(`{"id":"resp_interrupted","status":"in_progress"}`),
+		Background: true, Stream: true, Request: []byte(`{"model":"gpt-4o","input":"hi"}`), ReservedQuota: reservedQuota}
+	if err := response.Insert(); err != nil {
+		t.Fatalf("创建后台响应失败: %v", err)
+	}
+	if err := model.InsertResponseEvent(&model.ResponseEvent{ResponseId: response.ResponseId, SequenceNumber: 0,
+		Type: "response.created", Data: []byte(`{"type":"response.created"}`)}); err != nil {
+		t.Fatalf("保存事件失败: %v", err)
+	}
+	executed := false
+	service.SetBackgroundResponseRelay(func(c *gin.Context, response *model.StoredResponse) {
+		executed = true
+	})
+
+	service.FailInterruptedBackgroundResponses()
+	if executed {
+		t.Errorf("中断的后台响应不应重新执行")
+	}
+	stored, err := model.GetUserStoredResponse(1, response.ResponseId)
+	if err != nil || stored.Status != model.ResponseStatusFailed || stored.ReservedQuota != 0 {
+		t.Fatalf("中断的后台响应应标记为失败并释放预留额度: %+v %v", stored, err)
+	}
+	if gjson.GetBytes(stored.Response, "error.message").String() == "" {
+		t.Errorf("失败的响应对象应包含错误信息: %s", stored.Response)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota+reservedQuota {
+		t.Errorf("应退还预留额度: %d", quota)
+	}
+	events, err := model.GetResponseEvents(response.ResponseId, 0, 100)
+	if err != nil || len(events) != 1 || events[0].Type != "response.failed" || events[0].SequenceNumber != 1 {
+		t.Fatalf("流式响应应追加 response.failed 事件: %+v %v", events, err)
+	}
+}
@@ -0,0 +1,174 @@
+package model_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func saveBatchInput(t *testing.T, userId int, content string) *model.File {
+	file, err := service.SaveFile(context.Background(), userId, 1, model.FilePurposeBatch, "input.jsonl",
+		strings.NewReader(content), int64(len(content)), 0)
+	if err != nil {
+		t.Fatalf("保存输入文件失败: %v", err)
+	}
+	return file
+}
+
+func readFileLines(t *testing.T, userId int, fileId string) []string {
+	file, err := model.GetUserFile(userId, 0, fileId)
+	if err != nil {
+		t.Fatalf("查询文件 %s 失败: %v", fileId, err)
+	}
+	reader, err := service.OpenFile(context.Background(), file)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// TestBatchLifecycle 测试批处理的校验、额度预留、执行及结果文件
+func TestBatchLifecycle(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("FILE_STORAGE_DIR", t.TempDir())
+	gin.SetMode(gin.TestMode)
+	const userQuota = 10000000
+	const requestCost = 100
+	if err := model.DB.Create(&model.User{Id: 1, Username: "batch", AffCode: "b1", Group: "default", Quota: userQuota}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		if common.GetBatchRequestId(c) == "" || c.GetHeader("Authorization") != "Bearer sk-" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "not a batch request"})
+			return
+		}
+		if bytes.Contains(body, []byte("bad")) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "bad request"}})
+			return
+		}
+		// 模拟结算：每个成功请求的费用从批处理预留额度中扣减
+		relayInfo := &relaycommon.RelayInfo{UserId: 1, BatchId: common.GetBatchRequestId(c), IsPlayground: true}
+		if err := service.PostConsumeQuota(relayInfo, requestCost, 0, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": "chatcmpl-1", "object": "chat.completion"})
+	})
+	service.SetBatchRelayHandler(engine)
+
+	request := &dto.OpenAIBatchRequest{Endpoint: "/v1/chat/completions", CompletionWindow: service.BatchCompletionWindow}
+	invalid := saveBatchInput(t, 1, `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}
+{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}
+`)
+	batch, err := service.CreateBatch(context.Background(), 1, 1, "default", invalid, request)
+	if err != nil {
+		t.Fatalf("创建批处理失败: %v", err)
+	}
+	object := service.BatchToOpenAI(batch)
+	if batch.Status != model.BatchStatusFailed || object.Errors == nil || len(object.Errors.Data) != 1 || object.Errors.Data[0].Code != "duplicate_custom_id" {
+		t.Fatalf("重复 custom_id 应校验失败: %+v", object)
+	}
+
+	input := saveBatchInput(t, 1, `{"custom_id":"r1","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"max_tokens":10}}
+
+{"custom_id":"r2","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[{"role":"user","content":"bad"}]}}
+{"custom_id":"r3","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}}
+`)
+	batch, err = service.CreateBatch(context.Background(), 1, 1, "default", input, request)
+	if err != nil {
+		t.Fatalf("创建批处理失败: %v", err)
+	}
+	if batch.Status != model.BatchStatusInProgress || batch.TotalRequests != 3 || batch.ReservedQuota <= 0 {
+		t.Fatalf("批处理状态错误: %+v", batch)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota-batch.ReservedQuota {
+		t.Fatalf("预留额度后用户额度错误: %d", quota)
+	}
+
+	service.ProcessBatch(batch)
+	batch, err = model.GetBatchByBatchId(batch.BatchId)
+	if err != nil {
+		t.Fatalf("查询批处理失败: %v", err)
+	}
+	if batch.Status != model.BatchStatusCompleted || batch.CompletedRequests != 2 || batch.FailedRequests != 1 || batch.ReservedQuota != 0 {
+		t.Fatalf("批处理执行结果错误: %+v", batch)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota-2*requestCost {
+		t.Errorf("应只扣除实际费用并退还剩余预留额度，实际用户额度 %d", quota)
+	}
+	outputLines := readFileLines(t, 1, batch.OutputFileId)
+	errorLines := readFileLines(t, 1, batch.ErrorFileId)
+	if len(outputLines) != 2 || len(errorLines) != 1 {
+		t.Fatalf("结果文件行数错误: %d %d", len(outputLines), len(errorLines))
+	}
+	var line dto.BatchOutputLine
+	if err = common.UnmarshalJsonStr(errorLines[0], &line); err != nil || line.CustomId != "r2" || line.Response.StatusCode != http.StatusBadRequest {
+		t.Errorf("错误文件内容错误: %s", errorLines[0])
+	}
+	if lines, _ := model.GetBatchItemLines(batch.BatchId); len(lines) != 0 {
+		t.Errorf("批处理结束后应删除执行记录，剩余 %d 条", len(lines))
+	}
+}
+
+// TestBatchReservedQuotaConcurrentTake 测试并发扣减预留额度时不会失败，扣减总额不超过预留额度，结束时退还剩余部分
+func TestBatchReservedQuotaConcurrentTake(t *testing.T) {
+	setupTestDB(t)
+	batch := &model.Batch{BatchId: "batch_concurrent", UserId: 1, Status: model.BatchStatusInProgress, ReservedQuota: 1000}
+	if err := model.DB.Create(batch).Error; err != nil {
+		t.Fatalf("创建批处理失败: %v", err)
+	}
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	total := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			taken, err := model.TakeBatchReservedQuota(batch.BatchId, 70)
+			if err != nil {
+				t.Errorf("扣减预留额度失败: %v", err)
+				return
+			}
+			lock.Lock()
+			total += taken
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	if total != 1000 {
+		t.Fatalf("期望共扣减 1000，实际 %d", total)
+	}
+
+	if _, err := model.ReturnBatchReservedQuota(batch.BatchId, 30); err != nil {
+		t.Fatalf("退回预留额度失败: %v", err)
+	}
+	released, finished, err := model.FinishBatch(batch.BatchId, []string{model.BatchStatusInProgress}, model.BatchStatusCompleted, nil)
+	if err != nil || !finished || released != 30 {
+		t.Fatalf("结束批处理错误: released=%d finished=%v err=%v", released, finished, err)
+	}
+	if _, finished, _ = model.FinishBatch(batch.BatchId, []string{model.BatchStatusInProgress}, model.BatchStatusFailed, nil); finished {
+		t.Error("已结束的批处理不应再次结束")
+	}
+	if taken, _ := model.TakeBatchReservedQuota(batch.BatchId, 10); taken != 0 {
+		t.Errorf("已结束的批处理不应再扣减预留额度，实际扣减 %d", taken)
+	}
+}
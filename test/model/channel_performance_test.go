@@ -0,0 +1,53 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// TestChannelPerformanceRollup 测试渠道性能数据的汇总、合并写入及分位数计算
+func TestChannelPerformanceRollup(t *testing.T) {
+	setupTestDB(t)
+
+	for i := 0; i < 90; i++ {
+		model.RecordChannelAttempt(1, "gpt-4o", 800*time.Millisecond, 150*time.Millisecond, false)
+	}
+	model.SaveChannelPerformanceCache()
+	// 第二次写入需与已有记录合并
+	for i := 0; i < 10; i++ {
+		model.RecordChannelAttempt(1, "gpt-4o", 12*time.Second, 0, true)
+		model.RecordChannelAttempt(2, "gpt-4o", 400*time.Millisecond, 0, false)
+	}
+	model.SaveChannelPerformanceCache()
+
+	stats, err := model.GetChannelPerformanceStats(0, 0, 1, "gpt-4o", false)
+	if err != nil {
+		t.Fatalf("查询渠道性能失败: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("期望 1 条统计，实际 %d 条", len(stats))
+	}
+	stat := stats[0]
+	if stat.RequestCount != 100 || stat.ErrorCount != 10 {
+		t.Errorf("期望 100 次请求 10 次错误，实际 %d 次请求 %d 次错误", stat.RequestCount, stat.ErrorCount)
+	}
+	if stat.LatencyP50Ms <= 750 || stat.LatencyP50Ms > 1000 {
+		t.Errorf("期望 p50 延迟落在 750-1000ms 桶内，实际 %.1f", stat.LatencyP50Ms)
+	}
+	if stat.LatencyP99Ms <= 10000 || stat.LatencyP99Ms > 15000 {
+		t.Errorf("期望 p99 延迟落在 10-15s 桶内，实际 %.1f", stat.LatencyP99Ms)
+	}
+	if stat.TtftP50Ms <= 100 || stat.TtftP50Ms > 200 {
+		t.Errorf("期望首字 p50 落在 100-200ms 桶内，实际 %.1f", stat.TtftP50Ms)
+	}
+
+	ranked, err := model.RankChannelPerformance(0, 0, "gpt-4o", 10)
+	if err != nil {
+		t.Fatalf("渠道排名失败: %v", err)
+	}
+	if len(ranked) != 2 || ranked[0].ChannelId != 2 || ranked[0].SuggestedWeight != 100 {
+		t.Errorf("期望渠道 2 排名第一且建议权重为 100，实际 %+v", ranked)
+	}
+}
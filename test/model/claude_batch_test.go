@@ -0,0 +1,113 @@
+package model_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// TestClaudeBatchSettle 测试消息批处理结束后按成功结果的用量结算预扣额度
+func TestClaudeBatchSettle(t *testing.T) {
+	setupTestDB(t)
+	service.InitHttpClient()
+	const userQuota, reserved = 1000000, 100000
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages/batches/msgbatch_1/results" || r.Header.Get("x-api-key") != "sk-ant" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"custom_id":"a","result":{"type":"succeeded","message":{"model":"claude-up","usage":{"input_tokens":1000,"output_tokens":500}}}}
+{"custom_id":"b","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}}}
+`))
+	}))
+	defer server.Close()
+
+	if err := model.DB.Create(&model.User{Id: 1, Username: "claude", AffCode: "c1", Group: "default", Quota: userQuota - reserved}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "claudebatch", Name: "t", RemainQuota: userQuota - reserved}).Error; err != nil {
+		t.Fatalf("创建令牌失败: %v", err)
+	}
+	if err := model.DB.Create(&model.Channel{Id: 1, Type: constant.ChannelTypeAnthropic, Key: "sk-ant", Status: common.ChannelStatusEnabled, BaseURL: &server.URL}).Error; err != nil {
+		t.Fatalf("创建渠道失败: %v", err)
+	}
+	task := &model.Task{TaskID: "msgbatch_1", Platform: constant.TaskPlatformClaudeBatch, UserId: 1, ChannelId: 1, Quota: reserved,
+		Status: model.TaskStatusInProgress, Progress: "0%"}
+	task.SetData(&relay.ClaudeBatchTaskData{
+		Batch:   &dto.ClaudeMessageBatch{Id: "msgbatch_1", ProcessingStatus: dto.ClaudeMessageBatchStatusInProgress},
+		TokenId: 1,
+		Models: []*relay.ClaudeBatchModelPrice{{
+			OriginModelName:   "claude-test",
+			UpstreamModelName: "claude-up",
+			PriceData: types.PriceData{ModelRatio: 1, CompletionRatio: 5,
+				GroupRatioInfo: types.GroupRatioInfo{GroupRatio: 0.5, BatchRatio: 0.5}},
+		}},
+	})
+	if err := task.Insert(); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	batch := &dto.ClaudeMessageBatch{Id: "msgbatch_1", ProcessingStatus: dto.ClaudeMessageBatchStatusInProgress,
+		RequestCounts: dto.ClaudeMessageBatchRequestCounts{Processing: 1, Succeeded: 1}}
+	if err := relay.UpdateClaudeBatchTask(context.Background(), task, batch); err != nil {
+		t.Fatalf("更新任务失败: %v", err)
+	}
+	if task.Status != model.TaskStatusInProgress || task.Progress != "50%" {
+		t.Fatalf("未结束的批处理状态错误: %s %s", task.Status, task.Progress)
+	}
+
+	batch.ProcessingStatus = dto.ClaudeMessageBatchStatusEnded
+	batch.RequestCounts = dto.ClaudeMessageBatchRequestCounts{Succeeded: 1, Errored: 1}
+	if err := relay.UpdateClaudeBatchTask(context.Background(), task, batch); err != nil {
+		t.Fatalf("结算失败: %v", err)
+	}
+	// (1000 + 500*5) * 0.5
+	const actual = 1750
+	if task.Status != model.TaskStatusSuccess || task.Quota != actual {
+		t.Fatalf("结算后任务错误: %s %d", task.Status, task.Quota)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota-actual {
+		t.Errorf("结算后用户额度错误: %d", quota)
+	}
+	token, _ := model.GetTokenById(1)
+	if token.RemainQuota != userQuota-actual {
+		t.Errorf("结算后令牌额度错误: %d", token.RemainQuota)
+	}
+	var log model.Log
+	if err := model.DB.Where("type = ?", model.LogTypeConsume).First(&log).Error; err != nil || log.Quota != actual || log.ModelName != "claude-test" {
+		t.Errorf("消费日志错误: %+v %v", log, err)
+	}
+
+	// 上游批处理丢失时，预扣额度同时退还到用户及令牌
+	const failedReserved = 2000
+	model.DB.Model(&model.User{}).Where("id = ?", 1).Update("quota", userQuota-actual-failedReserved)
+	model.DB.Model(&model.Token{}).Where("id = ?", 1).Update("remain_quota", userQuota-actual-failedReserved)
+	failed := &model.Task{TaskID: "msgbatch_2", Platform: constant.TaskPlatformClaudeBatch, UserId: 1, ChannelId: 1, Quota: failedReserved,
+		Status: model.TaskStatusInProgress, Progress: "0%"}
+	failed.SetData(&relay.ClaudeBatchTaskData{
+		Batch:   &dto.ClaudeMessageBatch{Id: "msgbatch_2", ProcessingStatus: dto.ClaudeMessageBatchStatusInProgress},
+		TokenId: 1,
+		Models:  []*relay.ClaudeBatchModelPrice{{OriginModelName: "claude-test", UpstreamModelName: "claude-up"}},
+	})
+	if err := failed.Insert(); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	if err := relay.FailClaudeBatch(failed, "not found"); err != nil {
+		t.Fatalf("标记失败出错: %v", err)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != userQuota-actual {
+		t.Errorf("失败后用户额度未退还: %d", quota)
+	}
+	if token, _ = model.GetTokenById(1); token.RemainQuota != userQuota-actual {
+		t.Errorf("失败后令牌额度未退还: %d", token.RemainQuota)
+	}
+}
@@ -0,0 +1,111 @@
+package model_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// TestCouponCalculateBonus 测试优惠码赠送额度计算
+func TestCouponCalculateBonus(t *testing.T) {
+	tests := []struct {
+		name      string
+		coupon    model.Coupon
+		baseQuota int
+		expected  int
+	}{
+		{"百分比赠送", model.Coupon{Type: model.CouponTypePercentage, Value: 20}, 500000, 100000},
+		{"百分比赠送上限", model.Coupon{Type: model.CouponTypePercentage, Value: 50, MaxBonusQuota: 100000}, 500000, 100000},
+		{"固定额度", model.Coupon{Type: model.CouponTypeFixed, Value: 250000}, 1000, 250000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bonus := tt.coupon.CalculateBonus(tt.baseQuota); bonus != tt.expected {
+				t.Errorf("期望赠送 %d，实际 %d", tt.expected, bonus)
+			}
+		})
+	}
+}
+
+// TestCouponValidate 测试优惠码参数校验
+func TestCouponValidate(t *testing.T) {
+	valid := model.Coupon{Code: " SPRING20 ", Type: model.CouponTypePercentage, Value: 20}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("期望校验通过，实际: %v", err)
+	}
+	if valid.Code != "SPRING20" || valid.Status == 0 {
+		t.Errorf("校验后未规范化优惠码: %+v", valid)
+	}
+
+	invalid := []model.Coupon{
+		{Code: "", Type: model.CouponTypeFixed, Value: 1},
+		{Code: "A", Type: "unknown", Value: 1},
+		{Code: "A", Type: model.CouponTypeFixed, Value: 0},
+		{Code: "A", Type: model.CouponTypeFixed, Value: 1, StartTime: 100, EndTime: 50},
+		{Code: "A", Type: model.CouponTypeFixed, Value: 1, PerUserLimit: -1},
+	}
+	for i, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("用例 %d 期望校验失败", i)
+		}
+	}
+}
+
+// TestRechargeEpayCouponMaxUses 测试并发完成易支付订单时优惠码不超出总次数，且赠送额度与充值在同一事务中到账
+func TestRechargeEpayCouponMaxUses(t *testing.T) {
+	setupTestDB(t)
+
+	coupon := &model.Coupon{Code: "LIMITED", Type: model.CouponTypeFixed, Value: 100, MaxUses: 2, Status: 1}
+	if err := coupon.Insert(); err != nil {
+		t.Fatalf("创建优惠码失败: %v", err)
+	}
+	const userCount = 4
+	for i := 1; i <= userCount; i++ {
+		if err := model.DB.Create(&model.User{Id: i, Username: fmt.Sprintf("topup_%d", i), AffCode: fmt.Sprintf("t%d", i), Group: "default"}).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+		topUp := &model.TopUp{UserId: i, Amount: 1, TradeNo: fmt.Sprintf("epay_%d", i), Status: common.TopUpStatusPending, CouponCode: coupon.Code, BonusQuota: 100}
+		if err := topUp.Insert(); err != nil {
+			t.Fatalf("创建订单失败: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= userCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := model.RechargeEpay(fmt.Sprintf("epay_%d", i)); err != nil {
+				t.Errorf("完成订单失败: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// 重复回调不会重复充值
+	if err := model.RechargeEpay("epay_1"); err != nil {
+		t.Fatalf("重复回调失败: %v", err)
+	}
+
+	saved, _ := model.GetCouponById(coupon.Id)
+	if saved.UsedCount != 2 {
+		t.Errorf("优惠码应只核销 2 次，实际 %d 次", saved.UsedCount)
+	}
+	bonusUsers := 0
+	baseQuota := int(common.QuotaPerUnit)
+	for i := 1; i <= userCount; i++ {
+		quota, _ := model.GetUserQuota(i, true)
+		switch quota {
+		case baseQuota + 100:
+			bonusUsers++
+		case baseQuota:
+		default:
+			t.Errorf("用户 %d 额度错误: %d", i, quota)
+		}
+	}
+	if bonusUsers != 2 {
+		t.Errorf("应有 2 个用户获得赠送额度，实际 %d 个", bonusUsers)
+	}
+}
@@ -0,0 +1,75 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestInlineRequestFiles 测试请求中引用本站文件的 file_id 被替换为 base64 内容
+func TestInlineRequestFiles(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("FILE_STORAGE_DIR", t.TempDir())
+	gin.SetMode(gin.TestMode)
+	file, err := service.SaveFile(context.Background(), 1, 1, "user_data", "a.txt", strings.NewReader("hello"), 5, 0)
+	if err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	if file.ExpiresAt != file.CreatedAt+int64(common.FileRetentionDays)*86400 {
+		t.Errorf("默认保留期错误: %d", file.ExpiresAt)
+	}
+
+	body := `{"model":"gpt-4o","seed":12345678901234567890,"temperature":0.10,"input":[{"role":"user","content":[` +
+		`{"type":"input_file","file_id":"` + file.FileId + `"},` +
+		`{"type":"input_image","file_id":"` + file.FileId + `"},` +
+		`{"type":"input_file","file_id":"file-upstream"}]}]}`
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("id", 1)
+	if err = service.InlineRequestFiles(c); err != nil {
+		t.Fatalf("内联文件失败: %v", err)
+	}
+	inlined, _ := common.GetRequestBody(c)
+	for _, expected := range []string{
+		`"file_data":"data:text/plain;base64,aGVsbG8="`,
+		`"filename":"a.txt"`,
+		`"image_url":"data:text/plain;base64,aGVsbG8="`,
+		`"file_id":"file-upstream"`,
+	} {
+		if !strings.Contains(string(inlined), expected) {
+			t.Errorf("内联后的请求缺少 %s: %s", expected, inlined)
+		}
+	}
+	// 未引用文件的部分保持原样，不丢失数字精度及字段顺序
+	if !strings.HasPrefix(string(inlined), `{"model":"gpt-4o","seed":12345678901234567890,"temperature":0.10,"input":[`) {
+		t.Errorf("内联改变了请求的其他部分: %s", inlined)
+	}
+	if strings.Contains(string(inlined), file.FileId) {
+		t.Errorf("本站文件 id 未被替换: %s", inlined)
+	}
+
+	common.FileUserStorageLimitMB = 1
+	defer func() { common.FileUserStorageLimitMB = 1024 }()
+	if err = service.CheckFileStorageQuota(1, 1<<20); !errors.Is(err, service.ErrFileStorageQuotaExceeded) {
+		t.Errorf("超过存储空间上限时应返回错误: %v", err)
+	}
+	if err = service.CheckFileStorageQuota(2, 1<<20); err != nil {
+		t.Errorf("其他用户不应受影响: %v", err)
+	}
+	if err = model.DB.Model(file).Update("expires_at", 1).Error; err != nil {
+		t.Fatalf("更新过期时间失败: %v", err)
+	}
+	if deleted, err := service.CleanExpiredFiles(); err != nil || deleted != 1 {
+		t.Errorf("过期文件清理错误: %d %v", deleted, err)
+	}
+}
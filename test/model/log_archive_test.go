@@ -0,0 +1,55 @@
+package model_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// TestArchiveLogs 测试按天归档日志、校验后删除以及重新导入
+func TestArchiveLogs(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("LOG_ARCHIVE_DIR", t.TempDir())
+	t.Setenv("LOG_ARCHIVE_S3_BUCKET", "")
+
+	today := time.Now()
+	days := []time.Time{today.AddDate(0, 0, -3), today.AddDate(0, 0, -2), today}
+	for i, day := range days {
+		for j := 0; j <= i; j++ {
+			log := &model.Log{UserId: 1, CreatedAt: day.Unix(), Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 100, Content: "归档测试"}
+			if err := model.LOG_DB.Create(log).Error; err != nil {
+				t.Fatalf("创建日志失败: %v", err)
+			}
+		}
+	}
+
+	archives, err := service.ArchiveLogs(context.Background(), today.AddDate(0, 0, -1).Unix())
+	if err != nil {
+		t.Fatalf("归档失败: %v", err)
+	}
+	if len(archives) != 2 || archives[0].RowCount != 1 || archives[1].RowCount != 2 {
+		t.Fatalf("期望按天生成 2 个归档（1 条、2 条），实际 %+v", archives)
+	}
+	var remaining int64
+	model.LOG_DB.Model(&model.Log{}).Count(&remaining)
+	if remaining != 3 {
+		t.Errorf("期望归档后剩余 3 条日志，实际 %d 条", remaining)
+	}
+
+	imported, err := service.ImportLogArchive(context.Background(), archives[1].Id)
+	if err != nil {
+		t.Fatalf("导入归档失败: %v", err)
+	}
+	// 重复导入应覆盖而不是追加
+	if imported, err = service.ImportLogArchive(context.Background(), archives[1].Id); err != nil || imported != 2 {
+		t.Fatalf("期望重复导入 2 条，实际 %d 条，err=%v", imported, err)
+	}
+	restored, total, err := model.GetRestoredLogs(archives[1].Id, &common.PageInfo{Page: 1, PageSize: 10})
+	if err != nil || total != 2 || restored[0].Quota != 100 || restored[0].Content != "归档测试" {
+		t.Errorf("导入数据不正确: total=%d err=%v", total, err)
+	}
+}
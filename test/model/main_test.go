@@ -0,0 +1,28 @@
+package model_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB 为每个测试创建独立的 SQLite 数据库并迁移模型测试用到的表
+func setupTestDB(t *testing.T) {
+	// 不限制连接数，并发测试使用多个连接；SQLite 不支持行锁，写事务在开始时获取写锁并等待其他写事务结束
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(10000)&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err = db.AutoMigrate(&model.User{}, &model.Token{}, &model.Redemption{}, &model.RedemptionRecord{}, &model.QuotaLedger{}, &model.Log{}, &model.PayloadCaptureRule{}, &model.PayloadCapture{}, &model.Channel{}, &model.ChannelPerformance{}, &model.LogArchive{}, &model.RestoredLog{}, &model.UsageStat{}, &model.AlertRule{}, &model.AlertEvent{}, &model.AlertRequestStat{}, &model.AuditLog{}, &model.StatusProbe{}, &model.StatusIncident{}, &model.File{}, &model.Batch{}, &model.BatchItem{}, &model.Task{}, &model.StoredResponse{}, &model.ResponseEvent{}, &model.SubscriptionPlan{}, &model.Subscription{}, &model.Coupon{}, &model.TopUp{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	model.DB = db
+	model.LOG_DB = db
+	common.RedisEnabled = false
+}
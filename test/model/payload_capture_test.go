@@ -0,0 +1,50 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// TestPayloadCaptureRuleMatchAndLimit 测试采集规则按范围匹配及采集次数上限
+func TestPayloadCaptureRuleMatchAndLimit(t *testing.T) {
+	setupTestDB(t)
+
+	now := common.GetTimestamp()
+	rules := []*model.PayloadCaptureRule{
+		{Scope: model.PayloadCaptureScopeUser, Target: "7", SampleRate: 1, MaxCaptures: 2, EndTime: now + 3600},
+		{Scope: model.PayloadCaptureScopeModel, Target: "gpt-4o", SampleRate: 1, EndTime: now + 3600},
+		{Scope: model.PayloadCaptureScopeChannel, Target: "3", SampleRate: 1, EndTime: now + 3600, Status: common.PayloadCaptureRuleStatusDisabled},
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			t.Fatalf("校验采集规则失败: %v", err)
+		}
+		if err := rule.Insert(); err != nil {
+			t.Fatalf("创建采集规则失败: %v", err)
+		}
+	}
+
+	if matched := model.MatchPayloadCaptureRules(7, 1, 3, "claude-3"); len(matched) != 1 || matched[0].Id != rules[0].Id {
+		t.Fatalf("用户规则匹配错误: %+v", matched)
+	}
+	if matched := model.MatchPayloadCaptureRules(8, 1, 3, "gpt-4o"); len(matched) != 1 || matched[0].Id != rules[1].Id {
+		t.Fatalf("模型规则匹配错误: %+v", matched)
+	}
+
+	for i := 0; i < 3; i++ {
+		ok, err := model.TakePayloadCaptureQuota(rules[0].Id)
+		if err != nil {
+			t.Fatalf("占用采集次数失败: %v", err)
+		}
+		if ok != (i < 2) {
+			t.Fatalf("第 %d 次采集结果错误: %v", i+1, ok)
+		}
+	}
+
+	invalid := &model.PayloadCaptureRule{Scope: model.PayloadCaptureScopeToken, Target: "1", SampleRate: 1, EndTime: now + 30*24*3600}
+	if err := invalid.Validate(); err == nil {
+		t.Fatal("超过 7 天的采集规则应校验失败")
+	}
+}
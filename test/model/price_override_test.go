@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// TestMatchPriceOverrideModel 测试自定义价格规则的模型匹配
+func TestMatchPriceOverrideModel(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		modelName string
+		expected  bool
+	}{
+		{"claude-3-5-sonnet", "claude-3-5-sonnet", true},
+		{"claude-*", "claude-3-5-sonnet", true},
+		{"*-thinking", "claude-3-7-sonnet-thinking", true},
+		{"claude-*-sonnet*", "claude-3-5-sonnet-20241022", true},
+		{"*", "gpt-4o", true},
+		{"claude-*", "gpt-4o", false},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"ab*ba", "aba", false},
+	}
+
+	for _, tt := range tests {
+		ok, _ := model.MatchPriceOverrideModel(tt.pattern, tt.modelName)
+		if ok != tt.expected {
+			t.Errorf("MatchPriceOverrideModel(%q, %q) = %v, 期望 %v", tt.pattern, tt.modelName, ok, tt.expected)
+		}
+	}
+}
+
+// TestSelectPriceOverride 测试规则优先级：令牌级优先于用户级，精确匹配优先于通配
+func TestSelectPriceOverride(t *testing.T) {
+	overrides := []*model.PriceOverride{
+		{Id: 1, Model: "*", Type: types.PriceOverrideTypeRatio, Value: 0.9},
+		{Id: 2, Model: "claude-*", Type: types.PriceOverrideTypeRatio, Value: 0.8},
+		{Id: 3, Model: "claude-3-5-sonnet", Type: types.PriceOverrideTypePrice, Value: 0.01},
+		{Id: 4, TokenId: 10, Model: "claude-*", Type: types.PriceOverrideTypeRatio, Value: 0.5},
+	}
+
+	tests := []struct {
+		name       string
+		tokenId    int
+		modelName  string
+		expectedId int
+	}{
+		{"精确匹配优先", 1, "claude-3-5-sonnet", 3},
+		{"较长通配优先", 1, "claude-3-opus", 2},
+		{"全局通配兜底", 1, "gpt-4o", 1},
+		{"令牌级规则优先", 10, "claude-3-5-sonnet", 4},
+		{"其他令牌的规则不生效", 11, "claude-3-opus", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := model.SelectPriceOverride(overrides, tt.tokenId, tt.modelName)
+			if o == nil {
+				t.Fatalf("期望命中规则 %d，实际未命中", tt.expectedId)
+			}
+			if o.Id != tt.expectedId {
+				t.Errorf("期望命中规则 %d，实际命中 %d", tt.expectedId, o.Id)
+			}
+		})
+	}
+
+	if o := model.SelectPriceOverride(overrides[1:3], 0, "gpt-4o"); o != nil {
+		t.Errorf("期望未命中规则，实际命中 %d", o.Id)
+	}
+}
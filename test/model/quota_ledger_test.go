@@ -0,0 +1,94 @@
+package model_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// TestQuotaLedger 测试额度变动记账及一致性检查
+func TestQuotaLedger(t *testing.T) {
+	setupTestDB(t)
+
+	user := &model.User{Id: 1001, Username: "ledger_user", AffCode: "ldgr", Quota: 1000}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	if err := model.IncreaseUserQuota(1001, 500, true, model.LedgerReasonTopUp, "order-1"); err != nil {
+		t.Fatalf("增加额度失败: %v", err)
+	}
+	if err := model.DecreaseUserQuota(1001, 300, model.LedgerReasonConsume, "req-1"); err != nil {
+		t.Fatalf("扣减额度失败: %v", err)
+	}
+
+	var entries []*model.QuotaLedger
+	model.DB.Where("account_type = ? AND account_id = ?", model.LedgerAccountUser, 1001).Order("id").Find(&entries)
+	if len(entries) != 3 {
+		t.Fatalf("期望 3 条账户分录（含期初余额），实际 %d 条", len(entries))
+	}
+	expected := []struct {
+		reason  string
+		delta   int
+		balance int
+	}{
+		{model.LedgerReasonOpening, 1000, 1000},
+		{model.LedgerReasonTopUp, 500, 1500},
+		{model.LedgerReasonConsume, -300, 1200},
+	}
+	for i, e := range expected {
+		if entries[i].Reason != e.reason || entries[i].Delta != e.delta || entries[i].BalanceAfter != e.balance {
+			t.Errorf("分录 %d 不正确: %+v", i, entries[i])
+		}
+	}
+
+	result, err := model.CheckQuotaLedgerConsistency()
+	if err != nil {
+		t.Fatalf("一致性检查失败: %v", err)
+	}
+	if result.UnbalancedSum != 0 || len(result.Mismatches) != 0 || result.CheckedUsers != 1 {
+		t.Errorf("期望账本一致，实际: %+v", result)
+	}
+
+	// 绕过账本直接修改余额，应被检查出来
+	model.DB.Model(&model.User{}).Where("id = ?", 1001).Update("quota", 2000)
+	result, err = model.CheckQuotaLedgerConsistency()
+	if err != nil {
+		t.Fatalf("一致性检查失败: %v", err)
+	}
+	if len(result.Mismatches) != 1 || result.Mismatches[0].Diff != 800 {
+		t.Errorf("期望检查出差额 800，实际: %+v", result.Mismatches)
+	}
+}
+
+// TestQuotaLedgerConcurrentOpening 测试同一账户并发首次记账时只补记一条期初分录
+func TestQuotaLedgerConcurrentOpening(t *testing.T) {
+	setupTestDB(t)
+
+	if err := model.DB.Create(&model.User{Id: 1002, Username: "ledger_opening", AffCode: "ldop", Quota: 100}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := model.IncreaseUserQuota(1002, 10, true, model.LedgerReasonTopUp, ""); err != nil {
+				t.Errorf("增加额度失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var openings int64
+	model.DB.Model(&model.QuotaLedger{}).Where("account_type = ? AND account_id = ? AND reason = ?",
+		model.LedgerAccountUser, 1002, model.LedgerReasonOpening).Count(&openings)
+	if openings != 1 {
+		t.Errorf("期望 1 条期初分录，实际 %d 条", openings)
+	}
+	result, err := model.CheckQuotaLedgerConsistency()
+	if err != nil || len(result.Mismatches) != 0 {
+		t.Errorf("期望账本一致，实际: %+v %v", result, err)
+	}
+}
@@ -0,0 +1,145 @@
+package model_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// TestRedeemMultiUse 测试多次兑换码在并发兑换下的次数限制
+func TestRedeemMultiUse(t *testing.T) {
+	setupTestDB(t)
+
+	const userCount = 5
+	for i := 1; i <= userCount; i++ {
+		if err := model.DB.Create(&model.User{Id: i, Username: common.GetRandomString(8), AffCode: common.GetRandomString(4), Group: "default"}).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+	redemption := &model.Redemption{Key: common.GetUUID(), Name: "multi", Status: common.RedemptionCodeStatusEnabled, Quota: 100, MaxUses: 3, PerUserLimit: 1}
+	if err := redemption.Insert(); err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 1; i <= userCount; i++ {
+		wg.Add(1)
+		go func(userId int) {
+			defer wg.Done()
+			if _, err := model.Redeem(redemption.Key, userId); err == nil {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if success != 3 {
+		t.Errorf("期望成功兑换 3 次，实际 %d 次", success)
+	}
+	saved, err := model.GetRedemptionById(redemption.Id)
+	if err != nil {
+		t.Fatalf("查询兑换码失败: %v", err)
+	}
+	if saved.UsedCount != 3 || saved.Status != common.RedemptionCodeStatusUsed {
+		t.Errorf("期望已用 3 次且状态为已使用，实际 used_count=%d status=%d", saved.UsedCount, saved.Status)
+	}
+	var records int64
+	model.DB.Model(&model.RedemptionRecord{}).Where("redemption_id = ?", redemption.Id).Count(&records)
+	if records != 3 {
+		t.Errorf("期望 3 条兑换记录，实际 %d 条", records)
+	}
+}
+
+// TestRedeemGroupReward 测试分组兑换码的每用户次数限制及到期回退
+func TestRedeemGroupReward(t *testing.T) {
+	setupTestDB(t)
+
+	if err := model.DB.Create(&model.User{Id: 1, Username: "group_user", Group: "default"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	redemption := &model.Redemption{Key: common.GetUUID(), Name: "vip", Status: common.RedemptionCodeStatusEnabled,
+		RewardType: model.RedemptionRewardGroup, RewardGroup: "vip", RewardDuration: 3600, MaxUses: 10, PerUserLimit: 1}
+	if err := redemption.Insert(); err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	record, err := model.Redeem(redemption.Key, 1)
+	if err != nil {
+		t.Fatalf("兑换失败: %v", err)
+	}
+	if record.Group != "vip" || record.OriginalGroup != "default" || record.ExpiresAt == 0 {
+		t.Errorf("兑换记录不正确: %+v", record)
+	}
+	if _, err = model.Redeem(redemption.Key, 1); err == nil {
+		t.Errorf("期望超出每用户兑换次数时兑换失败")
+	}
+
+	// 模拟分组到期
+	model.DB.Model(&model.RedemptionRecord{}).Where("id = ?", record.Id).Update("expires_at", common.GetTimestamp()-1)
+	model.RevertExpiredRedemptionGroups()
+
+	var user model.User
+	model.DB.First(&user, "id = ?", 1)
+	if user.Group != "default" {
+		t.Errorf("期望分组回退为 default，实际 %s", user.Group)
+	}
+}
+
+// TestRedeemTokenReward 测试同一用户并发兑换令牌兑换码时的每用户次数限制，以及令牌额度独立于用户额度
+func TestRedeemTokenReward(t *testing.T) {
+	setupTestDB(t)
+
+	if err := model.DB.Create(&model.User{Id: 1, Username: "token_user", AffCode: "tk1", Group: "default"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	redemption := &model.Redemption{Key: common.GetUUID(), Name: "budget", Status: common.RedemptionCodeStatusEnabled,
+		RewardType: model.RedemptionRewardToken, Quota: 500, MaxUses: 10, PerUserLimit: 2}
+	if err := redemption.Insert(); err != nil {
+		t.Fatalf("创建兑换码失败: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var records []*model.RedemptionRecord
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if record, err := model.Redeem(redemption.Key, 1); err == nil {
+				mu.Lock()
+				records = append(records, record)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(records) != 2 {
+		t.Fatalf("同一用户并发兑换应成功 2 次，实际 %d 次", len(records))
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != 0 {
+		t.Errorf("令牌兑换码不应增加用户额度，实际 %d", quota)
+	}
+	token, err := model.GetTokenById(records[0].TokenId)
+	if err != nil || !token.Prepaid || token.RemainQuota != 500 {
+		t.Fatalf("兑换的令牌应为预付费令牌且带有额度: %+v %v", token, err)
+	}
+
+	relayInfo := &relaycommon.RelayInfo{UserId: 1, TokenId: token.Id, TokenKey: token.Key, TokenPrepaid: true}
+	if err = service.PostConsumeQuota(relayInfo, 200, 0, false); err != nil {
+		t.Fatalf("扣费失败: %v", err)
+	}
+	if quota, _ := model.GetUserQuota(1, true); quota != 0 {
+		t.Errorf("预付费令牌消耗不应扣减用户额度，实际 %d", quota)
+	}
+	if token, _ = model.GetTokenById(token.Id); token.RemainQuota != 300 {
+		t.Errorf("预付费令牌剩余额度应为 300，实际 %d", token.RemainQuota)
+	}
+}
@@ -0,0 +1,94 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// TestStatusProbeIncidentAndUptime 测试探测结果的故障区间及可用率统计
+func TestStatusProbeIncidentAndUptime(t *testing.T) {
+	setupTestDB(t)
+	now := common.GetTimestamp()
+	results := []bool{true, false, false, true}
+	for i, success := range results {
+		probe := &model.StatusProbe{ModelName: "gpt-4o", UsingGroup: "default", CreatedAt: now - int64(len(results)-i)*60, Success: success, LatencyMs: 100}
+		if !success {
+			probe.StatusCode = 502
+			probe.ErrorMessage = "status code 502: upstream https://internal-host/v1 error"
+		}
+		if err := model.RecordStatusProbe(probe); err != nil {
+			t.Fatalf("保存探测结果失败: %v", err)
+		}
+	}
+
+	incidents, err := model.GetStatusIncidents(now - 86400)
+	if err != nil || len(incidents) != 1 {
+		t.Fatalf("期望一个故障区间，实际 %d 个: %v", len(incidents), err)
+	}
+	if incidents[0].Failures != 2 || incidents[0].ResolvedAt != now-60 {
+		t.Errorf("故障区间错误: %+v", incidents[0])
+	}
+
+	page, err := service.GetStatusPage()
+	if err != nil {
+		t.Fatalf("生成状态页失败: %v", err)
+	}
+	if len(page.Models) != 1 {
+		t.Fatalf("期望一个探测对象，实际 %d 个", len(page.Models))
+	}
+	item := page.Models[0]
+	if item.Status != "up" || item.Uptime24h == nil || *item.Uptime24h != 50 || item.AvgLatencyMs24h != 100 {
+		t.Errorf("状态页数据错误: %+v", item)
+	}
+	if item.Uptime30d == nil || *item.Uptime30d != 50 {
+		t.Errorf("30 天可用率错误: %v", item.Uptime30d)
+	}
+	if len(item.Incidents) != 1 || item.Incidents[0].ErrorType != model.StatusProbeErrorServerError {
+		t.Errorf("公开的故障区间应只包含错误类别: %+v", item.Incidents)
+	}
+	if data, _ := common.Marshal(page); strings.Contains(string(data), "internal-host") {
+		t.Errorf("公开状态页不应包含原始错误信息: %s", data)
+	}
+}
+
+// TestStatusProbeToken 测试探测令牌属于状态探测系统用户，且被禁用或过期后恢复为可用状态
+func TestStatusProbeToken(t *testing.T) {
+	setupTestDB(t)
+	if err := model.DB.Create(&model.User{Id: 1, Username: "root", Role: common.RoleRootUser, AffCode: "root"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	// 使用较大的 id，避免与其他测试中的用户 id 相同而被视为系统用户
+	probeUser := &model.User{Id: 9999, Username: model.StatusProbeUsername, Role: common.RoleCommonUser, Status: common.UserStatusDisabled, AffCode: "probe"}
+	if err := model.DB.Create(probeUser).Error; err != nil {
+		t.Fatalf("创建系统用户失败: %v", err)
+	}
+
+	token, err := model.GetOrCreateStatusProbeToken("default")
+	if err != nil {
+		t.Fatalf("创建探测令牌失败: %v", err)
+	}
+	if token.UserId != probeUser.Id || !token.UnlimitedQuota {
+		t.Fatalf("探测令牌应属于系统用户且不限额度: %+v", token)
+	}
+	if !model.IsStatusProbeUser(probeUser.Id) || model.IsStatusProbeUser(1) {
+		t.Error("系统用户判断错误")
+	}
+	var status int
+	model.DB.Model(&model.User{}).Where("id = ?", probeUser.Id).Select("status").Scan(&status)
+	if status != common.UserStatusEnabled {
+		t.Errorf("被禁用的系统用户应恢复启用，实际状态 %d", status)
+	}
+
+	model.DB.Model(&model.Token{}).Where("id = ?", token.Id).Updates(map[string]any{"status": common.TokenStatusDisabled, "expired_time": 1})
+	repaired, err := model.GetOrCreateStatusProbeToken("default")
+	if err != nil {
+		t.Fatalf("获取探测令牌失败: %v", err)
+	}
+	if repaired.Id != token.Id || repaired.Status != common.TokenStatusEnabled || repaired.ExpiredTime != -1 {
+		t.Errorf("探测令牌未恢复为可用状态: %+v", repaired)
+	}
+}
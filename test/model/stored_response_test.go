@@ -0,0 +1,80 @@
+package model_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newResponsesContext(body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("id", 1)
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(types.RelayFormatOpenAIResponses))
+	return c
+}
+
+// TestStoredResponseExpand 测试保存的响应在 previous_response_id 引用时展开为完整对话
+func TestStoredResponseExpand(t *testing.T) {
+	setupTestDB(t)
+	gin.SetMode(gin.TestMode)
+	common.ResponsesStoreEnabled = true
+	defer func() { common.ResponsesStoreEnabled = false }()
+
+	c := newResponsesContext(`{"model":"gpt-test","input":"hi"}`)
+	request := &dto.OpenAIResponsesRequest{Model: "gpt-test", Input: []byte(`"hi"`)}
+	if !service.ShouldStoreResponse(c, request) {
+		t.Fatal("开启保存后应保存响应")
+	}
+	first := `{"id":"resp_1","object":"response","status":"completed","model":"gpt-test","output":[` +
+		`{"type":"reasoning","id":"rs_1","summary":[]},` +
+		`{"type":"message","id":"msg_up","role":"assistant","content":[{"type":"output_text","text":"hello"}]}]}`
+	if err := service.StoreResponse(c, request, []byte(first)); err != nil {
+		t.Fatalf("保存响应失败: %v", err)
+	}
+
+	c = newResponsesContext(`{"model":"gpt-test","previous_response_id":"resp_1","input":[{"role":"user","content":"again"}]}`)
+	if err := service.ExpandPreviousResponse(c); err != nil {
+		t.Fatalf("展开失败: %v", err)
+	}
+	body, _ := common.GetRequestBody(c)
+	if gjson.GetBytes(body, "previous_response_id").Exists() {
+		t.Errorf("展开后应移除 previous_response_id: %s", body)
+	}
+	input := gjson.GetBytes(body, "input").Array()
+	if len(input) != 3 || input[0].Get("content.0.text").String() != "hi" || input[1].Get("content.0.text").String() != "hello" ||
+		input[2].Get("content").String() != "again" {
+		t.Fatalf("展开后的 input 错误: %s", body)
+	}
+	if strings.Contains(string(body), `"id"`) {
+		t.Errorf("重新发送的条目不应带 id: %s", body)
+	}
+
+	var expanded dto.OpenAIResponsesRequest
+	_ = common.Unmarshal(body, &expanded)
+	if err := service.StoreResponse(c, &expanded, []byte(`{"id":"resp_2","object":"response","status":"completed","output":[]}`)); err != nil {
+		t.Fatalf("保存响应失败: %v", err)
+	}
+	stored, err := model.GetUserStoredResponse(1, "resp_2")
+	if err != nil {
+		t.Fatalf("查询响应失败: %v", err)
+	}
+	if gjson.GetBytes(stored.Response, "previous_response_id").String() != "resp_1" || len(gjson.GetBytes(stored.Input, "#.id").Array()) != 3 {
+		t.Errorf("保存的响应错误: %s %s", stored.Response, stored.Input)
+	}
+	if _, err = model.GetUserStoredResponse(2, "resp_2"); err == nil {
+		t.Error("其他用户不应能查询该响应")
+	}
+}
@@ -0,0 +1,46 @@
+package model_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// TestRenewSubscriptionDuplicateInvoice 测试同一账单的并发重复通知只发放一次额度
+func TestRenewSubscriptionDuplicateInvoice(t *testing.T) {
+	setupTestDB(t)
+
+	if err := model.DB.Create(&model.User{Id: 1, Username: "sub_user", AffCode: "s1", Group: "default"}).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	plan := &model.SubscriptionPlan{Name: "pro", QuotaPerPeriod: 1000, Enabled: true}
+	if err := model.DB.Create(plan).Error; err != nil {
+		t.Fatalf("创建套餐失败: %v", err)
+	}
+	sub := &model.Subscription{UserId: 1, PlanId: plan.Id, ReferenceId: "sub_ref", Status: model.SubscriptionStatusPending}
+	if err := model.DB.Create(sub).Error; err != nil {
+		t.Fatalf("创建订阅失败: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := model.RenewSubscription("sub_ref", "sub_stripe", "", "in_1", 100, 200); err != nil {
+				t.Errorf("续费失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if quota, _ := model.GetUserQuota(1, true); quota != plan.QuotaPerPeriod {
+		t.Errorf("同一账单应只发放一次额度，实际用户额度 %d", quota)
+	}
+	var entries int64
+	model.DB.Model(&model.QuotaLedger{}).Where("reference_id = ? AND delta > 0", "in_1").Count(&entries)
+	if entries != 1 {
+		t.Errorf("同一账单应只记录一条发放流水，实际 %d 条", entries)
+	}
+}
@@ -0,0 +1,46 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// TestQueryUsage 测试用量汇总写入及按维度组合查询
+func TestQueryUsage(t *testing.T) {
+	setupTestDB(t)
+	common.DataExportEnabled = true
+
+	now := common.GetTimestamp()
+	stats := []*model.UsageStat{
+		{BucketTime: now - now%3600, UserId: 1, TokenId: 1, ModelName: "gpt-4o", ChannelId: 1, UsingGroup: "default", RelayFormat: "openai", RequestCount: 3, PromptTokens: 30, CompletionTokens: 10, Quota: 300},
+		{BucketTime: now - now%3600, UserId: 1, TokenId: 2, ModelName: "claude", ChannelId: 2, UsingGroup: "default", RelayFormat: "claude", RequestCount: 2, ErrorCount: 1, PromptTokens: 20, Quota: 200},
+		{BucketTime: now - now%3600 - 3600, UserId: 2, TokenId: 3, ModelName: "gpt-4o", ChannelId: 1, UsingGroup: "vip", RelayFormat: "openai", RequestCount: 1, PromptTokens: 5, CompletionTokens: 5, Quota: 50},
+	}
+	for _, stat := range stats {
+		if err := model.DB.Create(stat).Error; err != nil {
+			t.Fatalf("创建用量汇总失败: %v", err)
+		}
+	}
+
+	rows, err := model.QueryUsage(model.UsageQuery{StartTime: now - 86400, EndTime: now, Bucket: model.UsageBucketNone, GroupBy: []string{"model", "relay_format"}})
+	if err != nil {
+		t.Fatalf("查询用量失败: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ModelName != "gpt-4o" || rows[0].RequestCount != 4 || rows[0].TotalTokens != 50 || rows[0].Quota != 350 {
+		t.Errorf("按模型汇总结果不正确: %+v", rows)
+	}
+
+	rows, err = model.QueryUsage(model.UsageQuery{StartTime: now - 86400, EndTime: now, Bucket: model.UsageBucketHour, UserId: 1})
+	if err != nil {
+		t.Fatalf("查询用量失败: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 5 || rows[0].ErrorCount != 1 {
+		t.Errorf("按用户筛选结果不正确: %+v", rows)
+	}
+
+	if _, err = model.QueryUsage(model.UsageQuery{Bucket: model.UsageBucketDay, GroupBy: []string{"ip"}}); err == nil {
+		t.Errorf("期望不支持的分组维度返回错误")
+	}
+}
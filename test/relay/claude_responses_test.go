@@ -0,0 +1,105 @@
+package relay_test
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// TestClaudeToResponsesRequest 测试 Claude Messages 请求转换为 Responses API 请求
+func TestClaudeToResponsesRequest(t *testing.T) {
+	var claudeRequest dto.ClaudeRequest
+	err := common.UnmarshalJsonStr(`{
+		"model": "gpt-test",
+		"max_tokens": 2048,
+		"system": [{"type": "text", "text": "be brief"}],
+		"thinking": {"type": "enabled", "budget_tokens": 1024},
+		"messages": [
+			{"role": "user", "content": "weather?"},
+			{"role": "assistant", "content": [
+				{"type": "thinking", "thinking": "need tool", "signature": "sig"},
+				{"type": "text", "text": "checking"},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "a"}}
+			]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "sunny"}]}]}
+		],
+		"tools": [{"name": "get_weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"}
+	}`, &claudeRequest)
+	if err != nil {
+		t.Fatalf("解析请求失败: %v", err)
+	}
+	request, err := service.ClaudeToResponsesRequest(&claudeRequest)
+	if err != nil {
+		t.Fatalf("转换请求失败: %v", err)
+	}
+	if string(request.Instructions) != `"be brief"` || request.MaxOutputTokens != 2048 {
+		t.Errorf("instructions 或 max_output_tokens 转换错误: %s %d", request.Instructions, request.MaxOutputTokens)
+	}
+	if request.Reasoning == nil || request.Reasoning.Effort != "low" {
+		t.Errorf("thinking 转换错误: %+v", request.Reasoning)
+	}
+	var input []map[string]any
+	if err = common.Unmarshal(request.Input, &input); err != nil {
+		t.Fatalf("解析 input 失败: %v", err)
+	}
+	types := []string{"", "", "function_call", "function_call_output"}
+	if len(input) != len(types) {
+		t.Fatalf("input 条目数量错误: %d", len(input))
+	}
+	for i, itemType := range types {
+		if got, _ := input[i]["type"].(string); got != itemType {
+			t.Errorf("第 %d 个条目类型应为 %q，实际为 %q", i, itemType, got)
+		}
+	}
+	if input[2]["arguments"] != `{"city":"a"}` || input[3]["output"] != "sunny" {
+		t.Errorf("工具调用转换错误: %+v %+v", input[2], input[3])
+	}
+	if string(request.ToolChoice) != `"required"` {
+		t.Errorf("tool_choice 转换错误: %s", request.ToolChoice)
+	}
+}
+
+// TestClaudeResponsesStreamConverter 测试 Responses API 流式事件转换为 Claude 流式事件
+func TestClaudeResponsesStreamConverter(t *testing.T) {
+	converter := service.NewClaudeResponsesStreamConverter("gpt-test")
+	events := []string{
+		`{"type":"response.created","sequence_number":0,"response":{"id":"resp_1","model":"gpt-test","status":"in_progress"}}`,
+		`{"type":"response.output_item.added","output_index":0,"item":{"type":"reasoning","id":"rs_1","summary":[]}}`,
+		`{"type":"response.reasoning_summary_text.delta","output_index":0,"delta":"think"}`,
+		`{"type":"response.output_item.done","output_index":0,"item":{"type":"reasoning","id":"rs_1"}}`,
+		`{"type":"response.output_item.added","output_index":1,"item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"f"}}`,
+		`{"type":"response.function_call_arguments.delta","output_index":1,"delta":"{}"}`,
+		`{"type":"response.output_item.done","output_index":1,"item":{"type":"function_call","id":"fc_1"}}`,
+		`{"type":"response.completed","response":{"id":"resp_1","status":"completed","usage":{"input_tokens":10,"output_tokens":4,"input_tokens_details":{"cached_tokens":6}}}}`,
+	}
+	var responses []*dto.ClaudeResponse
+	for _, data := range events {
+		var event dto.ResponsesStreamResponse
+		if err := common.UnmarshalJsonStr(data, &event); err != nil {
+			t.Fatalf("解析事件失败: %v", err)
+		}
+		responses = append(responses, converter.ConvertEvent(&event)...)
+	}
+	responses = append(responses, converter.Finish()...)
+
+	expected := []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}
+	if len(responses) != len(expected) {
+		t.Fatalf("事件数量错误: 期望 %d，实际 %d", len(expected), len(responses))
+	}
+	for i, response := range responses {
+		if response.Type != expected[i] {
+			t.Errorf("第 %d 个事件应为 %s，实际为 %s", i, expected[i], response.Type)
+		}
+	}
+	if responses[4].ContentBlock.Type != "tool_use" || responses[4].GetIndex() != 1 || responses[4].ContentBlock.Id != "call_1" {
+		t.Errorf("tool_use 内容块错误: %+v", responses[4].ContentBlock)
+	}
+	messageDelta := responses[7]
+	if *messageDelta.Delta.StopReason != "tool_use" || messageDelta.Usage.InputTokens != 4 || messageDelta.Usage.CacheReadInputTokens != 6 {
+		t.Errorf("message_delta 错误: %+v %+v", messageDelta.Delta, messageDelta.Usage)
+	}
+}
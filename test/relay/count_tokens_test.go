@@ -0,0 +1,71 @@
+package relay_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newCountTokensContext(path string, body string, channelType int, baseURL string, model string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyChannelType, channelType)
+	common.SetContextKey(c, constant.ContextKeyChannelBaseUrl, baseURL)
+	common.SetContextKey(c, constant.ContextKeyChannelKey, "sk-test")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, model)
+	return c, recorder
+}
+
+// TestCountTokensLocal 测试渠道不支持计数接口时本地估算 Gemini 请求的 token 数
+func TestCountTokensLocal(t *testing.T) {
+	service.InitTokenEncoders()
+	constant.CountToken = true
+	body := `{"generateContentRequest":{"contents":[{"role":"user","parts":[{"text":"hello world"},` +
+		`{"inlineData":{"mimeType":"image/png","data":"aGVsbG8="}}]}],"systemInstruction":{"parts":[{"text":"be brief"}]}}}`
+	c, recorder := newCountTokensContext("/v1beta/models/gemini-test:countTokens", body, constant.ChannelTypeOpenAI, "", "gemini-test")
+	if apiErr := relay.RelayCountTokens(c, types.RelayFormatGemini); apiErr != nil {
+		t.Fatalf("计数失败: %v", apiErr)
+	}
+	// 与请求计费的计数逻辑一致，Gemini 格式的图片按 520 计算
+	expected := service.CountTextToken("hello world\nbe brief", "gemini-test") + 520
+	if got := gjson.Get(recorder.Body.String(), "totalTokens").Int(); int(got) != expected {
+		t.Errorf("totalTokens 应为 %d，实际为 %s", expected, recorder.Body.String())
+	}
+}
+
+// TestCountTokensUpstream 测试 Anthropic 渠道的计数请求转发上游
+func TestCountTokensUpstream(t *testing.T) {
+	service.InitHttpClient()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/messages/count_tokens" || r.Header.Get("x-api-key") != "sk-test" || gjson.GetBytes(body, "model").String() != "claude-test" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"input_tokens":42}`))
+	}))
+	defer server.Close()
+	body := `{"model":"claude-test","messages":[{"role":"user","content":"hi"}]}`
+	c, recorder := newCountTokensContext("/v1/messages/count_tokens", body, constant.ChannelTypeAnthropic, server.URL, "claude-test")
+	if apiErr := relay.RelayCountTokens(c, types.RelayFormatClaude); apiErr != nil {
+		t.Fatalf("转发失败: %v", apiErr)
+	}
+	if recorder.Body.String() != `{"input_tokens":42}` {
+		t.Errorf("应原样返回上游响应: %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,136 @@
+package relay_test
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/volcengine"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// TestImageVariationFormToVolcengine 测试表单格式的变体请求经共用的表单解析转换为豆包图生图请求
+func TestImageVariationFormToVolcengine(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", "doubao-seedream")
+	_ = writer.WriteField("size", "1024x1024")
+	for _, name := range []string{"image[1]", "image[0]"} {
+		part, _ := writer.CreateFormFile(name, name+".png")
+		_, _ = part.Write([]byte("\x89PNG\r\n\x1a\n" + name))
+	}
+	_ = writer.Close()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/variations", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	request, err := helper.GetAndValidOpenAIImageRequest(c, relayconstant.RelayModeImagesVariations)
+	if err != nil {
+		t.Fatalf("解析变体表单失败: %v", err)
+	}
+	if request.Model != "doubao-seedream" || request.N != 1 || request.Size != "1024x1024" {
+		t.Fatalf("变体表单字段错误: %+v", request)
+	}
+	info := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeImagesVariations}
+	converted, err := (&volcengine.Adaptor{}).ConvertImageRequest(c, info, *request)
+	if err != nil {
+		t.Fatalf("转换变体请求失败: %v", err)
+	}
+	images := gjson.GetBytes(converted.(dto.ImageRequest).Image, "@this").Array()
+	if len(images) != 2 || !strings.HasPrefix(images[0].String(), "data:image/png;base64,") {
+		t.Fatalf("参考图应按字段顺序转换为 data URL: %s", converted.(dto.ImageRequest).Image)
+	}
+}
+
+// TestImageFormFilesOrder 测试 image[N] 字段按序号而不是字符串顺序排列
+func TestImageFormFilesOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, index := range []int{10, 2, 0, 1} {
+		name := fmt.Sprintf("image[%d]", index)
+		part, _ := writer.CreateFormFile(name, name+".png")
+		_, _ = part.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}
+	_ = writer.Close()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	files, err := relaycommon.GetImageFormFiles(c)
+	if err != nil {
+		t.Fatalf("读取表单图片失败: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Filename)
+	}
+	if got := strings.Join(names, ","); got != "image[0].png,image[1].png,image[2].png,image[10].png" {
+		t.Errorf("图片顺序错误: %s", got)
+	}
+}
+
+// TestImageInputsFromJSON 测试 JSON 编辑请求中 image 及 images 字段的图片
+func TestImageInputsFromJSON(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", nil)
+	c.Request.Header.Set("Content-Type", "application/json")
+	request := dto.ImageRequest{}
+	if err := request.UnmarshalJSON([]byte(`{"model":"gpt-image-1","prompt":"p","image":"https://a/1.png","images":[{"image_url":"https://a/2.png"},"https://a/3.png"]}`)); err != nil {
+		t.Fatalf("解析请求失败: %v", err)
+	}
+	images, err := relaycommon.GetImageInputs(c, request)
+	if err != nil || strings.Join(images, ",") != "https://a/1.png,https://a/2.png,https://a/3.png" {
+		t.Fatalf("输入图片错误: %v %v", images, err)
+	}
+	if _, err = relaycommon.GetImageInputs(c, dto.ImageRequest{}); err == nil {
+		t.Errorf("没有输入图片时应返回错误")
+	}
+}
+
+// TestImagePriceRatio 测试按尺寸、品质计算图片价格倍率
+func TestImagePriceRatio(t *testing.T) {
+	ratio_setting.InitRatioSettings()
+	defer ratio_setting.InitRatioSettings()
+	cases := []struct {
+		model, size, quality string
+		ratio                float64
+	}{
+		{"dall-e-3", "1024x1024", "standard", 1},
+		{"dall-e-3", "1792x1024", "", 2},
+		{"dall-e-3", "1024x1024", "hd", 2},
+		{"dall-e-3", "1792x1024", "hd", 3},
+		{"dall-e-2", "256x256", "", 0.4},
+		{"dall-e-3-custom", "1792x1024", "", 2},
+		{"dall-e-3-custom", "1792x1024", "hd", 3},
+		{"dall-e-mini", "512x512", "", 0.45},
+		{"unknown", "256x256", "hd", 1},
+	}
+	for _, tc := range cases {
+		if ratio := ratio_setting.GetImagePriceRatio(tc.model, tc.size, tc.quality); ratio != tc.ratio {
+			t.Errorf("%s %s %s 倍率应为 %v，实际 %v", tc.model, tc.size, tc.quality, tc.ratio, ratio)
+		}
+	}
+	if err := ratio_setting.UpdateImagePriceRatioByJSONString(`{"gpt-image-*":{"high":4,"1536x1024":1.5}}`); err != nil {
+		t.Fatalf("更新倍率失败: %v", err)
+	}
+	if ratio := ratio_setting.GetImagePriceRatio("gpt-image-1", "1536x1024", "high"); ratio != 6 {
+		t.Errorf("前缀匹配的尺寸、品质倍率应相乘: %v", ratio)
+	}
+	request := &dto.ImageRequest{Model: "gpt-image-1", Size: "1536x1024", Quality: "high", N: 2}
+	if meta := request.GetTokenCountMeta(); meta.ImagePriceRatio != 12 {
+		t.Errorf("计费倍率应包含张数: %v", meta.ImagePriceRatio)
+	}
+}
@@ -0,0 +1,165 @@
+package relay_test
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// TestResponsesRequestToOpenAIRequest 测试 Responses API 请求转换为 Chat Completions 请求
+func TestResponsesRequestToOpenAIRequest(t *testing.T) {
+	var request dto.OpenAIResponsesRequest
+	err := common.UnmarshalJsonStr(`{
+		"model": "gpt-test",
+		"instructions": "be brief",
+		"input": [
+			{"role": "user", "content": [{"type": "input_text", "text": "weather?"}, {"type": "input_image", "image_url": "https://example.com/a.png"}]},
+			{"type": "reasoning", "id": "rs_1", "summary": []},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"a\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"b\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+			{"type": "function_call_output", "call_id": "call_2", "output": "rainy"}
+		],
+		"tools": [
+			{"type": "function", "name": "get_weather", "parameters": {"type": "object"}},
+			{"type": "web_search_preview"}
+		],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"max_output_tokens": 100,
+		"reasoning": {"effort": "low"},
+		"temperature": 0,
+		"stream": true
+	}`, &request)
+	if err != nil {
+		t.Fatalf("解析请求失败: %v", err)
+	}
+	openAIRequest, err := service.ResponsesRequestToOpenAIRequest(&request)
+	if err != nil {
+		t.Fatalf("转换请求失败: %v", err)
+	}
+	if len(openAIRequest.Messages) != 5 {
+		t.Fatalf("消息数量错误: %d", len(openAIRequest.Messages))
+	}
+	roles := []string{"system", "user", "assistant", "tool", "tool"}
+	for i, role := range roles {
+		if openAIRequest.Messages[i].Role != role {
+			t.Errorf("第 %d 条消息角色应为 %s，实际为 %s", i, role, openAIRequest.Messages[i].Role)
+		}
+	}
+	if contents := openAIRequest.Messages[1].ParseContent(); len(contents) != 2 || contents[1].Type != dto.ContentTypeImageURL {
+		t.Errorf("用户消息内容转换错误: %+v", contents)
+	}
+	if toolCalls := openAIRequest.Messages[2].ParseToolCalls(); len(toolCalls) != 2 || toolCalls[1].ID != "call_2" {
+		t.Errorf("函数调用未合并: %+v", toolCalls)
+	}
+	if openAIRequest.Messages[4].ToolCallId != "call_2" || openAIRequest.Messages[4].StringContent() != "rainy" {
+		t.Errorf("函数调用结果转换错误: %+v", openAIRequest.Messages[4])
+	}
+	if len(openAIRequest.Tools) != 1 || openAIRequest.Tools[0].Function.Name != "get_weather" {
+		t.Errorf("工具转换错误: %+v", openAIRequest.Tools)
+	}
+	if toolChoice, ok := openAIRequest.ToolChoice.(map[string]any); !ok || toolChoice["type"] != "function" {
+		t.Errorf("tool_choice 转换错误: %+v", openAIRequest.ToolChoice)
+	}
+	if openAIRequest.MaxTokens != 100 || openAIRequest.ReasoningEffort != "low" || !openAIRequest.Stream {
+		t.Errorf("参数转换错误: %+v", openAIRequest)
+	}
+	if openAIRequest.Temperature == nil || *openAIRequest.Temperature != 0 {
+		t.Errorf("temperature 为 0 时应保留: %v", openAIRequest.Temperature)
+	}
+}
+
+// TestResponsesStreamConverter 测试 Chat Completions 流式分片转换为 Responses API 事件
+func TestResponsesStreamConverter(t *testing.T) {
+	converter := service.NewResponsesStreamConverter("resp_1", "gpt-test", 1)
+	chunks := []string{
+		`{"id":"c","model":"gpt-test","choices":[{"index":0,"delta":{"reasoning_content":"think"}}]}`,
+		`{"id":"c","model":"gpt-test","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+		`{"id":"c","model":"gpt-test","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"id":"c","model":"gpt-test","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\""}}]}}]}`,
+		`{"id":"c","model":"gpt-test","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c","model":"gpt-test","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`,
+	}
+	var events []dto.ResponsesStreamResponse
+	for _, data := range chunks {
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			t.Fatalf("解析分片失败: %v", err)
+		}
+		events = append(events, converter.ConvertChunk(&chunk)...)
+	}
+	events = append(events, converter.Finish()...)
+
+	expected := []string{
+		dto.ResponsesStreamTypeCreated,
+		dto.ResponsesStreamTypeInProgress,
+		dto.ResponsesStreamTypeOutputItemAdded,
+		dto.ResponsesStreamTypeSummaryPartAdded,
+		dto.ResponsesStreamTypeSummaryTextDelta,
+		dto.ResponsesStreamTypeSummaryTextDone,
+		dto.ResponsesStreamTypeSummaryPartDone,
+		dto.ResponsesStreamTypeOutputItemDone,
+		dto.ResponsesStreamTypeOutputItemAdded,
+		dto.ResponsesStreamTypeContentPartAdded,
+		dto.ResponsesStreamTypeOutputTextDelta,
+		dto.ResponsesStreamTypeOutputTextDelta,
+		dto.ResponsesStreamTypeOutputTextDone,
+		dto.ResponsesStreamTypeContentPartDone,
+		dto.ResponsesStreamTypeOutputItemDone,
+		dto.ResponsesStreamTypeOutputItemAdded,
+		dto.ResponsesStreamTypeArgumentsDelta,
+		dto.ResponsesStreamTypeArgumentsDelta,
+		dto.ResponsesStreamTypeArgumentsDone,
+		dto.ResponsesStreamTypeOutputItemDone,
+		dto.ResponsesStreamTypeCompleted,
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("事件数量错误: 期望 %d，实际 %d", len(expected), len(events))
+	}
+	for i, event := range events {
+		if event.Type != expected[i] {
+			t.Errorf("第 %d 个事件应为 %s，实际为 %s", i, expected[i], event.Type)
+		}
+		if event.SequenceNumber != i {
+			t.Errorf("第 %d 个事件序号错误: %d", i, event.SequenceNumber)
+		}
+	}
+
+	response := events[len(events)-1].Response
+	if len(response.Output) != 3 {
+		t.Fatalf("输出条目数量错误: %d", len(response.Output))
+	}
+	if response.Output[1].Content[0].Text != "Hello" {
+		t.Errorf("文本输出错误: %s", response.Output[1].Content[0].Text)
+	}
+	if response.Output[2].CallId != "call_1" || response.Output[2].Arguments != `{"a":1}` {
+		t.Errorf("函数调用输出错误: %+v", response.Output[2])
+	}
+	if response.Usage == nil || response.Usage.InputTokens != 3 || response.Usage.OutputTokens != 5 {
+		t.Errorf("用量转换错误: %+v", response.Usage)
+	}
+}
+
+// TestNativeResponsesAdaptor 测试只有实现了 Responses API 转换的适配器被视为原生支持
+func TestNativeResponsesAdaptor(t *testing.T) {
+	tests := map[int]bool{
+		constant.APITypeOpenAI:     true,
+		constant.APITypeOpenRouter: true,
+		constant.APITypeXinference: true,
+		constant.APITypeCloudflare: true,
+		constant.APITypeAnthropic:  false,
+		constant.APITypeGemini:     false,
+		constant.APITypeDeepSeek:   false,
+	}
+	for apiType, expected := range tests {
+		adaptor, ok := relay.GetAdaptor(apiType).(channel.NativeResponsesAdaptor)
+		if supported := ok && adaptor.SupportsNativeResponses(); supported != expected {
+			t.Errorf("api type %d 期望原生支持 %v，实际 %v", apiType, expected, supported)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package tracing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestMiddlewareContinuesTraceparent 测试根 span 延续请求头中的 traceparent，子 span 挂在根 span 下
+func TestMiddlewareContinuesTraceparent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	if _, err := tracing.Init(); err != nil {
+		t.Fatalf("init tracing: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(tracing.Middleware())
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		tracing.Start(c, "TokenAuth").End()
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	child, root := spans[0], spans[1]
+	if root.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("root span did not continue incoming trace, got %s", root.SpanContext().TraceID())
+	}
+	if root.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("root span parent mismatch, got %s", root.Parent().SpanID())
+	}
+	if child.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("child span is not attached to root span")
+	}
+	if root.Name() != "POST /v1/chat/completions" {
+		t.Errorf("unexpected root span name %q", root.Name())
+	}
+}
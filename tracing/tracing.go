@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+// Enabled 是否已配置 OTLP 导出，未启用时所有 span 均为 no-op
+var Enabled = false
+
+// Init 初始化 OpenTelemetry 链路追踪
+// 设置 OTEL_EXPORTER_OTLP_ENDPOINT 或 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT 后启用，
+// 导出协议为 OTLP/HTTP，采样、请求头等沿用 OpenTelemetry 标准环境变量
+func Init() (func(context.Context) error, error) {
+	// 无论是否启用导出，都透传请求中的 traceparent
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(common.GetEnvOrDefaultString("OTEL_SERVICE_NAME", "new-api")),
+		semconv.ServiceVersion(common.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	Enabled = true
+	common.SysLog("OpenTelemetry tracing enabled")
+	return provider.Shutdown, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Middleware 为每个请求创建根 span，并延续请求头中的 traceparent
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		spanName := c.Request.Method + " " + c.FullPath()
+		ctx, span := tracer().Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(c.FullPath()),
+				attribute.String("request_id", c.GetString(common.RequestIdKey)),
+			))
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
+
+// Start 以当前请求的 span 为父节点创建子 span
+func Start(c *gin.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer().Start(c.Request.Context(), name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// StartScope 创建子 span 并将其设为当前请求的父节点，之后创建的 span 都挂在其下，
+// 返回的函数结束 span 并恢复原来的父节点
+func StartScope(c *gin.Context, name string, attrs ...attribute.KeyValue) (trace.Span, func()) {
+	parent := c.Request.Context()
+	ctx, span := tracer().Start(parent, name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return span, func() {
+		span.End()
+		c.Request = c.Request.WithContext(parent)
+	}
+}
+
+// StartAt 创建起始时间为 startTime 的子 span，用于记录已经开始的阶段，如流式输出
+func StartAt(c *gin.Context, name string, startTime time.Time, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer().Start(c.Request.Context(), name, trace.WithTimestamp(startTime), trace.WithAttributes(attrs...))
+	return span
+}
+
+// EndWithError 记录错误并结束 span，err 为 nil 时直接结束
+func EndWithError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
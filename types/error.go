@@ -21,6 +21,13 @@ type ClaudeError struct {
 	Message string `json:"message,omitempty"`
 }
 
+// GeminiError https://ai.google.dev/gemini-api/docs/troubleshooting#error-codes
+type GeminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
 type ErrorType string
 
 const (
@@ -85,6 +92,9 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+
+	// subscription error
+	ErrorCodeSubscriptionAllowanceExceeded ErrorCode = "subscription_allowance_exceeded"
 )
 
 type NewAPIError struct {
@@ -202,6 +212,62 @@ func (e *NewAPIError) ToClaudeError() ClaudeError {
 	return result
 }
 
+func (e *NewAPIError) ToGeminiError() GeminiError {
+	message := e.Error()
+	if e.errorCode != ErrorCodeCountTokenFailed {
+		message = common.MaskSensitiveInfo(message)
+	}
+	if message == "" {
+		message = string(e.errorType)
+	}
+	return NewGeminiError(e.StatusCode, message)
+}
+
+func NewGeminiError(statusCode int, message string) GeminiError {
+	return GeminiError{
+		Code:    statusCode,
+		Message: message,
+		Status:  GeminiErrorStatus(statusCode),
+	}
+}
+
+// GeminiErrorStatus 将 HTTP 状态码转换为 Google API 的规范错误状态名
+func GeminiErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "ABORTED"
+	case http.StatusPreconditionFailed:
+		return "FAILED_PRECONDITION"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case 499:
+		return "CANCELLED"
+	case http.StatusInternalServerError:
+		return "INTERNAL"
+	case http.StatusNotImplemented:
+		return "UNIMPLEMENTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return "INTERNAL"
+	}
+	if statusCode >= http.StatusBadRequest {
+		return "FAILED_PRECONDITION"
+	}
+	return "UNKNOWN"
+}
+
 type NewAPIErrorOptions func(*NewAPIError)
 
 func NewError(err error, errorCode ErrorCode, ops ...NewAPIErrorOptions) *NewAPIError {
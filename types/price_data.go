@@ -2,10 +2,29 @@ package types
 
 import "fmt"
 
+const (
+	PriceOverrideTypeRatio = "ratio" // 替换分组倍率
+	PriceOverrideTypePrice = "price" // 固定按次价格
+
+	PriceOverrideScopeUser  = "user"
+	PriceOverrideScopeToken = "token"
+)
+
+// PriceOverrideInfo 用户/令牌级别自定义价格规则的命中信息
+type PriceOverrideInfo struct {
+	Id    int     `json:"id"`
+	Scope string  `json:"scope"`
+	Model string  `json:"model"`
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+}
+
 type GroupRatioInfo struct {
 	GroupRatio        float64
 	GroupSpecialRatio float64
 	HasSpecialRatio   bool
+	PriceOverride     *PriceOverrideInfo
+	BatchRatio        float64 // 批处理折扣倍率，0 表示不是批处理请求
 }
 
 type PriceData struct {
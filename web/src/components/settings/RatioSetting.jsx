@@ -40,6 +40,7 @@ const RatioSetting = () => {
     GroupRatio: '',
     GroupGroupRatio: '',
     ImageRatio: '',
+    ImagePriceRatio: '',
     AudioRatio: '',
     AudioCompletionRatio: '',
     AutoGroups: '',
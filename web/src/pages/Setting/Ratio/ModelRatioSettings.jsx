@@ -45,6 +45,7 @@ export default function ModelRatioSettings(props) {
     CacheRatio: '',
     CompletionRatio: '',
     ImageRatio: '',
+    ImagePriceRatio: '',
     AudioRatio: '',
     AudioCompletionRatio: '',
     ExposeRatioEnabled: false,
@@ -246,6 +247,32 @@ export default function ModelRatioSettings(props) {
             />
           </Col>
         </Row>
+        <Row gutter={16}>
+          <Col xs={24} sm={16}>
+            <Form.TextArea
+              label={t('图片尺寸品质倍率（仅按次计费的图片模型）')}
+              extraText={t(
+                '按次计费的图片生成、编辑及变体请求按尺寸、品质调整价格，键为模型名称（支持 * 结尾的前缀匹配），值的键为尺寸、品质或 尺寸@品质',
+              )}
+              placeholder={t(
+                '为一个 JSON 文本，例如：{"dall-e-3": {"1792x1024": 2, "hd": 2, "1792x1024@hd": 3}}',
+              )}
+              field={'ImagePriceRatio'}
+              autosize={{ minRows: 6, maxRows: 12 }}
+              trigger='blur'
+              stopValidateWithError
+              rules={[
+                {
+                  validator: (rule, value) => verifyJSON(value),
+                  message: '不是合法的 JSON 字符串',
+                },
+              ]}
+              onChange={(value) =>
+                setInputs({ ...inputs, ImagePriceRatio: value })
+              }
+            />
+          </Col>
+        </Row>
         <Row gutter={16}>
           <Col xs={24} sm={16}>
             <Form.TextArea